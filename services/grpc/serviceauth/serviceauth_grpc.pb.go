@@ -20,6 +20,7 @@ const _ = grpc.SupportPackageIsVersion9
 
 const (
 	ServiceAuth_VerifyAccessToken_FullMethodName = "/serviceauth.ServiceAuth/VerifyAccessToken"
+	ServiceAuth_GetSigningKey_FullMethodName     = "/serviceauth.ServiceAuth/GetSigningKey"
 )
 
 // ServiceAuthClient is the client API for ServiceAuth service.
@@ -27,6 +28,7 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ServiceAuthClient interface {
 	VerifyAccessToken(ctx context.Context, in *AccessTokenRequest, opts ...grpc.CallOption) (*TokenResponse, error)
+	GetSigningKey(ctx context.Context, in *SigningKeyRequest, opts ...grpc.CallOption) (*SigningKeyResponse, error)
 }
 
 type serviceAuthClient struct {
@@ -47,11 +49,22 @@ func (c *serviceAuthClient) VerifyAccessToken(ctx context.Context, in *AccessTok
 	return out, nil
 }
 
+func (c *serviceAuthClient) GetSigningKey(ctx context.Context, in *SigningKeyRequest, opts ...grpc.CallOption) (*SigningKeyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SigningKeyResponse)
+	err := c.cc.Invoke(ctx, ServiceAuth_GetSigningKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ServiceAuthServer is the server API for ServiceAuth service.
 // All implementations must embed UnimplementedServiceAuthServer
 // for forward compatibility.
 type ServiceAuthServer interface {
 	VerifyAccessToken(context.Context, *AccessTokenRequest) (*TokenResponse, error)
+	GetSigningKey(context.Context, *SigningKeyRequest) (*SigningKeyResponse, error)
 	mustEmbedUnimplementedServiceAuthServer()
 }
 
@@ -65,6 +78,9 @@ type UnimplementedServiceAuthServer struct{}
 func (UnimplementedServiceAuthServer) VerifyAccessToken(context.Context, *AccessTokenRequest) (*TokenResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method VerifyAccessToken not implemented")
 }
+func (UnimplementedServiceAuthServer) GetSigningKey(context.Context, *SigningKeyRequest) (*SigningKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSigningKey not implemented")
+}
 func (UnimplementedServiceAuthServer) mustEmbedUnimplementedServiceAuthServer() {}
 func (UnimplementedServiceAuthServer) testEmbeddedByValue()                     {}
 
@@ -104,6 +120,24 @@ func _ServiceAuth_VerifyAccessToken_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ServiceAuth_GetSigningKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SigningKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ServiceAuthServer).GetSigningKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ServiceAuth_GetSigningKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ServiceAuthServer).GetSigningKey(ctx, req.(*SigningKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ServiceAuth_ServiceDesc is the grpc.ServiceDesc for ServiceAuth service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -115,6 +149,10 @@ var ServiceAuth_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "VerifyAccessToken",
 			Handler:    _ServiceAuth_VerifyAccessToken_Handler,
 		},
+		{
+			MethodName: "GetSigningKey",
+			Handler:    _ServiceAuth_GetSigningKey_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "serviceauth.proto",
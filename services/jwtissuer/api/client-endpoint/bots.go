@@ -0,0 +1,117 @@
+package clientendpoint
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	Auth "peergrine/utils/auth"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const PARAM_BOT_ID = "bot_id" // 常數，用於路徑中的機器人 ID 參數
+
+// adminRequired 驗證管理令牌，未設定管理令牌時停用機器人管理端點。
+// 參數:
+//
+//	c (*gin.Context): Gin 上下文對象，用於處理請求和響應。
+func (app *ClientEndpoint) adminRequired(c *gin.Context) {
+	if len(app.botAdminToken) == 0 {
+		Error(c, http.StatusNotFound, "Bot registration is disabled")
+		return
+	}
+
+	authHeader := []byte(c.GetHeader("Authorization"))
+	expected := []byte("Bearer " + app.botAdminToken)
+
+	if subtle.ConstantTimeCompare(authHeader, expected) != 1 {
+		Error(c, http.StatusUnauthorized, "Admin token is invalid")
+		return
+	}
+
+	c.Next()
+}
+
+// RegisterBot 註冊一個機器人身分並返回其長期金鑰。金鑰只在此時返回一次。
+// 參數:
+//
+//	c (*gin.Context): Gin 上下文對象，用於處理請求和響應。
+func (app *ClientEndpoint) RegisterBot(c *gin.Context) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	botId := "bot-" + uuid.New().String()
+	botKey := base64.RawURLEncoding.EncodeToString(key)
+
+	if err := app.storage.SaveBot(botId, botKey); err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"bot_id":  botId,
+		"bot_key": botKey,
+	})
+}
+
+// DeleteBot 撤銷機器人身分，其金鑰無法再換取令牌，已簽發的令牌也不再通過驗證。
+// 參數:
+//
+//	c (*gin.Context): Gin 上下文對象，用於處理請求和響應。
+func (app *ClientEndpoint) DeleteBot(c *gin.Context) {
+	botId := c.Param(PARAM_BOT_ID)
+
+	if err := app.storage.DeleteBot(botId); err != nil {
+		Error(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// BotToken 以機器人金鑰換取權限範圍為機器人的存取令牌，金鑰以 "Bearer <bot_key>" 格式傳送。
+// 參數:
+//
+//	c (*gin.Context): Gin 上下文對象，用於處理請求和響應。
+func (app *ClientEndpoint) BotToken(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if len(authHeader) < 7 || authHeader[:7] != "Bearer " {
+		Error(c, http.StatusUnauthorized, "Authorization header is missing or formatted incorrectly. Expected format: 'Bearer <bot_key>'")
+		return
+	}
+
+	botId, exists := app.storage.GetBotIdFromKey(authHeader[7:])
+	if !exists {
+		Error(c, http.StatusUnauthorized, "Bot key is invalid or revoked")
+		return
+	}
+
+	currentTime := time.Now()
+	iat := currentTime.Unix()
+	exp := currentTime.Add(app.tokenDuration.Bearer).Unix()
+
+	serviceId := app.storage.ServiceId
+	secret, err := app.storage.GetSecret(serviceId)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	bearerToken, err := Auth.GenerateScopedBearerToken(serviceId, botId, app.channelId, Auth.SCOPE_BOT, secret, iat, exp)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, "Failed to generate new access token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"bot_id":       botId,
+		"access_token": bearerToken,
+		"expires_at":   exp,
+	})
+}
@@ -1,6 +1,7 @@
 package clientendpoint
 
 import (
+	"encoding/base64"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	AppConfig "peergrine/jwtissuer/app-config"
 	Storage "peergrine/jwtissuer/storage"
 	Auth "peergrine/utils/auth"
+	Envelope "peergrine/utils/envelope"
 	"strconv"
 	"time"
 
@@ -16,7 +18,8 @@ import (
 )
 
 const (
-	PARAM_USER_ID = "user_id" // 常數，用於上下文中的客戶端 ID 參數
+	PARAM_USER_ID    = "user_id"    // 常數，用於上下文中的客戶端 ID 參數
+	PARAM_SERVICE_ID = "service_id" // 常數，用於路徑中的發行者 ID 參數
 )
 
 type ClientEndpoint struct {
@@ -24,6 +27,7 @@ type ClientEndpoint struct {
 	storage       *Storage.Storage
 	tokenDuration AuthLifecycle.TokenDuration
 	channelId     string
+	botAdminToken string
 }
 
 func AtoD(str string) (time.Duration, error) {
@@ -69,6 +73,7 @@ func New(storage *Storage.Storage, config *AppConfig.AppConfig, connMap *ConnMap
 		storage:       storage,
 		tokenDuration: tokenDuration,
 		channelId:     config.Id,
+		botAdminToken: config.BotAdminToken,
 	}
 
 	authLifecycle, err := AuthLifecycle.New(storage, connMap, tokenDuration, config.Id)
@@ -83,6 +88,10 @@ func New(storage *Storage.Storage, config *AppConfig.AppConfig, connMap *ConnMap
 	server.GET("/initialize", authLifecycle.InitializeAuth)
 	server.POST("/refresh", app.RefreshToken)
 	server.POST("/transfer", app.TransferToken)
+	server.GET("/keys/:"+PARAM_SERVICE_ID, app.GetPublicKey)
+	server.POST("/bots/token", app.BotToken)
+	server.POST("/bots", app.adminRequired, app.RegisterBot)
+	server.DELETE("/bots/:"+PARAM_BOT_ID, app.adminRequired, app.DeleteBot)
 
 	return app, nil
 }
@@ -189,3 +198,22 @@ func (app *ClientEndpoint) TransferToken(c *gin.Context) {
 		"expires_at":    exp,
 	})
 }
+
+// GetPublicKey 返回指定發行者用於驗證轉發信封簽名的 Ed25519 公鑰（Base64 編碼）。
+// 參數:
+//
+//	c (*gin.Context): Gin 上下文對象，用於處理請求和響應。
+func (app *ClientEndpoint) GetPublicKey(c *gin.Context) {
+	serviceId := c.Param(PARAM_SERVICE_ID)
+
+	secret, err := app.storage.GetSecret(serviceId)
+	if err != nil || len(secret) == 0 {
+		Error(c, http.StatusNotFound, "Issuer not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"iss":        serviceId,
+		"public_key": base64.StdEncoding.EncodeToString(Envelope.PublicKeyFromSecret(secret)),
+	})
+}
@@ -2,7 +2,9 @@ package serviceendpoint
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"net"
 	ServiceAuth "peergrine/grpc/serviceauth"
 	ServiceUnifiedMessage "peergrine/grpc/unifiedmessage"
@@ -10,10 +12,13 @@ import (
 	AppConfig "peergrine/jwtissuer/app-config"
 	Storage "peergrine/jwtissuer/storage"
 	Auth "peergrine/utils/auth"
+	Envelope "peergrine/utils/envelope"
 	Pulsar "peergrine/utils/pulsar"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 func (s *App) VerifyAccessToken(ctx context.Context, req *ServiceAuth.AccessTokenRequest) (*ServiceAuth.TokenResponse, error) {
@@ -33,22 +38,75 @@ func (s *App) VerifyAccessToken(ctx context.Context, req *ServiceAuth.AccessToke
 		return nil, err
 	}
 
-	iat, _ := (*claims)["iat"].(float64)
-	exp, _ := (*claims)["exp"].(float64)
+	tokenPayload := Auth.Claims2TokenPayload(req.AccessToken, claims)
+
+	// 機器人令牌在機器人被撤銷後立即失效
+	if tokenPayload.Scope == Auth.SCOPE_BOT && !s.storage.HasBot(tokenPayload.UserId) {
+		return nil, errors.New("bot has been revoked")
+	}
 
 	res := ServiceAuth.TokenResponse{
-		Iss:       (*claims)["iss"].(string),
-		Iat:       int64(iat),
-		Exp:       int64(exp),
-		UserId:    (*claims)["user_id"].(string),
-		ChannelId: (*claims)["channel_id"].(string),
+		Iss:       tokenPayload.Iss,
+		Iat:       tokenPayload.Iat,
+		Exp:       tokenPayload.Exp,
+		UserId:    tokenPayload.UserId,
+		ChannelId: tokenPayload.ChannelId,
+		Scope:     tokenPayload.Scope,
 	}
 
 	return &res, nil
 }
 
+// serviceRequired 驗證呼叫者在 metadata 中攜帶的服務令牌，未設定服務令牌時拒絕所有呼叫。
+func (s *App) serviceRequired(ctx context.Context) error {
+	if s.config.ServiceToken == "" {
+		return errors.New("signing keys are disabled without a service token")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(Auth.SERVICE_TOKEN_METADATA)
+	expected := []byte("Bearer " + s.config.ServiceToken)
+
+	if len(values) != 1 || subtle.ConstantTimeCompare([]byte(values[0]), expected) != 1 {
+		return errors.New("service token is invalid")
+	}
+	return nil
+}
+
+// GetSigningKey 返回指定發行者的信封簽名種子，供中繼服務代表發行者簽署轉發的訊息。
+// 種子由發行者的秘密字串推導而來，無法反推出秘密字串，因此持有者不能簽發令牌；
+// 但持有者能冒充任何使用者簽署信封，因此只發放給攜帶服務令牌的中繼服務。
+func (s *App) GetSigningKey(ctx context.Context, req *ServiceAuth.SigningKeyRequest) (*ServiceAuth.SigningKeyResponse, error) {
+
+	if err := s.serviceRequired(ctx); err != nil {
+		return nil, err
+	}
+
+	secret, err := s.storage.GetSecret(req.Iss)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServiceAuth.SigningKeyResponse{
+		Iss:  req.Iss,
+		Seed: Envelope.SeedFromSecret(secret),
+	}, nil
+}
+
+// expired 判斷訊息是否已超過傳送者設定的期限。過期的訊息不再寫入連線，也不再經 Pulsar 轉發。
+func expired(req *ServiceUnifiedMessage.SendMessageRequest) bool {
+	return req.ExpiresAt != 0 && time.Now().Unix() >= req.ExpiresAt
+}
+
 func (s *App) SendMessage(ctx context.Context, req *ServiceUnifiedMessage.SendMessageRequest) (*ServiceUnifiedMessage.SendMessageResponse, error) {
 
+	if expired(req) {
+		return &ServiceUnifiedMessage.SendMessageResponse{
+			Success: false,
+			Message: "message expired",
+		}, nil
+	}
+
 	if s.config.Id == req.ChannelId {
 		conn, ok := s.connMap.Get(req.ClientId)
 		if ok {
@@ -133,7 +191,7 @@ func (app *App) listenPulsarMessage(ctx context.Context) {
 
 		var req ServiceUnifiedMessage.SendMessageRequest
 		err := json.Unmarshal(msg, &req)
-		if err == nil {
+		if err == nil && !expired(&req) {
 			clientId := req.ClientId
 
 			conn, ok := app.connMap.Get(clientId)
@@ -3,16 +3,19 @@ package serviceendpoint
 import (
 	"context"
 	ServiceAuth "peergrine/grpc/serviceauth"
+	ServiceUnifiedMessage "peergrine/grpc/unifiedmessage"
 	ConnMap "peergrine/jwtissuer/api/conn-map"
 	AppConfig "peergrine/jwtissuer/app-config"
 	Storage "peergrine/jwtissuer/storage"
 	Auth "peergrine/utils/auth"
+	Envelope "peergrine/utils/envelope"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 func TestVerifyAccessTokenWithServer(t *testing.T) {
@@ -78,3 +81,88 @@ func TestVerifyAccessTokenWithServer(t *testing.T) {
 	assert.Equal(t, UserId, res.UserId, "unexpected user id")
 	assert.Equal(t, channeId, res.ChannelId, "unexpected channel id")
 }
+
+func TestGetSigningKey(t *testing.T) {
+	secret := []byte("test_secret")
+	Iss := "test_issuer"
+
+	storage, err := Storage.New(Iss, "")
+	assert.NoError(t, err)
+	storage.SaveSecret(secret)
+
+	server := New(storage, &AppConfig.AppConfig{ServiceToken: "service"}, ConnMap.New(), nil)
+
+	// 未攜帶或攜帶錯誤服務令牌的呼叫者不能取得種子
+	_, err = server.GetSigningKey(context.Background(), &ServiceAuth.SigningKeyRequest{Iss: Iss})
+	assert.Error(t, err, "callers without a service token should be rejected")
+
+	wrong := metadata.NewIncomingContext(context.Background(), metadata.Pairs(Auth.SERVICE_TOKEN_METADATA, "Bearer wrong"))
+	_, err = server.GetSigningKey(wrong, &ServiceAuth.SigningKeyRequest{Iss: Iss})
+	assert.Error(t, err, "callers with a wrong service token should be rejected")
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(Auth.SERVICE_TOKEN_METADATA, "Bearer service"))
+
+	res, err := server.GetSigningKey(ctx, &ServiceAuth.SigningKeyRequest{Iss: Iss})
+	assert.NoError(t, err)
+	assert.Equal(t, Iss, res.Iss, "unexpected issuer")
+
+	// 種子產生的簽名必須能以公開的公鑰驗證
+	signer, err := Envelope.NewSigner(res.Iss, res.Seed)
+	assert.NoError(t, err)
+	assert.Equal(t, Envelope.PublicKeyFromSecret(secret), signer.PublicKey())
+
+	_, err = server.GetSigningKey(ctx, &ServiceAuth.SigningKeyRequest{Iss: "unknown"})
+	assert.Error(t, err, "unknown issuer should be rejected")
+}
+
+func TestVerifyBotToken(t *testing.T) {
+	secret := []byte("test_secret")
+	Iss := "test_issuer"
+	botId := "bot-test"
+	currentTime := time.Now()
+
+	storage, err := Storage.New(Iss, "")
+	assert.NoError(t, err)
+	storage.SaveSecret(secret)
+	assert.NoError(t, storage.SaveBot(botId, "bot_key"))
+
+	server := New(storage, &AppConfig.AppConfig{}, ConnMap.New(), nil)
+
+	token, err := Auth.GenerateScopedBearerToken(Iss, botId, "0", Auth.SCOPE_BOT, secret, currentTime.Unix(), currentTime.Add(time.Minute).Unix())
+	assert.NoError(t, err)
+
+	res, err := server.VerifyAccessToken(context.Background(), &ServiceAuth.AccessTokenRequest{AccessToken: token})
+	assert.NoError(t, err)
+	assert.Equal(t, botId, res.UserId, "unexpected user id")
+	assert.Equal(t, Auth.SCOPE_BOT, res.Scope, "unexpected scope")
+
+	// 撤銷機器人後，已簽發的令牌不再通過驗證
+	assert.NoError(t, storage.DeleteBot(botId))
+
+	_, err = server.VerifyAccessToken(context.Background(), &ServiceAuth.AccessTokenRequest{AccessToken: token})
+	assert.Error(t, err, "revoked bot token should be rejected")
+}
+
+func TestSendExpiredMessage(t *testing.T) {
+	storage, err := Storage.New("test_issuer", "")
+	assert.NoError(t, err)
+
+	server := New(storage, &AppConfig.AppConfig{}, ConnMap.New(), nil)
+
+	// 已過期的訊息不應被傳送
+	res, err := server.SendMessage(context.Background(), &ServiceUnifiedMessage.SendMessageRequest{
+		ClientId:  "test_user",
+		Message:   []byte("{}"),
+		ExpiresAt: time.Now().Add(-time.Second).Unix(),
+	})
+	assert.NoError(t, err)
+	assert.False(t, res.Success, "expired message should not be sent")
+
+	res, err = server.SendMessage(context.Background(), &ServiceUnifiedMessage.SendMessageRequest{
+		ClientId:  "test_user",
+		Message:   []byte("{}"),
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	})
+	assert.NoError(t, err)
+	assert.True(t, res.Success)
+}
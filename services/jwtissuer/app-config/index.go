@@ -17,6 +17,8 @@ const (
 	_DEFAULT_REFRESH_TOKEN_DURATION   = "7200"
 	_DEFAULT_PULSAR_ADDRESSES         = "" // pulsar://pulsar-broker:6650
 	_DEFAULT_PULSAR_TOPIC             = "JwtIssuer"
+	_DEFAULT_BOT_ADMIN_TOKEN          = "" // 未設定時停用機器人註冊
+	_DEFAULT_SERVICE_TOKEN            = "" // 未設定時停用簽名種子的發放
 	_DEFAULT_ZK_CONFIG_PATH           = "/jwtissuer"
 )
 
@@ -29,6 +31,8 @@ type AppConfig struct {
 	RefreshTokenDuration string `json:"refresh_token_duration" config:"APP_REFRESH_TOKEN_DURATION"`
 	PulsarAddrs          string `json:"pulsar_addresses" config:"APP_PULSAR_ADDRS"`
 	PulsarTopic          string `json:"pulsar_topic" config:"APP_PULSAR_TOPIC"`
+	BotAdminToken        string `json:"bot_admin_token" config:"APP_BOT_ADMIN_TOKEN" mask:"true"`
+	ServiceToken         string `json:"service_token" config:"APP_SERVICE_TOKEN" mask:"true"`
 }
 
 func Init() (*AppConfig, error) {
@@ -57,6 +61,8 @@ func Init() (*AppConfig, error) {
 		RefreshTokenDuration: _DEFAULT_REFRESH_TOKEN_DURATION,
 		PulsarAddrs:          _DEFAULT_PULSAR_ADDRESSES,
 		PulsarTopic:          _DEFAULT_PULSAR_TOPIC,
+		BotAdminToken:        _DEFAULT_BOT_ADMIN_TOKEN,
+		ServiceToken:         _DEFAULT_SERVICE_TOKEN,
 	}
 
 	log.Println("Reading configuration from environment and default values")
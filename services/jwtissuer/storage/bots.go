@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	Keys "peergrine/jwtissuer/storage/keys"
+)
+
+// hashBotKey 計算機器人金鑰的雜湊值，存儲中只保存雜湊值而不保存金鑰本身。
+func hashBotKey(botKey string) string {
+	sum := sha256.Sum256([]byte(botKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// SaveBot 儲存機器人身分及其長期金鑰。機器人金鑰不會過期，直到以 DeleteBot 撤銷。
+// 參數:
+//
+//	botId (string): 機器人的使用者ID。
+//	botKey (string): 機器人用來換取存取令牌的長期金鑰。
+//
+// 返回值:
+//
+//	error: 儲存過程中的錯誤，如果沒有錯誤，則返回 nil。
+func (storage *Storage) SaveBot(botId, botKey string) error {
+	keyHash := hashBotKey(botKey)
+
+	if storage.redis != nil {
+		if err := storage.redis.Set(Keys.BotKey(keyHash), []byte(botId), 0); err != nil {
+			return err
+		}
+		return storage.redis.Set(Keys.Bot(botId), []byte(keyHash), 0)
+	}
+
+	storage.mux.Lock()
+	defer storage.mux.Unlock()
+
+	storage.botKeys[keyHash] = botId
+	storage.bots[botId] = keyHash
+	return nil
+}
+
+// GetBotIdFromKey 從存儲中檢索機器人金鑰對應的機器人ID。
+// 參數:
+//
+//	botKey (string): 機器人的長期金鑰。
+//
+// 返回值:
+//
+//	string: 機器人ID。如果金鑰不存在或已撤銷，則返回空字符串。
+//	bool: 如果找到對應的機器人ID，則返回 true，否則返回 false。
+func (storage *Storage) GetBotIdFromKey(botKey string) (string, bool) {
+	keyHash := hashBotKey(botKey)
+
+	if storage.redis != nil {
+		botId, err := storage.redis.Get(Keys.BotKey(keyHash))
+		if err != nil {
+			return "", false
+		}
+		return string(botId), true
+	}
+
+	storage.mux.RLock()
+	defer storage.mux.RUnlock()
+
+	botId, exists := storage.botKeys[keyHash]
+	return botId, exists
+}
+
+// HasBot 檢查機器人身分是否仍然有效。
+// 參數:
+//
+//	botId (string): 機器人的使用者ID。
+//
+// 返回值:
+//
+//	bool: 如果機器人已註冊且未撤銷，則返回 true，否則返回 false。
+func (storage *Storage) HasBot(botId string) bool {
+	if storage.redis != nil {
+		exists, err := storage.redis.Exists(Keys.Bot(botId))
+		return err == nil && exists
+	}
+
+	storage.mux.RLock()
+	defer storage.mux.RUnlock()
+
+	_, exists := storage.bots[botId]
+	return exists
+}
+
+// DeleteBot 撤銷機器人身分及其長期金鑰。
+// 參數:
+//
+//	botId (string): 機器人的使用者ID。
+//
+// 返回值:
+//
+//	error: 機器人不存在或刪除過程中發生錯誤時返回錯誤信息。
+func (storage *Storage) DeleteBot(botId string) error {
+	if storage.redis != nil {
+		keyHash, err := storage.redis.Get(Keys.Bot(botId))
+		if err != nil {
+			return errors.New("bot not found")
+		}
+		if err := storage.redis.Del(Keys.BotKey(string(keyHash))); err != nil {
+			return err
+		}
+		return storage.redis.Del(Keys.Bot(botId))
+	}
+
+	storage.mux.Lock()
+	defer storage.mux.Unlock()
+
+	keyHash, exists := storage.bots[botId]
+	if !exists {
+		return errors.New("bot not found")
+	}
+
+	delete(storage.botKeys, keyHash)
+	delete(storage.bots, botId)
+	return nil
+}
@@ -11,6 +11,8 @@ type Storage struct {
 	ServiceId     string
 	mux           sync.RWMutex
 	refreshTokens map[string]string
+	bots          map[string]string // 機器人ID對應金鑰雜湊值，僅在未使用 Redis 時使用
+	botKeys       map[string]string // 金鑰雜湊值對應機器人ID，僅在未使用 Redis 時使用
 	redis         *Redis.Manager
 	secret        []byte
 }
@@ -28,6 +30,8 @@ func New(ServiceId, redisAddr string) (*Storage, error) {
 	storage := &Storage{
 		ServiceId:     ServiceId,
 		refreshTokens: make(map[string]string),
+		bots:          make(map[string]string),
+		botKeys:       make(map[string]string),
 	}
 
 	if redisAddr != "" {
@@ -7,3 +7,11 @@ func RefreshToken(refreshToken string) string {
 func Secret(secretId string) string {
 	return "secret:" + secretId
 }
+
+func BotKey(keyHash string) string {
+	return "bot_key:" + keyHash
+}
+
+func Bot(botId string) string {
+	return "bot:" + botId
+}
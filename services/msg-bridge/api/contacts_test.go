@@ -0,0 +1,76 @@
+package msgbridgeapi
+
+import (
+	"net/http"
+	AppConfig "peergrine/msg-bridge/app-config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 測試訊息只能傳給已配對的聯絡人
+func TestPostMessage(t *testing.T) {
+	app := newTestServer(t, nil)
+	sender := app.Login("sender", "")
+	receiver := app.Login("receiver", "")
+	stranger := app.Login("stranger", "")
+
+	events := app.listen(t, receiver)
+
+	assert.Equal(t, http.StatusForbidden, app.Status(http.MethodPost, "/messages/receiver", stranger, []byte("hello")))
+
+	app.pair(t, "sender", "receiver")
+	assert.Equal(t, http.StatusOK, app.deliverSoon(t, http.MethodPost, "/messages/receiver", sender, []byte("hello")))
+	assert.Equal(t, EVENT_MESSAGE, <-events)
+}
+
+// 測試封鎖不會隨聯絡人一起過期，且只能由封鎖者解除
+func TestRemoveContact(t *testing.T) {
+	app := newTestServer(t, func(config *AppConfig.AppConfig) {
+		config.ContactDuration = "1"
+	})
+	client := app.Login("client", "")
+	peer := app.Login("peer", "")
+
+	app.pair(t, "client", "peer")
+	require.Equal(t, http.StatusOK, app.Status(http.MethodDelete, "/contacts/peer?block=true", client, nil))
+
+	paired, err := app.storage.ContactExists("client", "peer")
+	require.NoError(t, err)
+	assert.False(t, paired)
+
+	// A new pairing lasts APP_CONTACT_DURATION; the block outlives it.
+	app.pair(t, "client", "peer")
+	require.Eventually(t, func() bool {
+		paired, _ := app.storage.ContactExists("client", "peer")
+		return !paired
+	}, 3*time.Second, 100*time.Millisecond)
+
+	blocked, err := app.storage.IsBlocked("peer", "client")
+	require.NoError(t, err)
+	assert.True(t, blocked, "The block should not expire with the contact")
+
+	require.Equal(t, http.StatusOK, app.Status(http.MethodDelete, "/blocks/client", peer, nil))
+	blocked, _ = app.storage.IsBlocked("client", "peer")
+	assert.True(t, blocked, "Only the client that placed the block can lift it")
+
+	require.Equal(t, http.StatusOK, app.Status(http.MethodDelete, "/blocks/peer", client, nil))
+	blocked, _ = app.storage.IsBlocked("client", "peer")
+	assert.False(t, blocked)
+}
+
+// 測試聯絡人的期限取決於較早過期的令牌，且聯絡人期限必須為正數
+func TestContactExpiresAt(t *testing.T) {
+	app := newTestServer(t, nil)
+	now := time.Now().Unix()
+
+	assert.Equal(t, now+600+7200, app.contactExpiresAt(now+3600, now+600), "The earlier token should bound the pairing")
+	assert.Equal(t, now+3600+7200, app.contactExpiresAt(0, now+3600), "An unknown token expiry should be skipped")
+
+	for _, duration := range []string{"0", "-1"} {
+		_, err := New(&AppConfig.AppConfig{ContactDuration: duration}, app.storage, nil)
+		assert.Error(t, err, duration)
+	}
+}
@@ -0,0 +1,450 @@
+package msgbridgeapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	AppConfig "peergrine/msg-bridge/app-config"
+	Storage "peergrine/msg-bridge/storage"
+	BlobStore "peergrine/utils/blob-store"
+	Configurator "peergrine/utils/configurator"
+	LinkCodes "peergrine/utils/link-code"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DROP_UPLOAD_LEASE bounds how long an interrupted chunk upload keeps other uploads of the drop out.
+const DROP_UPLOAD_LEASE = 10 * time.Minute
+
+const (
+	PARAM_DROP_ID        = "drop_id"
+	HEADER_UPLOAD_OFFSET = "Upload-Offset"
+	HEADER_UPLOAD_LENGTH = "Upload-Length"
+)
+
+// dropLimits are the server-side bounds of file drops.
+type dropLimits struct {
+	duration  time.Duration
+	maxSize   int64
+	quota     int64
+	chunkSize int64
+}
+
+// newDropBackend creates the blob backend and limits of file drops.
+// It returns a nil backend when drops are disabled.
+func newDropBackend(config *AppConfig.AppConfig) (BlobStore.Backend, dropLimits, error) {
+	var limits dropLimits
+
+	if config.DropBackend == "" {
+		return nil, limits, nil
+	}
+
+	var err error
+	if limits.duration, err = Configurator.ParseSeconds(config.DropDuration); err != nil || limits.duration <= 0 {
+		return nil, limits, fmt.Errorf("invalid drop duration: %s", config.DropDuration)
+	}
+	if limits.maxSize, err = strconv.ParseInt(config.DropMaxSize, 10, 64); err != nil || limits.maxSize <= 0 {
+		return nil, limits, fmt.Errorf("invalid drop max size: %s", config.DropMaxSize)
+	}
+	if limits.quota, err = strconv.ParseInt(config.DropQuota, 10, 64); err != nil || limits.quota < limits.maxSize {
+		return nil, limits, fmt.Errorf("invalid drop quota: %s", config.DropQuota)
+	}
+	if limits.chunkSize, err = strconv.ParseInt(config.DropChunkSize, 10, 64); err != nil || limits.chunkSize <= 0 {
+		return nil, limits, fmt.Errorf("invalid drop chunk size: %s", config.DropChunkSize)
+	}
+
+	backend, err := BlobStore.New(BlobStore.Config{
+		Type:      config.DropBackend,
+		Dir:       config.DropDir,
+		Endpoint:  config.DropS3Endpoint,
+		AccessKey: config.DropS3AccessKey,
+		SecretKey: config.DropS3SecretKey,
+		Bucket:    config.DropS3Bucket,
+		UseSSL:    config.DropS3UseSSL == "true",
+	})
+	if err != nil {
+		return nil, limits, err
+	}
+
+	return backend, limits, nil
+}
+
+// removeExpiredDrops periodically deletes blobs older than the drop lifetime. Drop metadata
+// expires on its own; the blobs it pointed to are collected here.
+func (app *Server) removeExpiredDrops(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := app.blobs.RemoveExpired(ctx, now.Add(-app.dropLimits.duration)); err != nil {
+				log.Printf("failed to remove expired drops: %v", err)
+			}
+		}
+	}
+}
+
+// chunkKey returns the blob key of the index-th chunk of a drop.
+func chunkKey(dropId string, index int) string {
+	return fmt.Sprintf("%s/%06d", dropId, index)
+}
+
+func dropInfo(drop *Storage.Drop, chunkSize int64) DropInfo {
+	return DropInfo{
+		DropId:    drop.Id,
+		Size:      drop.Size,
+		Received:  drop.Received,
+		ChunkSize: chunkSize,
+		ExpiresAt: drop.ExpiresAt,
+	}
+}
+
+func dropData(drop *Storage.Drop) DropData {
+	return DropData{
+		DropId:    drop.Id,
+		SenderId:  drop.SenderId,
+		Name:      drop.Name,
+		Size:      drop.Size,
+		ExpiresAt: drop.ExpiresAt,
+	}
+}
+
+// getDropFor loads a drop and checks that clientId may access it as sender, or as recipient
+// when allowRecipient is set. It writes the error response itself and returns nil on failure.
+func (app *Server) getDropFor(c *gin.Context, clientId string, allowRecipient bool) *Storage.Drop {
+	drop, err := app.storage.GetDrop(c.Param(PARAM_DROP_ID))
+	if err != nil {
+		Error(c, http.StatusNotFound, "Drop not found")
+		return nil
+	}
+
+	if drop.SenderId != clientId && (!allowRecipient || drop.RecipientId != clientId) {
+		Error(c, http.StatusNotFound, "Drop not found")
+		return nil
+	}
+
+	return drop
+}
+
+// resolveDropRecipient returns the recipient of a new drop: a paired contact, or the owner
+// of a link code, which is redeemed. It writes the error response itself and returns false on failure.
+func (app *Server) resolveDropRecipient(c *gin.Context, request CreateDrop, drop *Storage.Drop) bool {
+	tokenPayload, _ := getPlayload(c)
+
+	if request.LinkCode != "" {
+		keys := lookupKeys(c, tokenPayload)
+		if app.lookupLocked(c, keys) {
+			return false
+		}
+
+		target, err := app.storage.GetClientSession(request.LinkCode)
+		if err != nil {
+			app.lookupFailed(keys)
+			Error(c, http.StatusBadRequest, fmt.Sprintf("Failed to retrieve client session for link: %s. Error: %v", request.LinkCode, err))
+			return false
+		}
+
+		if target.Pake {
+			Error(c, http.StatusBadRequest, "Link code requires PAKE pairing")
+			return false
+		}
+
+		blocked, err := app.storage.IsBlocked(tokenPayload.UserId, target.ClientId)
+		if err != nil {
+			Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to check block state: %v", err))
+			return false
+		}
+		if blocked {
+			Error(c, http.StatusForbidden, "Dropping files to this client is blocked")
+			return false
+		}
+
+		if err := app.storage.RedeemClientSession(*target); err != nil {
+			if errors.Is(err, LinkCodes.ErrExhausted) {
+				Error(c, http.StatusGone, "Link code has no remaining uses")
+			} else {
+				Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to redeem link code: %v", err))
+			}
+			return false
+		}
+
+		drop.RecipientId = target.ClientId
+		drop.ChannelId = target.ChannelId
+		return true
+	}
+
+	paired, err := app.storage.ContactExists(tokenPayload.UserId, request.RecipientId)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to check contact: %v", err))
+		return false
+	}
+	if !paired {
+		Error(c, http.StatusForbidden, "Target client is not a paired contact")
+		return false
+	}
+
+	drop.RecipientId = request.RecipientId
+	return true
+}
+
+// postDrop creates a drop for a paired recipient or the owner of a link code and reserves
+// its declared size against the sender's quota.
+func (app *Server) postDrop(c *gin.Context) {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	var request CreateDrop
+	if err := c.ShouldBindJSON(&request); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid drop: %v", err))
+		return
+	}
+
+	if (request.RecipientId == "") == (request.LinkCode == "") {
+		Error(c, http.StatusBadRequest, "Exactly one of recipient_id and link_code is required")
+		return
+	}
+
+	if request.Size > app.dropLimits.maxSize {
+		Error(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Drop exceeds the maximum size of %d bytes", app.dropLimits.maxSize))
+		return
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to generate drop ID: %v", err))
+		return
+	}
+
+	drop := Storage.Drop{
+		Id:        hex.EncodeToString(idBytes),
+		SenderId:  tokenPayload.UserId,
+		Name:      request.Name,
+		Size:      request.Size,
+		ExpiresAt: time.Now().Add(app.dropLimits.duration).Unix(),
+	}
+
+	if !app.resolveDropRecipient(c, request, &drop) {
+		return
+	}
+
+	reserved, err := app.storage.ReserveQuota(drop.SenderId, drop.Size, app.dropLimits.quota, drop.ExpiresAt)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to reserve drop quota: %v", err))
+		return
+	}
+	if !reserved {
+		Error(c, http.StatusInsufficientStorage, "Drop quota exceeded")
+		return
+	}
+
+	if err := app.storage.SetDrop(drop); err != nil {
+		app.storage.ReleaseQuota(drop.SenderId, drop.Size)
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to store drop: %v", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, dropInfo(&drop, app.dropLimits.chunkSize))
+}
+
+// patchDrop appends the request body as the next chunk of a drop. The Upload-Offset header
+// must match the bytes already received, so an interrupted upload resumes from the offset
+// reported by HEAD /drops/:drop_id. The recipient is notified once the last byte arrives.
+func (app *Server) patchDrop(c *gin.Context) {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	// One chunk of a drop is uploaded at a time. The drop is read after taking the lock, so
+	// the offset check below sees every chunk recorded before.
+	locked, err := app.storage.LockDropUpload(c.Param(PARAM_DROP_ID), DROP_UPLOAD_LEASE)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to lock drop upload: %v", err))
+		return
+	}
+	if !locked {
+		Error(c, http.StatusConflict, "Another chunk of this drop is being uploaded")
+		return
+	}
+	defer app.storage.UnlockDropUpload(c.Param(PARAM_DROP_ID))
+
+	drop := app.getDropFor(c, tokenPayload.UserId, false)
+	if drop == nil {
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader(HEADER_UPLOAD_OFFSET), 10, 64)
+	if err != nil || offset != drop.Received {
+		c.Header(HEADER_UPLOAD_OFFSET, strconv.FormatInt(drop.Received, 10))
+		Error(c, http.StatusConflict, "Upload-Offset does not match the received bytes")
+		return
+	}
+
+	size := c.Request.ContentLength
+	if size <= 0 || size > app.dropLimits.chunkSize || size > drop.Size-drop.Received {
+		Error(c, http.StatusRequestEntityTooLarge, "Chunk size is missing, too large or exceeds the declared drop size")
+		return
+	}
+
+	index := len(drop.Chunks)
+	if err := app.blobs.Put(c.Request.Context(), chunkKey(drop.Id, index), c.Request.Body, size); err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to store drop chunk: %v", err))
+		return
+	}
+
+	// The chunk is only recorded if no other upload advanced the drop meanwhile, for example
+	// after the lock of a slow upload expired.
+	drop, err = app.storage.AppendDropChunk(drop.Id, offset, size)
+	if errors.Is(err, Storage.ErrUploadOffset) {
+		Error(c, http.StatusConflict, "Upload-Offset does not match the received bytes")
+		return
+	}
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to update drop: %v", err))
+		return
+	}
+
+	if drop.Complete() {
+		if err := app.storage.AddToInbox(drop.RecipientId, drop.Id, drop.ExpiresAt); err != nil {
+			Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to list drop for recipient: %v", err))
+			return
+		}
+
+		// The recipient may be offline; it finds the drop through GET /drops later.
+		app.deliver(tokenPayload, drop.RecipientId, drop.ChannelId, EVENT_DROP, dropData(drop))
+	}
+
+	c.Header(HEADER_UPLOAD_OFFSET, strconv.FormatInt(drop.Received, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// headDrop reports the upload progress of a drop to its sender or recipient.
+func (app *Server) headDrop(c *gin.Context) {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	drop := app.getDropFor(c, tokenPayload.UserId, true)
+	if drop == nil {
+		return
+	}
+
+	c.Header(HEADER_UPLOAD_OFFSET, strconv.FormatInt(drop.Received, 10))
+	c.Header(HEADER_UPLOAD_LENGTH, strconv.FormatInt(drop.Size, 10))
+	c.Status(http.StatusOK)
+}
+
+// listDrops returns the completed drops waiting for the caller.
+func (app *Server) listDrops(c *gin.Context) {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	dropIds, err := app.storage.ListInbox(tokenPayload.UserId)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to list drops: %v", err))
+		return
+	}
+
+	drops := []DropData{}
+	for _, dropId := range dropIds {
+		drop, err := app.storage.GetDrop(dropId)
+		if err != nil {
+			continue
+		}
+		drops = append(drops, dropData(drop))
+	}
+
+	c.JSON(http.StatusOK, drops)
+}
+
+// getDrop streams a completed drop to its recipient chunk by chunk.
+func (app *Server) getDrop(c *gin.Context) {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	drop := app.getDropFor(c, tokenPayload.UserId, true)
+	if drop == nil {
+		return
+	}
+
+	if drop.RecipientId != tokenPayload.UserId {
+		Error(c, http.StatusForbidden, "Only the recipient can download a drop")
+		return
+	}
+
+	if !drop.Complete() {
+		Error(c, http.StatusConflict, "Drop upload is not complete")
+		return
+	}
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Length", strconv.FormatInt(drop.Size, 10))
+	c.Status(http.StatusOK)
+
+	for index, size := range drop.Chunks {
+		chunk, err := app.blobs.Get(c.Request.Context(), chunkKey(drop.Id, index))
+		if err != nil {
+			// Headers are already sent; a short body tells the client the download failed.
+			log.Printf("failed to read drop %s chunk %d: %v", drop.Id, index, err)
+			return
+		}
+
+		_, err = io.CopyN(c.Writer, chunk, size)
+		chunk.Close()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// deleteDrop removes a drop and its blobs on behalf of its sender or recipient and returns
+// its size to the sender's quota.
+func (app *Server) deleteDrop(c *gin.Context) {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	drop := app.getDropFor(c, tokenPayload.UserId, true)
+	if drop == nil {
+		return
+	}
+
+	if err := app.storage.RemoveDrop(drop.Id); err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to remove drop: %v", err))
+		return
+	}
+
+	app.storage.RemoveFromInbox(drop.RecipientId, drop.Id)
+	app.storage.ReleaseQuota(drop.SenderId, drop.Size)
+
+	if err := app.blobs.Delete(c.Request.Context(), drop.Id+"/"); err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to remove drop blobs: %v", err))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
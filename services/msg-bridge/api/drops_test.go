@@ -0,0 +1,158 @@
+package msgbridgeapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	AppConfig "peergrine/msg-bridge/app-config"
+	Storage "peergrine/msg-bridge/storage"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDropServer starts a msg-bridge that stores drops of up to 8 bytes in 4 byte chunks
+// with a quota of 16 bytes per sender.
+func newDropServer(t *testing.T) *testServer {
+	return newTestServer(t, func(config *AppConfig.AppConfig) {
+		config.DropBackend = "local"
+		config.DropDir = t.TempDir()
+		config.DropDuration = "3600"
+		config.DropMaxSize = "8"
+		config.DropQuota = "16"
+		config.DropChunkSize = "4"
+	})
+}
+
+// createDrop creates a drop for a recipient and returns its status and upload state.
+func (s *testServer) createDrop(token string, recipientId string, size int64) (int, DropInfo) {
+	res := s.Request(context.Background(), http.MethodPost, "/drops", token, nil, CreateDrop{RecipientId: recipientId, Size: size})
+	defer res.Body.Close()
+
+	var info DropInfo
+	json.NewDecoder(res.Body).Decode(&info)
+	return res.StatusCode, info
+}
+
+// patchDrop uploads a chunk of a drop at offset and returns the response.
+func (s *testServer) patchDrop(token string, dropId string, offset int64, chunk []byte) *http.Response {
+	header := http.Header{HEADER_UPLOAD_OFFSET: {strconv.FormatInt(offset, 10)}}
+	res := s.Request(context.Background(), http.MethodPatch, "/drops/"+dropId, token, header, chunk)
+	res.Body.Close()
+	return res
+}
+
+// 測試傳送者的配額涵蓋所有未刪除的投遞，刪除後釋放
+func TestDropQuota(t *testing.T) {
+	app := newDropServer(t)
+	sender := app.Login("sender", "")
+	app.Login("recipient", "")
+
+	status, _ := app.createDrop(sender, "recipient", 8)
+	assert.Equal(t, http.StatusForbidden, status, "Drops need a paired recipient")
+
+	app.pair(t, "sender", "recipient")
+
+	status, _ = app.createDrop(sender, "recipient", 9)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+
+	status, first := app.createDrop(sender, "recipient", 8)
+	require.Equal(t, http.StatusOK, status)
+	status, _ = app.createDrop(sender, "recipient", 8)
+	require.Equal(t, http.StatusOK, status)
+
+	status, _ = app.createDrop(sender, "recipient", 1)
+	assert.Equal(t, http.StatusInsufficientStorage, status)
+
+	require.Equal(t, http.StatusOK, app.Status(http.MethodDelete, "/drops/"+first.DropId, sender, nil))
+
+	status, _ = app.createDrop(sender, "recipient", 8)
+	assert.Equal(t, http.StatusOK, status, "Deleting a drop should return its size to the quota")
+}
+
+// 測試同時上傳同一偏移量的區塊時只有一個成功，以及完成的投遞交給接收者
+func TestPatchDrop(t *testing.T) {
+	app := newDropServer(t)
+	sender := app.Login("sender", "")
+	recipient := app.Login("recipient", "")
+	app.pair(t, "sender", "recipient")
+
+	status, drop := app.createDrop(sender, "recipient", 8)
+	require.Equal(t, http.StatusOK, status)
+
+	const uploads = 5
+	statuses := make([]int, uploads)
+
+	var wg sync.WaitGroup
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i] = app.patchDrop(sender, drop.DropId, 0, []byte("abcd")).StatusCode
+		}(i)
+	}
+	wg.Wait()
+
+	uploaded := 0
+	for _, status := range statuses {
+		if status == http.StatusNoContent {
+			uploaded++
+		} else {
+			assert.Equal(t, http.StatusConflict, status)
+		}
+	}
+	assert.Equal(t, 1, uploaded, "Only one chunk should be recorded at offset 0")
+
+	res := app.patchDrop(sender, drop.DropId, 0, []byte("abcd"))
+	assert.Equal(t, http.StatusConflict, res.StatusCode)
+	assert.Equal(t, "4", res.Header.Get(HEADER_UPLOAD_OFFSET))
+
+	assert.Equal(t, http.StatusNotFound, app.patchDrop(recipient, drop.DropId, 4, []byte("efgh")).StatusCode, "Only the sender may upload")
+	assert.Equal(t, http.StatusConflict, app.Status(http.MethodGet, "/drops/"+drop.DropId, recipient, nil), "An incomplete drop cannot be downloaded")
+
+	require.Equal(t, http.StatusNoContent, app.patchDrop(sender, drop.DropId, 4, []byte("efgh")).StatusCode)
+
+	res = app.Request(context.Background(), http.MethodGet, "/drops", recipient, nil, nil)
+	var inbox []DropData
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&inbox))
+	res.Body.Close()
+	require.Len(t, inbox, 1)
+	assert.Equal(t, drop.DropId, inbox[0].DropId)
+
+	assert.Equal(t, http.StatusForbidden, app.Status(http.MethodGet, "/drops/"+drop.DropId, sender, nil), "Only the recipient may download")
+
+	res = app.Request(context.Background(), http.MethodGet, "/drops/"+drop.DropId, recipient, nil, nil)
+	content, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefgh", string(content))
+}
+
+// 測試 PAKE 連結碼不能用來投遞檔案，也不會被兌換
+func TestCreateDropWithPakeLinkCode(t *testing.T) {
+	app := newDropServer(t)
+	sender := app.Login("sender", "")
+	app.Login("recipient", "")
+
+	_, err := app.storage.ReserveClientSession(Storage.ClientSession{
+		LinkCode:      "pake-code",
+		ClientId:      "recipient",
+		ChannelId:     "channel-recipient",
+		ExpiresAt:     time.Now().Add(time.Hour).Unix(),
+		RemainingUses: 1,
+		Pake:          true,
+	})
+	require.NoError(t, err)
+
+	request := CreateDrop{LinkCode: "pake-code", Size: 8}
+	assert.Equal(t, http.StatusBadRequest, app.Status(http.MethodPost, "/drops", sender, request))
+
+	session, err := app.storage.GetClientSession("pake-code")
+	require.NoError(t, err, "The link code should not be redeemed")
+	assert.Equal(t, 1, session.RemainingUses)
+}
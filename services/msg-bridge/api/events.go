@@ -0,0 +1,71 @@
+package msgbridgeapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MAX_EVENT_SIZE is the largest accepted ephemeral event body in bytes.
+const MAX_EVENT_SIZE = 1024
+
+// coalesceGroups maps event types that describe the same state to a shared coalescing key,
+// so a late "typing" can never overtake the "stopped_typing" sent after it.
+var coalesceGroups = map[string]string{
+	"stopped_typing": "typing",
+}
+
+// postEvent relays an ephemeral event to a paired client. Events are rate-limited per sender
+// and coalesced per sender, target and type: within the coalescing interval only the latest
+// event is delivered. Events are never queued or stored, so a client that is not listening
+// simply misses them.
+func (app *Server) postEvent(c *gin.Context) {
+	targetId := c.Param(PARAM_USER_ID)
+
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MAX_EVENT_SIZE)
+
+	var event EphemeralEvent
+	if err := c.ShouldBindJSON(&event); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid event: %v", err))
+		return
+	}
+
+	paired, err := app.storage.ContactExists(tokenPayload.UserId, targetId)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to check contact: %v", err))
+		return
+	}
+	if !paired {
+		Error(c, http.StatusForbidden, "Target client is not a paired contact")
+		return
+	}
+
+	group, ok := coalesceGroups[event.Type]
+	if !ok {
+		group = event.Type
+	}
+
+	sender := *tokenPayload
+	data := EphemeralData{
+		SenderId: sender.UserId,
+		Type:     event.Type,
+		Data:     event.Data,
+	}
+
+	submitted := app.events.Submit(sender.UserId, sender.UserId+":"+targetId+":"+group, func() {
+		app.deliver(&sender, targetId, "", EVENT_EPHEMERAL, data)
+	})
+	if !submitted {
+		Error(c, http.StatusTooManyRequests, "Too many events")
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
@@ -2,57 +2,213 @@ package msgbridgeapi
 
 import (
 	"context"
-	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"math/big"
+	"log"
 	"net/http"
 	ServiceUnifiedMessage "peergrine/grpc/unifiedmessage"
 	AuthMessage "peergrine/jwtissuer/client-messages"
 	Storage "peergrine/msg-bridge/storage"
 	Auth "peergrine/utils/auth"
+	Envelope "peergrine/utils/envelope"
+	GenericChannels "peergrine/utils/generic-channels"
+	LinkCodes "peergrine/utils/link-code"
+	PublicKey "peergrine/utils/public-key"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
-// Constants
-const LINK_CODE_LETTER_BYTES = "abcdefghijkmnopqrstuvwxyzABCDEFHJKLMNPQRSTUVWXYZ0123456789"
-const LINK_CODE_DURATION = 5 * time.Minute
-
 const MESSAGE_TYPE = "message-relay"
 
-// generateUniqueLinkCode generates a unique link code for signal identification.
-// It attempts to generate a unique code up to a maximum number of times, and checks
-// whether the generated code already exists in the signal storage.
+// SSE event names written to clients listening on GET /messages.
+const (
+	EVENT_CONNECTED   = "connected"
+	EVENT_APPEND_USER = "append_user"
+	EVENT_MESSAGE     = "message"
+	EVENT_PAKE        = "pake"
+	EVENT_EPHEMERAL   = "ephemeral"
+	EVENT_DROP        = "drop"
+	EVENT_STREAM      = "stream"
+)
+
+// unifiedMessageTypes maps SSE events to their UnifiedMessage type when it differs from MESSAGE_TYPE.
+// Key exchange and relayed messages share MESSAGE_TYPE for compatibility with existing clients.
+var unifiedMessageTypes = map[string]string{
+	EVENT_PAKE:      MESSAGE_TYPE + "-pake",
+	EVENT_EPHEMERAL: MESSAGE_TYPE + "-ephemeral",
+	EVENT_DROP:      MESSAGE_TYPE + "-drop",
+	EVENT_STREAM:    MESSAGE_TYPE + "-stream",
+}
+
+// deliver pushes an event to every listener of a client through UnifiedMessage, the local SSE
+// subscriptions or Pulsar, or to the webhook of a bot.
+// The data is wrapped in an envelope signed with the key of the sender's token issuer, so the
+// recipient can verify the sender ID independently of the transport.
+// channelId is the UnifiedMessage channel of the client when the caller already knows it;
+// when empty it is looked up in storage.
 // Returns:
-//   - string: The unique link code if successful.
-//   - error: Returns an error if unable to generate a unique code after the maximum attempts.
-func (app *Server) generateUniqueLinkCode() (string, error) {
-	const maxAttempts = 5
-	const linkCodeLength = 8
+//   - int: The HTTP status describing the failure.
+//   - error: Returns an error if the event could not be handed off for delivery.
+func (app *Server) deliver(sender *Auth.TokenPayload, targetId string, channelId string, event string, data any) (int, error) {
+	return app.deliverUntil(sender, targetId, channelId, event, data, 0)
+}
 
-	letterLen := len(LINK_CODE_LETTER_BYTES)
+// deliverUntil is like deliver, but the event is dropped by every queue, Pulsar consumer and
+// webhook retry it passes through once expiresAt (Unix seconds, 0 for never) has passed.
+func (app *Server) deliverUntil(sender *Auth.TokenPayload, targetId string, channelId string, event string, data any, expiresAt int64) (int, error) {
 
-	for attempts := 0; attempts < maxAttempts; attempts++ {
-		b := make([]byte, linkCodeLength)
-		for i := range b {
-			randNum, err := rand.Int(rand.Reader, big.NewInt(int64(letterLen)))
+	envelope, err := app.keyring.Seal(sender.Iss, sender.UserId, data)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Failed to sign message envelope: %v", err)
+	}
+
+	// Bots receive their events by webhook rather than through a listener.
+	webhook, err := app.storage.GetWebhook(targetId)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Failed to retrieve webhook: %v", err)
+	}
+	if webhook != nil {
+		return app.deliverWebhook(webhook, event, envelope, expiresAt)
+	}
+
+	if app.unifiedMessageConnection != nil {
+
+		channelIds := []string{channelId}
+		if channelId == "" {
+			channelIds, err = app.storage.GetClientChannels(targetId)
 			if err != nil {
-				return "", fmt.Errorf("failed to generate random number for link code: %v", err)
+				return http.StatusNotFound, fmt.Errorf("Client channel not found for target ID: %s. Error: %v", targetId, err)
+			}
+		}
+
+		messageType, ok := unifiedMessageTypes[event]
+		if !ok {
+			messageType = MESSAGE_TYPE
+		}
+
+		message := AuthMessage.Message[*Envelope.Envelope]{
+			Type:    messageType,
+			Content: envelope,
+		}
+
+		messageBytes, _ := json.Marshal(message)
+
+		for _, channelId := range channelIds {
+
+			request := &ServiceUnifiedMessage.SendMessageRequest{
+				ChannelId: channelId,
+				ClientId:  targetId,
+				Message:   messageBytes,
+				ExpiresAt: expiresAt,
+			}
+
+			if app.pulsar != nil {
+
+				requestBytes, _ := json.Marshal(request)
+				if _, err := app.pulsar.SendMessage(channelId, requestBytes); err != nil {
+					return http.StatusInternalServerError, err
+				}
+
+			} else {
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+				_, err := app.unifiedMessageClient.SendMessage(ctx, request)
+				cancel()
+
+				if err != nil {
+					return http.StatusInternalServerError, err
+				}
+
 			}
-			b[i] = LINK_CODE_LETTER_BYTES[randNum.Int64()]
+
+		}
+
+		return http.StatusOK, nil
+	}
+
+	dataBytes, err := json.Marshal(envelope)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Failed to marshal message data: %v", err)
+	}
+
+	eventBytes := sseEvent(event, dataBytes)
+
+	// Listeners on this instance get the event directly, listeners on other instances through Pulsar.
+	delivered := app.messageChannels.Publish(targetId, QueuedEvent{
+		Content:   eventBytes,
+		ExpiresAt: expiresAt,
+	})
+
+	if app.pulsar == nil {
+		if delivered {
+			return http.StatusOK, nil
+		}
+		return http.StatusNotFound, errors.New("")
+	}
+
+	channelIds, err := app.storage.GetClientChannels(targetId)
+	if err != nil {
+		if delivered {
+			return http.StatusOK, nil
+		}
+		return http.StatusNotFound, fmt.Errorf("Client channel not found for target ID: %s. Error: %v", targetId, err)
+	}
+
+	pulsarMessage := ForawrdMessage{
+		ClientId:  targetId,
+		Content:   eventBytes,
+		ExpiresAt: expiresAt,
+	}
+
+	pulsarMessageBytes, _ := json.Marshal(pulsarMessage)
+
+	for _, channelId := range channelIds {
+		if channelId == app.config.Id {
+			continue
+		}
+		if _, err := app.pulsar.SendMessage(channelId, pulsarMessageBytes); err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("Failed to send message via Kafka for target ID: %s. Error: %v", targetId, err)
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+// deliveryError returns the value passed to Error for a failed delivery: internal errors are
+// logged as they are, everything else is sent to the client as its message.
+func deliveryError(status int, err error) any {
+	if status == http.StatusInternalServerError {
+		return err
+	}
+	return err.Error()
+}
+
+// reserveClientSession stores the session under a newly generated link code.
+// Each candidate code is reserved atomically in storage, and generation is retried
+// up to a maximum number of times when a code is already taken.
+// Returns:
+//   - string: The reserved link code if successful.
+//   - error: Returns an error if unable to reserve a code after the maximum attempts.
+func (app *Server) reserveClientSession(session Storage.ClientSession) (string, error) {
+	const maxAttempts = 5
+
+	for attempts := 0; attempts < maxAttempts; attempts++ {
+		linkCode, err := app.linkCodeLimits.Generate()
+		if err != nil {
+			return "", err
 		}
 
-		linkCode := string(b)
+		session.LinkCode = linkCode
 
-		exist, err := app.storage.ClientSessionExists(linkCode)
+		reserved, err := app.storage.ReserveClientSession(session)
 		if err != nil {
-			return "", fmt.Errorf("error checking link code existence in storage: %v", err)
+			return "", fmt.Errorf("error reserving link code in storage: %v", err)
 		}
-		if !exist {
+		if reserved {
 			return linkCode, nil
 		}
 	}
@@ -60,6 +216,52 @@ func (app *Server) generateUniqueLinkCode() (string, error) {
 	return "", fmt.Errorf("exceeded maximum attempts (%d) to generate a unique link code", maxAttempts)
 }
 
+// lookupKeys returns the attempt limiter keys of the identity and address behind a link-code lookup.
+func lookupKeys(c *gin.Context, tokenPayload *Auth.TokenPayload) []string {
+	return []string{"user:" + tokenPayload.UserId, "ip:" + c.ClientIP()}
+}
+
+// lookupFailed records a failed link-code lookup against keys. The lookup has already failed,
+// so an error of the limiter is only logged.
+func (app *Server) lookupFailed(keys []string) {
+	if err := app.lookupLimiter.Fail(keys...); err != nil {
+		log.Printf("Failed to record a failed link code lookup: %v\n", err)
+	}
+}
+
+// lookupLocked responds with 429 and reports true if the caller is locked out of link-code lookups.
+func (app *Server) lookupLocked(c *gin.Context, keys []string) bool {
+	locked, err := app.lookupLimiter.Locked(keys...)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to check lookup lockout: %v", err))
+		return true
+	}
+	if locked > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(locked.Seconds())+1))
+		Error(c, http.StatusTooManyRequests, "Too many failed link code lookups")
+		return true
+	}
+	return false
+}
+
+// contactExpiresAt returns the expiry of a pairing edge created or refreshed with tokens that
+// expire at tokenExpiresAt. The edge outlives the earliest of them by APP_CONTACT_DURATION, so
+// clients that refresh their tokens in time keep the pairing. Unknown expiries (0) are skipped.
+func (app *Server) contactExpiresAt(tokenExpiresAt ...int64) int64 {
+
+	var earliest int64
+	for _, expiresAt := range tokenExpiresAt {
+		if expiresAt > 0 && (earliest == 0 || expiresAt < earliest) {
+			earliest = expiresAt
+		}
+	}
+	if earliest == 0 {
+		earliest = time.Now().Unix()
+	}
+
+	return time.Unix(earliest, 0).Add(app.contactDuration).Unix()
+}
+
 func getPlayload(c *gin.Context) (*Auth.TokenPayload, error) {
 
 	tokenPayloadValue, exists := c.Get(TOKEN_PARLOAD)
@@ -81,6 +283,29 @@ func (app *Server) getChannelId(payload *Auth.TokenPayload) (unifiedMessage bool
 	return false, app.config.Id
 }
 
+// parsePublicKey validates the SPKI public key in the request body and returns the session data
+// describing it. It writes the error response itself and returns nil on failure.
+func parsePublicKey(c *gin.Context, clientId string) *SessionData {
+	bodyBytes, err := c.GetRawData()
+	if err != nil {
+		Error(c, http.StatusBadRequest, "Failed to read request body")
+		return nil
+	}
+
+	publicKey, err := PublicKey.Parse(string(bodyBytes))
+	if err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid public key: %v", err))
+		return nil
+	}
+
+	return &SessionData{
+		ClientId:     clientId,
+		PublicKey:    string(bodyBytes),
+		Fingerprint:  publicKey.Fingerprint(),
+		SafetyNumber: publicKey.SafetyNumber(),
+	}
+}
+
 func (app *Server) postPublicKey(c *gin.Context) {
 	tokenPayload, err := getPlayload(c)
 	if err != nil {
@@ -88,47 +313,58 @@ func (app *Server) postPublicKey(c *gin.Context) {
 		return
 	}
 
-	bodyBytes, err := c.GetRawData()
-	if err != nil {
-		Error(c, http.StatusBadRequest, "Failed to read request body")
+	var options LinkCodes.Options
+	if err := c.ShouldBindQuery(&options); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid link code options: %v", err))
 		return
 	}
 
-	linkCode, err := app.generateUniqueLinkCode()
+	duration, maxUses, err := app.linkCodeLimits.Resolve(options)
 	if err != nil {
-		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to generate a unique link code: %v", err))
+		Error(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	expiresAt := time.Now().Add(LINK_CODE_DURATION).Unix()
+	session := parsePublicKey(c, tokenPayload.UserId)
+	if session == nil {
+		return
+	}
 
-	session := SessionData{
-		ClientId:  tokenPayload.UserId,
-		PublicKey: string(bodyBytes),
+	expiresAt := time.Now().Add(duration).Unix()
+
+	envelope, err := app.keyring.Seal(tokenPayload.Iss, tokenPayload.UserId, session)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to sign session data: %v", err))
+		return
 	}
 
-	sessionBytes, err := json.Marshal(session)
+	sessionBytes, err := json.Marshal(envelope)
 	if err != nil {
 		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to marshal session data: %v", err))
 		return
 	}
 
 	clientSession := Storage.ClientSession{
-		LinkCode:     linkCode,
-		ClientId:     tokenPayload.UserId,
-		ChannelId:    tokenPayload.ChannelId,
-		SessionBytes: sessionBytes,
-		ExpiresAt:    expiresAt,
+		ClientId:       tokenPayload.UserId,
+		ChannelId:      tokenPayload.ChannelId,
+		SessionBytes:   sessionBytes,
+		ExpiresAt:      expiresAt,
+		TokenExpiresAt: tokenPayload.Exp,
+		RemainingUses:  maxUses,
 	}
 
-	if err := app.storage.SetClientSession(clientSession); err != nil {
-		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to store client session: %v", err))
+	linkCode, err := app.reserveClientSession(clientSession)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to reserve a unique link code: %v", err))
 		return
 	}
 
 	result := LinkCode{
-		LinkCode:  linkCode,
-		ExpiresAt: expiresAt,
+		LinkCode:     linkCode,
+		ExpiresAt:    expiresAt,
+		MaxUses:      maxUses,
+		Fingerprint:  session.Fingerprint,
+		SafetyNumber: session.SafetyNumber,
 	}
 
 	c.JSON(http.StatusOK, result)
@@ -145,41 +381,63 @@ func (app *Server) listenMessage(c *gin.Context) {
 
 	unifiedMessage, channelId := app.getChannelId(tokenPayload)
 
-	if err := app.storage.SetClientChannel(clientId, channelId); err != nil {
+	// Each listener registers separately so a second tab or device does not replace the first.
+	listenerId := uuid.New().String()
+
+	if err := app.storage.AddClientChannel(clientId, listenerId, channelId, app.clientChannelTTL); err != nil {
 		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to set client channel in storage: %v", err))
 		return
 	}
-	defer app.storage.RemoveClientChannel(clientId)
+	defer app.storage.RemoveClientChannel(clientId, listenerId, channelId)
 
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 	c.Writer.Header().Set("Cache-Control", "no-cache")
 	c.Writer.Header().Set("Connection", "keep-alive")
 
-	c.String(http.StatusOK, "event: connected")
+	c.Status(http.StatusOK)
+	c.Writer.Write(sseEvent(EVENT_CONNECTED, []byte("{}")))
 	c.Writer.Flush()
 
 	closeNotify := c.Writer.CloseNotify()
 
-	if unifiedMessage {
-		<-closeNotify
-	} else {
+	// The registry entry expires unless refreshed, so it is renewed well within its TTL.
+	heartbeat := time.NewTicker(app.clientChannelTTL / 3)
+	defer heartbeat.Stop()
 
-		messageChannnel := app.messageChannels.Add(clientId)
-		defer app.messageChannels.Del(clientId)
-		for {
-			select {
-			case <-closeNotify:
-				return
-			case message, ok := <-messageChannnel:
-				if ok {
-					c.Writer.Write(message)
-					c.Writer.Flush()
-				} else {
-					return
+	// With UnifiedMessage the events do not pass through this stream and messages stays nil.
+	var subscription *GenericChannels.Subscription[QueuedEvent]
+	var messages <-chan QueuedEvent
+
+	if !unifiedMessage {
+		subscription = app.messageChannels.Subscribe(clientId)
+		defer app.messageChannels.Unsubscribe(clientId, subscription)
+		messages = subscription.C()
+	}
+
+	for {
+		select {
+		case <-closeNotify:
+			return
+		case <-heartbeat.C:
+			if err := app.storage.AddClientChannel(clientId, listenerId, channelId, app.clientChannelTTL); err != nil {
+				log.Printf("Failed to refresh client channel of %s: %v\n", clientId, err)
+			}
+		case message, ok := <-messages:
+			if ok {
+				// Events that expired while queued are discarded unsent.
+				if message.Expired() {
+					continue
 				}
+				c.Writer.Write(message.Content)
+				c.Writer.Flush()
+			} else {
+				if subscription.Overflowed() {
+					stats := app.messageChannels.Stats()
+					log.Printf("Disconnected slow client %s, %d messages dropped in total\n", clientId, stats.Dropped)
+				}
+				return
 			}
 		}
-
 	}
 
 }
@@ -193,106 +451,62 @@ func (app *Server) getClient(c *gin.Context) {
 
 	targetLink := c.Param(PARAM_LINK_CODE)
 
+	keys := lookupKeys(c, tokenPayload)
+	if app.lookupLocked(c, keys) {
+		return
+	}
+
 	target, err := app.storage.GetClientSession(targetLink)
 	if err != nil {
+		app.lookupFailed(keys)
 		Error(c, http.StatusBadRequest, fmt.Sprintf("Failed to retrieve client session for link: %s. Error: %v", targetLink, err))
 		return
 	}
 
-	bodyBytes, err := c.GetRawData()
-	if err != nil {
-		Error(c, http.StatusBadRequest, "Failed to read request body")
+	if target.Pake {
+		Error(c, http.StatusBadRequest, "Link code requires PAKE pairing")
 		return
 	}
 
-	c.Header("Content-Type", "application/json")
-	c.Writer.Write(target.SessionBytes)
-	c.Status(http.StatusOK)
-
-	targetId := target.ClientId
-
-	data := SessionData{
-		ClientId:  tokenPayload.UserId,
-		PublicKey: string(bodyBytes),
+	blocked, err := app.storage.IsBlocked(tokenPayload.UserId, target.ClientId)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to check block state: %v", err))
+		return
+	}
+	if blocked {
+		Error(c, http.StatusForbidden, "Pairing with this client is blocked")
+		return
 	}
 
-	if app.unifiedMessageConnection != nil {
-
-		mesage := AuthMessage.Message[SessionData]{
-			Type:    MESSAGE_TYPE,
-			Content: data,
-		}
-
-		messageBytes, _ := json.Marshal(mesage)
-
-		request := &ServiceUnifiedMessage.SendMessageRequest{
-			ChannelId: target.ChannelId,
-			ClientId:  targetId,
-			Message:   messageBytes,
-		}
-
-		if app.pulsar != nil {
-
-			requestBytes, _ := json.Marshal(request)
-			_, err := app.pulsar.SendMessage(target.ChannelId, requestBytes)
-			if err != nil {
-				Error(c, http.StatusInternalServerError, err)
-				return
-			}
+	// The joiner's key is validated before the link code is redeemed so a bad key costs no use.
+	data := parsePublicKey(c, tokenPayload.UserId)
+	if data == nil {
+		return
+	}
 
+	if err := app.storage.RedeemClientSession(*target); err != nil {
+		if errors.Is(err, LinkCodes.ErrExhausted) {
+			Error(c, http.StatusGone, "Link code has no remaining uses")
 		} else {
-
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
-			defer cancel()
-
-			_, err := app.unifiedMessageClient.SendMessage(ctx, request)
-			if err != nil {
-				Error(c, http.StatusInternalServerError, err)
-				return
-			}
-
+			Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to redeem link code: %v", err))
 		}
+		return
+	}
 
-	} else {
-
-		dataBytes, err := json.Marshal(data)
-		if err != nil {
-			Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to marshal message data: %v", err))
-			return
-		}
-
-		sessionStr := fmt.Sprintf("event: append_user\n\ndata: %s\n\n", dataBytes)
-
-		sessionBytes := []byte(sessionStr)
-
-		messageChannel := app.messageChannels.Get(targetId)
-		if messageChannel != nil {
-			messageChannel <- sessionBytes
-		} else if app.pulsar != nil {
-			channelId, err := app.storage.GetClientChannel(targetId)
-			if err != nil {
-				Error(c, http.StatusNotFound, fmt.Sprintf("Client channel not found for target ID: %s. Error: %v", targetId, err))
-				return
-			}
-
-			pulsarMessage := ForawrdMessage{
-				ClientId: targetId,
-				Content:  sessionBytes,
-			}
-
-			pulsarMessageBytes, _ := json.Marshal(pulsarMessage)
+	targetId := target.ClientId
 
-			_, err = app.pulsar.SendMessage(channelId, pulsarMessageBytes)
-			if err != nil {
-				Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to send message via Kafka for target ID: %s. Error: %v", targetId, err))
-				return
-			}
+	if err := app.storage.SetContact(tokenPayload.UserId, targetId, app.contactExpiresAt(tokenPayload.Exp, target.TokenExpiresAt)); err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to store contact: %v", err))
+		return
+	}
 
-		} else {
-			Error(c, http.StatusNotFound, "")
-			return
-		}
+	c.Header("Content-Type", "application/json")
+	c.Writer.Write(target.SessionBytes)
+	c.Status(http.StatusOK)
 
+	if status, err := app.deliver(tokenPayload, targetId, target.ChannelId, EVENT_APPEND_USER, *data); err != nil {
+		Error(c, status, deliveryError(status, err))
+		return
 	}
 
 	c.Status(http.StatusOK)
@@ -308,101 +522,46 @@ func (app *Server) postMessage(c *gin.Context) {
 		return
 	}
 
-	bodyBytes, err := io.ReadAll(c.Request.Body)
+	paired, err := app.storage.ContactExists(tokenPayload.UserId, targetId)
 	if err != nil {
-		Error(c, http.StatusBadRequest, "Failed to read request body")
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to check contact: %v", err))
 		return
 	}
-
-	data := MessageData{
-		SenderId: tokenPayload.UserId,
-		Message:  string(bodyBytes),
+	if !paired {
+		Error(c, http.StatusForbidden, "Target client is not a paired contact")
+		return
 	}
 
-	dataJson, err := json.Marshal(data)
-	if err != nil {
-		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to marshal message data: %v", err))
+	var options MessageOptions
+	if err := c.ShouldBindQuery(&options); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid message options: %v", err))
 		return
 	}
 
-	if app.unifiedMessageConnection != nil {
-
-		message := AuthMessage.Message[MessageData]{
-			Type:    MESSAGE_TYPE,
-			Content: data,
-		}
-
-		messageBytes, _ := json.Marshal(message)
-
-		channelId, err := app.storage.GetClientChannel(targetId)
-		if err != nil {
-			Error(c, http.StatusNotFound, fmt.Sprintf("Client channel not found for target ID: %s. Error: %v", targetId, err))
-			return
-		}
-
-		request := &ServiceUnifiedMessage.SendMessageRequest{
-			ChannelId: channelId,
-			ClientId:  targetId,
-			Message:   messageBytes,
-		}
-
-		if app.pulsar != nil {
-
-			requestBytes, _ := json.Marshal(request)
-
-			_, err = app.pulsar.SendMessage(channelId, requestBytes)
-			if err != nil {
-				Error(c, http.StatusInternalServerError, err)
-				return
-			}
-
-		} else {
-
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
-			defer cancel()
-
-			_, err := app.unifiedMessageClient.SendMessage(ctx, request)
-			if err != nil {
-				Error(c, http.StatusInternalServerError, err)
-				return
-			}
-
-		}
-
-	} else {
-
-		messageStr := fmt.Sprintf("event: message\n\ndata: %s\n\n", dataJson)
-		messageBytes := []byte(messageStr)
-
-		messageChannel := app.messageChannels.Get(targetId)
-		if messageChannel != nil {
-			messageChannel <- messageBytes
-		} else if app.pulsar != nil {
-
-			channelId, err := app.storage.GetClientChannel(targetId)
-			if err != nil {
-				Error(c, http.StatusNotFound, fmt.Sprintf("Client channel not found for target ID: %s. Error: %v", targetId, err))
-				return
-			}
-
-			pulsarMessage := ForawrdMessage{
-				ClientId: targetId,
-				Content:  messageBytes,
-			}
+	message := app.readMessage(c)
+	if message == nil {
+		return
+	}
 
-			pulsarMessageBytes, _ := json.Marshal(pulsarMessage)
+	var expiresAt int64
+	if options.ExpiresIn > 0 {
+		expiresAt = time.Now().Unix() + options.ExpiresIn
+	}
 
-			_, err = app.pulsar.SendMessage(channelId, pulsarMessageBytes)
-			if err != nil {
-				Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to send message via Kafka for target ID: %s. Error: %v", targetId, err))
-				return
-			}
+	data := MessageData{
+		SenderId:  tokenPayload.UserId,
+		Message:   *message,
+		ExpiresAt: expiresAt,
+	}
 
-		} else {
-			Error(c, http.StatusNotFound, "")
-			return
-		}
+	if status, err := app.deliverUntil(tokenPayload, targetId, "", EVENT_MESSAGE, data, expiresAt); err != nil {
+		Error(c, status, deliveryError(status, err))
+		return
+	}
 
+	// The message is already delivered, so a failed refresh only shortens the pairing.
+	if err := app.storage.SetContact(tokenPayload.UserId, targetId, app.contactExpiresAt(tokenPayload.Exp)); err != nil {
+		log.Printf("Failed to refresh contact of %s and %s: %v\n", tokenPayload.UserId, targetId, err)
 	}
 
 	c.Status(http.StatusOK)
@@ -430,3 +589,53 @@ func (app *Server) removeSession(c *gin.Context) {
 	app.storage.RemoveClientSession(linkCode)
 	c.Status(http.StatusOK)
 }
+
+func (app *Server) removeContact(c *gin.Context) {
+	peerId := c.Param(PARAM_USER_ID)
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if err := app.storage.RemoveContact(tokenPayload.UserId, peerId); err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to remove contact: %v", err))
+		return
+	}
+
+	if c.Query("block") == "true" {
+		if err := app.storage.SetBlock(tokenPayload.UserId, peerId); err != nil {
+			Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to block client: %v", err))
+			return
+		}
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// removeBlock lifts a block the caller placed with DELETE /contacts/:user_id?block=true.
+// The two identities have to complete a link-code exchange again to be paired.
+func (app *Server) removeBlock(c *gin.Context) {
+	peerId := c.Param(PARAM_USER_ID)
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if err := app.storage.RemoveBlock(tokenPayload.UserId, peerId); err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to unblock client: %v", err))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// getStats reports the overflow policy of the message queues and how many events they
+// queued, dropped or disconnected since the service started.
+func (app *Server) getStats(c *gin.Context) {
+	c.JSON(http.StatusOK, QueueStats{
+		Overflow: app.config.QueueOverflow,
+		Stats:    app.messageChannels.Stats(),
+	})
+}
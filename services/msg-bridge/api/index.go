@@ -3,20 +3,33 @@ package msgbridgeapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	ServiceAuth "peergrine/grpc/serviceauth"
 	ServiceUnifiedMessage "peergrine/grpc/unifiedmessage"
 	AppConfig "peergrine/msg-bridge/app-config"
 	Storage "peergrine/msg-bridge/storage"
+	AttemptLimiter "peergrine/utils/attempt-limiter"
 	Auth "peergrine/utils/auth"
+	BlobStore "peergrine/utils/blob-store"
+	Coalescer "peergrine/utils/coalescer"
+	Configurator "peergrine/utils/configurator"
+	Envelope "peergrine/utils/envelope"
 	GenericChannels "peergrine/utils/generic-channels"
+	IpPolicy "peergrine/utils/ip-policy"
+	LinkCodes "peergrine/utils/link-code"
 	Pulsar "peergrine/utils/pulsar"
+	TypedMessage "peergrine/utils/typed-message"
+	Webhook "peergrine/utils/webhook"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 const (
@@ -25,6 +38,10 @@ const (
 	TOKEN_PARLOAD   = "payload"
 )
 
+// SIGNING_KEY_TTL bounds how long the signing key of an issuer is cached before it is fetched
+// again, so a rotated issuer secret is picked up.
+const SIGNING_KEY_TTL = 10 * time.Minute
+
 type Server struct {
 	config                   *AppConfig.AppConfig
 	storage                  *Storage.Storage
@@ -32,23 +49,147 @@ type Server struct {
 	authClient               ServiceAuth.ServiceAuthClient
 	unifiedMessageConnection *grpc.ClientConn
 	unifiedMessageClient     ServiceUnifiedMessage.UnifiedMessageClient
-	messageChannels          GenericChannels.Channels[[]byte]
+	messageChannels          GenericChannels.Subscriptions[QueuedEvent]
 	pulsar                   *Pulsar.Client
 	server                   *http.Server
 	stopListenMessages       context.CancelFunc
+	contactDuration          time.Duration
+	linkCodeLimits           LinkCodes.Limits
+	lookupLimiter            *AttemptLimiter.Limiter
+	keyring                  *Envelope.Keyring
+	events                   *Coalescer.Coalescer
+	blobs                    BlobStore.Backend
+	dropLimits               dropLimits
+	stopRemoveDrops          context.CancelFunc
+	pipes                    *pipes
+	streamMaxSize            int64
+	streamWait               time.Duration
+	clientChannelTTL         time.Duration
+	webhooks                 *Webhook.Dispatcher
+	webhookPolicy            IpPolicy.Policy
+	messageTypes             TypedMessage.Registry
 }
 
 // New creates and initializes a new Server instance with configuration, storage, and Kafka client.
 // It also sets up the gRPC authentication client if the auth service address is provided.
 func New(config *AppConfig.AppConfig, storage *Storage.Storage, pulsar *Pulsar.Client) (*Server, error) {
 
+	contactDuration, err := Configurator.ParseSeconds(config.ContactDuration)
+	if err != nil || contactDuration <= 0 {
+		return nil, fmt.Errorf("invalid contact duration: %s", config.ContactDuration)
+	}
+
+	linkCodeLimits, err := LinkCodes.NewLimits(
+		config.LinkCodeLength,
+		config.LinkCodeDuration,
+		config.LinkCodeMinDuration,
+		config.LinkCodeMaxDuration,
+		config.LinkCodeMaxUses,
+		config.LinkCodeDefaultUses,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	lookupLimiter, err := AttemptLimiter.FromConfig(
+		storage.Redis,
+		"message-lookup-",
+		config.LookupMaxFailures,
+		config.LookupFailureWindow,
+		config.LookupLockout,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	eventRate, err := strconv.Atoi(config.EventRate)
+	if err != nil || eventRate <= 0 {
+		return nil, fmt.Errorf("invalid event rate: %s", config.EventRate)
+	}
+
+	eventCoalesce, err := Configurator.ParseMilliseconds(config.EventCoalesce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event coalesce interval: %s", config.EventCoalesce)
+	}
+
+	streamMaxSize, err := strconv.ParseInt(config.StreamMaxSize, 10, 64)
+	if err != nil || streamMaxSize <= 0 {
+		return nil, fmt.Errorf("invalid stream max size: %s", config.StreamMaxSize)
+	}
+
+	streamWait, err := Configurator.ParseSeconds(config.StreamWait)
+	if err != nil || streamWait <= 0 {
+		return nil, fmt.Errorf("invalid stream wait: %s", config.StreamWait)
+	}
+
+	queueSize, err := strconv.Atoi(config.QueueSize)
+	if err != nil || queueSize <= 0 {
+		return nil, fmt.Errorf("invalid queue size: %s", config.QueueSize)
+	}
+
+	queueOverflow, err := GenericChannels.ParsePolicy(config.QueueOverflow)
+	if err != nil {
+		return nil, err
+	}
+
+	clientChannelTTL, err := Configurator.ParseSeconds(config.ClientChannelTTL)
+	if err != nil || clientChannelTTL < 3*time.Second {
+		return nil, fmt.Errorf("invalid client channel TTL: %s", config.ClientChannelTTL)
+	}
+
+	webhookMaxAttempts, err := strconv.Atoi(config.WebhookMaxAttempts)
+	if err != nil || webhookMaxAttempts <= 0 {
+		return nil, fmt.Errorf("invalid webhook max attempts: %s", config.WebhookMaxAttempts)
+	}
+
+	webhookBackoff, err := Configurator.ParseMilliseconds(config.WebhookBackoff)
+	if err != nil || webhookBackoff <= 0 {
+		return nil, fmt.Errorf("invalid webhook backoff: %s", config.WebhookBackoff)
+	}
+
+	webhookTimeout, err := Configurator.ParseSeconds(config.WebhookTimeout)
+	if err != nil || webhookTimeout <= 0 {
+		return nil, fmt.Errorf("invalid webhook timeout: %s", config.WebhookTimeout)
+	}
+
+	webhookPolicy, err := IpPolicy.New(Configurator.SplitList(config.WebhookAllowedNetworks))
+	if err != nil {
+		return nil, err
+	}
+
+	blobs, dropLimits, err := newDropBackend(config)
+	if err != nil {
+		return nil, err
+	}
+
 	app := &Server{
-		config:          config,
-		storage:         storage,
-		messageChannels: GenericChannels.New[[]byte](),
-		pulsar:          pulsar,
+		config:           config,
+		storage:          storage,
+		messageChannels:  GenericChannels.NewSubscriptions[QueuedEvent](queueSize, queueOverflow),
+		pulsar:           pulsar,
+		contactDuration:  contactDuration,
+		linkCodeLimits:   linkCodeLimits,
+		lookupLimiter:    lookupLimiter,
+		events:           Coalescer.New(eventRate, eventCoalesce),
+		blobs:            blobs,
+		dropLimits:       dropLimits,
+		pipes:            newPipes(),
+		streamMaxSize:    streamMaxSize,
+		streamWait:       streamWait,
+		clientChannelTTL: clientChannelTTL,
+		webhooks:         Webhook.New(WEBHOOK_WORKERS, WEBHOOK_QUEUE_SIZE, webhookMaxAttempts, webhookBackoff, webhookTimeout, webhookPolicy),
+		webhookPolicy:    webhookPolicy,
+		messageTypes:     TypedMessage.DefaultRegistry(),
+	}
+
+	// Entries left behind by a previous run with the same APP_ID would otherwise point
+	// senders at listeners that are gone until they expire.
+	if err := storage.RemoveInstanceClientChannels(); err != nil {
+		log.Printf("Failed to remove stale client channels: %v\n", err)
 	}
 
+	app.keyring = Envelope.NewKeyring(app.fetchSigningSeed, SIGNING_KEY_TTL)
+
 	if config.AuthAddr != "" {
 
 		conn, err := grpc.NewClient(config.AuthAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -90,6 +231,14 @@ func New(config *AppConfig.AppConfig, storage *Storage.Storage, pulsar *Pulsar.C
 
 	router := gin.Default()
 
+	// Only trust client addresses forwarded by the configured proxies, so a forged
+	// X-Forwarded-For cannot sidestep the lookup lockout.
+	if err := router.SetTrustedProxies(Configurator.SplitList(config.TrustedProxies)); err != nil {
+		return nil, err
+	}
+
+	router.GET("/stats", app.getStats) // GET: Queue overflow counters for monitoring
+
 	// Define message routes with authentication middleware
 	messageRoutes := router.Group("/", app.authRequired)
 	{
@@ -98,6 +247,33 @@ func New(config *AppConfig.AppConfig, storage *Storage.Storage, pulsar *Pulsar.C
 		messageRoutes.DELETE("/session/:"+PARAM_LINK_CODE, app.removeSession) // DELETE: Remove link code
 		messageRoutes.GET("/messages", app.listenMessage)                     // GET: Establish SSE to receive messages
 		messageRoutes.POST("/messages/:"+PARAM_USER_ID, app.postMessage)      // POST: Send an encrypted message to a specific client
+		messageRoutes.POST("/events/:"+PARAM_USER_ID, app.postEvent)          // POST: Send an ephemeral typing, reaction or presence event
+		messageRoutes.POST("/contacts/:"+PARAM_USER_ID, app.postContact)      // POST: Confirm a PAKE exchange and pair with a client
+		messageRoutes.DELETE("/contacts/:"+PARAM_USER_ID, app.removeContact)  // DELETE: Unpair from (and optionally block) a client
+		messageRoutes.DELETE("/blocks/:"+PARAM_USER_ID, app.removeBlock)      // DELETE: Lift a block placed on a client
+		messageRoutes.POST("/pake", app.postPake)                             // POST: Save the first PAKE message and create a link code
+		messageRoutes.GET("/pake/:"+PARAM_LINK_CODE, app.getPake)             // GET: Retrieve the owner's PAKE message using link code
+		messageRoutes.POST("/pake/:"+PARAM_LINK_CODE, app.postPakeResponse)   // POST: Send the PAKE response and key confirmation to the owner
+		messageRoutes.POST("/streams", app.postStream)                        // POST: Open a relay stream to a paired client
+		messageRoutes.PUT("/streams/:"+PARAM_STREAM_ID, app.putStream)        // PUT: Upload the bytes of a relay stream
+		messageRoutes.GET("/streams/:"+PARAM_STREAM_ID, app.getStream)        // GET: Download the bytes of a relay stream
+		messageRoutes.PUT("/webhook", app.putWebhook)                         // PUT: Set the webhook of a bot and rotate its secret
+		messageRoutes.GET("/webhook", app.getWebhook)                         // GET: Get the webhook URL of a bot
+		messageRoutes.DELETE("/webhook", app.deleteWebhook)                   // DELETE: Remove the webhook of a bot
+	}
+
+	if app.blobs != nil {
+
+		ctx, cancel := context.WithCancel(context.Background())
+		app.stopRemoveDrops = cancel
+		go app.removeExpiredDrops(ctx)
+
+		messageRoutes.GET("/drops", app.listDrops)                     // GET: List completed drops waiting for the client
+		messageRoutes.POST("/drops", app.postDrop)                     // POST: Create a drop for a paired client or link code
+		messageRoutes.HEAD("/drops/:"+PARAM_DROP_ID, app.headDrop)     // HEAD: Get the upload offset of a drop
+		messageRoutes.PATCH("/drops/:"+PARAM_DROP_ID, app.patchDrop)   // PATCH: Upload the next chunk of a drop
+		messageRoutes.GET("/drops/:"+PARAM_DROP_ID, app.getDrop)       // GET: Download a completed drop
+		messageRoutes.DELETE("/drops/:"+PARAM_DROP_ID, app.deleteDrop) // DELETE: Remove a drop
 	}
 
 	app.server = &http.Server{
@@ -118,7 +294,14 @@ func (app *Server) Close() {
 	if app.stopListenMessages != nil {
 		app.stopListenMessages()
 	}
+	if app.stopRemoveDrops != nil {
+		app.stopRemoveDrops()
+	}
 	app.messageChannels.Close()
+	app.storage.RemoveInstanceClientChannels()
+	app.lookupLimiter.Close()
+	app.events.Close()
+	app.webhooks.Close()
 
 	if app.authConnection != nil {
 		app.authConnection.Close()
@@ -139,16 +322,44 @@ func (app *Server) listenPulsarMessages(ctx context.Context) {
 		err := json.Unmarshal(msg, &message)
 		if err == nil {
 
-			messageChannel := app.messageChannels.Get(message.ClientId)
+			// Events that expired in the topic are discarded by Publish.
+			app.messageChannels.Publish(message.ClientId, QueuedEvent{
+				Content:   message.Content,
+				ExpiresAt: message.ExpiresAt,
+			})
 
-			if messageChannel != nil {
-				messageChannel <- message.Content
-			}
+		}
 
+	}
+
+}
+
+// fetchSigningSeed obtains the envelope signing seed of an issuer from the auth service,
+// or derives it from the issuer secret in Redis when no auth service is configured.
+func (app *Server) fetchSigningSeed(iss string) ([]byte, error) {
+
+	if app.authConnection != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+		defer cancel()
+
+		ctx = metadata.AppendToOutgoingContext(ctx, Auth.SERVICE_TOKEN_METADATA, "Bearer "+app.config.ServiceToken)
+		res, err := app.authClient.GetSigningKey(ctx, &ServiceAuth.SigningKeyRequest{Iss: iss})
+		if err != nil {
+			return nil, err
 		}
+		return res.Seed, nil
+	}
+
+	if app.storage.Redis == nil {
+		return nil, errors.New("no auth service or Redis configured to obtain issuer secrets")
+	}
 
+	secret, err := app.storage.GetSecret(iss)
+	if err != nil {
+		return nil, err
 	}
 
+	return Envelope.SeedFromSecret(secret), nil
 }
 
 // Error handles errors by logging internal server errors and sending appropriate HTTP responses.
@@ -202,9 +413,13 @@ func (app *Server) authRequired(c *gin.Context) {
 				Exp:       res.Exp,
 				UserId:    res.UserId,
 				ChannelId: res.ChannelId,
+				Scope:     res.Scope,
 			}
 
-			app.storage.SetTokenCache(bearerToken, tokenPayload)
+			// Bot tokens are verified on every request, so revoking a bot takes effect immediately.
+			if tokenPayload.Scope != Auth.SCOPE_BOT {
+				app.storage.SetTokenCache(bearerToken, tokenPayload)
+			}
 
 			c.Set(TOKEN_PARLOAD, tokenPayload)
 		} else {
@@ -229,7 +444,21 @@ func (app *Server) authRequired(c *gin.Context) {
 
 			tokenPayload := Auth.Claims2TokenPayload(bearerToken, claims)
 
-			app.storage.SetTokenCache(bearerToken, tokenPayload)
+			// Bot tokens are checked against the revoked bots on every request.
+			if tokenPayload.Scope == Auth.SCOPE_BOT {
+				exists, err := app.storage.BotExists(tokenPayload.UserId)
+				if err != nil {
+					Error(c, http.StatusInternalServerError, err)
+					return
+				}
+				if !exists {
+					Error(c, http.StatusUnauthorized, "Bot has been revoked")
+					return
+				}
+			} else {
+				app.storage.SetTokenCache(bearerToken, tokenPayload)
+			}
+
 			c.Set(TOKEN_PARLOAD, tokenPayload)
 		}
 	}
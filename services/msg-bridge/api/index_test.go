@@ -0,0 +1,111 @@
+package msgbridgeapi
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	AppConfig "peergrine/msg-bridge/app-config"
+	Storage "peergrine/msg-bridge/storage"
+	ApiTest "peergrine/utils/api-test"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testServer is a msg-bridge instance on local storage that accepts cached tokens.
+type testServer struct {
+	*Server
+	*ApiTest.Client
+}
+
+// newTestServer starts a msg-bridge for a test; configure may change the default settings.
+func newTestServer(t *testing.T, configure func(config *AppConfig.AppConfig)) *testServer {
+	config := &AppConfig.AppConfig{
+		Id:                  "test-instance",
+		LinkCodeLength:      "8",
+		LinkCodeDuration:    "300",
+		LinkCodeMinDuration: "30",
+		LinkCodeMaxDuration: "3600",
+		LinkCodeMaxUses:     "0",
+		LinkCodeDefaultUses: "0",
+		LookupMaxFailures:   "10",
+		LookupFailureWindow: "60",
+		LookupLockout:       "300",
+		ContactDuration:     "7200",
+		EventRate:           "10",
+		EventCoalesce:       "500",
+		StreamMaxSize:       "1048576",
+		StreamWait:          "10",
+		QueueSize:           "64",
+		QueueOverflow:       "disconnect",
+		ClientChannelTTL:    "45",
+		WebhookMaxAttempts:  "3",
+		WebhookBackoff:      "10",
+		WebhookTimeout:      "5",
+	}
+	if configure != nil {
+		configure(config)
+	}
+
+	storage, err := Storage.New(config.Id, "")
+	require.NoError(t, err)
+
+	app, err := New(config, storage, nil)
+	require.NoError(t, err)
+	t.Cleanup(app.Close)
+
+	app.keyring = ApiTest.Keyring()
+	return &testServer{Server: app, Client: ApiTest.Start(t, app.server.Handler, storage)}
+}
+
+// pair records a contact between two clients, as a completed link-code exchange would.
+func (s *testServer) pair(t *testing.T, clientId string, peerId string) {
+	require.NoError(t, s.storage.SetContact(clientId, peerId, s.contactExpiresAt()))
+}
+
+// listen opens GET /messages for a client until the test ends and returns the events it
+// receives, skipping the connected event.
+func (s *testServer) listen(t *testing.T, token string) <-chan string {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	res := s.Request(ctx, http.MethodGet, "/messages", token, nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	events := make(chan string, 16)
+	reader := bufio.NewReader(res.Body)
+
+	// The connected event is written before the stream subscribes, so the first delivery to
+	// the client may still miss it; see deliverSoon.
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "event: "+EVENT_CONNECTED+"\n", line)
+
+	go func() {
+		defer res.Body.Close()
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if event, ok := strings.CutPrefix(line, "event: "); ok {
+				events <- strings.TrimSpace(event)
+			}
+		}
+	}()
+
+	return events
+}
+
+// deliverSoon repeats a request until the listener of its target has subscribed, and returns
+// the status of the last attempt. Attempts that find no listener deliver nothing.
+func (s *testServer) deliverSoon(t *testing.T, method string, path string, token string, body any) int {
+	status := 0
+	require.Eventually(t, func() bool {
+		status = s.Status(method, path, token, body)
+		return status != http.StatusNotFound
+	}, time.Second, 10*time.Millisecond)
+	return status
+}
@@ -0,0 +1,63 @@
+package msgbridgeapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	TypedMessage "peergrine/utils/typed-message"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MESSAGE_OVERHEAD is the room left for the JSON fields around the largest payload.
+const MESSAGE_OVERHEAD = 1024
+
+// readMessage reads the message of POST /messages/:user_id and validates it against the
+// message type registry. JSON bodies are read as a TypedMessage.Message; any other body is
+// plain chat text, as sent by clients predating typed messages.
+// It writes the error response itself and returns nil on failure.
+func (app *Server) readMessage(c *gin.Context) *TypedMessage.Message {
+	// Base64 payloads are a third larger than the limits, which apply to decoded bytes.
+	maxBody := int64(app.messageTypes.MaxSize())*4/3 + MESSAGE_OVERHEAD
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
+
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			Error(c, http.StatusRequestEntityTooLarge, "Message too large")
+		} else {
+			Error(c, http.StatusBadRequest, "Failed to read request body")
+		}
+		return nil
+	}
+
+	var message TypedMessage.Message
+	if c.ContentType() == gin.MIMEJSON {
+		if err := json.Unmarshal(bodyBytes, &message); err != nil {
+			Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid message: %v", err))
+			return nil
+		}
+	} else {
+		message = TypedMessage.Text(string(bodyBytes))
+	}
+
+	if err := app.messageTypes.Validate(&message); err != nil {
+		if errors.Is(err, TypedMessage.ErrTooLarge) {
+			Error(c, http.StatusRequestEntityTooLarge, err.Error())
+		} else {
+			Error(c, http.StatusBadRequest, err.Error())
+		}
+		return nil
+	}
+
+	return &message
+}
+
+// sseEvent serializes an event for GET /messages. The same bytes are queued for local
+// listeners and forwarded to other instances in ForawrdMessage.Content.
+func sseEvent(event string, data []byte) []byte {
+	return []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", event, data))
+}
@@ -0,0 +1,234 @@
+package msgbridgeapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	Storage "peergrine/msg-bridge/storage"
+	LinkCodes "peergrine/utils/link-code"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PAKE_CONFIRMATION_WINDOW is how long the owner has to confirm an exchange after the joiner answered.
+const PAKE_CONFIRMATION_WINDOW = 2 * time.Minute
+
+// getPakeSession looks up a PAKE link code on behalf of a joiner. Unknown link codes count
+// towards the lookup lockout, and the joiner must not have blocked or been blocked by the owner.
+// It writes the error response itself and returns nil on failure.
+func (app *Server) getPakeSession(c *gin.Context, joinerId string, keys []string) *Storage.ClientSession {
+	linkCode := c.Param(PARAM_LINK_CODE)
+
+	if app.lookupLocked(c, keys) {
+		return nil
+	}
+
+	session, err := app.storage.GetClientSession(linkCode)
+	if err != nil {
+		app.lookupFailed(keys)
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Failed to retrieve client session for link: %s. Error: %v", linkCode, err))
+		return nil
+	}
+
+	if !session.Pake {
+		Error(c, http.StatusBadRequest, "Link code does not use PAKE pairing")
+		return nil
+	}
+
+	if session.ClientId == joinerId {
+		Error(c, http.StatusBadRequest, "Cannot pair with own link code")
+		return nil
+	}
+
+	blocked, err := app.storage.IsBlocked(joinerId, session.ClientId)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to check block state: %v", err))
+		return nil
+	}
+	if blocked {
+		Error(c, http.StatusForbidden, "Pairing with this client is blocked")
+		return nil
+	}
+
+	return session
+}
+
+// postPake creates a PAKE link code holding the owner's first PAKE message.
+func (app *Server) postPake(c *gin.Context) {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	var options LinkCodes.Options
+	if err := c.ShouldBindQuery(&options); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid link code options: %v", err))
+		return
+	}
+
+	duration, maxUses, err := app.linkCodeLimits.Resolve(options)
+	if err != nil {
+		Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var share PakeShare
+	if err := c.ShouldBindJSON(&share); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid PAKE message: %v", err))
+		return
+	}
+
+	expiresAt := time.Now().Add(duration).Unix()
+
+	envelope, err := app.keyring.Seal(tokenPayload.Iss, tokenPayload.UserId, PakeData{
+		ClientId: tokenPayload.UserId,
+		Message:  share.Message,
+	})
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to sign session data: %v", err))
+		return
+	}
+
+	sessionBytes, err := json.Marshal(envelope)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to marshal session data: %v", err))
+		return
+	}
+
+	clientSession := Storage.ClientSession{
+		ClientId:       tokenPayload.UserId,
+		ChannelId:      tokenPayload.ChannelId,
+		SessionBytes:   sessionBytes,
+		ExpiresAt:      expiresAt,
+		TokenExpiresAt: tokenPayload.Exp,
+		RemainingUses:  maxUses,
+		Pake:           true,
+	}
+
+	linkCode, err := app.reserveClientSession(clientSession)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to reserve a unique link code: %v", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, LinkCode{
+		LinkCode:  linkCode,
+		ExpiresAt: expiresAt,
+		MaxUses:   maxUses,
+	})
+}
+
+// getPake returns the owner's first PAKE message to a joiner without redeeming the link code.
+func (app *Server) getPake(c *gin.Context) {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	session := app.getPakeSession(c, tokenPayload.UserId, lookupKeys(c, tokenPayload))
+	if session == nil {
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", session.SessionBytes)
+}
+
+// postPakeResponse redeems a PAKE link code and relays the joiner's PAKE message and key
+// confirmation to the owner as a pake event. The pairing is only recorded once the owner
+// confirms the exchange through POST /contacts/:user_id.
+func (app *Server) postPakeResponse(c *gin.Context) {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	session := app.getPakeSession(c, tokenPayload.UserId, lookupKeys(c, tokenPayload))
+	if session == nil {
+		return
+	}
+
+	var response PakeResponse
+	if err := c.ShouldBindJSON(&response); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid PAKE response: %v", err))
+		return
+	}
+
+	if err := app.storage.RedeemClientSession(*session); err != nil {
+		if errors.Is(err, LinkCodes.ErrExhausted) {
+			Error(c, http.StatusGone, "Link code has no remaining uses")
+		} else {
+			Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to redeem link code: %v", err))
+		}
+		return
+	}
+
+	expiresAt := time.Now().Add(PAKE_CONFIRMATION_WINDOW).Unix()
+	if err := app.storage.SetPakeExchange(session.ClientId, tokenPayload.UserId, tokenPayload.Exp, expiresAt); err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to store PAKE exchange: %v", err))
+		return
+	}
+
+	data := PakeData{
+		ClientId:     tokenPayload.UserId,
+		LinkCode:     session.LinkCode,
+		Message:      response.Message,
+		Confirmation: response.Confirmation,
+	}
+
+	if status, err := app.deliver(tokenPayload, session.ClientId, session.ChannelId, EVENT_PAKE, data); err != nil {
+		Error(c, status, deliveryError(status, err))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// postContact completes a PAKE pairing: the owner of the link code, having verified the
+// joiner's key confirmation, sends its own confirmation back and the pairing is recorded.
+func (app *Server) postContact(c *gin.Context) {
+	peerId := c.Param(PARAM_USER_ID)
+
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	var confirmation PakeConfirmation
+	if err := c.ShouldBindJSON(&confirmation); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid PAKE confirmation: %v", err))
+		return
+	}
+
+	peerTokenExpiresAt, pending, err := app.storage.TakePakeExchange(tokenPayload.UserId, peerId)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to check PAKE exchange: %v", err))
+		return
+	}
+	if !pending {
+		Error(c, http.StatusNotFound, "No pending PAKE exchange with this client")
+		return
+	}
+
+	if err := app.storage.SetContact(tokenPayload.UserId, peerId, app.contactExpiresAt(tokenPayload.Exp, peerTokenExpiresAt)); err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to store contact: %v", err))
+		return
+	}
+
+	data := PakeData{
+		ClientId:     tokenPayload.UserId,
+		Confirmation: confirmation.Confirmation,
+	}
+
+	if status, err := app.deliver(tokenPayload, peerId, "", EVENT_PAKE, data); err != nil {
+		Error(c, status, deliveryError(status, err))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,299 @@
+package msgbridgeapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	Storage "peergrine/msg-bridge/storage"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const PARAM_STREAM_ID = "stream_id"
+
+var errStreamTooLarge = errors.New("upload exceeds the declared stream size")
+
+// pipe joins the upload and the download of one stream on the instance that owns it.
+// io.Pipe hands each write straight to a read, so the relay never holds more than the
+// chunk being copied and a slow recipient slows the sender down.
+type pipe struct {
+	reader      *io.PipeReader
+	writer      *io.PipeWriter
+	uploaded    chan struct{} // Closed when the uploader connects
+	downloaded  chan struct{} // Closed when the downloader connects
+	uploading   bool
+	downloading bool
+}
+
+// pipes holds the pipes of the streams owned by this instance.
+type pipes struct {
+	mux   sync.Mutex
+	pipes map[string]*pipe
+}
+
+func newPipes() *pipes {
+	return &pipes{pipes: make(map[string]*pipe)}
+}
+
+// join attaches the uploader or the downloader to the pipe of a stream, creating the pipe
+// for whichever side connects first. It reports false if that side is already attached.
+func (p *pipes) join(streamId string, upload bool) (*pipe, bool) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	current, exists := p.pipes[streamId]
+	if !exists {
+		reader, writer := io.Pipe()
+		current = &pipe{
+			reader:     reader,
+			writer:     writer,
+			uploaded:   make(chan struct{}),
+			downloaded: make(chan struct{}),
+		}
+		p.pipes[streamId] = current
+	}
+
+	if upload {
+		if current.uploading {
+			return nil, false
+		}
+		current.uploading = true
+		close(current.uploaded)
+	} else {
+		if current.downloading {
+			return nil, false
+		}
+		current.downloading = true
+		close(current.downloaded)
+	}
+
+	return current, true
+}
+
+// remove closes the pipe of a stream, failing any copy still in progress.
+func (p *pipes) remove(streamId string) {
+	p.mux.Lock()
+	current, exists := p.pipes[streamId]
+	delete(p.pipes, streamId)
+	p.mux.Unlock()
+
+	if exists {
+		current.writer.CloseWithError(io.ErrClosedPipe)
+		current.reader.CloseWithError(io.ErrClosedPipe)
+	}
+}
+
+// awaitPeer waits until the other side of the stream connects. It writes the error response
+// itself, removes the stream and returns false if the stream expires or the caller disconnects first.
+func (app *Server) awaitPeer(c *gin.Context, stream *Storage.Stream, peer <-chan struct{}) bool {
+	timer := time.NewTimer(time.Until(time.Unix(stream.ExpiresAt, 0)))
+	defer timer.Stop()
+
+	select {
+	case <-peer:
+		return true
+	case <-timer.C:
+		Error(c, http.StatusRequestTimeout, "The other side of the stream did not connect in time")
+	case <-c.Request.Context().Done():
+	}
+
+	app.pipes.remove(stream.Id)
+	app.storage.RemoveStream(stream.Id)
+	return false
+}
+
+// routeStream loads a stream for its sender or recipient. Requests for streams owned by
+// another instance are proxied to that instance, which streams the body through without
+// buffering it. It returns nil when the request was answered or forwarded.
+func (app *Server) routeStream(c *gin.Context, clientId string, sender bool) *Storage.Stream {
+	stream, err := app.storage.GetStream(c.Param(PARAM_STREAM_ID))
+	if err != nil {
+		Error(c, http.StatusNotFound, "Stream not found")
+		return nil
+	}
+
+	if (sender && stream.SenderId != clientId) || (!sender && stream.RecipientId != clientId) {
+		Error(c, http.StatusNotFound, "Stream not found")
+		return nil
+	}
+
+	if stream.OwnerId == app.config.Id {
+		return stream
+	}
+
+	if stream.OwnerAddr == "" {
+		Error(c, http.StatusServiceUnavailable, "Stream is held by an instance without an advertised address")
+		return nil
+	}
+
+	target, err := url.Parse(stream.OwnerAddr)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Invalid advertised address %s: %v", stream.OwnerAddr, err))
+		return nil
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.FlushInterval = -1
+	proxy.ServeHTTP(c.Writer, c.Request)
+	c.Abort()
+	return nil
+}
+
+// postStream opens a relay stream to a paired recipient on this instance and notifies the
+// recipient with a stream event. Both sides must connect within APP_STREAM_WAIT.
+func (app *Server) postStream(c *gin.Context) {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	var request CreateStream
+	if err := c.ShouldBindJSON(&request); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid stream: %v", err))
+		return
+	}
+
+	if request.Size > app.streamMaxSize {
+		Error(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Stream exceeds the maximum size of %d bytes", app.streamMaxSize))
+		return
+	}
+
+	paired, err := app.storage.ContactExists(tokenPayload.UserId, request.RecipientId)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to check contact: %v", err))
+		return
+	}
+	if !paired {
+		Error(c, http.StatusForbidden, "Target client is not a paired contact")
+		return
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to generate stream ID: %v", err))
+		return
+	}
+
+	stream := Storage.Stream{
+		Id:          hex.EncodeToString(idBytes),
+		SenderId:    tokenPayload.UserId,
+		RecipientId: request.RecipientId,
+		Size:        request.Size,
+		OwnerId:     app.config.Id,
+		OwnerAddr:   app.config.AdvertiseAddr,
+		ExpiresAt:   time.Now().Add(app.streamWait).Unix(),
+	}
+
+	if err := app.storage.SetStream(stream); err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to store stream: %v", err))
+		return
+	}
+
+	data := StreamData{
+		StreamId:  stream.Id,
+		SenderId:  stream.SenderId,
+		Size:      stream.Size,
+		ExpiresAt: stream.ExpiresAt,
+	}
+
+	if status, err := app.deliver(tokenPayload, stream.RecipientId, "", EVENT_STREAM, data); err != nil {
+		app.storage.RemoveStream(stream.Id)
+		Error(c, status, deliveryError(status, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, data)
+}
+
+// putStream pipes the request body to the recipient once it is downloading.
+// Exactly the declared size is relayed.
+func (app *Server) putStream(c *gin.Context) {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	stream := app.routeStream(c, tokenPayload.UserId, true)
+	if stream == nil {
+		return
+	}
+
+	if c.Request.ContentLength > stream.Size {
+		Error(c, http.StatusRequestEntityTooLarge, errStreamTooLarge.Error())
+		return
+	}
+
+	current, ok := app.pipes.join(stream.Id, true)
+	if !ok {
+		Error(c, http.StatusConflict, "Stream is already being uploaded")
+		return
+	}
+
+	if !app.awaitPeer(c, stream, current.downloaded) {
+		return
+	}
+
+	_, err = io.CopyN(current.writer, c.Request.Body, stream.Size)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		current.writer.CloseWithError(err)
+		Error(c, http.StatusGone, fmt.Sprintf("Stream was interrupted: %v", err))
+		return
+	}
+
+	if extra, _ := c.Request.Body.Read(make([]byte, 1)); extra > 0 {
+		current.writer.CloseWithError(errStreamTooLarge)
+		Error(c, http.StatusRequestEntityTooLarge, errStreamTooLarge.Error())
+		return
+	}
+
+	current.writer.Close()
+	c.Status(http.StatusOK)
+}
+
+// getStream streams the sender's upload to the recipient.
+func (app *Server) getStream(c *gin.Context) {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	stream := app.routeStream(c, tokenPayload.UserId, false)
+	if stream == nil {
+		return
+	}
+
+	current, ok := app.pipes.join(stream.Id, false)
+	if !ok {
+		Error(c, http.StatusConflict, "Stream is already being downloaded")
+		return
+	}
+
+	if !app.awaitPeer(c, stream, current.uploaded) {
+		return
+	}
+	defer app.storage.RemoveStream(stream.Id)
+	defer app.pipes.remove(stream.Id)
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Length", strconv.FormatInt(stream.Size, 10))
+	c.Status(http.StatusOK)
+
+	if _, err := io.Copy(c.Writer, current.reader); err != nil {
+		// The sender sees the failure on its next write; the recipient gets a short body.
+		current.reader.CloseWithError(err)
+	}
+}
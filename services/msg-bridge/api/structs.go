@@ -1,22 +1,157 @@
 package msgbridgeapi
 
+import (
+	"encoding/json"
+	Envelope "peergrine/utils/envelope"
+	GenericChannels "peergrine/utils/generic-channels"
+	TypedMessage "peergrine/utils/typed-message"
+	"time"
+)
+
 // LinkCode contains the link code and expiration time.
 type LinkCode struct {
 	LinkCode  string `json:"link_code"`
 	ExpiresAt int64  `json:"expires_at"`
+	MaxUses   int    `json:"max_uses"` // 0 when the link code can be redeemed until it expires
+
+	Fingerprint  string `json:"fingerprint,omitempty"`   // Hex SHA-256 of the published SPKI key, unset for PAKE link codes
+	SafetyNumber string `json:"safety_number,omitempty"` // Short digest of the same key for comparison out of band
+}
+
+// QueueStats is the response of GET /stats: the overflow policy of the message queues and what
+// happened to the events published to them since the service started.
+type QueueStats struct {
+	Overflow string                `json:"overflow"`
+	Stats    GenericChannels.Stats `json:"stats"`
 }
 
 type SessionData struct {
-	ClientId  string `json:"client_id"`
-	PublicKey string `json:"public_key"`
+	ClientId     string `json:"client_id"`
+	PublicKey    string `json:"public_key"`
+	Fingerprint  string `json:"fingerprint"`
+	SafetyNumber string `json:"safety_number"`
+}
+
+// MessageOptions are the query options of POST /messages/:user_id.
+type MessageOptions struct {
+	ExpiresIn int64 `form:"expires_in" binding:"min=0,max=604800"` // Seconds after which the message is no longer delivered, 0 for no limit, at most a week
 }
 
 type MessageData struct {
-	SenderId string `json:"sender_id"`
-	Message  string `json:"message"`
+	SenderId  string               `json:"sender_id"`
+	Message   TypedMessage.Message `json:"message"`
+	ExpiresAt int64                `json:"expires_at,omitempty"` // Receivers should delete the message at this time
 }
 
 type ForawrdMessage struct {
-	ClientId string `json:"client_id"`
-	Content  []byte `json:"content"`
+	ClientId  string `json:"client_id"`
+	Content   []byte `json:"content"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+// QueuedEvent is an SSE event waiting in the queue of a GET /messages stream.
+type QueuedEvent struct {
+	Content   []byte
+	ExpiresAt int64 // Unix seconds after which the event is dropped, 0 when it never expires
+}
+
+// Expired reports whether the event is past its deadline.
+func (e QueuedEvent) Expired() bool {
+	return e.ExpiresAt != 0 && time.Now().Unix() >= e.ExpiresAt
+}
+
+// PakeShare is the first PAKE message of the link code owner, relayed to joiners as is.
+type PakeShare struct {
+	Message string `json:"message" binding:"required,base64,max=1024"`
+}
+
+// PakeResponse is the joiner's PAKE message along with its key confirmation.
+type PakeResponse struct {
+	Message      string `json:"message" binding:"required,base64,max=1024"`
+	Confirmation string `json:"confirmation" binding:"required,base64,max=256"`
+}
+
+// PakeConfirmation is the owner's key confirmation that completes a PAKE pairing.
+type PakeConfirmation struct {
+	Confirmation string `json:"confirmation" binding:"required,base64,max=256"`
+}
+
+// PakeData is returned by GET /pake/:link_code and sent as the content of pake events.
+// The server never interprets Message or Confirmation.
+type PakeData struct {
+	ClientId     string `json:"client_id"`
+	LinkCode     string `json:"link_code,omitempty"`
+	Message      string `json:"message,omitempty"`
+	Confirmation string `json:"confirmation,omitempty"`
+}
+
+// EphemeralEvent is a typing, reaction or presence signal posted to POST /events/:user_id.
+type EphemeralEvent struct {
+	Type string          `json:"type" binding:"required,oneof=typing stopped_typing reaction viewing"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// EphemeralData is the content of ephemeral events. It is relayed at most once and never stored.
+type EphemeralData struct {
+	SenderId string          `json:"sender_id"`
+	Type     string          `json:"type"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+// CreateDrop is the request body of POST /drops. Exactly one of RecipientId and LinkCode is set.
+type CreateDrop struct {
+	RecipientId string `json:"recipient_id"`
+	LinkCode    string `json:"link_code"`
+	Size        int64  `json:"size" binding:"required,min=1"`
+	Name        string `json:"name" binding:"max=1024"` // Client-encrypted file metadata
+}
+
+// DropInfo describes the upload state of a drop.
+type DropInfo struct {
+	DropId    string `json:"drop_id"`
+	Size      int64  `json:"size"`
+	Received  int64  `json:"received"`
+	ChunkSize int64  `json:"chunk_size"` // Largest accepted chunk in bytes
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// DropData is the content of drop events and of the entries listed by GET /drops.
+type DropData struct {
+	DropId    string `json:"drop_id"`
+	SenderId  string `json:"sender_id"`
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// CreateStream is the request body of POST /streams.
+type CreateStream struct {
+	RecipientId string `json:"recipient_id" binding:"required"`
+	Size        int64  `json:"size" binding:"required,min=1"`
+}
+
+// StreamData describes a relay stream. It is returned to the sender and sent to the
+// recipient as the content of stream events.
+type StreamData struct {
+	StreamId  string `json:"stream_id"`
+	SenderId  string `json:"sender_id"`
+	Size      int64  `json:"size"`
+	ExpiresAt int64  `json:"expires_at"` // Both sides must connect before this time
+}
+
+// WebhookConfig is the request body of PUT /webhook.
+type WebhookConfig struct {
+	Url string `json:"url" binding:"required,url,max=2048"`
+}
+
+// WebhookData describes the webhook of a bot. Secret is only set in the response of PUT /webhook.
+type WebhookData struct {
+	Url    string `json:"url"`
+	Secret string `json:"secret,omitempty"` // Base64 HMAC-SHA256 key of the X-Peergrine-Signature header
+}
+
+// WebhookEvent is the body posted to a bot's webhook.
+type WebhookEvent struct {
+	Event    string             `json:"event"`
+	Envelope *Envelope.Envelope `json:"envelope"`
 }
@@ -0,0 +1,148 @@
+package msgbridgeapi
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	Storage "peergrine/msg-bridge/storage"
+	Auth "peergrine/utils/auth"
+	Envelope "peergrine/utils/envelope"
+	Webhook "peergrine/utils/webhook"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	WEBHOOK_WORKERS    = 4    // Concurrent webhook requests per instance
+	WEBHOOK_QUEUE_SIZE = 1024 // Webhook deliveries waiting for a worker, including retries
+)
+
+// getBotPayload returns the token payload of a bot, writing a 403 response for other identities.
+func getBotPayload(c *gin.Context) *Auth.TokenPayload {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return nil
+	}
+
+	if tokenPayload.Scope != Auth.SCOPE_BOT {
+		Error(c, http.StatusForbidden, "Only bot identities can manage webhooks")
+		return nil
+	}
+
+	return tokenPayload
+}
+
+// putWebhook sets the webhook of a bot and returns a new signing secret. Setting the webhook
+// again rotates the secret.
+func (app *Server) putWebhook(c *gin.Context) {
+	tokenPayload := getBotPayload(c)
+	if tokenPayload == nil {
+		return
+	}
+
+	var config WebhookConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid webhook: %v", err))
+		return
+	}
+
+	// Internal addresses are refused here for a clear error, and again on every delivery.
+	if err := Webhook.CheckUrl(c.Request.Context(), config.Url, app.webhookPolicy); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid webhook: %v", err))
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	webhook := Storage.Webhook{
+		BotId:  tokenPayload.UserId,
+		Url:    config.Url,
+		Secret: secret,
+	}
+
+	if err := app.storage.SetWebhook(webhook); err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to store webhook: %v", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, WebhookData{
+		Url:    webhook.Url,
+		Secret: base64.StdEncoding.EncodeToString(secret),
+	})
+}
+
+// getWebhook returns the webhook URL of a bot. The secret is only returned when it is set.
+func (app *Server) getWebhook(c *gin.Context) {
+	tokenPayload := getBotPayload(c)
+	if tokenPayload == nil {
+		return
+	}
+
+	webhook, err := app.storage.GetWebhook(tokenPayload.UserId)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to retrieve webhook: %v", err))
+		return
+	}
+	if webhook == nil {
+		Error(c, http.StatusNotFound, "No webhook is set")
+		return
+	}
+
+	c.JSON(http.StatusOK, WebhookData{Url: webhook.Url})
+}
+
+// deleteWebhook removes the webhook of a bot; events addressed to it are then relayed like
+// those of any other client.
+func (app *Server) deleteWebhook(c *gin.Context) {
+	tokenPayload := getBotPayload(c)
+	if tokenPayload == nil {
+		return
+	}
+
+	if err := app.storage.RemoveWebhook(tokenPayload.UserId); err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to remove webhook: %v", err))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// deliverWebhook queues a signed event for the webhook of a bot. Delivery is retried in the
+// background, so a successful return only means the event was accepted. Ephemeral events
+// are attempted once and never retried, as they are never queued for listeners either.
+func (app *Server) deliverWebhook(webhook *Storage.Webhook, event string, envelope *Envelope.Envelope, expiresAt int64) (int, error) {
+	body, err := json.Marshal(WebhookEvent{
+		Event:    event,
+		Envelope: envelope,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Failed to marshal webhook event: %v", err)
+	}
+
+	var expires time.Time
+	if expiresAt != 0 {
+		expires = time.Unix(expiresAt, 0)
+	}
+
+	var queued bool
+	if event == EVENT_EPHEMERAL {
+		queued = app.webhooks.SendOnce(webhook.Url, webhook.Secret, body)
+	} else {
+		queued = app.webhooks.SendUntil(webhook.Url, webhook.Secret, body, expires)
+	}
+
+	if !queued {
+		return http.StatusServiceUnavailable, errors.New("Webhook queue is full")
+	}
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,118 @@
+package msgbridgeapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	AppConfig "peergrine/msg-bridge/app-config"
+	Auth "peergrine/utils/auth"
+	Webhook "peergrine/utils/webhook"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 測試只有機器人能設定 webhook，且內部位址與非 HTTP 網址會被拒絕
+func TestPutWebhook(t *testing.T) {
+	app := newTestServer(t, nil)
+	client := app.Login("client", "")
+	bot := app.Login("bot", Auth.SCOPE_BOT)
+
+	assert.Equal(t, http.StatusForbidden, app.Status(http.MethodPut, "/webhook", client, WebhookConfig{Url: "https://example.com/hook"}))
+	assert.Equal(t, http.StatusNotFound, app.Status(http.MethodGet, "/webhook", bot, nil))
+
+	for _, url := range []string{
+		"http://127.0.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.1:6379",
+		"http://[::1]/hook",
+		"ftp://example.com/hook",
+	} {
+		assert.Equal(t, http.StatusBadRequest, app.Status(http.MethodPut, "/webhook", bot, WebhookConfig{Url: url}), url)
+	}
+}
+
+// 測試傳給機器人的訊息以簽署的 webhook 請求送達
+func TestDeliverWebhook(t *testing.T) {
+	app := newTestServer(t, func(config *AppConfig.AppConfig) {
+		config.WebhookAllowedNetworks = "127.0.0.1"
+	})
+	sender := app.Login("sender", "")
+	bot := app.Login("bot", Auth.SCOPE_BOT)
+
+	type delivery struct {
+		signature string
+		body      []byte
+	}
+	deliveries := make(chan delivery, 1)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{signature: r.Header.Get(Webhook.SIGNATURE_HEADER), body: body}
+	}))
+	defer receiver.Close()
+
+	res := app.Request(context.Background(), http.MethodPut, "/webhook", bot, nil, WebhookConfig{Url: receiver.URL + "/hook"})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var webhook WebhookData
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&webhook))
+	res.Body.Close()
+
+	secret, err := base64.StdEncoding.DecodeString(webhook.Secret)
+	require.NoError(t, err)
+
+	app.pair(t, "sender", "bot")
+	require.Equal(t, http.StatusOK, app.Status(http.MethodPost, "/messages/bot", sender, []byte("hello")))
+
+	select {
+	case received := <-deliveries:
+		require.NoError(t, Webhook.Verify(secret, received.signature, received.body, time.Minute))
+
+		var event WebhookEvent
+		require.NoError(t, json.Unmarshal(received.body, &event))
+		assert.Equal(t, EVENT_MESSAGE, event.Event)
+		assert.Equal(t, "sender", event.Envelope.SenderId)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Webhook was not called")
+	}
+
+	require.Equal(t, http.StatusOK, app.Status(http.MethodDelete, "/webhook", bot, nil))
+	assert.Equal(t, http.StatusNotFound, app.Status(http.MethodGet, "/webhook", bot, nil))
+}
+
+// 測試傳給機器人的暫時事件只嘗試投遞一次，失敗也不重試
+func TestDeliverEphemeralWebhook(t *testing.T) {
+	app := newTestServer(t, func(config *AppConfig.AppConfig) {
+		config.WebhookAllowedNetworks = "127.0.0.1"
+		config.WebhookBackoff = "10"
+		config.EventCoalesce = "10"
+	})
+	sender := app.Login("sender", "")
+	bot := app.Login("bot", Auth.SCOPE_BOT)
+
+	var attempts atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	require.Equal(t, http.StatusOK, app.Status(http.MethodPut, "/webhook", bot, WebhookConfig{Url: receiver.URL + "/hook"}))
+
+	app.pair(t, "sender", "bot")
+	require.Equal(t, http.StatusAccepted, app.Status(http.MethodPost, "/events/bot", sender, EphemeralEvent{Type: "typing"}))
+
+	require.Eventually(t, func() bool {
+		return attempts.Load() > 0
+	}, time.Second, 10*time.Millisecond)
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, int32(1), attempts.Load(), "Ephemeral events should not be retried")
+}
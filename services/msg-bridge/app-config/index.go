@@ -10,23 +10,93 @@ import (
 )
 
 const (
-	_DEFAULT_ADDRESS              = ":80"
-	_DEFAULT_AUTHORIZE_ADDRESS    = "" // auth:50051
-	_DEFAULT_REDIS_ADDRESS        = "" // redis:6379
-	_DEFAULT_PULSAR_ADDRESSES     = "" // pulsar://pulsar-broker:6650
-	_DEFAULT_PULSAR_TOPIC         = "MsgBridge"
-	_DEFAULT_UNIFIED_MESSAGE_ADDR = ""
-	_DEFAULT_ZK_CONFIG_PATH       = "/msg-bridge"
+	_DEFAULT_ADDRESS                  = ":80"
+	_DEFAULT_AUTHORIZE_ADDRESS        = "" // auth:50051
+	_DEFAULT_SERVICE_TOKEN            = ""
+	_DEFAULT_REDIS_ADDRESS            = "" // redis:6379
+	_DEFAULT_PULSAR_ADDRESSES         = "" // pulsar://pulsar-broker:6650
+	_DEFAULT_PULSAR_TOPIC             = "MsgBridge"
+	_DEFAULT_UNIFIED_MESSAGE_ADDR     = ""
+	_DEFAULT_LINK_CODE_LENGTH         = "8"
+	_DEFAULT_LINK_CODE_DURATION       = "300"
+	_DEFAULT_LINK_CODE_MIN_DURATION   = "30"
+	_DEFAULT_LINK_CODE_MAX_DURATION   = "3600"
+	_DEFAULT_LINK_CODE_MAX_USES       = "0"
+	_DEFAULT_LINK_CODE_DEFAULT_USES   = "0"
+	_DEFAULT_LOOKUP_MAX_FAILURES      = "10"
+	_DEFAULT_LOOKUP_FAILURE_WINDOW    = "60"
+	_DEFAULT_LOOKUP_LOCKOUT           = "300"
+	_DEFAULT_TRUSTED_PROXIES          = "" // 10.0.0.0/8,192.168.1.2
+	_DEFAULT_CONTACT_DURATION         = "7200"
+	_DEFAULT_EVENT_RATE               = "10"
+	_DEFAULT_EVENT_COALESCE           = "500"
+	_DEFAULT_DROP_BACKEND             = "" // local, s3
+	_DEFAULT_DROP_DIR                 = "/var/lib/msg-bridge/drops"
+	_DEFAULT_DROP_S3_ENDPOINT         = "" // minio:9000
+	_DEFAULT_DROP_S3_ACCESS_KEY       = ""
+	_DEFAULT_DROP_S3_SECRET_KEY       = ""
+	_DEFAULT_DROP_S3_BUCKET           = "msg-bridge-drops"
+	_DEFAULT_DROP_S3_USE_SSL          = "false"
+	_DEFAULT_DROP_DURATION            = "86400"
+	_DEFAULT_DROP_MAX_SIZE            = "104857600"
+	_DEFAULT_DROP_QUOTA               = "536870912"
+	_DEFAULT_DROP_CHUNK_SIZE          = "8388608"
+	_DEFAULT_ADVERTISE_ADDR           = "" // http://msg-bridge-0:80
+	_DEFAULT_STREAM_MAX_SIZE          = "1073741824"
+	_DEFAULT_STREAM_WAIT              = "60"
+	_DEFAULT_QUEUE_SIZE               = "64"
+	_DEFAULT_QUEUE_OVERFLOW           = "disconnect" // drop_oldest, drop_newest, disconnect
+	_DEFAULT_CLIENT_CHANNEL_TTL       = "45"
+	_DEFAULT_WEBHOOK_MAX_ATTEMPTS     = "5"
+	_DEFAULT_WEBHOOK_BACKOFF          = "1000"
+	_DEFAULT_WEBHOOK_TIMEOUT          = "10"
+	_DEFAULT_WEBHOOK_ALLOWED_NETWORKS = "" // 10.0.0.0/8,192.168.1.2
+	_DEFAULT_ZK_CONFIG_PATH           = "/msg-bridge"
 )
 
 type AppConfig struct {
-	Id                 string `json:"-" config:"APP_ID"`
-	Addr               string `json:"address" config:"APP_ADDR"`
-	AuthAddr           string `json:"auth_address" config:"APP_AUTH_ADDR"`
-	RedisAddr          string `json:"redis_address" config:"APP_REDIS_ADDR"`
-	PulsarAddrs        string `json:"pulsar_addresses" config:"APP_PULSAR_ADDRS"`
-	PulsarTopic        string `json:"pulsar_topic" config:"APP_PULSAR_TOPIC"`
-	UnifiedMessageAddr string `json:"unified_message_address" config:"APP_UNIFIED_MESSAGE_ADDR"`
+	Id                     string `json:"-" config:"APP_ID"`
+	Addr                   string `json:"address" config:"APP_ADDR"`
+	AuthAddr               string `json:"auth_address" config:"APP_AUTH_ADDR"`
+	ServiceToken           string `json:"service_token" config:"APP_SERVICE_TOKEN" mask:"true"`
+	RedisAddr              string `json:"redis_address" config:"APP_REDIS_ADDR"`
+	PulsarAddrs            string `json:"pulsar_addresses" config:"APP_PULSAR_ADDRS"`
+	PulsarTopic            string `json:"pulsar_topic" config:"APP_PULSAR_TOPIC"`
+	UnifiedMessageAddr     string `json:"unified_message_address" config:"APP_UNIFIED_MESSAGE_ADDR"`
+	LinkCodeLength         string `json:"link_code_length" config:"APP_LINK_CODE_LENGTH"`
+	LinkCodeDuration       string `json:"link_code_duration" config:"APP_LINK_CODE_DURATION"`
+	LinkCodeMinDuration    string `json:"link_code_min_duration" config:"APP_LINK_CODE_MIN_DURATION"`
+	LinkCodeMaxDuration    string `json:"link_code_max_duration" config:"APP_LINK_CODE_MAX_DURATION"`
+	LinkCodeMaxUses        string `json:"link_code_max_uses" config:"APP_LINK_CODE_MAX_USES"`
+	LinkCodeDefaultUses    string `json:"link_code_default_uses" config:"APP_LINK_CODE_DEFAULT_USES"`
+	LookupMaxFailures      string `json:"lookup_max_failures" config:"APP_LOOKUP_MAX_FAILURES"`
+	LookupFailureWindow    string `json:"lookup_failure_window" config:"APP_LOOKUP_FAILURE_WINDOW"`
+	LookupLockout          string `json:"lookup_lockout" config:"APP_LOOKUP_LOCKOUT"`
+	TrustedProxies         string `json:"trusted_proxies" config:"APP_TRUSTED_PROXIES"`
+	ContactDuration        string `json:"contact_duration" config:"APP_CONTACT_DURATION"`
+	EventRate              string `json:"event_rate" config:"APP_EVENT_RATE"`
+	EventCoalesce          string `json:"event_coalesce" config:"APP_EVENT_COALESCE"`
+	DropBackend            string `json:"drop_backend" config:"APP_DROP_BACKEND"`
+	DropDir                string `json:"drop_dir" config:"APP_DROP_DIR"`
+	DropS3Endpoint         string `json:"drop_s3_endpoint" config:"APP_DROP_S3_ENDPOINT"`
+	DropS3AccessKey        string `json:"drop_s3_access_key" config:"APP_DROP_S3_ACCESS_KEY" mask:"true"`
+	DropS3SecretKey        string `json:"drop_s3_secret_key" config:"APP_DROP_S3_SECRET_KEY" mask:"true"`
+	DropS3Bucket           string `json:"drop_s3_bucket" config:"APP_DROP_S3_BUCKET"`
+	DropS3UseSSL           string `json:"drop_s3_use_ssl" config:"APP_DROP_S3_USE_SSL"`
+	DropDuration           string `json:"drop_duration" config:"APP_DROP_DURATION"`
+	DropMaxSize            string `json:"drop_max_size" config:"APP_DROP_MAX_SIZE"`
+	DropQuota              string `json:"drop_quota" config:"APP_DROP_QUOTA"`
+	DropChunkSize          string `json:"drop_chunk_size" config:"APP_DROP_CHUNK_SIZE"`
+	AdvertiseAddr          string `json:"-" config:"APP_ADVERTISE_ADDR"`
+	StreamMaxSize          string `json:"stream_max_size" config:"APP_STREAM_MAX_SIZE"`
+	StreamWait             string `json:"stream_wait" config:"APP_STREAM_WAIT"`
+	QueueSize              string `json:"queue_size" config:"APP_QUEUE_SIZE"`
+	QueueOverflow          string `json:"queue_overflow" config:"APP_QUEUE_OVERFLOW"`
+	ClientChannelTTL       string `json:"client_channel_ttl" config:"APP_CLIENT_CHANNEL_TTL"`
+	WebhookMaxAttempts     string `json:"webhook_max_attempts" config:"APP_WEBHOOK_MAX_ATTEMPTS"`
+	WebhookBackoff         string `json:"webhook_backoff" config:"APP_WEBHOOK_BACKOFF"`
+	WebhookTimeout         string `json:"webhook_timeout" config:"APP_WEBHOOK_TIMEOUT"`
+	WebhookAllowedNetworks string `json:"webhook_allowed_networks" config:"APP_WEBHOOK_ALLOWED_NETWORKS"`
 }
 
 func Init() (*AppConfig, error) {
@@ -48,12 +118,47 @@ func Init() (*AppConfig, error) {
 	)
 
 	appConfig := &AppConfig{
-		Addr:               _DEFAULT_ADDRESS,
-		AuthAddr:           _DEFAULT_AUTHORIZE_ADDRESS,
-		RedisAddr:          _DEFAULT_REDIS_ADDRESS,
-		PulsarAddrs:        _DEFAULT_PULSAR_ADDRESSES,
-		PulsarTopic:        _DEFAULT_PULSAR_TOPIC,
-		UnifiedMessageAddr: _DEFAULT_UNIFIED_MESSAGE_ADDR,
+		Addr:                   _DEFAULT_ADDRESS,
+		AuthAddr:               _DEFAULT_AUTHORIZE_ADDRESS,
+		ServiceToken:           _DEFAULT_SERVICE_TOKEN,
+		RedisAddr:              _DEFAULT_REDIS_ADDRESS,
+		PulsarAddrs:            _DEFAULT_PULSAR_ADDRESSES,
+		PulsarTopic:            _DEFAULT_PULSAR_TOPIC,
+		UnifiedMessageAddr:     _DEFAULT_UNIFIED_MESSAGE_ADDR,
+		LinkCodeLength:         _DEFAULT_LINK_CODE_LENGTH,
+		LinkCodeDuration:       _DEFAULT_LINK_CODE_DURATION,
+		LinkCodeMinDuration:    _DEFAULT_LINK_CODE_MIN_DURATION,
+		LinkCodeMaxDuration:    _DEFAULT_LINK_CODE_MAX_DURATION,
+		LinkCodeMaxUses:        _DEFAULT_LINK_CODE_MAX_USES,
+		LinkCodeDefaultUses:    _DEFAULT_LINK_CODE_DEFAULT_USES,
+		LookupMaxFailures:      _DEFAULT_LOOKUP_MAX_FAILURES,
+		LookupFailureWindow:    _DEFAULT_LOOKUP_FAILURE_WINDOW,
+		LookupLockout:          _DEFAULT_LOOKUP_LOCKOUT,
+		TrustedProxies:         _DEFAULT_TRUSTED_PROXIES,
+		ContactDuration:        _DEFAULT_CONTACT_DURATION,
+		EventRate:              _DEFAULT_EVENT_RATE,
+		EventCoalesce:          _DEFAULT_EVENT_COALESCE,
+		DropBackend:            _DEFAULT_DROP_BACKEND,
+		DropDir:                _DEFAULT_DROP_DIR,
+		DropS3Endpoint:         _DEFAULT_DROP_S3_ENDPOINT,
+		DropS3AccessKey:        _DEFAULT_DROP_S3_ACCESS_KEY,
+		DropS3SecretKey:        _DEFAULT_DROP_S3_SECRET_KEY,
+		DropS3Bucket:           _DEFAULT_DROP_S3_BUCKET,
+		DropS3UseSSL:           _DEFAULT_DROP_S3_USE_SSL,
+		DropDuration:           _DEFAULT_DROP_DURATION,
+		DropMaxSize:            _DEFAULT_DROP_MAX_SIZE,
+		DropQuota:              _DEFAULT_DROP_QUOTA,
+		DropChunkSize:          _DEFAULT_DROP_CHUNK_SIZE,
+		AdvertiseAddr:          _DEFAULT_ADVERTISE_ADDR,
+		StreamMaxSize:          _DEFAULT_STREAM_MAX_SIZE,
+		StreamWait:             _DEFAULT_STREAM_WAIT,
+		QueueSize:              _DEFAULT_QUEUE_SIZE,
+		QueueOverflow:          _DEFAULT_QUEUE_OVERFLOW,
+		ClientChannelTTL:       _DEFAULT_CLIENT_CHANNEL_TTL,
+		WebhookMaxAttempts:     _DEFAULT_WEBHOOK_MAX_ATTEMPTS,
+		WebhookBackoff:         _DEFAULT_WEBHOOK_BACKOFF,
+		WebhookTimeout:         _DEFAULT_WEBHOOK_TIMEOUT,
+		WebhookAllowedNetworks: _DEFAULT_WEBHOOK_ALLOWED_NETWORKS,
 	}
 
 	log.Println("Reading environment configuration values...")
@@ -0,0 +1,363 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	GenericStorage "peergrine/utils/generic-storage"
+	"sync"
+	"time"
+)
+
+const (
+	REDIS_PREFIX_DROP        = "message-drop:"
+	REDIS_PREFIX_DROP_QUOTA  = "message-drop-quota:"
+	REDIS_PREFIX_DROP_INBOX  = "message-drop-inbox:"
+	REDIS_PREFIX_DROP_UPLOAD = "message-drop-upload:"
+)
+
+// ErrUploadOffset is returned when a chunk does not continue the bytes received so far.
+var ErrUploadOffset = errors.New("upload offset does not match the received bytes")
+
+// Drop describes an encrypted file uploaded for a recipient to download later.
+// The blob itself lives in the blob backend as one object per uploaded chunk.
+type Drop struct {
+	Id          string
+	SenderId    string
+	RecipientId string
+	ChannelId   string  // UnifiedMessage channel of the recipient when known at creation
+	Name        string  // Client-encrypted metadata, opaque to the server
+	Size        int64   // Declared size of the whole blob
+	Chunks      []int64 // Sizes of the uploaded chunks in order
+	Received    int64   // Sum of Chunks; the upload is complete when it equals Size
+	ExpiresAt   int64
+}
+
+func (d Drop) GetKey() string {
+	return d.Id
+}
+
+func (d Drop) GetExpiresAt() int64 {
+	return d.ExpiresAt
+}
+
+// Complete reports whether every byte of the drop has been uploaded.
+func (d Drop) Complete() bool {
+	return d.Received == d.Size
+}
+
+// quota is the number of bytes a sender holds in live drops.
+type quota struct {
+	Key       string
+	Used      int64
+	ExpiresAt int64
+}
+
+func (q quota) GetKey() string {
+	return q.Key
+}
+
+func (q quota) GetExpiresAt() int64 {
+	return q.ExpiresAt
+}
+
+// dropStore keeps drop metadata and quotas in memory when Redis is not configured.
+type dropStore struct {
+	drops     *GenericStorage.LocalStorageManager[Drop]
+	quotas    *GenericStorage.LocalStorageManager[quota]
+	quotaMux  sync.Mutex
+	inbox     map[string]map[string]int64 // Recipient ID to drop IDs and their expiry
+	inboxMux  sync.Mutex
+	uploads   map[string]time.Time // Drop ID to the end of its upload reservation
+	uploadMux sync.Mutex
+}
+
+func newDropStore() *dropStore {
+	return &dropStore{
+		drops:   GenericStorage.NewLocalStorageManager[Drop](),
+		quotas:  GenericStorage.NewLocalStorageManager[quota](),
+		inbox:   make(map[string]map[string]int64),
+		uploads: make(map[string]time.Time),
+	}
+}
+
+func (d *dropStore) Close() {
+	d.drops.Close()
+	d.quotas.Close()
+}
+
+// SetDrop stores or replaces the metadata of a drop until it expires.
+func (s *Storage) SetDrop(drop Drop) error {
+
+	if s.Redis != nil {
+		dropBytes, err := json.Marshal(drop)
+		if err != nil {
+			return err
+		}
+
+		duration := time.Until(time.Unix(drop.ExpiresAt, 0))
+		return s.Redis.Set(REDIS_PREFIX_DROP+drop.Id, dropBytes, duration)
+	}
+
+	s.drops.drops.Set(drop)
+	return nil
+}
+
+func (s *Storage) GetDrop(dropId string) (*Drop, error) {
+
+	if s.Redis != nil {
+		dropBytes, err := s.Redis.Get(REDIS_PREFIX_DROP + dropId)
+		if err != nil {
+			return nil, fmt.Errorf("drop not found: %s", dropId)
+		}
+
+		var drop Drop
+		if err := json.Unmarshal(dropBytes, &drop); err != nil {
+			return nil, err
+		}
+		return &drop, nil
+	}
+
+	drop := s.drops.drops.Get(dropId)
+	if drop == nil {
+		return nil, fmt.Errorf("drop not found: %s", dropId)
+	}
+	return drop, nil
+}
+
+func (s *Storage) RemoveDrop(dropId string) error {
+
+	if s.Redis != nil {
+		return s.Redis.Del(REDIS_PREFIX_DROP + dropId)
+	}
+
+	s.drops.drops.Remove(dropId)
+	return nil
+}
+
+// ReserveQuota adds size bytes to the drops held by clientId if the total stays within limit.
+// The counter lives until expiresAt and is extended by every reservation, so drops that expire
+// without being deleted stop counting once the sender has been idle for a whole drop lifetime.
+// It reports whether the bytes were reserved.
+func (s *Storage) ReserveQuota(clientId string, size int64, limit int64, expiresAt int64) (bool, error) {
+
+	if s.Redis != nil {
+		key := REDIS_PREFIX_DROP_QUOTA + clientId
+		duration := time.Until(time.Unix(expiresAt, 0))
+
+		used, err := s.Redis.IncrByWithExpire(key, size, duration)
+		if err != nil {
+			return false, err
+		}
+		if used > limit {
+			_, err := s.Redis.IncrByWithExpire(key, -size, duration)
+			return false, err
+		}
+		return true, nil
+	}
+
+	s.drops.quotaMux.Lock()
+	defer s.drops.quotaMux.Unlock()
+
+	current := quota{Key: clientId}
+	if existing := s.drops.quotas.Get(clientId); existing != nil {
+		current = *existing
+	}
+
+	if current.Used+size > limit {
+		return false, nil
+	}
+
+	current.Used += size
+	current.ExpiresAt = expiresAt
+	s.drops.quotas.Set(current)
+	return true, nil
+}
+
+// ReleaseQuota returns size bytes of a deleted drop to the quota of clientId.
+func (s *Storage) ReleaseQuota(clientId string, size int64) error {
+
+	if s.Redis != nil {
+		key := REDIS_PREFIX_DROP_QUOTA + clientId
+
+		used, err := s.Redis.DecrBy(key, size)
+		if err != nil {
+			return err
+		}
+		if used <= 0 {
+			return s.Redis.Del(key)
+		}
+		return nil
+	}
+
+	s.drops.quotaMux.Lock()
+	defer s.drops.quotaMux.Unlock()
+
+	s.drops.quotas.Update(clientId, func(current *quota) bool {
+		current.Used -= size
+		return current.Used > 0
+	})
+	return nil
+}
+
+// AppendDropChunk records an uploaded chunk of size bytes at offset. The drop is only updated
+// if it has still received exactly offset bytes, so of two uploads of the same chunk only one
+// is recorded; the other gets ErrUploadOffset. It returns the updated drop.
+func (s *Storage) AppendDropChunk(dropId string, offset int64, size int64) (*Drop, error) {
+
+	if s.Redis != nil {
+		key := REDIS_PREFIX_DROP + dropId
+
+		dropBytes, err := s.Redis.Get(key)
+		if err != nil {
+			return nil, fmt.Errorf("drop not found: %s", dropId)
+		}
+
+		var drop Drop
+		if err := json.Unmarshal(dropBytes, &drop); err != nil {
+			return nil, err
+		}
+		if drop.Received != offset {
+			return nil, ErrUploadOffset
+		}
+
+		drop.Chunks = append(drop.Chunks, size)
+		drop.Received += size
+
+		updatedBytes, err := json.Marshal(drop)
+		if err != nil {
+			return nil, err
+		}
+
+		swapped, err := s.Redis.CompareAndSwap(key, dropBytes, updatedBytes)
+		if err != nil {
+			return nil, err
+		}
+		if !swapped {
+			return nil, ErrUploadOffset
+		}
+		return &drop, nil
+	}
+
+	var updated Drop
+	matched := false
+
+	exists := s.drops.drops.Update(dropId, func(drop *Drop) bool {
+		if drop.Received == offset {
+			drop.Chunks = append(drop.Chunks, size)
+			drop.Received += size
+			matched = true
+		}
+		updated = *drop
+		return true
+	})
+	if !exists {
+		return nil, fmt.Errorf("drop not found: %s", dropId)
+	}
+	if !matched {
+		return nil, ErrUploadOffset
+	}
+	return &updated, nil
+}
+
+// LockDropUpload reserves the next chunk upload of a drop for up to ttl and reports whether
+// the reservation succeeded. Only one chunk of a drop is written to the blob backend at a time.
+func (s *Storage) LockDropUpload(dropId string, ttl time.Duration) (bool, error) {
+
+	if s.Redis != nil {
+		return s.Redis.SetNX(REDIS_PREFIX_DROP_UPLOAD+dropId, []byte(s.ChannelId), ttl)
+	}
+
+	s.drops.uploadMux.Lock()
+	defer s.drops.uploadMux.Unlock()
+
+	now := time.Now()
+	if lockedUntil, exists := s.drops.uploads[dropId]; exists && now.Before(lockedUntil) {
+		return false, nil
+	}
+	s.drops.uploads[dropId] = now.Add(ttl)
+	return true, nil
+}
+
+// UnlockDropUpload releases the reservation taken by LockDropUpload.
+func (s *Storage) UnlockDropUpload(dropId string) error {
+
+	if s.Redis != nil {
+		return s.Redis.Del(REDIS_PREFIX_DROP_UPLOAD + dropId)
+	}
+
+	s.drops.uploadMux.Lock()
+	defer s.drops.uploadMux.Unlock()
+
+	delete(s.drops.uploads, dropId)
+	return nil
+}
+
+// AddToInbox lists a completed drop for its recipient until expiresAt. Redis keeps the inbox of a
+// recipient in one sorted set scored by expiry, so listing it never scans the keyspace.
+func (s *Storage) AddToInbox(recipientId string, dropId string, expiresAt int64) error {
+
+	if s.Redis != nil {
+		duration := time.Until(time.Unix(expiresAt, 0))
+		return s.Redis.ZAddWithExpire(REDIS_PREFIX_DROP_INBOX+recipientId, dropId, expiresAt, duration)
+	}
+
+	s.drops.inboxMux.Lock()
+	defer s.drops.inboxMux.Unlock()
+
+	inbox, exists := s.drops.inbox[recipientId]
+	if !exists {
+		inbox = make(map[string]int64)
+		s.drops.inbox[recipientId] = inbox
+	}
+	inbox[dropId] = expiresAt
+	return nil
+}
+
+// ListInbox returns the IDs of the completed drops waiting for recipientId.
+func (s *Storage) ListInbox(recipientId string) ([]string, error) {
+
+	now := time.Now().Unix()
+
+	if s.Redis != nil {
+		key := REDIS_PREFIX_DROP_INBOX + recipientId
+
+		// A drop expiring now is already gone, so members scored up to now are removed.
+		if err := s.Redis.ZRemRangeByScore(key, now+1); err != nil {
+			return nil, err
+		}
+		return s.Redis.ZRangeByScore(key, now+1)
+	}
+
+	s.drops.inboxMux.Lock()
+	defer s.drops.inboxMux.Unlock()
+
+	dropIds := []string{}
+	for dropId, expiresAt := range s.drops.inbox[recipientId] {
+		if expiresAt <= now {
+			delete(s.drops.inbox[recipientId], dropId)
+			continue
+		}
+		dropIds = append(dropIds, dropId)
+	}
+	if len(s.drops.inbox[recipientId]) == 0 {
+		delete(s.drops.inbox, recipientId)
+	}
+	return dropIds, nil
+}
+
+func (s *Storage) RemoveFromInbox(recipientId string, dropId string) error {
+
+	if s.Redis != nil {
+		return s.Redis.ZRem(REDIS_PREFIX_DROP_INBOX+recipientId, dropId)
+	}
+
+	s.drops.inboxMux.Lock()
+	defer s.drops.inboxMux.Unlock()
+
+	delete(s.drops.inbox[recipientId], dropId)
+	if len(s.drops.inbox[recipientId]) == 0 {
+		delete(s.drops.inbox, recipientId)
+	}
+	return nil
+}
@@ -1,21 +1,45 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	GenericStorage "peergrine/utils/generic-storage"
+	LinkCodes "peergrine/utils/link-code"
+	Redis "peergrine/utils/redis"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
-	REDIS_PREFIX_LINKCODE       = "message-linkcode:"
-	REDIS_PREFIX_CLIENT_CHANNEL = "message-client-channel:"
+	REDIS_PREFIX_LINKCODE        = "message-linkcode:"
+	REDIS_PREFIX_LINKCODE_USES   = "message-linkcode-uses:"
+	REDIS_PREFIX_CLIENT_CHANNEL  = "message-client-channel:"
+	REDIS_PREFIX_CLIENT_INSTANCE = "message-client-instance:"
+	REDIS_PREFIX_CONTACT         = "message-contact:"
+	REDIS_PREFIX_BLOCK           = "message-block:"
+	REDIS_PREFIX_PAKE            = "message-pake:"
 )
 
+// _TAKE_SCRIPT deletes a key and returns the value it held, or nil if it did not exist.
+const _TAKE_SCRIPT = `
+local value = redis.call("GET", KEYS[1])
+if value then
+	redis.call("DEL", KEYS[1])
+end
+return value
+`
+
 type ClientSession struct {
-	LinkCode     string
-	ClientId     string
-	ChannelId    string
-	SessionBytes []byte
-	ExpiresAt    int64
+	LinkCode       string
+	ClientId       string
+	ChannelId      string
+	SessionBytes   []byte
+	ExpiresAt      int64
+	TokenExpiresAt int64 // Expiry of the owner's token when the link code was created
+	RemainingUses  int   // Redemptions left before the link code is deleted, 0 for unlimited
+	Pake           bool  // Set when the link code is the password of a PAKE rather than a public key lookup
 }
 
 func (m ClientSession) GetKey() string {
@@ -26,8 +50,27 @@ func (m ClientSession) GetExpiresAt() int64 {
 	return m.ExpiresAt
 }
 
+// Contact is a pairing edge between two identities, or a block placed by one identity on another.
+type Contact struct {
+	Key            string
+	ExpiresAt      int64
+	TokenExpiresAt int64 // Expiry of the joiner's token, for pending PAKE exchanges
+}
+
+func (c Contact) GetKey() string {
+	return c.Key
+}
+
+func (c Contact) GetExpiresAt() int64 {
+	return c.ExpiresAt
+}
+
 type Storage struct {
 	*GenericStorage.Storage[ClientSession]
+	contacts *GenericStorage.LocalStorageManager[Contact]
+	drops    *dropStore
+	streams  *GenericStorage.LocalStorageManager[Stream]
+	webhooks *webhookStore
 }
 
 func New(channelId string, redisAddr string) (*Storage, error) {
@@ -36,17 +79,85 @@ func New(channelId string, redisAddr string) (*Storage, error) {
 	if err != nil {
 		return nil, err
 	}
-	storage := &Storage{s}
+	storage := &Storage{
+		Storage:  s,
+		contacts: GenericStorage.NewLocalStorageManager[Contact](),
+		drops:    newDropStore(),
+		streams:  GenericStorage.NewLocalStorageManager[Stream](),
+		webhooks: newWebhookStore(),
+	}
 	return storage, nil
 }
 
-func (s *Storage) SetClientSession(session ClientSession) error {
+// Close releases the contact, drop, stream and webhook stores along with the underlying generic storage.
+func (s *Storage) Close() error {
+	s.contacts.Close()
+	s.drops.Close()
+	s.streams.Close()
+	s.webhooks.Close()
+	return s.Storage.Close()
+}
+
+// ReserveClientSession stores the session only if its link code is not taken yet.
+// In Redis the check and the write are a single SET NX, so concurrent instances cannot
+// hand out the same link code.
+// It reports whether the link code was reserved.
+func (s *Storage) ReserveClientSession(session ClientSession) (bool, error) {
+
+	if s.Redis == nil {
+		return s.Local.SetIfAbsent(session), nil
+	}
+
+	key := REDIS_PREFIX_LINKCODE + session.GetKey()
+	reserved, err := s.SetToRedisNX(key, session)
+	if err != nil || !reserved {
+		return false, err
+	}
+
+	if session.RemainingUses > 0 {
+		key := REDIS_PREFIX_LINKCODE_USES + session.GetKey()
+		duration := time.Until(time.Unix(session.ExpiresAt, 0))
+		if err := s.Redis.Set(key, []byte(strconv.Itoa(session.RemainingUses)), duration); err != nil {
+			s.Redis.Del(REDIS_PREFIX_LINKCODE + session.GetKey())
+			return false, err
+		}
+	}
 
 	s.Local.Set(session)
+	return true, nil
+}
+
+// RedeemClientSession consumes one use of a limited link code and deletes the code on its last use.
+// Returns LinkCodes.ErrExhausted if another caller already took the last use.
+func (s *Storage) RedeemClientSession(session ClientSession) error {
+
+	if session.RemainingUses <= 0 {
+		return nil
+	}
 
 	if s.Redis != nil {
-		key := REDIS_PREFIX_LINKCODE + session.GetKey()
-		return s.SetToRedis(key, session)
+		key := REDIS_PREFIX_LINKCODE_USES + session.GetKey()
+
+		remaining, err := s.Redis.Decr(key)
+		if err != nil {
+			return err
+		}
+		if remaining < 0 {
+			s.Redis.Del(key)
+			return LinkCodes.ErrExhausted
+		}
+		if remaining == 0 {
+			return s.RemoveClientSession(session.GetKey())
+		}
+		return nil
+	}
+
+	exists := s.Local.Update(session.GetKey(), func(session *ClientSession) bool {
+		session.RemainingUses--
+		return session.RemainingUses > 0
+	})
+	if !exists {
+		return LinkCodes.ErrExhausted
 	}
 
 	return nil
@@ -68,76 +179,271 @@ func (s *Storage) GetClientSession(linkCode string) (*ClientSession, error) {
 	return nil, fmt.Errorf("client session not found for link code: %s", linkCode)
 }
 
-func (s *Storage) ClientSessionExists(linkCode string) (bool, error) {
-
-	localExists := s.Local.Exists(linkCode)
+func (s *Storage) RemoveClientSession(linkCode string) error {
 
-	if localExists {
-		return localExists, nil
-	}
+	s.Local.Remove(linkCode)
 
 	if s.Redis != nil {
+		s.Redis.Del(REDIS_PREFIX_LINKCODE_USES + linkCode)
+
 		key := REDIS_PREFIX_LINKCODE + linkCode
-		return s.Redis.Exists(key)
+		return s.Redis.Del(key)
 	}
 
-	return false, nil
+	return nil
 }
 
-func (s *Storage) RemoveClientSession(linkCode string) error {
+// clientChannelMember identifies the registry entry of a listener. The owning instance comes
+// first so an instance can find its own entries after a restart.
+func (s *Storage) clientChannelMember(listenerId string, channelId string) string {
+	return s.ChannelId + ":" + listenerId + ":" + channelId
+}
 
-	s.Local.Remove(linkCode)
+// AddClientChannel records, or refreshes, that a listener of the client receives events on
+// channelId. Every listener (tab or device) has its own entry, so listeners of the same client
+// can come and go independently. The entry expires after ttl unless refreshed, so entries of
+// an instance that stopped without cleaning up do not outlive it for long.
+func (s *Storage) AddClientChannel(clientId string, listenerId string, channelId string, ttl time.Duration) error {
 
 	if s.Redis != nil {
-		key := REDIS_PREFIX_LINKCODE + linkCode
-		return s.Redis.Del(key)
+
+		now := time.Now()
+		expiresAt := now.Add(ttl).UnixMilli()
+		key := REDIS_PREFIX_CLIENT_CHANNEL + clientId
+
+		if err := s.Redis.ZAddWithExpire(key, s.clientChannelMember(listenerId, channelId), expiresAt, ttl); err != nil {
+			return err
+		}
+
+		if err := s.Redis.ZRemRangeByScore(key, now.UnixMilli()); err != nil {
+			return err
+		}
+
+		// The instance index lets RemoveInstanceClientChannels find the clients of this instance.
+		return s.Redis.ZAddWithExpire(REDIS_PREFIX_CLIENT_INSTANCE+s.ChannelId, clientId, expiresAt, ttl)
 	}
 
 	return nil
 }
 
-func (s *Storage) SetClientChannel(clientId string, channelId string) error {
+// GetClientChannels returns the distinct channels on which the client has live listeners.
+func (s *Storage) GetClientChannels(clientId string) ([]string, error) {
 
 	if s.Redis != nil {
 
 		key := REDIS_PREFIX_CLIENT_CHANNEL + clientId
 
-		content := []byte(channelId)
-		err := s.Redis.Set(key, content, 0)
+		members, err := s.Redis.ZRangeByScore(key, time.Now().UnixMilli())
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("failed to retrieve client channels for client ID: %s", clientId)
+		}
+
+		seen := make(map[string]bool, len(members))
+		channelIds := make([]string, 0, len(members))
+		for _, member := range members {
+			parts := strings.SplitN(member, ":", 3)
+			if len(parts) == 3 && !seen[parts[2]] {
+				seen[parts[2]] = true
+				channelIds = append(channelIds, parts[2])
+			}
+		}
+
+		if len(channelIds) == 0 {
+			return nil, fmt.Errorf("client channel not found for client ID: %s", clientId)
 		}
 
+		return channelIds, nil
 	}
 
-	return nil
+	return nil, fmt.Errorf("client channel not found for client ID: %s", clientId)
 }
 
-func (s *Storage) GetClientChannel(clientId string) (string, error) {
+// RemoveClientChannel removes the entry of a single listener added by AddClientChannel.
+func (s Storage) RemoveClientChannel(clientId string, listenerId string, channelId string) error {
 
 	if s.Redis != nil {
 
 		key := REDIS_PREFIX_CLIENT_CHANNEL + clientId
+		return s.Redis.ZRem(key, s.clientChannelMember(listenerId, channelId))
+
+	}
 
-		content, err := s.Redis.Get(key)
+	return nil
+}
+
+// RemoveInstanceClientChannels removes every registry entry owned by this instance, including
+// entries left behind by a previous run with the same instance ID.
+func (s *Storage) RemoveInstanceClientChannels() error {
+
+	if s.Redis == nil {
+		return nil
+	}
+
+	instanceKey := REDIS_PREFIX_CLIENT_INSTANCE + s.ChannelId
+
+	clientIds, err := s.Redis.ZRangeByScore(instanceKey, 0)
+	if err != nil {
+		return err
+	}
+
+	prefix := s.ChannelId + ":"
+
+	for _, clientId := range clientIds {
+		key := REDIS_PREFIX_CLIENT_CHANNEL + clientId
+
+		members, err := s.Redis.ZRangeByScore(key, 0)
 		if err != nil {
-			return "", fmt.Errorf("failed to retrieve client channel for client ID: %s", clientId)
+			return err
 		}
 
-		return string(content), nil
+		for _, member := range members {
+			if strings.HasPrefix(member, prefix) {
+				if err := s.Redis.ZRem(key, member); err != nil {
+					return err
+				}
+			}
+		}
 	}
 
-	return "", fmt.Errorf("client channel not found for client ID: %s", clientId)
+	return s.Redis.Del(instanceKey)
 }
 
-func (s Storage) RemoveClientChannel(clientId string) error {
+// contactKey returns the same key for both directions of a pairing edge.
+func contactKey(clientId string, peerId string) string {
+	if clientId > peerId {
+		clientId, peerId = peerId, clientId
+	}
+	return REDIS_PREFIX_CONTACT + clientId + ":" + peerId
+}
+
+// blockKey returns the key of a block placed by clientId on peerId.
+func blockKey(clientId string, peerId string) string {
+	return REDIS_PREFIX_BLOCK + clientId + ":" + peerId
+}
+
+// setEdge stores a contact or block key until expiresAt, or until it is removed when
+// expiresAt is 0. Redis is authoritative when configured so that every instance observes
+// removals immediately.
+func (s *Storage) setEdge(key string, expiresAt int64) error {
 
 	if s.Redis != nil {
+		var duration time.Duration
+		if expiresAt != 0 {
+			duration = time.Until(time.Unix(expiresAt, 0))
+		}
+		return s.Redis.Set(key, []byte(strconv.FormatInt(expiresAt, 10)), duration)
+	}
 
-		key := REDIS_PREFIX_CLIENT_CHANNEL + clientId
+	if expiresAt == 0 {
+		expiresAt = math.MaxInt64
+	}
+
+	s.contacts.Set(Contact{Key: key, ExpiresAt: expiresAt})
+	return nil
+}
+
+func (s *Storage) edgeExists(key string) (bool, error) {
+
+	if s.Redis != nil {
+		return s.Redis.Exists(key)
+	}
+
+	return s.contacts.Exists(key), nil
+}
+
+func (s *Storage) removeEdge(key string) error {
+
+	if s.Redis != nil {
 		return s.Redis.Del(key)
+	}
+
+	s.contacts.Remove(key)
+	return nil
+}
 
+// SetContact records that clientId and peerId completed a link-code exchange.
+// Calling it again for an existing pair extends the edge to the new expiresAt.
+func (s *Storage) SetContact(clientId string, peerId string, expiresAt int64) error {
+	return s.setEdge(contactKey(clientId, peerId), expiresAt)
+}
+
+// ContactExists reports whether clientId and peerId are paired.
+func (s *Storage) ContactExists(clientId string, peerId string) (bool, error) {
+	return s.edgeExists(contactKey(clientId, peerId))
+}
+
+// RemoveContact unpairs clientId and peerId in both directions.
+func (s *Storage) RemoveContact(clientId string, peerId string) error {
+	return s.removeEdge(contactKey(clientId, peerId))
+}
+
+// SetBlock prevents peerId from pairing with clientId again until clientId removes the block.
+func (s *Storage) SetBlock(clientId string, peerId string) error {
+	return s.setEdge(blockKey(clientId, peerId), 0)
+}
+
+// RemoveBlock lifts a block placed by clientId on peerId.
+func (s *Storage) RemoveBlock(clientId string, peerId string) error {
+	return s.removeEdge(blockKey(clientId, peerId))
+}
+
+// IsBlocked reports whether either identity has blocked the other.
+func (s *Storage) IsBlocked(clientId string, peerId string) (bool, error) {
+
+	blocked, err := s.edgeExists(blockKey(clientId, peerId))
+	if err != nil || blocked {
+		return blocked, err
 	}
 
+	return s.edgeExists(blockKey(peerId, clientId))
+}
+
+// pakeKey returns the key of a PAKE exchange the joiner answered and the owner has not confirmed yet.
+func pakeKey(ownerId string, joinerId string) string {
+	return REDIS_PREFIX_PAKE + ownerId + ":" + joinerId
+}
+
+// SetPakeExchange records that joinerId, holding a token that expires at tokenExpiresAt,
+// answered a PAKE link code of ownerId. The owner can confirm the exchange until expiresAt.
+func (s *Storage) SetPakeExchange(ownerId string, joinerId string, tokenExpiresAt int64, expiresAt int64) error {
+
+	key := pakeKey(ownerId, joinerId)
+
+	if s.Redis != nil {
+		return s.Redis.Set(key, []byte(strconv.FormatInt(tokenExpiresAt, 10)), time.Until(time.Unix(expiresAt, 0)))
+	}
+
+	s.contacts.Set(Contact{Key: key, ExpiresAt: expiresAt, TokenExpiresAt: tokenExpiresAt})
 	return nil
 }
+
+// TakePakeExchange removes a pending PAKE exchange and returns the expiry of the joiner's
+// token, or false if there was none. Of two concurrent confirmations only one takes the exchange.
+func (s *Storage) TakePakeExchange(ownerId string, joinerId string) (int64, bool, error) {
+
+	key := pakeKey(ownerId, joinerId)
+
+	if s.Redis != nil {
+		result, err := s.Redis.Eval(_TAKE_SCRIPT, []string{key})
+		if errors.Is(err, Redis.Nil) {
+			return 0, false, nil
+		}
+		if err != nil {
+			return 0, false, err
+		}
+
+		value, _ := result.(string)
+		tokenExpiresAt, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid PAKE exchange: %w", err)
+		}
+		return tokenExpiresAt, true, nil
+	}
+
+	var tokenExpiresAt int64
+	taken := s.contacts.Update(key, func(exchange *Contact) bool {
+		tokenExpiresAt = exchange.TokenExpiresAt
+		return false
+	})
+	return tokenExpiresAt, taken, nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const REDIS_PREFIX_STREAM = "message-stream:"
+
+// Stream is a pending relay of bytes from a sender to a recipient. Both sides must connect
+// to the instance that created the stream, which pipes the upload into the download.
+type Stream struct {
+	Id          string
+	SenderId    string
+	RecipientId string
+	Size        int64
+	OwnerId     string // ID of the instance holding the pipe
+	OwnerAddr   string // Advertised address other instances forward requests to
+	ExpiresAt   int64
+}
+
+func (s Stream) GetKey() string {
+	return s.Id
+}
+
+func (s Stream) GetExpiresAt() int64 {
+	return s.ExpiresAt
+}
+
+func (s *Storage) SetStream(stream Stream) error {
+
+	if s.Redis != nil {
+		streamBytes, err := json.Marshal(stream)
+		if err != nil {
+			return err
+		}
+
+		duration := time.Until(time.Unix(stream.ExpiresAt, 0))
+		return s.Redis.Set(REDIS_PREFIX_STREAM+stream.Id, streamBytes, duration)
+	}
+
+	s.streams.Set(stream)
+	return nil
+}
+
+func (s *Storage) GetStream(streamId string) (*Stream, error) {
+
+	if s.Redis != nil {
+		streamBytes, err := s.Redis.Get(REDIS_PREFIX_STREAM + streamId)
+		if err != nil {
+			return nil, fmt.Errorf("stream not found: %s", streamId)
+		}
+
+		var stream Stream
+		if err := json.Unmarshal(streamBytes, &stream); err != nil {
+			return nil, err
+		}
+		return &stream, nil
+	}
+
+	stream := s.streams.Get(streamId)
+	if stream == nil {
+		return nil, fmt.Errorf("stream not found: %s", streamId)
+	}
+	return stream, nil
+}
+
+func (s *Storage) RemoveStream(streamId string) error {
+
+	if s.Redis != nil {
+		return s.Redis.Del(REDIS_PREFIX_STREAM + streamId)
+	}
+
+	s.streams.Remove(streamId)
+	return nil
+}
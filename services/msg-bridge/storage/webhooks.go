@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	GenericStorage "peergrine/utils/generic-storage"
+	Redis "peergrine/utils/redis"
+	"sync"
+	"time"
+)
+
+const REDIS_PREFIX_WEBHOOK = "message-webhook:"
+
+// WEBHOOK_CACHE_TTL bounds how long an instance keeps using a webhook read from Redis, or the
+// absence of one, before reading it again. Changes made on the same instance apply at once.
+const WEBHOOK_CACHE_TTL = 30 * time.Second
+
+// Webhook is the endpoint events addressed to a bot are posted to instead of an SSE stream.
+// Webhooks do not expire; they are removed when the bot deletes them. Other instances may keep
+// delivering to the previous webhook for up to WEBHOOK_CACHE_TTL after a change.
+type Webhook struct {
+	BotId  string
+	Url    string
+	Secret []byte // HMAC key shared with the bot to sign deliveries
+}
+
+// cachedWebhook is the webhook of a client read from Redis; Webhook is nil when it has none.
+type cachedWebhook struct {
+	ClientId  string
+	Webhook   *Webhook
+	ExpiresAt int64
+}
+
+func (c cachedWebhook) GetKey() string {
+	return c.ClientId
+}
+
+func (c cachedWebhook) GetExpiresAt() int64 {
+	return c.ExpiresAt
+}
+
+// webhookStore keeps webhooks in memory when Redis is not configured, and caches the webhooks
+// read from Redis otherwise, as every delivery looks up the webhook of its target.
+type webhookStore struct {
+	mux      sync.RWMutex
+	webhooks map[string]Webhook
+	cache    *GenericStorage.LocalStorageManager[cachedWebhook]
+}
+
+func newWebhookStore() *webhookStore {
+	return &webhookStore{
+		webhooks: make(map[string]Webhook),
+		cache:    GenericStorage.NewLocalStorageManager[cachedWebhook](),
+	}
+}
+
+func (w *webhookStore) Close() {
+	w.cache.Close()
+}
+
+// remember caches the webhook of clientId, or its absence when webhook is nil.
+func (w *webhookStore) remember(clientId string, webhook *Webhook) {
+	w.cache.Set(cachedWebhook{
+		ClientId:  clientId,
+		Webhook:   webhook,
+		ExpiresAt: time.Now().Add(WEBHOOK_CACHE_TTL).Unix(),
+	})
+}
+
+// SetWebhook stores the webhook of a bot, replacing any previous one.
+func (s *Storage) SetWebhook(webhook Webhook) error {
+
+	if s.Redis != nil {
+		webhookBytes, err := json.Marshal(webhook)
+		if err != nil {
+			return err
+		}
+
+		if err := s.Redis.Set(REDIS_PREFIX_WEBHOOK+webhook.BotId, webhookBytes, 0); err != nil {
+			return err
+		}
+
+		s.webhooks.remember(webhook.BotId, &webhook)
+		return nil
+	}
+
+	s.webhooks.mux.Lock()
+	defer s.webhooks.mux.Unlock()
+
+	s.webhooks.webhooks[webhook.BotId] = webhook
+	return nil
+}
+
+// GetWebhook returns the webhook of a client, or nil without an error when the client has none.
+func (s *Storage) GetWebhook(clientId string) (*Webhook, error) {
+
+	if s.Redis != nil {
+		if cached := s.webhooks.cache.Get(clientId); cached != nil {
+			return cached.Webhook, nil
+		}
+
+		webhookBytes, err := s.Redis.Get(REDIS_PREFIX_WEBHOOK + clientId)
+		if errors.Is(err, Redis.Nil) {
+			s.webhooks.remember(clientId, nil)
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var webhook Webhook
+		if err := json.Unmarshal(webhookBytes, &webhook); err != nil {
+			return nil, err
+		}
+
+		s.webhooks.remember(clientId, &webhook)
+		return &webhook, nil
+	}
+
+	s.webhooks.mux.RLock()
+	defer s.webhooks.mux.RUnlock()
+
+	webhook, exists := s.webhooks.webhooks[clientId]
+	if !exists {
+		return nil, nil
+	}
+	return &webhook, nil
+}
+
+func (s *Storage) RemoveWebhook(botId string) error {
+
+	if s.Redis != nil {
+		if err := s.Redis.Del(REDIS_PREFIX_WEBHOOK + botId); err != nil {
+			return err
+		}
+
+		s.webhooks.remember(botId, nil)
+		return nil
+	}
+
+	s.webhooks.mux.Lock()
+	defer s.webhooks.mux.Unlock()
+
+	delete(s.webhooks.webhooks, botId)
+	return nil
+}
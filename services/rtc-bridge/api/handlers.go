@@ -1,53 +1,49 @@
 package rtcbridgeapi
 
 import (
+	"bytes"
 	"context"
-	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math/big"
+	"log"
 	"net/http"
-	"net/url"
 	ServiceUnifiedMessage "peergrine/grpc/unifiedmessage"
 	AuthMessage "peergrine/jwtissuer/client-messages"
 	Storage "peergrine/rtc-bridge/storage"
 	Auth "peergrine/utils/auth"
-	"strings"
+	Envelope "peergrine/utils/envelope"
+	GenericChannels "peergrine/utils/generic-channels"
+	LinkCodes "peergrine/utils/link-code"
+	SessionDescription "peergrine/utils/session-description"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Constants
-const LINK_CODE_LETTER_BYTES = "abcdefghijkmnopqrstuvwxyzABCDEFHJKLMNPQRSTUVWXYZ0123456789"
-const LINK_CODE_DURATION = 5 * time.Minute
-
 const MESSAGE_TYPE = "signaling"
 
-func (app *API) generateUniqueLinkCode() (string, error) {
-	const maxAttempts = 5
-	const linkCodeLength = 8
+// SIGNAL_QUEUE_SIZE bounds the answers queued for an offerer; further answers are dropped until it catches up.
+const SIGNAL_QUEUE_SIZE = 16
 
-	letterLen := len(LINK_CODE_LETTER_BYTES)
+// reserveSignal stores the signal under a newly generated link code, retrying when a code is taken.
+func (app *API) reserveSignal(signal Storage.Signal) (string, error) {
+	const maxAttempts = 5
 
 	for attempts := 0; attempts < maxAttempts; attempts++ {
-		b := make([]byte, linkCodeLength)
-		for i := range b {
-			randNum, err := rand.Int(rand.Reader, big.NewInt(int64(letterLen)))
-			if err != nil {
-				return "", err
-			}
-			b[i] = LINK_CODE_LETTER_BYTES[randNum.Int64()]
+		linkCode, err := app.linkCodeLimits.Generate()
+		if err != nil {
+			return "", err
 		}
 
-		linkCode := string(b)
+		signal.SetLinkCode(linkCode)
 
-		exist, err := app.storage.SignalExists(linkCode)
+		reserved, err := app.storage.ReserveSignal(signal)
 		if err != nil {
 			return "", err
 		}
-		if !exist {
+		if reserved {
 			return linkCode, nil
 		}
 	}
@@ -55,6 +51,34 @@ func (app *API) generateUniqueLinkCode() (string, error) {
 	return "", errors.New("failed to generate a unique link code after multiple attempts")
 }
 
+// lookupKeys returns the attempt limiter keys of the identity and address behind a link-code lookup.
+func lookupKeys(c *gin.Context, tokenPayload *Auth.TokenPayload) []string {
+	return []string{"user:" + tokenPayload.UserId, "ip:" + c.ClientIP()}
+}
+
+// lookupFailed records a failed link-code lookup against keys. The lookup has already failed,
+// so an error of the limiter is only logged.
+func (app *API) lookupFailed(keys []string) {
+	if err := app.lookupLimiter.Fail(keys...); err != nil {
+		log.Printf("Failed to record a failed link code lookup: %v\n", err)
+	}
+}
+
+// lookupLocked responds with 429 and reports true if the caller is locked out of link-code lookups.
+func (app *API) lookupLocked(c *gin.Context, keys []string) bool {
+	locked, err := app.lookupLimiter.Locked(keys...)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return true
+	}
+	if locked > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(locked.Seconds())+1))
+		Error(c, http.StatusTooManyRequests, "Too many failed link code lookups")
+		return true
+	}
+	return false
+}
+
 func getPlayload(c *gin.Context) (*Auth.TokenPayload, error) {
 
 	tokenPayloadValue, exists := c.Get(TOKEN_PARLOAD)
@@ -85,51 +109,42 @@ func (app *API) setSignal(c *gin.Context) {
 
 	clientId := tokenPayload.UserId
 
-	var signal SignalData
-
-	if err := c.ShouldBindJSON(&signal); err != nil {
-		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid JSON format: %s", err.Error()))
+	var options LinkCodes.Options
+	if err := c.ShouldBindQuery(&options); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid link code options: %s", err.Error()))
 		return
 	}
 
-	if !validSDP(signal.SDP) || !validCandidates(signal.Candidates) {
-		Error(c, http.StatusBadRequest, "Invalid SDP or Candidates")
+	duration, maxUses, err := app.linkCodeLimits.Resolve(options)
+	if err != nil {
+		Error(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	linkCode, err := app.generateUniqueLinkCode()
-	if err != nil {
-		Error(c, http.StatusInternalServerError, fmt.Sprintf("failed to generate link code: %v", err))
+	var signalOptions SignalOptions
+	if err := c.ShouldBindQuery(&signalOptions); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid signal options: %s", err.Error()))
 		return
 	}
 
-	signal.ClientId = clientId
-
-	unifiedMessage, channelId := app.getChannelId(tokenPayload)
+	var signal SignalData
 
-	signal.ChannelId = channelId
+	if err := c.ShouldBindJSON(&signal); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid JSON format: %s", err.Error()))
+		return
+	}
 
-	signalBytes, err := json.Marshal(signal)
+	result, status, err := app.createOffer(tokenPayload, &signal, duration, maxUses, signalOptions.RequireApproval)
 	if err != nil {
-		Error(c, http.StatusInternalServerError, fmt.Sprintf("failed to marshal signal: %v", err))
+		Error(c, status, err.Error())
 		return
 	}
 
-	expiresAt := time.Now().Add(LINK_CODE_DURATION).Unix()
-	clientSignal := Storage.NewSignal(clientId, linkCode, signalBytes, expiresAt)
-
-	clientSignal.SetChannelId(signal.ChannelId)
+	linkCode := result.LinkCode
+	unifiedMessage, channelId := app.getChannelId(tokenPayload)
 
-	if err := app.storage.SetSignal(clientSignal); err != nil {
-		Error(c, http.StatusInternalServerError, fmt.Sprintf("failed to store client signal: %v", err))
-		return
-	}
 	defer app.storage.RemoveSignal(linkCode)
-
-	result := LinkCode{
-		LinkCode:  linkCode,
-		ExpiresAt: expiresAt,
-	}
+	defer app.cancelJoinRequests(tokenPayload, linkCode)
 
 	resultBytes, _ := json.Marshal(result)
 
@@ -141,11 +156,19 @@ func (app *API) setSignal(c *gin.Context) {
 	c.Writer.Write(resultBytes)
 	c.Writer.Flush()
 
-	ctx, cancel := context.WithTimeout(context.Background(), LINK_CODE_DURATION)
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 
 	closeNotify := c.Writer.CloseNotify()
 
+	// Candidates trickled by answerers are addressed to the offerer rather than the link code.
+	channel := newStreamChannel(channelId, tokenPayload.Scope)
+	if err := app.storage.AddClientChannel(clientId, channel, duration); err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+	defer app.storage.RemoveClientChannel(clientId, channel)
+
 	if unifiedMessage {
 
 		select {
@@ -155,37 +178,137 @@ func (app *API) setSignal(c *gin.Context) {
 		}
 	} else {
 
-		awaitSignal := app.signalChannels.Add(linkCode)
-		defer app.signalChannels.Del(linkCode)
-
-		select {
-		case targetSignal, ok := <-awaitSignal:
-			if ok {
-				targetSignalBytes, _ := json.Marshal(targetSignal)
-				c.Writer.Write(targetSignalBytes)
-				c.Writer.Flush()
+		answers := app.signalChannels.Subscribe(linkCode)
+		defer app.signalChannels.Unsubscribe(linkCode, answers)
+
+		candidates := app.signalChannels.Subscribe(clientKey(clientId))
+		defer app.signalChannels.Unsubscribe(clientKey(clientId), candidates)
+
+		// Answerers that announced trickle ICE and have not sent their last candidates yet.
+		trickling := make(map[string]bool)
+
+		// Stream every answer until the link code runs out of uses, then the remaining candidates.
+		for received := 0; maxUses == 0 || received < maxUses || len(trickling) > 0; {
+			var event SignalEvent
+			var ok bool
+
+			select {
+			case event, ok = <-answers.C():
+				if !ok {
+					return
+				}
+				// Join requests and withdrawals are streamed without using up the link code.
+				if event.Event == EVENT_ANSWER {
+					received++
+					if event.Trickle {
+						trickling[event.SenderId] = true
+					}
+				}
+			case event, ok = <-candidates.C():
+				if !ok {
+					return
+				}
+				if event.Done {
+					delete(trickling, event.SenderId)
+				}
+			case <-ctx.Done():
+				Error(c, http.StatusRequestTimeout, "Request timed out")
+				return
+			case <-closeNotify:
+				return
 			}
-		case <-ctx.Done():
-			Error(c, http.StatusRequestTimeout, "Request timed out")
-		case <-closeNotify:
+
+			eventBytes, _ := json.Marshal(event.Envelope)
+			c.Writer.Write(eventBytes)
+			c.Writer.Flush()
 		}
 
 	}
 
 }
 
+// createOffer validates, filters and seals an offer of the token holder and stores it under
+// a new link code.
+func (app *API) createOffer(tokenPayload *Auth.TokenPayload, signal *SignalData, duration time.Duration, maxUses int, requireApproval bool) (*LinkCode, int, error) {
+
+	if err := app.validateSignal(&signal.SDP, signal.Candidates); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	app.filterSignal(tokenPayload, &signal.SDP, &signal.Candidates)
+
+	clientId := tokenPayload.UserId
+
+	signal.ClientId = clientId
+
+	_, signal.ChannelId = app.getChannelId(tokenPayload)
+
+	// 信號以發行者金鑰簽署後存放，取得信號的一方可驗證其發送者
+	envelope, err := app.keyring.Seal(tokenPayload.Iss, clientId, signal)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to sign signal: %v", err)
+	}
+
+	signalBytes, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to marshal signal: %v", err)
+	}
+
+	expiresAt := time.Now().Add(duration).Unix()
+	clientSignal := Storage.NewSignal(clientId, "", signalBytes, expiresAt)
+
+	clientSignal.SetChannelId(signal.ChannelId)
+	clientSignal.SetRemainingUses(maxUses)
+	clientSignal.SetRequireApproval(requireApproval)
+	clientSignal.SetScope(tokenPayload.Scope)
+
+	linkCode, err := app.reserveSignal(clientSignal)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to reserve link code: %v", err)
+	}
+
+	return &LinkCode{
+		LinkCode:        linkCode,
+		ExpiresAt:       expiresAt,
+		MaxUses:         maxUses,
+		RequireApproval: requireApproval,
+	}, http.StatusOK, nil
+}
+
 func (app *API) getSignal(c *gin.Context) {
 	targetLink := c.Param(PARAM_USER_LINK)
 
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	keys := lookupKeys(c, tokenPayload)
+	if app.lookupLocked(c, keys) {
+		return
+	}
+
 	client, err := app.storage.GetSignal(targetLink)
 	if err != nil {
+		app.lookupFailed(keys)
 		Error(c, http.StatusBadRequest, "Client signal not found")
 		return
 	}
 
-	c.Header("Content-Type", "application/json")
-	c.Writer.Write(client.SignalBytes)
-	c.Status(http.StatusOK)
+	// The offer was filtered for the owner's scope when stored, and is filtered for the
+	// caller's scope here.
+	var envelope *Envelope.Envelope
+	if err := json.Unmarshal(client.SignalBytes, &envelope); err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+	if envelope, err = app.filterForReceiver(envelope, tokenPayload.Scope); err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, envelope)
 }
 
 func (app *API) forwardSignal(c *gin.Context) {
@@ -197,10 +320,14 @@ func (app *API) forwardSignal(c *gin.Context) {
 		return
 	}
 
-	clientId := tokenPayload.UserId
+	keys := lookupKeys(c, tokenPayload)
+	if app.lookupLocked(c, keys) {
+		return
+	}
 
 	targetSignal, err := app.storage.GetSignal(targetLink)
 	if err != nil {
+		app.lookupFailed(keys)
 		Error(c, http.StatusBadRequest, "Target signal not found")
 		return
 	}
@@ -211,103 +338,235 @@ func (app *API) forwardSignal(c *gin.Context) {
 		return
 	}
 
-	if !validSDP(signal.SDP) || !validCandidates(signal.Candidates) {
-		Error(c, http.StatusBadRequest, "Invalid SDP or Candidates")
+	if status, err := app.answerOffer(c.Request.Context(), tokenPayload, targetSignal, &signal); err != nil {
+		Error(c, status, err.Error())
 		return
 	}
 
-	if app.unifiedMessageConnection != nil {
+	c.Status(http.StatusOK)
+}
 
-		message := &AuthMessage.Message[SignalData]{
-			Type:    MESSAGE_TYPE,
-			Content: signal,
-		}
+// answerOffer validates, filters and seals an answer of the token holder and delivers it to
+// the owner of the link code. Answers to link codes that require approval wait for the owner
+// to accept them until ctx ends.
+func (app *API) answerOffer(ctx context.Context, tokenPayload *Auth.TokenPayload, targetSignal *Storage.Signal, signal *SignalData) (int, error) {
+
+	if err := app.validateSignal(&signal.SDP, signal.Candidates); err != nil {
+		return http.StatusBadRequest, err
+	}
 
-		messageBytes, _ := json.Marshal(message)
+	app.filterSignal(tokenPayload, &signal.SDP, &signal.Candidates)
+
+	clientId := tokenPayload.UserId
 
-		request := &ServiceUnifiedMessage.SendMessageRequest{
-			ChannelId: targetSignal.ChannelId,
-			ClientId:  targetSignal.ClientId,
-			Message:   messageBytes,
+	// The answer is held until the owner accepts the join request, so a declined joiner
+	// neither reaches the owner nor uses up the link code. The owner's acceptance takes the
+	// use of an approved joiner.
+	if targetSignal.RequireApproval {
+		if status, err := app.awaitApproval(ctx, tokenPayload, targetSignal, signal.ClientName); err != nil {
+			return status, err
 		}
+	} else if err := app.storage.RedeemSignal(*targetSignal); err != nil {
+		if errors.Is(err, LinkCodes.ErrExhausted) {
+			return http.StatusGone, errors.New("Link code has no remaining uses")
+		}
+		return http.StatusInternalServerError, err
+	}
 
-		if app.pulsar != nil {
+	signal.ClientId = clientId
 
-			requestBytes, _ := json.Marshal(request)
-			_, err := app.pulsar.SendMessage(targetSignal.ChannelId, requestBytes)
-			if err != nil {
-				Error(c, http.StatusInternalServerError, err)
-				return
-			}
-		} else {
+	envelope, err := app.keyring.Seal(tokenPayload.Iss, clientId, signal)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
-			defer cancel()
+	if err := app.storage.SetPeer(clientId, targetSignal.ClientId, time.Now().Add(app.peerDuration).Unix()); err != nil {
+		return http.StatusInternalServerError, err
+	}
 
-			_, err := app.unifiedMessageClient.SendMessage(ctx, request)
-			if err != nil {
-				Error(c, http.StatusInternalServerError, err)
-				return
-			}
+	answer := SignalEvent{
+		SenderId: clientId,
+		Trickle:  signal.Trickle,
+		Envelope: envelope,
+	}
+
+	if app.unifiedMessageConnection != nil {
+
+		// The offerer's further signals reach the answerer on the channel of its token.
+		if err := app.storage.AddClientChannel(clientId, unifiedMessageChannel(tokenPayload.ChannelId, tokenPayload.Scope), app.peerDuration); err != nil {
+			return http.StatusInternalServerError, err
 		}
 
-	} else {
+	}
 
-		signalChannel := app.signalChannels.Get(targetLink)
-		if signalChannel != nil {
+	return app.sendToLinkCode(targetSignal, answer, MESSAGE_TYPE)
+}
 
-			signal.ClientId = clientId
-			signalChannel <- signal
+// sendUnifiedMessage delivers a sealed signal to a client over UnifiedMessage, through Pulsar
+// when the instances share a topic with the UnifiedMessage service.
+func (app *API) sendUnifiedMessage(channelId string, clientId string, messageType string, envelope *Envelope.Envelope) error {
 
-		} else if app.pulsar != nil {
+	message := &AuthMessage.Message[*Envelope.Envelope]{
+		Type:    messageType,
+		Content: envelope,
+	}
 
-			kafkerSignal := KafkerSignal{
-				LinkCode: targetLink,
-				Signal:   signal,
-			}
-			signalBytes, _ := json.Marshal(kafkerSignal)
+	messageBytes, _ := json.Marshal(message)
 
-			_, err := app.pulsar.SendMessage(targetSignal.ChannelId, signalBytes)
-			if err != nil {
-				Error(c, http.StatusInternalServerError, err)
-				return
-			}
+	request := &ServiceUnifiedMessage.SendMessageRequest{
+		ChannelId: channelId,
+		ClientId:  clientId,
+		Message:   messageBytes,
+	}
 
-		} else {
-			Error(c, http.StatusNotFound, "")
-			return
+	if app.pulsar != nil {
+		requestBytes, _ := json.Marshal(request)
+		_, err := app.pulsar.SendMessage(channelId, requestBytes)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+
+	_, err := app.unifiedMessageClient.SendMessage(ctx, request)
+	return err
+}
+
+// validateSDP parses the Session Description Protocol (SDP) string against the session policy
+// and strips the codecs the deployment does not offer from it in place.
+func (app *API) validateSDP(sdp *string) error {
+	stripped, err := app.sessionPolicy.Strip(*sdp)
+	if err != nil {
+		return fmt.Errorf("Invalid SDP: %w", err)
+	}
+	*sdp = stripped
+	return nil
+}
+
+// validateCandidates validates the number and syntax of WebRTC candidates. An empty
+// candidate string is the end-of-candidates marker of browsers.
+func (app *API) validateCandidates(candidates []Candidate) error {
+	if len(candidates) > app.sessionPolicy.MaxCandidates {
+		return fmt.Errorf("Invalid Candidates: more than %d candidates", app.sessionPolicy.MaxCandidates)
+	}
+
+	for i, candidate := range candidates {
+		if candidate.Candidate == nil || candidate.SdpMLineIndex == nil || candidate.SdpMid == nil {
+			return fmt.Errorf("Invalid Candidates: candidate %d needs candidate, sdpMLineIndex and sdpMid", i)
 		}
+		if *candidate.SdpMLineIndex < 0 || *candidate.SdpMLineIndex >= SessionDescription.MAX_MEDIA {
+			return fmt.Errorf("Invalid Candidates: candidate %d has sdpMLineIndex out of range", i)
+		}
+		if len(*candidate.SdpMid) > 64 {
+			return fmt.Errorf("Invalid Candidates: candidate %d has an sdpMid longer than 64 bytes", i)
+		}
+		if *candidate.Candidate == "" {
+			continue
+		}
+		if _, err := SessionDescription.ParseCandidate(*candidate.Candidate); err != nil {
+			return fmt.Errorf("Invalid Candidates: candidate %d: %w", i, err)
+		}
+	}
 
+	return nil
+}
+
+// validateSignal validates the SDP and candidates of an offer or answer.
+func (app *API) validateSignal(sdp *string, candidates []Candidate) error {
+	if err := app.validateSDP(sdp); err != nil {
+		return err
 	}
+	return app.validateCandidates(candidates)
+}
 
-	c.Status(http.StatusOK)
+// candidateFilter returns the candidate filter of the deployment, or that of the token scope
+// when one is configured.
+func (app *API) candidateFilter(tokenPayload *Auth.TokenPayload) SessionDescription.CandidateFilter {
+	if filter, ok := app.scopeFilters[tokenPayload.Scope]; ok {
+		return filter
+	}
+	return app.candidateFilters
 }
 
-// validSDP validates the Session Description Protocol (SDP) string.
-func validSDP(rawSDP string) bool {
-	sdp := strings.ReplaceAll(rawSDP, "\n", "&")
+// filterSignal removes the candidates the filter of the sender does not allow from a validated
+// SDP and candidate list, before they are stored or forwarded.
+func (app *API) filterSignal(tokenPayload *Auth.TokenPayload, sdp *string, candidates *[]Candidate) {
+	filter := app.candidateFilter(tokenPayload)
 
-	query, err := url.ParseQuery(sdp)
-	if err != nil {
-		return false
+	*sdp = filter.FilterSDP(*sdp)
+	*candidates = filterCandidates(filter, *candidates)
+}
+
+// filterCandidates returns the validated candidates the filter allows, in their filtered form.
+func filterCandidates(filter SessionDescription.CandidateFilter, candidates []Candidate) []Candidate {
+	if filter.IsZero() {
+		return candidates
 	}
 
-	for _, key := range []string{"v", "o", "s", "m", "c", "a"} {
-		if !query.Has(key) {
-			return false
+	kept := make([]Candidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		// The end-of-candidates marker carries no address.
+		if *candidate.Candidate == "" {
+			kept = append(kept, candidate)
+			continue
+		}
+
+		if filtered, ok := filter.Apply(*candidate.Candidate); ok {
+			candidate.Candidate = &filtered
+			kept = append(kept, candidate)
 		}
 	}
 
-	return true
+	return kept
 }
 
-// validCandidates validates the WebRTC candidates.
-func validCandidates(candidates []Candidate) bool {
-	for _, candidate := range candidates {
-		if candidate.Candidate == nil || candidate.SdpMLineIndex == nil || candidate.SdpMid == nil {
-			return false
+// filterForReceiver applies the candidate filters of the receiver's token scopes to a sealed
+// signal and seals the result again for the same sender, since the sender only applied its own
+// filter. The sdp and candidates fields of the payload are filtered; envelopes the filters
+// leave unchanged are returned as they are.
+func (app *API) filterForReceiver(envelope *Envelope.Envelope, scopes ...string) (*Envelope.Envelope, error) {
+	var filter SessionDescription.CandidateFilter
+	for _, scope := range scopes {
+		filter = filter.Merge(app.scopeFilters[scope])
+	}
+	if filter.IsZero() || envelope == nil {
+		return envelope, nil
+	}
+
+	var payload map[string]json.RawMessage
+	if err := envelope.Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	changed := false
+
+	var sdp string
+	if raw, ok := payload["sdp"]; ok && json.Unmarshal(raw, &sdp) == nil {
+		if filtered := filter.FilterSDP(sdp); filtered != sdp {
+			payload["sdp"], _ = json.Marshal(filtered)
+			changed = true
+		}
+	}
+
+	var candidates []Candidate
+	if raw, ok := payload["candidates"]; ok && json.Unmarshal(raw, &candidates) == nil && len(candidates) > 0 {
+		if filtered, _ := json.Marshal(filterCandidates(filter, candidates)); !bytes.Equal(filtered, raw) {
+			payload["candidates"] = filtered
+			changed = true
 		}
 	}
 
-	return true
+	if !changed {
+		return envelope, nil
+	}
+	return app.keyring.Seal(envelope.Iss, envelope.SenderId, payload)
+}
+
+// getStats reports how many signal events the signal queues queued or dropped since the
+// service started. Signal queues always drop the newest event when they are full.
+func (app *API) getStats(c *gin.Context) {
+	c.JSON(http.StatusOK, QueueStats{
+		Overflow: GenericChannels.DropNewest.String(),
+		Stats:    app.signalChannels.Stats(),
+	})
 }
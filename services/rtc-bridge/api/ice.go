@@ -0,0 +1,155 @@
+package rtcbridgeapi
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	AppConfig "peergrine/rtc-bridge/app-config"
+	TurnServer "peergrine/rtc-bridge/turn-server"
+	Auth "peergrine/utils/auth"
+	Configurator "peergrine/utils/configurator"
+	IceServers "peergrine/utils/ice-servers"
+	IpPolicy "peergrine/utils/ip-policy"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupIceServers starts the embedded STUN/TURN server if enabled and prepares the servers
+// returned by GET /ice-servers. Without configured URLs the embedded server is advertised.
+func (app *API) setupIceServers() error {
+	config := app.config
+	stunUrls, turnUrls, secret := config.StunUrls, config.TurnUrls, config.TurnSecret
+
+	if config.TurnEmbedded == "true" {
+
+		// External TURN servers cannot verify credentials signed with a secret they do not share.
+		if secret == "" && turnUrls != "" {
+			return errors.New("APP_TURN_SECRET is required with APP_TURN_URLS")
+		}
+
+		// Without a shared secret credentials are only valid on this instance, which is
+		// also the only one advertising its embedded server.
+		if secret == "" {
+			random := make([]byte, 32)
+			if _, err := rand.Read(random); err != nil {
+				return err
+			}
+			secret = base64.StdEncoding.EncodeToString(random)
+		}
+
+		turnConfig, err := turnServerConfig(config)
+		if err != nil {
+			return err
+		}
+		turnConfig.Secret = []byte(secret)
+
+		server, err := TurnServer.New(turnConfig)
+		if err != nil {
+			return err
+		}
+		app.turnServer = server
+
+		if stunUrls == "" && turnUrls == "" {
+			embeddedStun, embeddedTurn := server.URLs()
+			stunUrls = strings.Join(embeddedStun, ",")
+			turnUrls = strings.Join(embeddedTurn, ",")
+		}
+	}
+
+	iceServers, err := IceServers.NewConfig(stunUrls, turnUrls, secret, config.TurnCredentialTTL)
+	if err != nil {
+		if app.turnServer != nil {
+			app.turnServer.Close()
+		}
+		return err
+	}
+	app.iceServers = iceServers
+
+	return nil
+}
+
+// turnServerConfig parses the settings of the embedded STUN/TURN server.
+func turnServerConfig(appConfig *AppConfig.AppConfig) (TurnServer.Config, error) {
+	config := TurnServer.Config{Realm: appConfig.TurnRealm}
+	var err error
+
+	if config.PublicIP = net.ParseIP(appConfig.TurnPublicIP); config.PublicIP == nil {
+		return config, fmt.Errorf("invalid TURN public IP: %q", appConfig.TurnPublicIP)
+	}
+	if config.UDPPort, err = parsePort(appConfig.TurnUDPPort); err != nil {
+		return config, fmt.Errorf("invalid TURN UDP port: %s", appConfig.TurnUDPPort)
+	}
+	if config.TCPPort, err = parsePort(appConfig.TurnTCPPort); err != nil {
+		return config, fmt.Errorf("invalid TURN TCP port: %s", appConfig.TurnTCPPort)
+	}
+
+	minPort, err := parsePort(appConfig.TurnRelayMinPort)
+	if err != nil {
+		return config, fmt.Errorf("invalid TURN relay min port: %s", appConfig.TurnRelayMinPort)
+	}
+	maxPort, err := parsePort(appConfig.TurnRelayMaxPort)
+	if err != nil {
+		return config, fmt.Errorf("invalid TURN relay max port: %s", appConfig.TurnRelayMaxPort)
+	}
+	config.RelayMinPort, config.RelayMaxPort = uint16(minPort), uint16(maxPort)
+
+	if config.Limits.MaxAllocations, err = strconv.Atoi(appConfig.TurnMaxAllocations); err != nil || config.Limits.MaxAllocations < 0 {
+		return config, fmt.Errorf("invalid TURN max allocations: %s", appConfig.TurnMaxAllocations)
+	}
+	if config.Limits.MaxBandwidth, err = strconv.ParseInt(appConfig.TurnMaxBandwidth, 10, 64); err != nil || config.Limits.MaxBandwidth < 0 {
+		return config, fmt.Errorf("invalid TURN max bandwidth: %s", appConfig.TurnMaxBandwidth)
+	}
+	if config.PeerPolicy, err = IpPolicy.New(Configurator.SplitList(appConfig.TurnAllowedPeers)); err != nil {
+		return config, fmt.Errorf("invalid TURN allowed peers: %v", err)
+	}
+
+	return config, nil
+}
+
+// parsePort parses a port number, where 0 stands for none.
+func parsePort(str string) (int, error) {
+	port, err := strconv.ParseUint(str, 10, 16)
+	return int(port), err
+}
+
+// getIceServers returns the STUN and TURN servers for the caller. TURN credentials are
+// derived from the caller's user ID and expire after the configured TTL, so no static TURN
+// password ever reaches a client.
+func (app *API) getIceServers(c *gin.Context) {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	servers, expiresAt := app.iceServers.Servers(tokenPayload.UserId, time.Now())
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, IceServerList{
+		IceServers: servers,
+		ExpiresAt:  expiresAt.Unix(),
+		TTL:        int64(app.iceServers.TTL.Seconds()),
+	})
+}
+
+// linkIceServers advertises the STUN and TURN servers of the caller in Link headers, where
+// WHIP and WHEP clients look for them (RFC 9725).
+func (app *API) linkIceServers(c *gin.Context, tokenPayload *Auth.TokenPayload) {
+	servers, _ := app.iceServers.Servers(tokenPayload.UserId, time.Now())
+
+	for _, server := range servers {
+		for _, url := range server.URLs {
+			link := "<" + url + `>; rel="ice-server"`
+			if server.Username != "" {
+				link += fmt.Sprintf(`; username=%q; credential=%q; credential-type="password"`, server.Username, server.Credential)
+			}
+			c.Writer.Header().Add("Link", link)
+		}
+	}
+}
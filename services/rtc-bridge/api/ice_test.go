@@ -0,0 +1,18 @@
+package rtcbridgeapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 測試啟用內建 TURN 伺服器並設定外部 TURN 伺服器時，缺少共用密鑰會拒絕啟動
+func TestSetupIceServersRequiresSecret(t *testing.T) {
+	app := newTestAPI(t, nil)
+	app.config.TurnEmbedded = "true"
+	app.config.TurnUrls = "turn:turn.example.com:3478"
+	app.config.TurnSecret = ""
+
+	assert.EqualError(t, app.setupIceServers(), "APP_TURN_SECRET is required with APP_TURN_URLS")
+	assert.Nil(t, app.turnServer, "The embedded server should not be started")
+}
@@ -3,28 +3,45 @@ package rtcbridgeapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	ServiceAuth "peergrine/grpc/serviceauth"
 	ServiceUnifiedMessage "peergrine/grpc/unifiedmessage"
 	AppConfig "peergrine/rtc-bridge/app-config"
 	Storage "peergrine/rtc-bridge/storage"
+	TurnServer "peergrine/rtc-bridge/turn-server"
+	AttemptLimiter "peergrine/utils/attempt-limiter"
 	Auth "peergrine/utils/auth"
+	Configurator "peergrine/utils/configurator"
+	Envelope "peergrine/utils/envelope"
 	GenericChannels "peergrine/utils/generic-channels"
+	IceServers "peergrine/utils/ice-servers"
+	LinkCodes "peergrine/utils/link-code"
 	Pulsar "peergrine/utils/pulsar"
+	SessionDescription "peergrine/utils/session-description"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 const (
-	PARAM_USER_ID   = "user_id"   // 常數，用於上下文中的客戶端 ID 參數
-	PARAM_USER_LINK = "user_link" // 常數，用於路徑中的客戶端連結參數
-	TOKEN_PARLOAD   = "payload"
+	PARAM_USER_ID    = "user_id"    // 常數，用於上下文中的客戶端 ID 參數
+	PARAM_USER_LINK  = "user_link"  // 常數，用於路徑中的客戶端連結參數
+	PARAM_ROOM_CODE  = "room_code"  // 常數，用於路徑中的房間代碼參數
+	PARAM_SESSION_ID = "session_id" // 常數，用於路徑中的 WHIP/WHEP 會話 ID 參數
+	TOKEN_PARLOAD    = "payload"
 )
 
+// SIGNING_KEY_TTL 為快取的發行者簽名金鑰的有效期，過期後重新取得，以套用輪替的秘密字串
+const SIGNING_KEY_TTL = 10 * time.Minute
+
 type API struct {
 	config                   *AppConfig.AppConfig
 	storage                  *Storage.Storage
@@ -32,22 +49,99 @@ type API struct {
 	authClient               ServiceAuth.ServiceAuthClient
 	unifiedMessageConnection *grpc.ClientConn
 	unifiedMessageClient     ServiceUnifiedMessage.UnifiedMessageClient
-	signalChannels           GenericChannels.Channels[SignalData]
+	signalChannels           GenericChannels.Subscriptions[SignalEvent]
 	pulsar                   *Pulsar.Client
 	server                   *http.Server
 	stopListenMessages       context.CancelFunc
+	linkCodeLimits           LinkCodes.Limits
+	lookupLimiter            *AttemptLimiter.Limiter
+	keyring                  *Envelope.Keyring
+	peerDuration             time.Duration
+	roomMaxMembers           int
+	iceServers               IceServers.Config
+	turnServer               *TurnServer.Server
+	sessionPolicy            SessionDescription.Policy
+	candidateFilters         SessionDescription.CandidateFilter
+	scopeFilters             map[string]SessionDescription.CandidateFilter
+	allowedOrigins           []string
+	maxBodySize              int64
 }
 
 // New 創建新的 API 實例並設置相關的路由和中介軟體
 func New(config *AppConfig.AppConfig, storage *Storage.Storage, pulsar *Pulsar.Client) (*API, error) {
 
+	linkCodeLimits, err := LinkCodes.NewLimits(
+		config.LinkCodeLength,
+		config.LinkCodeDuration,
+		config.LinkCodeMinDuration,
+		config.LinkCodeMaxDuration,
+		config.LinkCodeMaxUses,
+		config.LinkCodeDefaultUses,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	lookupLimiter, err := AttemptLimiter.FromConfig(
+		storage.Redis,
+		"signal-lookup-",
+		config.LookupMaxFailures,
+		config.LookupFailureWindow,
+		config.LookupLockout,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	peerDuration, err := Configurator.ParseSeconds(config.PeerDuration)
+	if err != nil || peerDuration <= 0 {
+		return nil, fmt.Errorf("invalid peer duration: %s", config.PeerDuration)
+	}
+
+	roomMaxMembers, err := strconv.Atoi(config.RoomMaxMembers)
+	if err != nil || roomMaxMembers < 2 {
+		return nil, fmt.Errorf("invalid room max members: %s", config.RoomMaxMembers)
+	}
+
+	sdpMaxSize, err := strconv.Atoi(config.SdpMaxSize)
+	if err != nil || sdpMaxSize <= 0 {
+		return nil, fmt.Errorf("invalid SDP max size: %s", config.SdpMaxSize)
+	}
+
+	sessionPolicy := SessionDescription.DefaultPolicy().WithCodecs(Configurator.SplitList(config.SdpCodecs))
+	sessionPolicy.MaxSize = sdpMaxSize
+
+	candidateFilter, err := SessionDescription.ParseCandidateFilter(Configurator.SplitList(config.CandidateFilters))
+	if err != nil {
+		return nil, err
+	}
+
+	scopeFilters, err := parseScopeFilters(config.ScopeFilters, candidateFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	// 保留 JSON 跳脫字元所需的空間
+	maxBodySize := int64(2 * (sdpMaxSize + sessionPolicy.MaxCandidates*SessionDescription.MAX_CANDIDATE_LENGTH))
+
 	app := &API{
-		config:         config,
-		storage:        storage,
-		signalChannels: GenericChannels.New[SignalData](),
-		pulsar:         pulsar,
+		config:           config,
+		storage:          storage,
+		signalChannels:   GenericChannels.NewSubscriptions[SignalEvent](SIGNAL_QUEUE_SIZE, GenericChannels.DropNewest),
+		pulsar:           pulsar,
+		linkCodeLimits:   linkCodeLimits,
+		lookupLimiter:    lookupLimiter,
+		peerDuration:     peerDuration,
+		roomMaxMembers:   roomMaxMembers,
+		sessionPolicy:    sessionPolicy,
+		candidateFilters: candidateFilter,
+		scopeFilters:     scopeFilters,
+		allowedOrigins:   parseOrigins(config.AllowedOrigins),
+		maxBodySize:      maxBodySize,
 	}
 
+	app.keyring = Envelope.NewKeyring(app.fetchSigningSeed, SIGNING_KEY_TTL)
+
 	if config.AuthAddr != "" {
 
 		conn, err := grpc.NewClient(config.AuthAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -78,6 +172,10 @@ func New(config *AppConfig.AppConfig, storage *Storage.Storage, pulsar *Pulsar.C
 
 	}
 
+	if err := app.setupIceServers(); err != nil {
+		return nil, err
+	}
+
 	if pulsar != nil {
 
 		ctx, cancel := context.WithCancel(context.Background())
@@ -86,14 +184,41 @@ func New(config *AppConfig.AppConfig, storage *Storage.Storage, pulsar *Pulsar.C
 
 	}
 
-	router := gin.Default()
+	// 令牌在請求記錄前移出查詢參數，避免寫入存取日誌
+	router := gin.New()
+	router.Use(hideAccessToken, gin.Logger(), gin.Recovery())
+
+	// 只信任設定的代理伺服器轉發的客戶端位址，避免偽造 X-Forwarded-For 繞過查詢鎖定
+	if err := router.SetTrustedProxies(Configurator.SplitList(config.TrustedProxies)); err != nil {
+		return nil, err
+	}
+
+	router.GET("ws", app.serveSocket) // WebSocket 信號通道，自行驗證令牌以支援瀏覽器
+	router.GET("stats", app.getStats) // 信號佇列的統計資料，供監控使用
 
-	signalRoutes := router.Group("/", app.authRequired)
+	signalRoutes := router.Group("/", app.limitBody, app.authRequired)
 
 	{
-		signalRoutes.GET(":"+PARAM_USER_LINK, app.getSignal)      // 獲取信號
-		signalRoutes.POST(":"+PARAM_USER_LINK, app.forwardSignal) // 轉發信號
-		signalRoutes.POST("", app.setSignal)                      // 設置信號
+		signalRoutes.GET("ice-servers", app.getIceServers)                                          // 獲取 STUN/TURN 伺服器與臨時憑證
+		signalRoutes.POST("rooms", app.createRoom)                                                  // 建立房間
+		signalRoutes.GET("rooms/:"+PARAM_ROOM_CODE, app.joinRoom)                                   // 加入房間並接收房間事件
+		signalRoutes.POST("rooms/:"+PARAM_ROOM_CODE+"/members/:"+PARAM_USER_ID, app.sendRoomSignal) // 向房間成員傳送信號
+		signalRoutes.GET("signals", app.listenSignals)                                              // 接收對等端的後續信號
+		signalRoutes.POST("peers/:"+PARAM_USER_ID+"/candidates", app.sendPeerCandidates)            // 向對等端傳送候選
+		signalRoutes.POST("peers/:"+PARAM_USER_ID+"/signals", app.sendPeerSignal)                   // 向對等端傳送重新協商與結束信號
+		signalRoutes.PUT("peers/:"+PARAM_USER_ID, app.refreshPeer)                                  // 延長與對等端的通道
+		signalRoutes.DELETE("peers/:"+PARAM_USER_ID, app.endPeer)                                   // 結束與對等端的通話
+		signalRoutes.DELETE("sessions/:"+PARAM_SESSION_ID, app.endSession)                          // 結束 WHIP/WHEP 會話
+		signalRoutes.PATCH("sessions/:"+PARAM_SESSION_ID, app.patchSession)                         // WHIP/WHEP 會話不支援 trickle ICE
+		signalRoutes.POST("whip/:"+PARAM_USER_LINK, app.offerStream(STREAM_WHIP))                   // WHIP 推流，向連結碼擁有者發送 offer
+		signalRoutes.POST("whep/:"+PARAM_USER_LINK, app.offerStream(STREAM_WHEP))                   // WHEP 播放，向連結碼擁有者發送 offer
+		signalRoutes.POST("streams/:"+PARAM_USER_ID, app.answerStream)                              // 回應或拒絕 WHIP/WHEP 客戶端的 offer
+		signalRoutes.GET(":"+PARAM_USER_LINK, app.getSignal)                                        // 獲取信號
+		signalRoutes.POST(":"+PARAM_USER_LINK, app.forwardSignal)                                   // 轉發信號
+		signalRoutes.POST(":"+PARAM_USER_LINK+"/candidates", app.addLinkCodeCandidates)             // 附加候選至連結碼
+		signalRoutes.POST(":"+PARAM_USER_LINK+"/requests/:"+PARAM_USER_ID, app.decideJoinRequest)   // 接受或拒絕加入請求
+		signalRoutes.DELETE(":"+PARAM_USER_LINK, app.cancelSignal)                                  // 取消連結碼
+		signalRoutes.POST("", app.setSignal)                                                        // 設置信號
 	}
 
 	app.server = &http.Server{
@@ -113,6 +238,11 @@ func (app *API) Close() {
 		app.stopListenMessages()
 	}
 	app.signalChannels.Close()
+	app.lookupLimiter.Close()
+
+	if app.turnServer != nil {
+		app.turnServer.Close()
+	}
 
 	if app.authConnection != nil {
 		app.authConnection.Close()
@@ -135,14 +265,16 @@ func (app *API) listenPulsarMessages(ctx context.Context) {
 
 			linkCode := kafkerSignal.LinkCode
 
-			signalChannel := app.signalChannels.Get(linkCode)
-
-			if signalChannel != nil {
-				if kafkerSignal.Signal.ClientId == "" {
-					app.signalChannels.Del(linkCode)
-				} else {
-					signalChannel <- kafkerSignal.Signal
-				}
+			if kafkerSignal.Room != "" {
+				app.signalChannels.Publish(roomKey(kafkerSignal.Room, kafkerSignal.ClientId), kafkerSignal.SignalEvent)
+			} else if linkCode != "" && kafkerSignal.ClientId != "" {
+				app.signalChannels.Publish(joinKey(linkCode, kafkerSignal.ClientId), kafkerSignal.SignalEvent)
+			} else if kafkerSignal.ClientId != "" {
+				app.signalChannels.Publish(clientKey(kafkerSignal.ClientId), kafkerSignal.SignalEvent)
+			} else if kafkerSignal.Envelope == nil {
+				app.signalChannels.Remove(linkCode)
+			} else {
+				app.signalChannels.Publish(linkCode, kafkerSignal.SignalEvent)
 			}
 
 		}
@@ -151,6 +283,34 @@ func (app *API) listenPulsarMessages(ctx context.Context) {
 
 }
 
+// fetchSigningSeed 取得發行者的信封簽名種子。
+// 有認證服務時透過 gRPC 取得，否則從 Redis 中的發行者秘密字串推導。
+func (app *API) fetchSigningSeed(iss string) ([]byte, error) {
+
+	if app.authConnection != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+		defer cancel()
+
+		ctx = metadata.AppendToOutgoingContext(ctx, Auth.SERVICE_TOKEN_METADATA, "Bearer "+app.config.ServiceToken)
+		res, err := app.authClient.GetSigningKey(ctx, &ServiceAuth.SigningKeyRequest{Iss: iss})
+		if err != nil {
+			return nil, err
+		}
+		return res.Seed, nil
+	}
+
+	if app.storage.Redis == nil {
+		return nil, errors.New("no auth service or Redis configured to obtain issuer secrets")
+	}
+
+	secret, err := app.storage.GetSecret(iss)
+	if err != nil {
+		return nil, err
+	}
+
+	return Envelope.SeedFromSecret(secret), nil
+}
+
 // Error 處理錯誤消息並根據狀態碼響應
 func Error(c *gin.Context, statusCode int, msg any) {
 
@@ -163,6 +323,12 @@ func Error(c *gin.Context, statusCode int, msg any) {
 	c.Abort() // 中止請求
 }
 
+// limitBody 中介軟體限制請求內容的大小，避免讀取過大的信號
+func (app *API) limitBody(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, app.maxBodySize)
+	c.Next()
+}
+
 // AuthRequired 中介軟體進行授權，檢查 Authorization 標頭並驗證令牌
 func (app *API) authRequired(c *gin.Context) {
 	authHeader := c.GetHeader("Authorization")
@@ -171,71 +337,126 @@ func (app *API) authRequired(c *gin.Context) {
 		return
 	}
 
-	bearerToken := authHeader[7:]
+	tokenPayload, status, err := app.verifyToken(authHeader[7:])
+	if err != nil {
+		Error(c, status, err.Error())
+		return
+	}
+
+	c.Set(TOKEN_PARLOAD, *tokenPayload)
+	c.Next()
+}
+
+// verifyToken 驗證令牌，優先使用快取，其次使用授權服務或本地密鑰
+// 返回值:
+//   - *Auth.TokenPayload: 令牌內容
+//   - int: 驗證失敗時對應的 HTTP 狀態碼
+//   - error: 驗證失敗的原因
+func (app *API) verifyToken(bearerToken string) (*Auth.TokenPayload, int, error) {
 
 	cacheTokenPayload := app.storage.GetTokenCache(bearerToken)
 	if cacheTokenPayload != nil {
-		c.Set(TOKEN_PARLOAD, *cacheTokenPayload)
-	} else {
+		return cacheTokenPayload, http.StatusOK, nil
+	}
 
-		if app.authConnection != nil {
+	if app.authConnection != nil {
 
-			req := &ServiceAuth.AccessTokenRequest{
-				AccessToken: bearerToken,
-			}
+		req := &ServiceAuth.AccessTokenRequest{
+			AccessToken: bearerToken,
+		}
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
-			defer cancel()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+		defer cancel()
 
-			res, err := app.authClient.VerifyAccessToken(ctx, req)
+		res, err := app.authClient.VerifyAccessToken(ctx, req)
 
-			if err != nil {
-				log.Println(err)
-				Error(c, http.StatusUnauthorized, "a:Token is invalid or has expired. Please provide a valid token.")
-				return
-			}
+		if err != nil {
+			log.Println(err)
+			return nil, http.StatusUnauthorized, errors.New("a:Token is invalid or has expired. Please provide a valid token.")
+		}
 
-			tokenPayload := Auth.TokenPayload{
-				Token:     bearerToken,
-				Iss:       res.Iss,
-				Iat:       res.Iat,
-				Exp:       res.Exp,
-				UserId:    res.UserId,
-				ChannelId: res.ChannelId,
-			}
+		tokenPayload := Auth.TokenPayload{
+			Token:     bearerToken,
+			Iss:       res.Iss,
+			Iat:       res.Iat,
+			Exp:       res.Exp,
+			UserId:    res.UserId,
+			ChannelId: res.ChannelId,
+			Scope:     res.Scope,
+		}
 
+		// 機器人令牌不快取，每次都經授權服務驗證，撤銷機器人後立即失效
+		if tokenPayload.Scope != Auth.SCOPE_BOT {
 			app.storage.SetTokenCache(bearerToken, tokenPayload)
+		}
 
-			c.Set(TOKEN_PARLOAD, tokenPayload)
+		return &tokenPayload, http.StatusOK, nil
+	}
 
-		} else {
+	iss, err := Auth.ExtractIssuerFromToken(bearerToken)
+	if err != nil {
+		return nil, http.StatusUnauthorized, errors.New("Failed to extract issuer from token. Token may be malformed or invalid.")
+	}
 
-			iss, err := Auth.ExtractIssuerFromToken(bearerToken)
-			if err != nil {
-				Error(c, http.StatusUnauthorized, "Failed to extract issuer from token. Token may be malformed or invalid.")
-				return
-			}
+	secret, err := app.storage.GetSecret(iss)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
 
-			secret, err := app.storage.GetSecret(iss)
-			if err != nil {
-				Error(c, http.StatusInternalServerError, err)
-				return
-			}
+	claims, err := Auth.DecodeToken(bearerToken, secret)
+	if err != nil {
+		return nil, http.StatusUnauthorized, errors.New("l:Token is invalid or has expired. Please provide a valid token.")
+	}
 
-			claims, err := Auth.DecodeToken(bearerToken, secret)
-			if err != nil {
-				Error(c, http.StatusUnauthorized, "l:Token is invalid or has expired. Please provide a valid token.")
-				return
-			}
+	tokenPayload := Auth.Claims2TokenPayload(bearerToken, claims)
 
-			tokenPayload := Auth.Claims2TokenPayload(bearerToken, claims)
+	// 機器人令牌每次都檢查機器人是否已被撤銷
+	if tokenPayload.Scope == Auth.SCOPE_BOT {
+		exists, err := app.storage.BotExists(tokenPayload.UserId)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		if !exists {
+			return nil, http.StatusUnauthorized, errors.New("Bot has been revoked")
+		}
+	} else {
+		app.storage.SetTokenCache(bearerToken, tokenPayload)
+	}
 
-			app.storage.SetTokenCache(bearerToken, tokenPayload)
-			c.Set(TOKEN_PARLOAD, tokenPayload)
+	return &tokenPayload, http.StatusOK, nil
+}
+
+// parseOrigins 解析允許開啟 WebSocket 的來源，統一為小寫且不含結尾的斜線
+func parseOrigins(list string) []string {
+	origins := Configurator.SplitList(list)
+	for i, origin := range origins {
+		origins[i] = strings.TrimSuffix(strings.ToLower(origin), "/")
+	}
+	return origins
+}
+
+// parseScopeFilters 解析各權限範圍的候選過濾器，格式為 "scope=filter+filter;scope=filter"，
+// 範圍的過濾器會疊加在部署的過濾器之上
+func parseScopeFilters(list string, base SessionDescription.CandidateFilter) (map[string]SessionDescription.CandidateFilter, error) {
+	filters := make(map[string]SessionDescription.CandidateFilter)
 
+	for _, entry := range strings.Split(list, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
 		}
 
+		scope, names, found := strings.Cut(entry, "=")
+		if scope = strings.TrimSpace(scope); !found || scope == "" {
+			return nil, fmt.Errorf("invalid scope candidate filters: %q", entry)
+		}
+
+		filter, err := SessionDescription.ParseCandidateFilter(strings.Split(names, "+"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid candidate filters of scope %s: %w", scope, err)
+		}
+
+		filters[scope] = filters[scope].Merge(filter).Merge(base)
 	}
 
-	c.Next()
+	return filters, nil
 }
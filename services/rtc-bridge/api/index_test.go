@@ -0,0 +1,131 @@
+package rtcbridgeapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	AppConfig "peergrine/rtc-bridge/app-config"
+	Storage "peergrine/rtc-bridge/storage"
+	ApiTest "peergrine/utils/api-test"
+	Envelope "peergrine/utils/envelope"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// testSDP is a browser offer with only a data channel; tests also use it as the answer.
+var testSDP = strings.Join([]string{
+	"v=0",
+	"o=- 4611731400430051336 2 IN IP4 127.0.0.1",
+	"s=-",
+	"t=0 0",
+	"a=group:BUNDLE 0",
+	"m=application 9 UDP/DTLS/SCTP webrtc-datachannel",
+	"c=IN IP4 0.0.0.0",
+	"a=ice-ufrag:EsAw",
+	"a=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1",
+	"a=fingerprint:sha-256 D2:FA:0E:C3:22:59:5E:14:95:69:92:3D:13:B4:84:24:2C:C2:A2:C0:3E:FD:34:8E:5E:EA:6F:AF:52:CE:E6:0F",
+	"a=setup:actpass",
+	"a=mid:0",
+	"a=sctp-port:5000",
+}, "\r\n") + "\r\n"
+
+// testAPI is an rtc-bridge instance that accepts cached tokens. String bodies are sent as SDP.
+type testAPI struct {
+	*API
+	*ApiTest.Client
+}
+
+// newTestAPI starts an rtc-bridge on local storage for a test; configure may change the
+// default settings.
+func newTestAPI(t *testing.T, configure func(config *AppConfig.AppConfig)) *testAPI {
+	return startTestAPI(t, configure, "")
+}
+
+// newTestAPIs starts instances of rtc-bridge that share one Redis. Tokens are cached per
+// instance, so clients log in to each instance they use.
+func newTestAPIs(t *testing.T, instances int) []*testAPI {
+	redis := miniredis.RunT(t)
+
+	apis := make([]*testAPI, instances)
+	for i := range apis {
+		id := "test-instance-" + strconv.Itoa(i)
+		apis[i] = startTestAPI(t, func(config *AppConfig.AppConfig) {
+			config.Id = id
+		}, redis.Addr())
+	}
+	return apis
+}
+
+func startTestAPI(t *testing.T, configure func(config *AppConfig.AppConfig), redisAddr string) *testAPI {
+	config := &AppConfig.AppConfig{
+		Id:                  "test-instance",
+		LinkCodeLength:      "6",
+		LinkCodeDuration:    "60",
+		LinkCodeMinDuration: "10",
+		LinkCodeMaxDuration: "600",
+		LinkCodeMaxUses:     "5",
+		LinkCodeDefaultUses: "1",
+		LookupMaxFailures:   "5",
+		LookupFailureWindow: "60",
+		LookupLockout:       "60",
+		PeerDuration:        "3600",
+		RoomMaxMembers:      "8",
+		TurnCredentialTTL:   "600",
+		SdpMaxSize:          "65536",
+	}
+	if configure != nil {
+		configure(config)
+	}
+
+	storage, err := Storage.New(config.Id, redisAddr)
+	require.NoError(t, err)
+
+	app, err := New(config, storage, nil)
+	require.NoError(t, err)
+	t.Cleanup(app.Close)
+
+	app.keyring = ApiTest.Keyring()
+
+	client := ApiTest.Start(t, app.server.Handler, storage)
+	client.RawType = CONTENT_TYPE_SDP
+	return &testAPI{API: app, Client: client}
+}
+
+// offerStream is the response stream of POST /: the link code, then one envelope per event.
+type offerStream struct {
+	LinkCode
+	decoder *json.Decoder
+	cancel  context.CancelFunc
+}
+
+// createLinkCode creates a link code with POST / and keeps its stream open until the test ends.
+func (a *testAPI) createLinkCode(t *testing.T, token string, query string) *offerStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	res := a.Request(ctx, http.MethodPost, "/?"+query, token, nil, SignalData{SDP: testSDP})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	stream := &offerStream{decoder: json.NewDecoder(res.Body), cancel: cancel}
+	require.NoError(t, stream.decoder.Decode(&stream.LinkCode))
+	return stream
+}
+
+// next reads the next envelope of the stream and decodes its payload.
+func (s *offerStream) next(t *testing.T, payload any) {
+	var envelope Envelope.Envelope
+	require.NoError(t, s.decoder.Decode(&envelope))
+	require.NoError(t, envelope.Decode(payload))
+}
+
+// candidate returns a host candidate on port.
+func candidate(port int) Candidate {
+	raw := "candidate:1 1 udp 2122260223 203.0.113.7 " + strconv.Itoa(port) + " typ host"
+	index := 0
+	mid := "0"
+	return Candidate{Candidate: &raw, SdpMLineIndex: &index, SdpMid: &mid}
+}
@@ -0,0 +1,329 @@
+package rtcbridgeapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	Storage "peergrine/rtc-bridge/storage"
+	Auth "peergrine/utils/auth"
+	LinkCodes "peergrine/utils/link-code"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Join request event names.
+const (
+	EVENT_JOIN     = "join"     // To the owner: a client asks to answer the link code
+	EVENT_WITHDRAW = "withdraw" // To the owner: the client stopped waiting for a decision
+	EVENT_ACCEPT   = "accept"   // To the joiner: its answer is forwarded
+	EVENT_DECLINE  = "decline"  // To the joiner: its answer is dropped
+	EVENT_CANCEL   = "cancel"   // To the joiner: the owner cancelled the link code
+)
+
+// joinKey returns the subscription key of the decision on the join request of a client.
+func joinKey(linkCode string, clientId string) string {
+	return "join:" + linkCode + ":" + clientId
+}
+
+// sendToLinkCode delivers an event to the owner of a link code: over UnifiedMessage, to the
+// local POST / stream, or through Pulsar to the instance holding it. The event passes the
+// candidate filter of the owner's scope.
+func (app *API) sendToLinkCode(targetSignal *Storage.Signal, event SignalEvent, messageType string) (int, error) {
+
+	var err error
+	if event.Envelope, err = app.filterForReceiver(event.Envelope, targetSignal.Scope); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if app.unifiedMessageConnection != nil {
+		if err := app.sendUnifiedMessage(targetSignal.ChannelId, targetSignal.ClientId, messageType, event.Envelope); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return http.StatusOK, nil
+	}
+
+	if app.signalChannels.Publish(targetSignal.LinkCode, event) {
+		return http.StatusOK, nil
+	}
+
+	if app.pulsar == nil {
+		return http.StatusNotFound, errors.New("Link code owner is not listening for answers")
+	}
+
+	kafkerSignal := KafkerSignal{
+		LinkCode:    targetSignal.LinkCode,
+		SignalEvent: event,
+	}
+	signalBytes, _ := json.Marshal(kafkerSignal)
+
+	if _, err := app.pulsar.SendMessage(targetSignal.ChannelId, signalBytes); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// sendJoinEvent delivers a decision or cancellation to the instance where a joiner waits.
+func (app *API) sendJoinEvent(linkCode string, request Storage.JoinRequest, event SignalEvent) error {
+
+	if request.ChannelId == app.config.Id {
+		app.signalChannels.Publish(joinKey(linkCode, request.ClientId), event)
+		return nil
+	}
+
+	if app.pulsar == nil {
+		return nil
+	}
+
+	kafkerSignal := KafkerSignal{
+		LinkCode:    linkCode,
+		ClientId:    request.ClientId,
+		SignalEvent: event,
+	}
+	signalBytes, _ := json.Marshal(kafkerSignal)
+
+	_, err := app.pulsar.SendMessage(request.ChannelId, signalBytes)
+	return err
+}
+
+// awaitApproval sends a join request to the owner of a link code and waits for its decision.
+// It returns http.StatusOK once the owner accepts, which has already used up one use of the
+// link code for the joiner, otherwise the status and error to respond with. A joiner that
+// gives up, which ends ctx, withdraws its request.
+func (app *API) awaitApproval(ctx context.Context, tokenPayload *Auth.TokenPayload, targetSignal *Storage.Signal, clientName string) (int, error) {
+
+	linkCode := targetSignal.LinkCode
+	clientId := tokenPayload.UserId
+
+	ttl := time.Until(time.Unix(targetSignal.ExpiresAt, 0))
+	if ttl <= 0 {
+		return http.StatusGone, errors.New("Link code has expired")
+	}
+
+	// Subscribe before the owner can see the request, so an early decision is not lost.
+	decisions := app.signalChannels.Subscribe(joinKey(linkCode, clientId))
+	defer app.signalChannels.Unsubscribe(joinKey(linkCode, clientId), decisions)
+
+	request := Storage.JoinRequest{ClientId: clientId, ChannelId: app.config.Id}
+	if err := app.storage.AddJoinRequest(linkCode, request, ttl); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer app.storage.RemoveJoinRequest(linkCode, request)
+
+	send := func(eventName string) (int, error) {
+		envelope, err := app.keyring.Seal(tokenPayload.Iss, clientId, JoinData{
+			Type:       eventName,
+			LinkCode:   linkCode,
+			ClientId:   clientId,
+			ClientName: clientName,
+		})
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		event := SignalEvent{
+			Event:    eventName,
+			SenderId: clientId,
+			Envelope: envelope,
+		}
+		return app.sendToLinkCode(targetSignal, event, MESSAGE_TYPE+"-"+eventName)
+	}
+
+	if status, err := send(EVENT_JOIN); err != nil {
+		return status, err
+	}
+
+	timeout := time.NewTimer(ttl)
+	defer timeout.Stop()
+
+	select {
+	case event, ok := <-decisions.C():
+		if !ok || event.Event == EVENT_CANCEL {
+			return http.StatusGone, errors.New("Link code was cancelled")
+		}
+		if event.Event != EVENT_ACCEPT {
+			return http.StatusForbidden, errors.New("Join request was declined")
+		}
+		return http.StatusOK, nil
+	case <-timeout.C:
+	case <-ctx.Done():
+	}
+
+	if _, err := send(EVENT_WITHDRAW); err != nil {
+		log.Printf("Failed to withdraw the join request of %s: %v\n", clientId, err)
+	}
+	return http.StatusRequestTimeout, errors.New("Join request timed out")
+}
+
+// cancelJoinRequests tells every client waiting on a link code that it was cancelled.
+func (app *API) cancelJoinRequests(tokenPayload *Auth.TokenPayload, linkCode string) {
+
+	requests, err := app.storage.GetJoinRequests(linkCode)
+	if err != nil || len(requests) == 0 {
+		return
+	}
+
+	envelope, err := app.keyring.Seal(tokenPayload.Iss, tokenPayload.UserId, JoinData{
+		Type:     EVENT_CANCEL,
+		LinkCode: linkCode,
+		ClientId: tokenPayload.UserId,
+	})
+	if err != nil {
+		log.Printf("Failed to cancel the join requests of %s: %v\n", linkCode, err)
+		return
+	}
+
+	event := SignalEvent{
+		Event:    EVENT_CANCEL,
+		SenderId: tokenPayload.UserId,
+		Envelope: envelope,
+	}
+
+	for _, request := range requests {
+		if err := app.sendJoinEvent(linkCode, request, event); err != nil {
+			log.Printf("Failed to cancel the join request of %s: %v\n", request.ClientId, err)
+		}
+		app.storage.RemoveJoinRequest(linkCode, request)
+	}
+}
+
+// decideJoinRequest lets the owner of a link code accept or decline a pending join request.
+// The joiner learns the decision from the response to its answer; an accepted answer then
+// reaches the owner like any other.
+func (app *API) decideJoinRequest(c *gin.Context) {
+	linkCode := c.Param(PARAM_USER_LINK)
+	joinerId := c.Param(PARAM_USER_ID)
+
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	var decision JoinDecision
+	if err := c.ShouldBindJSON(&decision); err != nil {
+		Error(c, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	targetSignal, err := app.storage.GetSignal(linkCode)
+	if err != nil {
+		Error(c, http.StatusBadRequest, "Target signal not found")
+		return
+	}
+
+	if targetSignal.ClientId != tokenPayload.UserId {
+		Error(c, http.StatusForbidden, "Only the owner of the link code may decide on join requests")
+		return
+	}
+
+	requests, err := app.storage.GetJoinRequests(linkCode)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	pending := make([]Storage.JoinRequest, 0, 1)
+	for _, request := range requests {
+		if request.ClientId == joinerId {
+			pending = append(pending, request)
+		}
+	}
+
+	if len(pending) == 0 {
+		Error(c, http.StatusNotFound, "Join request not found")
+		return
+	}
+
+	// An accepted joiner takes its use of the link code now, so the owner cannot accept more
+	// joiners than the link code has uses left. A joiner accepted after the last use is told
+	// the link code is gone instead.
+	eventName := decision.Decision
+	status := http.StatusOK
+
+	if eventName == EVENT_ACCEPT {
+		if err := app.storage.RedeemSignal(*targetSignal); err != nil {
+			if !errors.Is(err, LinkCodes.ErrExhausted) {
+				Error(c, http.StatusInternalServerError, err)
+				return
+			}
+			eventName, status = EVENT_CANCEL, http.StatusGone
+		}
+	}
+
+	envelope, err := app.keyring.Seal(tokenPayload.Iss, tokenPayload.UserId, JoinData{
+		Type:     eventName,
+		LinkCode: linkCode,
+		ClientId: tokenPayload.UserId,
+	})
+	if err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	event := SignalEvent{
+		Event:    eventName,
+		SenderId: tokenPayload.UserId,
+		Envelope: envelope,
+	}
+
+	for _, request := range pending {
+		if err := app.sendJoinEvent(linkCode, request, event); err != nil {
+			Error(c, http.StatusInternalServerError, err)
+			return
+		}
+		app.storage.RemoveJoinRequest(linkCode, request)
+	}
+
+	if status == http.StatusGone {
+		Error(c, status, "Link code has no remaining uses")
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// cancelSignal deletes a link code before it expires. Clients waiting for approval are told
+// it was cancelled and the POST / stream of the owner ends.
+func (app *API) cancelSignal(c *gin.Context) {
+	linkCode := c.Param(PARAM_USER_LINK)
+
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	targetSignal, err := app.storage.GetSignal(linkCode)
+	if err != nil {
+		Error(c, http.StatusBadRequest, "Target signal not found")
+		return
+	}
+
+	if targetSignal.ClientId != tokenPayload.UserId {
+		Error(c, http.StatusForbidden, "Only the owner of the link code may cancel it")
+		return
+	}
+
+	if err := app.storage.RemoveSignal(linkCode); err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	app.cancelJoinRequests(tokenPayload, linkCode)
+
+	app.signalChannels.Remove(linkCode)
+
+	// Without UnifiedMessage the channel of the signal is the instance holding the stream.
+	if app.unifiedMessageConnection == nil && app.pulsar != nil && targetSignal.ChannelId != app.config.Id {
+		signalBytes, _ := json.Marshal(KafkerSignal{LinkCode: linkCode})
+		if _, err := app.pulsar.SendMessage(targetSignal.ChannelId, signalBytes); err != nil {
+			log.Printf("Failed to end the stream of link code %s: %v\n", linkCode, err)
+		}
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,103 @@
+package rtcbridgeapi
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// answerLater answers a link code with POST /:user_link in the background and returns a
+// channel that receives the status.
+func (a *testAPI) answerLater(token string, linkCode string) <-chan int {
+	status := make(chan int, 1)
+	go func() {
+		status <- a.Status(http.MethodPost, "/"+linkCode, token, SignalData{SDP: testSDP})
+	}()
+	return status
+}
+
+// awaitJoinRequests waits until a link code has count pending join requests.
+func (a *testAPI) awaitJoinRequests(t *testing.T, linkCode string, count int) {
+	require.Eventually(t, func() bool {
+		requests, _ := a.storage.GetJoinRequests(linkCode)
+		return len(requests) == count
+	}, time.Second, 10*time.Millisecond)
+}
+
+// 測試拒絕的加入請求不佔用次數，且接受的請求不超過剩餘次數
+func TestDecideJoinRequest(t *testing.T) {
+	app := newTestAPI(t, nil)
+	owner := app.Login("owner", "")
+	declined := app.Login("declined", "")
+	first := app.Login("first", "")
+	second := app.Login("second", "")
+
+	stream := app.createLinkCode(t, owner, "require_approval=true&max_uses=1")
+	linkCode := stream.LinkCode.LinkCode
+	path := "/" + linkCode + "/requests/"
+
+	declinedStatus := app.answerLater(declined, linkCode)
+	app.awaitJoinRequests(t, linkCode, 1)
+
+	assert.Equal(t, http.StatusForbidden, app.Status(http.MethodPost, path+"declined", second, JoinDecision{Decision: EVENT_ACCEPT}), "Only the owner may decide")
+	assert.Equal(t, http.StatusOK, app.Status(http.MethodPost, path+"declined", owner, JoinDecision{Decision: EVENT_DECLINE}))
+	assert.Equal(t, http.StatusForbidden, <-declinedStatus)
+
+	signal, err := app.storage.GetSignal(linkCode)
+	require.NoError(t, err)
+	assert.Equal(t, 1, signal.RemainingUses, "A declined joiner should not use up the link code")
+
+	joiners := map[string]<-chan int{
+		"first":  app.answerLater(first, linkCode),
+		"second": app.answerLater(second, linkCode),
+	}
+	app.awaitJoinRequests(t, linkCode, 2)
+
+	// Both joiners are accepted at once, but only one use is left. The owner stream ends with
+	// the first answer and removes the link code, so the other decision finds either no uses
+	// or no link code.
+	decisions := make(chan int, len(joiners))
+	for joinerId := range joiners {
+		go func(joinerId string) {
+			decisions <- app.Status(http.MethodPost, path+joinerId, owner, JoinDecision{Decision: EVENT_ACCEPT})
+		}(joinerId)
+	}
+
+	accepted := 0
+	for range joiners {
+		switch <-decisions {
+		case http.StatusOK:
+			accepted++
+		case http.StatusGone, http.StatusBadRequest:
+		default:
+			t.Error("Unexpected status of a decision")
+		}
+	}
+	assert.Equal(t, 1, accepted)
+
+	statuses := make(map[int]int)
+	for _, status := range joiners {
+		statuses[<-status]++
+	}
+	assert.Equal(t, map[int]int{http.StatusOK: 1, http.StatusGone: 1}, statuses, "Only one joiner should get the last use")
+}
+
+// 測試在另一個實例取消的連結碼，在共用 Redis 時無法從建立它的實例取得或回應
+func TestCancelSignalAcrossInstances(t *testing.T) {
+	apis := newTestAPIs(t, 2)
+	first, second := apis[0], apis[1]
+	owner := first.Login("owner", "")
+	second.Login("owner", "")
+	answerer := first.Login("answerer", "")
+
+	stream := first.createLinkCode(t, owner, "")
+	linkCode := stream.LinkCode.LinkCode
+
+	require.Equal(t, http.StatusOK, second.Status(http.MethodDelete, "/"+linkCode, owner, nil))
+
+	assert.Equal(t, http.StatusBadRequest, first.Status(http.MethodGet, "/"+linkCode, answerer, nil))
+	assert.Equal(t, http.StatusBadRequest, first.Status(http.MethodPost, "/"+linkCode, answerer, SignalData{SDP: testSDP}))
+}
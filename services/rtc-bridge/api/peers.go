@@ -0,0 +1,155 @@
+package rtcbridgeapi
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	Auth "peergrine/utils/auth"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Peer signal types, relayed between two clients for the life of a call.
+const (
+	PEER_SIGNAL_OFFER       = "offer"       // Renegotiation offer, for example after adding a track
+	PEER_SIGNAL_ANSWER      = "answer"      // Answer to a renegotiation offer
+	PEER_SIGNAL_ICE_RESTART = "ice_restart" // Asks the peer to restart ICE, optionally with the restart offer
+	PEER_SIGNAL_BYE         = "bye"         // Ends the call and the peer entry
+)
+
+// sendPeerSignal relays a renegotiation offer or answer, an ICE restart request or a bye to
+// a client the caller exchanged an offer and an answer with. Every signal extends the peer
+// entry by the peer duration, so the channel stays open as long as the call is active; bye
+// removes it.
+func (app *API) sendPeerSignal(c *gin.Context) {
+	peerId := c.Param(PARAM_USER_ID)
+
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	var signal PeerSignal
+	if err := c.ShouldBindJSON(&signal); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid JSON format: %s", err.Error()))
+		return
+	}
+
+	if status, err := app.relayPeerSignal(tokenPayload, peerId, &signal); err != nil {
+		Error(c, status, err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// refreshPeer keeps the peer entry with a client open for another peer duration, for calls
+// that send no signals or candidates for a while.
+func (app *API) refreshPeer(c *gin.Context) {
+	peerId := c.Param(PARAM_USER_ID)
+
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if status, err := app.extendPeer(tokenPayload, peerId); err != nil {
+		Error(c, status, err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// extendPeer extends the peer entry of the token holder and a client by the peer duration.
+// An entry that already expired or was ended is not reopened.
+func (app *API) extendPeer(tokenPayload *Auth.TokenPayload, peerId string) (int, error) {
+
+	clientId := tokenPayload.UserId
+
+	peer, err := app.storage.ExtendPeer(clientId, peerId, time.Now().Add(app.peerDuration).Unix())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !peer {
+		return http.StatusForbidden, errors.New("Target client has not exchanged an offer and answer with this client")
+	}
+
+	// The UnifiedMessage channel of the caller is known from its token, so keep it routable
+	// for the answers and signals the peer sends back.
+	if unifiedMessage, channelId := app.getChannelId(tokenPayload); unifiedMessage {
+		if err := app.storage.AddClientChannel(clientId, unifiedMessageChannel(channelId, tokenPayload.Scope), app.peerDuration); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+// relayPeerSignal validates, filters and delivers a peer signal of the token holder.
+func (app *API) relayPeerSignal(tokenPayload *Auth.TokenPayload, peerId string, signal *PeerSignal) (int, error) {
+
+	var err error
+
+	// The SDP is required for offers and answers and optional for ICE restart requests.
+	if signal.Type == PEER_SIGNAL_OFFER || signal.Type == PEER_SIGNAL_ANSWER || signal.SDP != "" {
+		err = app.validateSDP(&signal.SDP)
+	}
+	if err == nil {
+		err = app.validateCandidates(signal.Candidates)
+	}
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	app.filterSignal(tokenPayload, &signal.SDP, &signal.Candidates)
+
+	clientId := tokenPayload.UserId
+
+	if signal.Type == PEER_SIGNAL_BYE {
+		peer, err := app.storage.PeerExists(clientId, peerId)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if !peer {
+			return http.StatusForbidden, errors.New("Target client has not exchanged an offer and answer with this client")
+		}
+	} else if status, err := app.extendPeer(tokenPayload, peerId); err != nil {
+		return status, err
+	}
+
+	envelope, err := app.keyring.Seal(tokenPayload.Iss, clientId, PeerSignalData{
+		Type:       signal.Type,
+		ClientId:   clientId,
+		SDP:        signal.SDP,
+		Candidates: signal.Candidates,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	event := SignalEvent{
+		Event:    signal.Type,
+		SenderId: clientId,
+		Done:     signal.Type == PEER_SIGNAL_BYE, // A departed answerer sends no further candidates
+		Envelope: envelope,
+	}
+
+	status, err := app.deliverSignal(peerId, event, MESSAGE_TYPE+"-peer")
+
+	if signal.Type == PEER_SIGNAL_BYE {
+		// The call is over even if the peer is no longer listening.
+		if err := app.storage.RemovePeer(clientId, peerId); err != nil {
+			log.Printf("Failed to remove peer entry of %s and %s: %v\n", clientId, peerId, err)
+		}
+		if status == http.StatusNotFound {
+			return http.StatusOK, nil
+		}
+	}
+
+	return status, err
+}
@@ -0,0 +1,455 @@
+package rtcbridgeapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	Storage "peergrine/rtc-bridge/storage"
+	Auth "peergrine/utils/auth"
+	LinkCodes "peergrine/utils/link-code"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Room event types. Offers, answers and candidates keep the type of the RoomSignal.
+const (
+	ROOM_EVENT_ROSTER = "roster"
+	ROOM_EVENT_JOIN   = "join"
+	ROOM_EVENT_LEAVE  = "leave"
+)
+
+// roomKey returns the subscription key of the room events addressed to a member.
+func roomKey(code string, clientId string) string {
+	return "room:" + code + ":" + clientId
+}
+
+// roomClients returns the distinct clients of the member entries, leaving out exceptId.
+func roomClients(members []Storage.RoomMember, exceptId string) []string {
+	seen := make(map[string]bool)
+	clients := make([]string, 0, len(members))
+	for _, member := range members {
+		if member.ClientId != exceptId && !seen[member.ClientId] {
+			seen[member.ClientId] = true
+			clients = append(clients, member.ClientId)
+		}
+	}
+	return clients
+}
+
+// reserveRoom stores the room under a newly generated code, retrying when a code is taken.
+func (app *API) reserveRoom(room Storage.Room) (string, error) {
+	const maxAttempts = 5
+
+	for attempts := 0; attempts < maxAttempts; attempts++ {
+		code, err := app.linkCodeLimits.Generate()
+		if err != nil {
+			return "", err
+		}
+
+		room.Code = code
+
+		reserved, err := app.storage.ReserveRoom(room)
+		if err != nil {
+			return "", err
+		}
+		if reserved {
+			return code, nil
+		}
+	}
+
+	return "", errors.New("failed to generate a unique room code after multiple attempts")
+}
+
+// sendRoomEvent seals a room event and delivers it to every connection of the given members:
+// over UnifiedMessage, to the local room streams, or through Pulsar to the instances holding them.
+func (app *API) sendRoomEvent(sender *Auth.TokenPayload, targets []Storage.RoomMember, event RoomEvent) error {
+
+	sealed, err := app.keyring.Seal(sender.Iss, sender.UserId, event)
+	if err != nil {
+		return err
+	}
+
+	// Connections of a client on the same channel share a subscription or UnifiedMessage channel,
+	// which receives the event once, filtered for the scopes of all of them.
+	routes := make([]Storage.RoomMember, 0, len(targets))
+	scopes := make(map[string][]string)
+
+	for _, target := range targets {
+		route := target.ChannelId + "\n" + target.ClientId
+		if _, ok := scopes[route]; !ok {
+			routes = append(routes, target)
+		}
+		scopes[route] = append(scopes[route], target.Scope)
+	}
+
+	for _, target := range routes {
+		envelope, err := app.filterForReceiver(sealed, scopes[target.ChannelId+"\n"+target.ClientId]...)
+		if err != nil {
+			return err
+		}
+
+		signalEvent := SignalEvent{
+			Event:    event.Type,
+			SenderId: sender.UserId,
+			Envelope: envelope,
+		}
+
+		if app.unifiedMessageConnection != nil {
+			if err := app.sendUnifiedMessage(target.ChannelId, target.ClientId, MESSAGE_TYPE+"-room", envelope); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if target.ChannelId == app.config.Id {
+			app.signalChannels.Publish(roomKey(event.RoomCode, target.ClientId), signalEvent)
+			continue
+		}
+
+		if app.pulsar == nil {
+			continue
+		}
+
+		kafkerSignal := KafkerSignal{
+			ClientId:    target.ClientId,
+			Room:        event.RoomCode,
+			SignalEvent: signalEvent,
+		}
+		signalBytes, _ := json.Marshal(kafkerSignal)
+
+		if _, err := app.pulsar.SendMessage(target.ChannelId, signalBytes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createRoom creates a room for group signaling and returns its code. The room accepts the
+// same ttl query option as POST /.
+func (app *API) createRoom(c *gin.Context) {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	var options LinkCodes.Options
+	if err := c.ShouldBindQuery(&options); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid room options: %s", err.Error()))
+		return
+	}
+
+	duration, _, err := app.linkCodeLimits.Resolve(options)
+	if err != nil {
+		Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	room := Storage.Room{
+		OwnerId:    tokenPayload.UserId,
+		ExpiresAt:  time.Now().Add(duration).Unix(),
+		MaxMembers: app.roomMaxMembers,
+	}
+
+	code, err := app.reserveRoom(room)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, fmt.Sprintf("failed to reserve room code: %v", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, RoomCode{
+		RoomCode:   code,
+		ExpiresAt:  room.ExpiresAt,
+		MaxMembers: room.MaxMembers,
+	})
+}
+
+// joinRoom adds the caller to a room for as long as the request stays open. The stream starts
+// with the roster of the other members, followed by join and leave events and the offers,
+// answers and candidates other members send to the caller.
+func (app *API) joinRoom(c *gin.Context) {
+	code := c.Param(PARAM_ROOM_CODE)
+
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	clientId := tokenPayload.UserId
+
+	keys := lookupKeys(c, tokenPayload)
+	if app.lookupLocked(c, keys) {
+		return
+	}
+
+	room, err := app.storage.GetRoom(code)
+	if err != nil {
+		app.lookupFailed(keys)
+		Error(c, http.StatusBadRequest, "Room not found")
+		return
+	}
+
+	unifiedMessage, channelId := app.getChannelId(tokenPayload)
+
+	member := Storage.RoomMember{
+		ClientId:   clientId,
+		ListenerId: uuid.New().String(),
+		ChannelId:  channelId,
+		Scope:      tokenPayload.Scope,
+	}
+
+	// Subscribe before joining so no event sent after the roster is missed.
+	var events <-chan SignalEvent
+	if !unifiedMessage {
+		subscription := app.signalChannels.Subscribe(roomKey(code, clientId))
+		defer app.signalChannels.Unsubscribe(roomKey(code, clientId), subscription)
+		events = subscription.C()
+	}
+
+	// The member limit is checked by the same storage operation that adds the member.
+	join, err := app.storage.AddRoomMember(code, member, room.MaxMembers, SIGNAL_CHANNEL_TTL)
+	app.announceDepartures(tokenPayload, code, join.Expired)
+	if errors.Is(err, Storage.ErrRoomFull) {
+		Error(c, http.StatusConflict, "Room is full")
+		return
+	}
+	if err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+	defer app.leaveRoom(tokenPayload, code, member)
+
+	members, err := app.storage.GetRoomMembers(code)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	others := roomClients(members, clientId)
+
+	roster, err := app.keyring.Seal(tokenPayload.Iss, clientId, RoomEvent{
+		Type:     ROOM_EVENT_ROSTER,
+		RoomCode: code,
+		ClientId: clientId,
+		Members:  others,
+	})
+	if err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !join.Rejoined {
+		targets := make([]Storage.RoomMember, 0, len(members))
+		for _, target := range members {
+			if target.ClientId != clientId {
+				targets = append(targets, target)
+			}
+		}
+
+		event := RoomEvent{
+			Type:     ROOM_EVENT_JOIN,
+			RoomCode: code,
+			ClientId: clientId,
+		}
+		if err := app.sendRoomEvent(tokenPayload, targets, event); err != nil {
+			log.Printf("Failed to announce %s in room %s: %v\n", clientId, code, err)
+		}
+	}
+
+	rosterBytes, _ := json.Marshal(roster)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	c.Writer.Write(rosterBytes)
+	c.Writer.Flush()
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Unix(room.ExpiresAt, 0))
+	defer cancel()
+
+	closeNotify := c.Writer.CloseNotify()
+
+	heartbeat := time.NewTicker(SIGNAL_CHANNEL_TTL / 3)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closeNotify:
+			return
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			join, err := app.storage.AddRoomMember(code, member, room.MaxMembers, SIGNAL_CHANNEL_TTL)
+			app.announceDepartures(tokenPayload, code, join.Expired)
+			if errors.Is(err, Storage.ErrRoomFull) {
+				// The entry of this connection expired and its place was taken in the meantime.
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to refresh %s in room %s: %v\n", clientId, code, err)
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			eventBytes, _ := json.Marshal(event.Envelope)
+			c.Writer.Write(eventBytes)
+			c.Writer.Flush()
+		}
+	}
+}
+
+// leaveRoom removes a connection from a room and announces the departure once the client
+// has no connection left.
+func (app *API) leaveRoom(tokenPayload *Auth.TokenPayload, code string, member Storage.RoomMember) {
+	if err := app.storage.RemoveRoomMember(code, member); err != nil {
+		log.Printf("Failed to remove %s from room %s: %v\n", member.ClientId, code, err)
+	}
+
+	members, err := app.storage.GetRoomMembers(code)
+	if err != nil {
+		log.Printf("Failed to read members of room %s: %v\n", code, err)
+		return
+	}
+
+	for _, other := range members {
+		if other.ClientId == member.ClientId {
+			return
+		}
+	}
+
+	leave := RoomEvent{
+		Type:     ROOM_EVENT_LEAVE,
+		RoomCode: code,
+		ClientId: member.ClientId,
+	}
+	if err := app.sendRoomEvent(tokenPayload, members, leave); err != nil {
+		log.Printf("Failed to announce departure of %s from room %s: %v\n", member.ClientId, code, err)
+	}
+}
+
+// announceDepartures sends a leave event for the clients of expired member entries that have no
+// connection to the room left, such as the members of an instance that stopped without
+// removing them. The event is signed on behalf of the member whose request noticed it.
+// Entries of that member itself are skipped, as its own stream announces its departure.
+func (app *API) announceDepartures(tokenPayload *Auth.TokenPayload, code string, expired []Storage.RoomMember) {
+	if len(expired) == 0 {
+		return
+	}
+
+	members, err := app.storage.GetRoomMembers(code)
+	if err != nil {
+		log.Printf("Failed to read members of room %s: %v\n", code, err)
+		return
+	}
+
+	remaining := make(map[string]bool, len(members))
+	for _, member := range members {
+		remaining[member.ClientId] = true
+	}
+	remaining[tokenPayload.UserId] = true
+
+	for _, member := range expired {
+		if remaining[member.ClientId] {
+			continue
+		}
+		// Several expired connections of one client lead to a single event.
+		remaining[member.ClientId] = true
+
+		leave := RoomEvent{
+			Type:     ROOM_EVENT_LEAVE,
+			RoomCode: code,
+			ClientId: member.ClientId,
+		}
+		if err := app.sendRoomEvent(tokenPayload, members, leave); err != nil {
+			log.Printf("Failed to announce departure of %s from room %s: %v\n", member.ClientId, code, err)
+		}
+	}
+}
+
+// sendRoomSignal relays an offer, answer or candidates from one room member to another, so
+// members can set up a connection with every other member.
+func (app *API) sendRoomSignal(c *gin.Context) {
+	code := c.Param(PARAM_ROOM_CODE)
+	targetId := c.Param(PARAM_USER_ID)
+
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	var signal RoomSignal
+	if err := c.ShouldBindJSON(&signal); err != nil {
+		Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid JSON format: %s", err.Error()))
+		return
+	}
+
+	if signal.Type != EVENT_CANDIDATES {
+		err = app.validateSDP(&signal.SDP)
+	}
+	if err == nil {
+		err = app.validateCandidates(signal.Candidates)
+	}
+	if err != nil {
+		Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	app.filterSignal(tokenPayload, &signal.SDP, &signal.Candidates)
+
+	if _, err := app.storage.GetRoom(code); err != nil {
+		Error(c, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	members, err := app.storage.GetRoomMembers(code)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	joined := false
+	targets := make([]Storage.RoomMember, 0, 1)
+	for _, member := range members {
+		if member.ClientId == tokenPayload.UserId {
+			joined = true
+		}
+		if member.ClientId == targetId {
+			targets = append(targets, member)
+		}
+	}
+
+	if !joined {
+		Error(c, http.StatusForbidden, "Not a member of this room")
+		return
+	}
+	if len(targets) == 0 {
+		Error(c, http.StatusNotFound, "Target client is not a member of this room")
+		return
+	}
+
+	event := RoomEvent{
+		Type:       signal.Type,
+		RoomCode:   code,
+		ClientId:   tokenPayload.UserId,
+		SDP:        signal.SDP,
+		Candidates: signal.Candidates,
+		Done:       signal.Done,
+	}
+
+	if err := app.sendRoomEvent(tokenPayload, targets, event); err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
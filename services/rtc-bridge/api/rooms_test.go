@@ -0,0 +1,116 @@
+package rtcbridgeapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	AppConfig "peergrine/rtc-bridge/app-config"
+	Envelope "peergrine/utils/envelope"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createRoom creates a room with POST /rooms and returns its code.
+func (a *testAPI) createRoom(t *testing.T, token string) string {
+	res := a.Request(context.Background(), http.MethodPost, "/rooms", token, nil, nil)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var room RoomCode
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&room))
+	return room.RoomCode
+}
+
+// joinRoom joins a room with GET /rooms/:room_code and returns the status, the stream of room
+// events and a function that leaves the room.
+func (a *testAPI) joinRoom(t *testing.T, token string, code string) (int, *json.Decoder, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	res := a.Request(ctx, http.MethodGet, "/rooms/"+code, token, nil, nil)
+	if res.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}
+	return res.StatusCode, json.NewDecoder(res.Body), cancel
+}
+
+// nextRoomEvent reads the next event of a room stream.
+func nextRoomEvent(t *testing.T, events *json.Decoder) RoomEvent {
+	var envelope Envelope.Envelope
+	require.NoError(t, events.Decode(&envelope))
+
+	var event RoomEvent
+	require.NoError(t, envelope.Decode(&event))
+	return event
+}
+
+// 測試同時加入的成員不會超過房間人數上限
+func TestJoinRoomFull(t *testing.T) {
+	app := newTestAPI(t, func(config *AppConfig.AppConfig) {
+		config.RoomMaxMembers = "3"
+	})
+	owner := app.Login("owner", "")
+	code := app.createRoom(t, owner)
+
+	const joiners = 8
+	statuses := make([]int, joiners)
+
+	var wg sync.WaitGroup
+	for i := 0; i < joiners; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token := app.Login("member-"+strconv.Itoa(i), "")
+			statuses[i], _, _ = app.joinRoom(t, token, code)
+		}(i)
+	}
+	wg.Wait()
+
+	joined, full := 0, 0
+	for _, status := range statuses {
+		switch status {
+		case http.StatusOK:
+			joined++
+		case http.StatusConflict:
+			full++
+		}
+	}
+	assert.Equal(t, 3, joined, "Only as many members as the room holds should join")
+	assert.Equal(t, joiners-3, full)
+}
+
+// 測試房間的名單、加入與離開事件，以及不存在的房間
+func TestJoinRoom(t *testing.T) {
+	app := newTestAPI(t, nil)
+	first := app.Login("first", "")
+	second := app.Login("second", "")
+	code := app.createRoom(t, first)
+
+	status, firstEvents, _ := app.joinRoom(t, first, code)
+	require.Equal(t, http.StatusOK, status)
+	roster := nextRoomEvent(t, firstEvents)
+	assert.Equal(t, ROOM_EVENT_ROSTER, roster.Type)
+	assert.Empty(t, roster.Members)
+
+	status, secondEvents, leave := app.joinRoom(t, second, code)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"first"}, nextRoomEvent(t, secondEvents).Members)
+
+	join := nextRoomEvent(t, firstEvents)
+	assert.Equal(t, ROOM_EVENT_JOIN, join.Type)
+	assert.Equal(t, "second", join.ClientId)
+
+	leave()
+	departure := nextRoomEvent(t, firstEvents)
+	assert.Equal(t, ROOM_EVENT_LEAVE, departure.Type)
+	assert.Equal(t, "second", departure.ClientId)
+
+	status, _, _ = app.joinRoom(t, second, "missing")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
@@ -0,0 +1,406 @@
+package rtcbridgeapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	Storage "peergrine/rtc-bridge/storage"
+	Auth "peergrine/utils/auth"
+	GenericChannels "peergrine/utils/generic-channels"
+	LinkCodes "peergrine/utils/link-code"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Message types of the /ws endpoint. Peer signals keep the type of the PeerSignal, and
+// messages relayed from other clients keep the name of their event.
+const (
+	SOCKET_OFFER     = "offer"     // A new link code, or with to a renegotiation offer
+	SOCKET_ANSWER    = "answer"    // An answer to a link code, or with to a renegotiation answer
+	SOCKET_CANDIDATE = "candidate" // Candidates for a peer, or with link_code for a stored offer
+	SOCKET_BYE       = "bye"       // Ends the call with a peer
+	SOCKET_ACK       = "ack"       // From the server: the message with the same id succeeded
+	SOCKET_ERROR     = "error"     // From the server: the message with the same id failed
+)
+
+// SOCKET_WRITE_WAIT bounds how long a write to a slow client may block.
+const SOCKET_WRITE_WAIT = 10 * time.Second
+
+// SOCKET_MAX_OFFERS bounds the link codes a socket holds until they expire.
+const SOCKET_MAX_OFFERS = 16
+
+// ACCESS_TOKEN is the query parameter that carries the token of browser WebSocket requests,
+// and the context key hideAccessToken moves it to.
+const ACCESS_TOKEN = "access_token"
+
+// signalSocket is a /ws connection. gorilla/websocket allows a single concurrent writer.
+type signalSocket struct {
+	conn   *websocket.Conn
+	mutex  sync.Mutex
+	offers map[string]time.Time // Link codes created on the socket and when they expire, used by the read loop only
+}
+
+// openOffers drops the link codes that expired and returns how many remain.
+func (s *signalSocket) openOffers() int {
+	now := time.Now()
+	for linkCode, expiresAt := range s.offers {
+		if now.After(expiresAt) {
+			delete(s.offers, linkCode)
+		}
+	}
+	return len(s.offers)
+}
+
+func (s *signalSocket) write(message SocketMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.conn.SetWriteDeadline(time.Now().Add(SOCKET_WRITE_WAIT))
+	return s.conn.WriteJSON(message)
+}
+
+// reply acknowledges a client message, or reports why it failed.
+func (s *signalSocket) reply(request SocketMessage, ack SocketMessage, status int, err error) {
+	if err != nil {
+		s.write(SocketMessage{Type: SOCKET_ERROR, Id: request.Id, Status: status, Error: err.Error()})
+		return
+	}
+
+	ack.Type = SOCKET_ACK
+	ack.Id = request.Id
+	s.write(ack)
+}
+
+// pump writes the events of a subscription to the socket until it is closed, ctx ends or
+// the optional deadline passes.
+func (s *signalSocket) pump(ctx context.Context, linkCode string, subscription *GenericChannels.Subscription[SignalEvent], deadline <-chan time.Time) {
+	for {
+		select {
+		case event, ok := <-subscription.C():
+			if !ok {
+				return
+			}
+
+			messageType := event.Event
+			switch event.Event {
+			case EVENT_ANSWER:
+				messageType = SOCKET_ANSWER
+			case EVENT_CANDIDATES:
+				messageType = SOCKET_CANDIDATE
+			}
+
+			s.write(SocketMessage{Type: messageType, LinkCode: linkCode, Envelope: event.Envelope})
+		case <-deadline:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// hideAccessToken moves the access_token query parameter into the request context before the
+// request is logged, so tokens of browser WebSocket requests do not end up in the access log.
+func hideAccessToken(c *gin.Context) {
+	query := c.Request.URL.Query()
+	if token := query.Get(ACCESS_TOKEN); token != "" {
+		c.Set(ACCESS_TOKEN, token)
+		query.Del(ACCESS_TOKEN)
+		c.Request.URL.RawQuery = query.Encode()
+	}
+	c.Next()
+}
+
+// bearerToken returns the token of the Authorization header, or of the access_token query
+// parameter for browsers, which cannot set headers on WebSocket requests.
+func bearerToken(c *gin.Context) string {
+	if authHeader := c.GetHeader("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		return authHeader[7:]
+	}
+	return c.GetString(ACCESS_TOKEN)
+}
+
+// checkOrigin accepts WebSocket requests from the same host as the request, from the origins
+// of APP_ALLOWED_ORIGINS, or without an Origin header, which only clients other than browsers
+// omit. Otherwise any web page could open a socket with a token of its visitor.
+func (app *API) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	for _, allowed := range app.allowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// serveSocket carries the signaling of a client over a WebSocket: it creates and answers link
+// codes, relays candidates and peer signals, and receives the answers, candidates and peer
+// signals addressed to the client, through the same storage and routing as the HTTP endpoints.
+// Link codes created on the socket are removed when it closes, and the socket closes when the
+// token expires. Over UnifiedMessage signals never reach the socket, so it is refused.
+func (app *API) serveSocket(c *gin.Context) {
+
+	if app.unifiedMessageConnection != nil {
+		Error(c, http.StatusBadRequest, "Signals are delivered through UnifiedMessage")
+		return
+	}
+
+	token := bearerToken(c)
+	if token == "" {
+		Error(c, http.StatusUnauthorized, "Bearer token is missing. Expected an 'Authorization: Bearer <token>' header or an access_token query parameter")
+		return
+	}
+
+	tokenPayload, status, err := app.verifyToken(token)
+	if err != nil {
+		Error(c, status, err.Error())
+		return
+	}
+
+	keys := lookupKeys(c, tokenPayload)
+
+	upgrader := websocket.Upgrader{CheckOrigin: app.checkOrigin}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	socket := &signalSocket{conn: conn, offers: make(map[string]time.Time)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clientId := tokenPayload.UserId
+	channel := newStreamChannel(app.config.Id, tokenPayload.Scope)
+
+	if err := app.storage.AddClientChannel(clientId, channel, SIGNAL_CHANNEL_TTL); err != nil {
+		socket.write(SocketMessage{Type: SOCKET_ERROR, Status: http.StatusInternalServerError, Error: err.Error()})
+		return
+	}
+	defer app.storage.RemoveClientChannel(clientId, channel)
+
+	subscription := app.signalChannels.Subscribe(clientKey(clientId))
+	defer app.signalChannels.Unsubscribe(clientKey(clientId), subscription)
+
+	go socket.pump(ctx, "", subscription, nil)
+
+	defer func() {
+		for linkCode := range socket.offers {
+			app.cancelJoinRequests(tokenPayload, linkCode)
+			app.storage.RemoveSignal(linkCode)
+		}
+	}()
+
+	go app.keepSocketAlive(ctx, socket, tokenPayload, channel)
+
+	conn.SetReadLimit(app.maxBodySize)
+	conn.SetReadDeadline(time.Now().Add(SIGNAL_CHANNEL_TTL))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(SIGNAL_CHANNEL_TTL))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		// Malformed messages are reported without closing the socket.
+		var message SocketMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			socket.write(SocketMessage{Type: SOCKET_ERROR, Status: http.StatusBadRequest, Error: "Invalid JSON format"})
+			continue
+		}
+
+		app.handleSocketMessage(ctx, socket, tokenPayload, keys, message)
+	}
+}
+
+// keepSocketAlive pings the client, refreshes its signal channel and closes the socket once
+// the token expires.
+func (app *API) keepSocketAlive(ctx context.Context, socket *signalSocket, tokenPayload *Auth.TokenPayload, channel Storage.ClientChannel) {
+
+	heartbeat := time.NewTicker(SIGNAL_CHANNEL_TTL / 3)
+	defer heartbeat.Stop()
+
+	expiry := time.NewTimer(time.Until(time.Unix(tokenPayload.Exp, 0)))
+	defer expiry.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-expiry.C:
+			message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Token expired")
+			socket.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(SOCKET_WRITE_WAIT))
+			socket.conn.Close()
+			return
+		case <-heartbeat.C:
+			if err := app.storage.AddClientChannel(tokenPayload.UserId, channel, SIGNAL_CHANNEL_TTL); err != nil {
+				log.Printf("Failed to refresh signal channel of %s: %v\n", tokenPayload.UserId, err)
+			}
+			if err := socket.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(SOCKET_WRITE_WAIT)); err != nil {
+				socket.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// handleSocketMessage runs a client message and replies to it.
+func (app *API) handleSocketMessage(ctx context.Context, socket *signalSocket, tokenPayload *Auth.TokenPayload, keys []string, message SocketMessage) {
+
+	switch {
+	case message.To != "" && message.Type != SOCKET_CANDIDATE:
+		switch message.Type {
+		case PEER_SIGNAL_OFFER, PEER_SIGNAL_ANSWER, PEER_SIGNAL_ICE_RESTART, PEER_SIGNAL_BYE:
+		default:
+			socket.reply(message, SocketMessage{}, http.StatusBadRequest, errors.New("Unknown message type"))
+			return
+		}
+
+		status, err := app.relayPeerSignal(tokenPayload, message.To, &PeerSignal{
+			Type:       message.Type,
+			SDP:        message.SDP,
+			Candidates: message.Candidates,
+		})
+		socket.reply(message, SocketMessage{}, status, err)
+
+	case message.Type == SOCKET_OFFER:
+		app.socketOffer(ctx, socket, tokenPayload, message)
+
+	case message.Type == SOCKET_ANSWER:
+		app.socketAnswer(ctx, socket, tokenPayload, keys, message)
+
+	case message.Type == SOCKET_CANDIDATE:
+		update := CandidateUpdate{Candidates: message.Candidates, Done: message.Done}
+		if err := app.checkCandidates(tokenPayload, &update); err != nil {
+			socket.reply(message, SocketMessage{}, http.StatusBadRequest, err)
+			return
+		}
+
+		var status int
+		var err error
+		switch {
+		case message.To != "":
+			status, err = app.relayPeerCandidates(tokenPayload, message.To, &update)
+		case message.LinkCode != "":
+			status, err = app.addOfferCandidates(tokenPayload, message.LinkCode, &update)
+		default:
+			status, err = http.StatusBadRequest, errors.New("Candidates need either to or link_code")
+		}
+		socket.reply(message, SocketMessage{}, status, err)
+
+	case message.Type == SOCKET_BYE || message.Type == PEER_SIGNAL_ICE_RESTART:
+		socket.reply(message, SocketMessage{}, http.StatusBadRequest, errors.New("Peer signals need the peer ID in to"))
+
+	default:
+		socket.reply(message, SocketMessage{}, http.StatusBadRequest, errors.New("Unknown message type"))
+	}
+}
+
+// socketOffer stores an offer under a new link code, which the socket owns from then on, and
+// streams the answers to it until the link code expires or the socket closes.
+func (app *API) socketOffer(ctx context.Context, socket *signalSocket, tokenPayload *Auth.TokenPayload, message SocketMessage) {
+
+	if socket.openOffers() >= SOCKET_MAX_OFFERS {
+		socket.reply(message, SocketMessage{}, http.StatusTooManyRequests, fmt.Errorf("A socket may hold at most %d link codes", SOCKET_MAX_OFFERS))
+		return
+	}
+
+	duration, maxUses, err := app.linkCodeLimits.Resolve(LinkCodes.Options{TTL: message.TTL, MaxUses: message.MaxUses})
+	if err != nil {
+		socket.reply(message, SocketMessage{}, http.StatusBadRequest, err)
+		return
+	}
+
+	signal := SignalData{
+		ClientName: message.ClientName,
+		SDP:        message.SDP,
+		Candidates: message.Candidates,
+		Trickle:    message.Trickle,
+	}
+
+	result, status, err := app.createOffer(tokenPayload, &signal, duration, maxUses, false)
+	if err != nil {
+		socket.reply(message, SocketMessage{}, status, err)
+		return
+	}
+
+	socket.offers[result.LinkCode] = time.Now().Add(duration)
+
+	answers := app.signalChannels.Subscribe(result.LinkCode)
+
+	go func() {
+		defer app.signalChannels.Unsubscribe(result.LinkCode, answers)
+
+		deadline := time.NewTimer(duration)
+		defer deadline.Stop()
+
+		socket.pump(ctx, result.LinkCode, answers, deadline.C)
+	}()
+
+	socket.reply(message, SocketMessage{
+		LinkCode:  result.LinkCode,
+		ExpiresAt: result.ExpiresAt,
+		MaxUses:   result.MaxUses,
+	}, http.StatusOK, nil)
+}
+
+// socketAnswer answers a link code. Answers that wait for the approval of the owner run in
+// the background so the socket keeps serving other messages meanwhile.
+func (app *API) socketAnswer(ctx context.Context, socket *signalSocket, tokenPayload *Auth.TokenPayload, keys []string, message SocketMessage) {
+
+	locked, err := app.lookupLimiter.Locked(keys...)
+	if err != nil {
+		socket.reply(message, SocketMessage{}, http.StatusInternalServerError, err)
+		return
+	}
+	if locked > 0 {
+		socket.reply(message, SocketMessage{}, http.StatusTooManyRequests, errors.New("Too many failed link code lookups"))
+		return
+	}
+
+	targetSignal, err := app.storage.GetSignal(message.LinkCode)
+	if err != nil {
+		app.lookupFailed(keys)
+		socket.reply(message, SocketMessage{}, http.StatusBadRequest, errors.New("Target signal not found"))
+		return
+	}
+
+	signal := SignalData{
+		ClientName: message.ClientName,
+		SDP:        message.SDP,
+		Candidates: message.Candidates,
+		Trickle:    message.Trickle,
+	}
+
+	answer := func() {
+		status, err := app.answerOffer(ctx, tokenPayload, targetSignal, &signal)
+		socket.reply(message, SocketMessage{LinkCode: message.LinkCode}, status, err)
+	}
+
+	if targetSignal.RequireApproval {
+		go answer()
+	} else {
+		answer()
+	}
+}
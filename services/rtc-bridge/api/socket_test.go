@@ -0,0 +1,94 @@
+package rtcbridgeapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	AppConfig "peergrine/rtc-bridge/app-config"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dialSocket connects to /ws with the token in the access_token query parameter. An empty
+// origin sends no Origin header.
+func (a *testAPI) dialSocket(token string, origin string) (*websocket.Conn, int, error) {
+	header := http.Header{}
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+
+	url := "ws" + strings.TrimPrefix(a.URL, "http") + "/ws?" + ACCESS_TOKEN + "=" + token
+	conn, res, err := websocket.DefaultDialer.Dial(url, header)
+
+	status := 0
+	if res != nil {
+		status = res.StatusCode
+	}
+	return conn, status, err
+}
+
+// 測試 WebSocket 只接受同源、允許的來源或沒有 Origin 的請求
+func TestServeSocketOrigin(t *testing.T) {
+	app := newTestAPI(t, func(config *AppConfig.AppConfig) {
+		config.AllowedOrigins = "https://app.example.com"
+	})
+	token := app.Login("client", "")
+
+	for _, origin := range []string{"", app.URL, "https://app.example.com", "HTTPS://APP.EXAMPLE.COM"} {
+		conn, _, err := app.dialSocket(token, origin)
+		if assert.NoError(t, err, origin) {
+			conn.Close()
+		}
+	}
+
+	_, status, err := app.dialSocket(token, "https://evil.example.com")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+// 測試存取日誌不會記錄查詢參數中的令牌
+func TestHideAccessToken(t *testing.T) {
+	var logs bytes.Buffer
+
+	router := gin.New()
+	router.Use(hideAccessToken, gin.LoggerWithWriter(&logs))
+	router.GET("ws", func(c *gin.Context) {
+		c.String(http.StatusOK, bearerToken(c))
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ws?"+ACCESS_TOKEN+"=secret-token&other=1", nil))
+	assert.Equal(t, "secret-token", recorder.Body.String(), "The token should still reach the handler")
+	assert.NotContains(t, logs.String(), "secret-token")
+	assert.Contains(t, logs.String(), "other=1")
+}
+
+// 測試每個 WebSocket 最多持有 SOCKET_MAX_OFFERS 個連結碼
+func TestSocketMaxOffers(t *testing.T) {
+	app := newTestAPI(t, nil)
+	token := app.Login("client", "")
+
+	conn, _, err := app.dialSocket(token, "")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	replies := make(map[int]int)
+	for i := 0; i <= SOCKET_MAX_OFFERS; i++ {
+		require.NoError(t, conn.WriteJSON(SocketMessage{Type: SOCKET_OFFER, Id: "offer", SDP: testSDP}))
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		var reply SocketMessage
+		require.NoError(t, conn.ReadJSON(&reply))
+		require.Equal(t, "offer", reply.Id)
+
+		replies[reply.Status]++
+	}
+
+	assert.Equal(t, map[int]int{0: SOCKET_MAX_OFFERS, http.StatusTooManyRequests: 1}, replies)
+}
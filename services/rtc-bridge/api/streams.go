@@ -0,0 +1,344 @@
+package rtcbridgeapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	Storage "peergrine/rtc-bridge/storage"
+	Auth "peergrine/utils/auth"
+	LinkCodes "peergrine/utils/link-code"
+	SessionDescription "peergrine/utils/session-description"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Stream kinds, also the names of the events carrying their offers to the owner of a link code.
+const (
+	STREAM_WHIP = "whip" // Ingest: the client sends media to the owner of the link code
+	STREAM_WHEP = "whep" // Playback: the client receives media from the owner of the link code
+)
+
+const CONTENT_TYPE_SDP = "application/sdp"
+
+// STREAM_ANSWER_WAIT bounds how long a WHIP or WHEP client waits for the owner to answer.
+const STREAM_ANSWER_WAIT = 30 * time.Second
+
+// streamClientId returns the ID under which the offer of a WHIP or WHEP client waits for the
+// answer of a link code owner. Deriving it from the owner lets only the owner answer, and keeps
+// the client channel of the user itself untouched.
+func streamClientId(ownerId string, clientId string) string {
+	return "stream:" + ownerId + ":" + clientId
+}
+
+// offerStream returns the WHIP or WHEP endpoint of a link code. The client posts its offer as
+// application/sdp, which reaches the owner of the link code as a whip or whep event, and gets
+// the answer of the owner back in the 201 response.
+func (app *API) offerStream(kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		linkCode := c.Param(PARAM_USER_LINK)
+
+		tokenPayload, err := getPlayload(c)
+		if err != nil {
+			Error(c, http.StatusForbidden, err.Error())
+			return
+		}
+
+		if c.ContentType() != CONTENT_TYPE_SDP {
+			Error(c, http.StatusUnsupportedMediaType, "Offer must be sent as "+CONTENT_TYPE_SDP)
+			return
+		}
+
+		keys := lookupKeys(c, tokenPayload)
+		if app.lookupLocked(c, keys) {
+			return
+		}
+
+		targetSignal, err := app.storage.GetSignal(linkCode)
+		if err != nil {
+			app.lookupFailed(keys)
+			Error(c, http.StatusNotFound, "Target signal not found")
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			Error(c, http.StatusBadRequest, "Failed to read the offer")
+			return
+		}
+
+		sdp := string(body)
+		if err := app.validateSDP(&sdp); err != nil {
+			Error(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var candidates []Candidate
+		app.filterSignal(tokenPayload, &sdp, &candidates)
+
+		answer, sessionId, status, err := app.exchangeStream(c.Request.Context(), tokenPayload, targetSignal, kind, sdp)
+		if err != nil {
+			Error(c, status, err.Error())
+			return
+		}
+
+		// Every session has a resource of its own, which outlives the link code.
+		app.linkIceServers(c, tokenPayload)
+		c.Header("Location", "../sessions/"+url.PathEscape(sessionId))
+		c.Data(http.StatusCreated, CONTENT_TYPE_SDP, []byte(answer))
+	}
+}
+
+// exchangeStream delivers the offer of a WHIP or WHEP client to the owner of a link code and
+// waits for the answer until ctx ends. It returns the answer and the ID of the new session.
+// The candidates of the answer are inserted into its SDP, as the client expects a complete
+// answer. Only an answered offer uses up the link code.
+func (app *API) exchangeStream(ctx context.Context, tokenPayload *Auth.TokenPayload, targetSignal *Storage.Signal, kind string, sdp string) (string, string, int, error) {
+
+	clientId := tokenPayload.UserId
+	ownerId := targetSignal.ClientId
+	streamId := streamClientId(ownerId, clientId)
+
+	reserved, err := app.storage.ReserveStreamOffer(ownerId, clientId, STREAM_ANSWER_WAIT)
+	if err != nil {
+		return "", "", http.StatusInternalServerError, err
+	}
+	if !reserved {
+		return "", "", http.StatusConflict, errors.New("An offer of this client to the link code owner is already waiting")
+	}
+	defer app.storage.ReleaseStreamOffer(ownerId, clientId)
+
+	// Subscribe before the owner can see the offer, so an early answer is not lost.
+	answers := app.signalChannels.Subscribe(clientKey(streamId))
+	defer app.signalChannels.Unsubscribe(clientKey(streamId), answers)
+
+	channel := newStreamChannel(app.config.Id, tokenPayload.Scope)
+	if err := app.storage.AddClientChannel(streamId, channel, STREAM_ANSWER_WAIT); err != nil {
+		return "", "", http.StatusInternalServerError, err
+	}
+	defer app.storage.RemoveClientChannel(streamId, channel)
+
+	sessionId := uuid.New().String()
+
+	envelope, err := app.keyring.Seal(tokenPayload.Iss, clientId, StreamData{
+		Type:      kind,
+		LinkCode:  targetSignal.LinkCode,
+		ClientId:  clientId,
+		SessionId: sessionId,
+		SDP:       sdp,
+	})
+	if err != nil {
+		return "", "", http.StatusInternalServerError, err
+	}
+
+	offer := SignalEvent{
+		Event:    kind,
+		SenderId: clientId,
+		Envelope: envelope,
+	}
+	if status, err := app.sendToLinkCode(targetSignal, offer, MESSAGE_TYPE+"-"+kind); err != nil {
+		return "", "", status, err
+	}
+
+	timeout := time.NewTimer(STREAM_ANSWER_WAIT)
+	defer timeout.Stop()
+
+	select {
+	case event, ok := <-answers.C():
+		if !ok {
+			return "", "", http.StatusServiceUnavailable, errors.New("Signal channel closed")
+		}
+		if event.Event != PEER_SIGNAL_ANSWER {
+			return "", "", http.StatusForbidden, errors.New("Offer was declined")
+		}
+
+		var answer PeerSignalData
+		if err := event.Envelope.Decode(&answer); err != nil {
+			return "", "", http.StatusInternalServerError, err
+		}
+
+		if err := app.storage.RedeemSignal(*targetSignal); err != nil {
+			// The owner answered after the last use was taken, so its session ends right away.
+			app.sendSessionBye(tokenPayload, Storage.StreamSession{Id: sessionId, ClientId: clientId, OwnerId: ownerId})
+			if errors.Is(err, LinkCodes.ErrExhausted) {
+				return "", "", http.StatusGone, errors.New("Link code has no remaining uses")
+			}
+			return "", "", http.StatusInternalServerError, err
+		}
+
+		for _, candidate := range answer.Candidates {
+			answer.SDP = SessionDescription.InsertCandidates(answer.SDP, *candidate.SdpMLineIndex, []string{*candidate.Candidate})
+		}
+
+		expiresAt := time.Now().Add(app.peerDuration).Unix()
+		if err := app.storage.SetPeer(clientId, ownerId, expiresAt); err != nil {
+			return "", "", http.StatusInternalServerError, err
+		}
+
+		// The client ends the session with DELETE /sessions/:session_id.
+		if err := app.storage.SetStreamSession(Storage.StreamSession{
+			Id:        sessionId,
+			ClientId:  clientId,
+			OwnerId:   ownerId,
+			ExpiresAt: expiresAt,
+		}); err != nil {
+			return "", "", http.StatusInternalServerError, err
+		}
+
+		return answer.SDP, sessionId, http.StatusOK, nil
+	case <-timeout.C:
+	case <-ctx.Done():
+	}
+
+	return "", "", http.StatusRequestTimeout, errors.New("Link code owner did not answer in time")
+}
+
+// answerStream lets the owner of a link code answer or decline the offer a WHIP or WHEP client
+// is waiting with.
+func (app *API) answerStream(c *gin.Context) {
+	clientId := c.Param(PARAM_USER_ID)
+
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	var answer StreamAnswer
+	if err := c.ShouldBindJSON(&answer); err != nil {
+		Error(c, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	if answer.Type == PEER_SIGNAL_ANSWER {
+		if err := app.validateSignal(&answer.SDP, answer.Candidates); err != nil {
+			Error(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		app.filterSignal(tokenPayload, &answer.SDP, &answer.Candidates)
+	}
+
+	ownerId := tokenPayload.UserId
+
+	envelope, err := app.keyring.Seal(tokenPayload.Iss, ownerId, PeerSignalData{
+		Type:       answer.Type,
+		ClientId:   ownerId,
+		SDP:        answer.SDP,
+		Candidates: answer.Candidates,
+	})
+	if err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	event := SignalEvent{
+		Event:    answer.Type,
+		SenderId: ownerId,
+		Envelope: envelope,
+	}
+
+	// WHIP and WHEP clients wait on the HTTP request, never on UnifiedMessage.
+	status, err := app.routeSignal(streamClientId(ownerId, clientId), event)
+	if status == http.StatusNotFound {
+		Error(c, status, "No offer of this client is waiting for an answer")
+		return
+	}
+	if err != nil {
+		Error(c, status, err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// endSession ends a WHIP or WHEP session, the resource its client deletes when it stops. The
+// owner of the link code receives a bye carrying the session ID.
+func (app *API) endSession(c *gin.Context) {
+	sessionId := c.Param(PARAM_SESSION_ID)
+
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	session, err := app.storage.GetStreamSession(sessionId)
+	if err != nil {
+		Error(c, http.StatusNotFound, "Session not found")
+		return
+	}
+	if session.ClientId != tokenPayload.UserId {
+		Error(c, http.StatusForbidden, "Session belongs to another client")
+		return
+	}
+
+	if status, err := app.sendSessionBye(tokenPayload, *session); err != nil {
+		Error(c, status, err.Error())
+		return
+	}
+
+	if err := app.storage.RemovePeer(session.ClientId, session.OwnerId); err != nil {
+		log.Printf("Failed to remove peer entry of %s and %s: %v\n", session.ClientId, session.OwnerId, err)
+	}
+	if err := app.storage.RemoveStreamSession(sessionId); err != nil {
+		Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// patchSession refuses PATCH on a WHIP or WHEP session: its offer and answer are complete, and
+// ICE restarts go through a new session.
+func (app *API) patchSession(c *gin.Context) {
+	c.Header("Allow", http.MethodDelete)
+	Error(c, http.StatusMethodNotAllowed, "Trickle ICE and ICE restarts are not supported for stream sessions")
+}
+
+// sendSessionBye tells the owner of the link code that a stream session has ended. An owner
+// that is no longer listening needs no bye.
+func (app *API) sendSessionBye(tokenPayload *Auth.TokenPayload, session Storage.StreamSession) (int, error) {
+
+	envelope, err := app.keyring.Seal(tokenPayload.Iss, session.ClientId, PeerSignalData{
+		Type:      PEER_SIGNAL_BYE,
+		ClientId:  session.ClientId,
+		SessionId: session.Id,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	status, err := app.deliverSignal(session.OwnerId, SignalEvent{
+		Event:    PEER_SIGNAL_BYE,
+		SenderId: session.ClientId,
+		Done:     true,
+		Envelope: envelope,
+	}, MESSAGE_TYPE+"-peer")
+	if status == http.StatusNotFound {
+		return http.StatusOK, nil
+	}
+
+	return status, err
+}
+
+// endPeer ends the call with a peer, like a bye sent to POST /peers/:user_id/signals.
+func (app *API) endPeer(c *gin.Context) {
+	peerId := c.Param(PARAM_USER_ID)
+
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if status, err := app.relayPeerSignal(tokenPayload, peerId, &PeerSignal{Type: PEER_SIGNAL_BYE}); err != nil {
+		Error(c, status, err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,108 @@
+package rtcbridgeapi
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamResult is the outcome of a WHIP or WHEP request.
+type streamResult struct {
+	status   int
+	location string
+	answer   string
+}
+
+// offerLater sends a WHIP offer to a link code in the background and returns a channel that
+// receives the outcome.
+func (a *testAPI) offerLater(token string, linkCode string) <-chan streamResult {
+	result := make(chan streamResult, 1)
+	go func() {
+		res := a.Request(context.Background(), http.MethodPost, "/whip/"+linkCode, token, nil, testSDP)
+		defer res.Body.Close()
+		answer, _ := io.ReadAll(res.Body)
+		result <- streamResult{status: res.StatusCode, location: res.Header.Get("Location"), answer: string(answer)}
+	}()
+	return result
+}
+
+// 測試拒絕的 offer 不佔用次數，以及同一客戶端同時只能有一個等待中的 offer
+func TestOfferStream(t *testing.T) {
+	app := newTestAPI(t, nil)
+	owner := app.Login("owner", "")
+	client := app.Login("client", "")
+
+	stream := app.createLinkCode(t, owner, "max_uses=1")
+	linkCode := stream.LinkCode.LinkCode
+
+	declined := app.offerLater(client, linkCode)
+
+	var offer StreamData
+	stream.next(t, &offer)
+	assert.Equal(t, STREAM_WHIP, offer.Type)
+	assert.Equal(t, "client", offer.ClientId)
+	assert.NotEmpty(t, offer.SessionId)
+
+	assert.Equal(t, http.StatusConflict, app.Status(http.MethodPost, "/whip/"+linkCode, client, testSDP), "A second offer of the same client should be refused while the first waits")
+
+	assert.Equal(t, http.StatusOK, app.Status(http.MethodPost, "/streams/client", owner, StreamAnswer{Type: "decline"}))
+	assert.Equal(t, http.StatusForbidden, (<-declined).status)
+
+	signal, err := app.storage.GetSignal(linkCode)
+	require.NoError(t, err)
+	assert.Equal(t, 1, signal.RemainingUses, "A declined offer should not use up the link code")
+
+	answered := app.offerLater(client, linkCode)
+	stream.next(t, &offer)
+
+	assert.Equal(t, http.StatusOK, app.Status(http.MethodPost, "/streams/client", owner, StreamAnswer{Type: PEER_SIGNAL_ANSWER, SDP: testSDP}))
+
+	result := <-answered
+	require.Equal(t, http.StatusCreated, result.status)
+	assert.Equal(t, "../sessions/"+offer.SessionId, result.location)
+	assert.True(t, strings.HasPrefix(result.answer, "v=0"))
+
+	assert.Equal(t, http.StatusNotFound, app.Status(http.MethodPost, "/whip/"+linkCode, client, testSDP), "The link code should end with its last use")
+}
+
+// 測試每個 WHIP/WHEP 會話有自己的資源，且不支援 PATCH
+func TestEndSession(t *testing.T) {
+	app := newTestAPI(t, nil)
+	owner := app.Login("owner", "")
+	client := app.Login("client", "")
+	other := app.Login("other", "")
+
+	stream := app.createLinkCode(t, owner, "max_uses=2")
+	linkCode := stream.LinkCode.LinkCode
+
+	sessions := make([]string, 0, 2)
+	for i := 0; i < 2; i++ {
+		answered := app.offerLater(client, linkCode)
+
+		var offer StreamData
+		stream.next(t, &offer)
+		require.Equal(t, http.StatusOK, app.Status(http.MethodPost, "/streams/client", owner, StreamAnswer{Type: PEER_SIGNAL_ANSWER, SDP: testSDP}))
+
+		result := <-answered
+		require.Equal(t, http.StatusCreated, result.status)
+		sessions = append(sessions, "/sessions/"+strings.TrimPrefix(result.location, "../sessions/"))
+	}
+	require.NotEqual(t, sessions[0], sessions[1])
+
+	res := app.Request(context.Background(), http.MethodPatch, sessions[0], client, nil, "a=end-of-candidates\r\n")
+	res.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+	assert.Equal(t, http.MethodDelete, res.Header.Get("Allow"))
+
+	assert.Equal(t, http.StatusForbidden, app.Status(http.MethodDelete, sessions[0], other, nil))
+	assert.Equal(t, http.StatusOK, app.Status(http.MethodDelete, sessions[0], client, nil))
+	assert.Equal(t, http.StatusNotFound, app.Status(http.MethodDelete, sessions[0], client, nil))
+
+	_, err := app.storage.GetStreamSession(strings.TrimPrefix(sessions[1], "/sessions/"))
+	assert.NoError(t, err, "Ending one session should leave the other")
+}
@@ -1,5 +1,11 @@
 package rtcbridgeapi
 
+import (
+	Envelope "peergrine/utils/envelope"
+	GenericChannels "peergrine/utils/generic-channels"
+	IceServers "peergrine/utils/ice-servers"
+)
+
 // Candidate represents a WebRTC candidate.
 type Candidate struct {
 	Candidate     *string `json:"candidate"`
@@ -14,15 +20,160 @@ type SignalData struct {
 	ChannelId  string      `json:"channel_id"`
 	SDP        string      `json:"sdp"`
 	Candidates []Candidate `json:"candidates"`
+	Trickle    bool        `json:"trickle"` // Further candidates follow through the candidates endpoints
+}
+
+// CandidateUpdate is the request body of the trickle ICE endpoints.
+type CandidateUpdate struct {
+	Candidates []Candidate `json:"candidates"`
+	Done       bool        `json:"done"` // End of candidates: the sender finished ICE gathering
+}
+
+// CandidateData is the content of a candidates event. Type tells it apart from an answer
+// on the stream of POST /.
+type CandidateData struct {
+	Type       string      `json:"type"`
+	ClientId   string      `json:"client_id"`
+	Candidates []Candidate `json:"candidates"`
+	Done       bool        `json:"done"`
+}
+
+// SignalOptions are the query options of POST / besides the link code options.
+type SignalOptions struct {
+	RequireApproval bool `form:"require_approval"` // Answers wait until the owner accepts their join request
 }
 
 // LinkCode contains the link code and expiration time.
 type LinkCode struct {
+	LinkCode        string `json:"link_code"`
+	ExpiresAt       int64  `json:"expires_at"`
+	MaxUses         int    `json:"max_uses"` // 0 when the link code can be answered until it expires
+	RequireApproval bool   `json:"require_approval,omitempty"`
+}
+
+// JoinDecision is the request body of POST /:user_link/requests/:user_id.
+type JoinDecision struct {
+	Decision string `json:"decision" binding:"required,oneof=accept decline"`
+}
+
+// JoinData is the content of the join request events: join and withdraw from the joiner to
+// the owner, accept, decline and cancel from the owner to the joiner.
+type JoinData struct {
+	Type       string `json:"type"`
+	LinkCode   string `json:"link_code"`
+	ClientId   string `json:"client_id"`             // Client the event is from
+	ClientName string `json:"client_name,omitempty"` // Name given in the answer, in join events
+}
+
+// PeerSignal is the request body of POST /peers/:user_id/signals.
+type PeerSignal struct {
+	Type       string      `json:"type" binding:"required,oneof=offer answer ice_restart bye"`
+	SDP        string      `json:"sdp"`        // Required for offer and answer, optional for ice_restart
+	Candidates []Candidate `json:"candidates"` // Optional, for offers and answers gathered without trickle ICE
+}
+
+// PeerSignalData is the content of the events relayed by POST /peers/:user_id/signals.
+type PeerSignalData struct {
+	Type       string      `json:"type"`
+	ClientId   string      `json:"client_id"`
+	SessionId  string      `json:"session_id,omitempty"` // WHIP or WHEP session ended by a bye
+	SDP        string      `json:"sdp,omitempty"`
+	Candidates []Candidate `json:"candidates,omitempty"`
+}
+
+// StreamData is the content of whip and whep events: the offer of a WHIP or WHEP client to
+// the owner of a link code.
+type StreamData struct {
+	Type      string `json:"type"` // whip or whep
 	LinkCode  string `json:"link_code"`
-	ExpiresAt int64  `json:"expires_at"`
+	ClientId  string `json:"client_id"`
+	SessionId string `json:"session_id"` // Session the client ends with DELETE /sessions/:session_id
+	SDP       string `json:"sdp"`
+}
+
+// StreamAnswer is the request body of POST /streams/:user_id.
+type StreamAnswer struct {
+	Type       string      `json:"type" binding:"required,oneof=answer decline"`
+	SDP        string      `json:"sdp"`        // Required for answers
+	Candidates []Candidate `json:"candidates"` // Added to the SDP, as WHIP and WHEP clients do not trickle
+}
+
+// QueueStats is the response of GET /stats: the overflow policy of the signal queues and what
+// happened to the events published to them since the service started.
+type QueueStats struct {
+	Overflow string                `json:"overflow"`
+	Stats    GenericChannels.Stats `json:"stats"`
 }
 
+// IceServerList is the response of GET /ice-servers.
+type IceServerList struct {
+	IceServers []IceServers.Server `json:"ice_servers"`
+	ExpiresAt  int64               `json:"expires_at"` // When the TURN credentials stop working
+	TTL        int64               `json:"ttl"`        // Lifetime of the TURN credentials in seconds
+}
+
+// SignalEvent is a sealed answer or candidates event queued for a signal stream.
+type SignalEvent struct {
+	Event    string             `json:"event,omitempty"`     // EVENT_ANSWER when empty
+	SenderId string             `json:"sender_id,omitempty"` // Client that sent the event
+	Trickle  bool               `json:"trickle,omitempty"`   // Answer whose candidates follow as candidates events
+	Done     bool               `json:"done,omitempty"`      // Last candidates event of the sender
+	Envelope *Envelope.Envelope `json:"envelope"`
+}
+
+// KafkerSignal carries a signal event to the instance waiting on a link code, or with
+// ClientId set, to the instance holding the signal stream of that client. With both set,
+// it carries the decision on a join request to the instance where the joiner waits.
+// A nil Envelope tells the instance to stop waiting on the link code.
 type KafkerSignal struct {
-	LinkCode string     `json:"link_code"`
-	Signal   SignalData `json:"signal"`
+	LinkCode string `json:"link_code,omitempty"`
+	ClientId string `json:"client_id,omitempty"`
+	Room     string `json:"room,omitempty"` // With ClientId, the room stream of that client
+	SignalEvent
+}
+
+// RoomCode contains the room code and expiration time.
+type RoomCode struct {
+	RoomCode   string `json:"room_code"`
+	ExpiresAt  int64  `json:"expires_at"`
+	MaxMembers int    `json:"max_members"`
+}
+
+// RoomSignal is the request body of POST /rooms/:room_code/members/:user_id.
+type RoomSignal struct {
+	Type       string      `json:"type" binding:"required,oneof=offer answer candidates"`
+	SDP        string      `json:"sdp"`
+	Candidates []Candidate `json:"candidates"`
+	Done       bool        `json:"done"` // End of candidates
+}
+
+// RoomEvent is the content of the events streamed to room members.
+type RoomEvent struct {
+	Type       string      `json:"type"` // roster, join, leave, offer, answer or candidates
+	RoomCode   string      `json:"room_code"`
+	ClientId   string      `json:"client_id"`         // Member the event is from or about
+	Members    []string    `json:"members,omitempty"` // Other members, in roster events
+	SDP        string      `json:"sdp,omitempty"`
+	Candidates []Candidate `json:"candidates,omitempty"`
+	Done       bool        `json:"done,omitempty"`
+}
+
+// SocketMessage is a message of the /ws endpoint in either direction. Clients set id to match
+// the ack or error the server replies with.
+type SocketMessage struct {
+	Type       string             `json:"type"`
+	Id         string             `json:"id,omitempty"`
+	To         string             `json:"to,omitempty"`        // Peer of a peer signal or candidates
+	LinkCode   string             `json:"link_code,omitempty"` // Link code answered, given candidates or created
+	ClientName string             `json:"client_name,omitempty"`
+	SDP        string             `json:"sdp,omitempty"`
+	Candidates []Candidate        `json:"candidates,omitempty"`
+	Trickle    bool               `json:"trickle,omitempty"`
+	Done       bool               `json:"done,omitempty"`
+	TTL        int64              `json:"ttl,omitempty"`        // Link code options of an offer, as for POST /
+	MaxUses    int                `json:"max_uses,omitempty"`   // Link code options of an offer, as for POST /, and in its ack
+	ExpiresAt  int64              `json:"expires_at,omitempty"` // In the ack of an offer
+	Envelope   *Envelope.Envelope `json:"envelope,omitempty"`   // Signed signal relayed from another client
+	Status     int                `json:"status,omitempty"`     // HTTP status equivalent of an error
+	Error      string             `json:"error,omitempty"`
 }
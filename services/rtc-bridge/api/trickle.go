@@ -0,0 +1,356 @@
+package rtcbridgeapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	Storage "peergrine/rtc-bridge/storage"
+	Auth "peergrine/utils/auth"
+	Envelope "peergrine/utils/envelope"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Signal event names. Answers keep an empty event name on the wire for compatibility.
+const (
+	EVENT_ANSWER     = ""
+	EVENT_CANDIDATES = "candidates"
+)
+
+// SIGNAL_CHANNEL_TTL is how long the registry entry of a GET /signals stream lives unless
+// the stream refreshes it, which it does every third of this interval.
+const SIGNAL_CHANNEL_TTL = 45 * time.Second
+
+// UNIFIED_MESSAGE_LISTENER is the listener ID of the client channel entries that record a
+// UnifiedMessage channel outside of a stream. Every request announcing the same channel
+// refreshes the same entry.
+const UNIFIED_MESSAGE_LISTENER = "unified-message"
+
+// newStreamChannel returns a client channel entry of its own for a stream, so the stream can
+// remove it on close without affecting the other streams of the client.
+func newStreamChannel(channelId string, scope string) Storage.ClientChannel {
+	return Storage.ClientChannel{ListenerId: uuid.New().String(), ChannelId: channelId, Scope: scope}
+}
+
+// unifiedMessageChannel returns the client channel entry of a UnifiedMessage channel.
+func unifiedMessageChannel(channelId string, scope string) Storage.ClientChannel {
+	return Storage.ClientChannel{ListenerId: UNIFIED_MESSAGE_LISTENER, ChannelId: channelId, Scope: scope}
+}
+
+// channelIds returns the distinct channels of client channel entries.
+func channelIds(channels []Storage.ClientChannel) []string {
+	seen := make(map[string]bool, len(channels))
+	ids := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		if !seen[channel.ChannelId] {
+			seen[channel.ChannelId] = true
+			ids = append(ids, channel.ChannelId)
+		}
+	}
+	return ids
+}
+
+// channelScopes returns the token scopes of client channel entries.
+func channelScopes(channels []Storage.ClientChannel) []string {
+	scopes := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		scopes = append(scopes, channel.Scope)
+	}
+	return scopes
+}
+
+// clientKey returns the subscription key of the signals addressed to a client. Link codes
+// never contain a colon, so the keys cannot collide.
+func clientKey(clientId string) string {
+	return "client:" + clientId
+}
+
+// deliverSignal sends an event to the signal stream of a client: over UnifiedMessage, to a
+// local GET /signals or POST / stream, or through Pulsar to the instance holding one.
+// The event passes the candidate filters of the scopes the client listens with.
+func (app *API) deliverSignal(targetId string, event SignalEvent, messageType string) (int, error) {
+
+	if app.unifiedMessageConnection != nil {
+		channels, err := app.storage.GetClientChannels(targetId)
+		if err != nil {
+			return http.StatusNotFound, fmt.Errorf("Client channel not found for target ID: %s", targetId)
+		}
+		envelope, err := app.filterForReceiver(event.Envelope, channelScopes(channels)...)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		for _, channelId := range channelIds(channels) {
+			if err := app.sendUnifiedMessage(channelId, targetId, messageType, envelope); err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+		return http.StatusOK, nil
+	}
+
+	return app.routeSignal(targetId, event)
+}
+
+// routeSignal sends an event to the local subscriptions of a client, and through Pulsar to
+// every other instance holding a stream of the client. Every stream registers a client
+// channel entry, and the event passes the strictest filter of their scopes.
+func (app *API) routeSignal(targetId string, event SignalEvent) (int, error) {
+
+	channels, err := app.storage.GetClientChannels(targetId)
+	if err != nil {
+		return http.StatusNotFound, fmt.Errorf("Target client is not listening for signals: %s", targetId)
+	}
+
+	if event.Envelope, err = app.filterForReceiver(event.Envelope, channelScopes(channels)...); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	delivered := app.signalChannels.Publish(clientKey(targetId), event)
+
+	if app.pulsar == nil {
+		if delivered {
+			return http.StatusOK, nil
+		}
+		return http.StatusNotFound, fmt.Errorf("Target client is not listening for signals: %s", targetId)
+	}
+
+	kafkerSignal := KafkerSignal{
+		ClientId:    targetId,
+		SignalEvent: event,
+	}
+	signalBytes, _ := json.Marshal(kafkerSignal)
+
+	for _, channelId := range channelIds(channels) {
+		if channelId == app.config.Id {
+			continue
+		}
+		if _, err := app.pulsar.SendMessage(channelId, signalBytes); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		delivered = true
+	}
+
+	if !delivered {
+		return http.StatusNotFound, fmt.Errorf("Target client is not listening for signals: %s", targetId)
+	}
+	return http.StatusOK, nil
+}
+
+// listenSignals streams the signals addressed to the caller rather than to a link code,
+// such as the candidates trickled by the offerer after an answer.
+func (app *API) listenSignals(c *gin.Context) {
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if app.unifiedMessageConnection != nil {
+		Error(c, http.StatusBadRequest, "Signals are delivered through UnifiedMessage")
+		return
+	}
+
+	clientId := tokenPayload.UserId
+	channel := newStreamChannel(app.config.Id, tokenPayload.Scope)
+
+	if err := app.storage.AddClientChannel(clientId, channel, SIGNAL_CHANNEL_TTL); err != nil {
+		Error(c, http.StatusInternalServerError, err)
+		return
+	}
+	defer app.storage.RemoveClientChannel(clientId, channel)
+
+	subscription := app.signalChannels.Subscribe(clientKey(clientId))
+	defer app.signalChannels.Unsubscribe(clientKey(clientId), subscription)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	closeNotify := c.Writer.CloseNotify()
+
+	heartbeat := time.NewTicker(SIGNAL_CHANNEL_TTL / 3)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closeNotify:
+			return
+		case <-heartbeat.C:
+			if err := app.storage.AddClientChannel(clientId, channel, SIGNAL_CHANNEL_TTL); err != nil {
+				log.Printf("Failed to refresh signal channel of %s: %v\n", clientId, err)
+			}
+		case event, ok := <-subscription.C():
+			if !ok {
+				return
+			}
+			eventBytes, _ := json.Marshal(event.Envelope)
+			c.Writer.Write(eventBytes)
+			c.Writer.Flush()
+		}
+	}
+}
+
+// bindCandidates reads, validates and filters a candidate update of the token holder.
+// It writes the error response itself and returns nil on failure.
+func (app *API) bindCandidates(c *gin.Context, tokenPayload *Auth.TokenPayload) *CandidateUpdate {
+	var update CandidateUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		Error(c, http.StatusBadRequest, "Invalid JSON format")
+		return nil
+	}
+
+	if err := app.checkCandidates(tokenPayload, &update); err != nil {
+		Error(c, http.StatusBadRequest, err.Error())
+		return nil
+	}
+
+	return &update
+}
+
+// checkCandidates validates a candidate update of the token holder and applies its candidate filter.
+func (app *API) checkCandidates(tokenPayload *Auth.TokenPayload, update *CandidateUpdate) error {
+	if err := app.validateCandidates(update.Candidates); err != nil {
+		return err
+	}
+
+	update.Candidates = filterCandidates(app.candidateFilter(tokenPayload), update.Candidates)
+	return nil
+}
+
+// addLinkCodeCandidates attaches candidates gathered after POST / to the offer stored under
+// a link code, so answerers that fetch the offer later receive them. Only the owner of the
+// link code may add candidates; answerers that already fetched the offer get them from
+// POST /peers/:user_id/candidates.
+func (app *API) addLinkCodeCandidates(c *gin.Context) {
+	targetLink := c.Param(PARAM_USER_LINK)
+
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	update := app.bindCandidates(c, tokenPayload)
+	if update == nil {
+		return
+	}
+
+	if status, err := app.addOfferCandidates(tokenPayload, targetLink, update); err != nil {
+		Error(c, status, err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// addOfferCandidates appends a checked candidate update to the offer stored under a link code
+// owned by the token holder.
+func (app *API) addOfferCandidates(tokenPayload *Auth.TokenPayload, linkCode string, update *CandidateUpdate) (int, error) {
+
+	// The offer is re-read and re-sealed if another update lands first, so concurrent
+	// updates of the owner append to each other instead of overwriting.
+	status := http.StatusInternalServerError
+
+	err := app.storage.UpdateSignal(linkCode, func(targetSignal *Storage.Signal) error {
+
+		if targetSignal.ClientId != tokenPayload.UserId {
+			status = http.StatusForbidden
+			return errors.New("Only the owner of the link code may add candidates")
+		}
+
+		var envelope Envelope.Envelope
+		if err := json.Unmarshal(targetSignal.SignalBytes, &envelope); err != nil {
+			return err
+		}
+
+		var signal SignalData
+		if err := envelope.Decode(&signal); err != nil {
+			return err
+		}
+
+		// The stored offer stays within the same bounds as one sent in a single request.
+		if err := app.validateCandidates(append(signal.Candidates, update.Candidates...)); err != nil {
+			status = http.StatusBadRequest
+			return err
+		}
+
+		signal.Candidates = append(signal.Candidates, update.Candidates...)
+		if update.Done {
+			signal.Trickle = false
+		}
+
+		sealed, err := app.keyring.Seal(tokenPayload.Iss, tokenPayload.UserId, signal)
+		if err != nil {
+			return err
+		}
+
+		targetSignal.SignalBytes, _ = json.Marshal(sealed)
+		return nil
+	})
+
+	if errors.Is(err, Storage.ErrSignalNotFound) {
+		return http.StatusBadRequest, errors.New("Target signal not found")
+	}
+	if err != nil {
+		return status, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// sendPeerCandidates trickles candidates to a client the caller exchanged an offer and an
+// answer with. An update with done set marks the end of the caller's candidates.
+func (app *API) sendPeerCandidates(c *gin.Context) {
+	peerId := c.Param(PARAM_USER_ID)
+
+	tokenPayload, err := getPlayload(c)
+	if err != nil {
+		Error(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	update := app.bindCandidates(c, tokenPayload)
+	if update == nil {
+		return
+	}
+
+	if status, err := app.relayPeerCandidates(tokenPayload, peerId, update); err != nil {
+		Error(c, status, err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// relayPeerCandidates delivers a checked candidate update of the token holder to a peer.
+func (app *API) relayPeerCandidates(tokenPayload *Auth.TokenPayload, peerId string, update *CandidateUpdate) (int, error) {
+
+	// Candidates keep the call alive like any other peer signal.
+	if status, err := app.extendPeer(tokenPayload, peerId); err != nil {
+		return status, err
+	}
+
+	envelope, err := app.keyring.Seal(tokenPayload.Iss, tokenPayload.UserId, CandidateData{
+		Type:       EVENT_CANDIDATES,
+		ClientId:   tokenPayload.UserId,
+		Candidates: update.Candidates,
+		Done:       update.Done,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	event := SignalEvent{
+		Event:    EVENT_CANDIDATES,
+		SenderId: tokenPayload.UserId,
+		Done:     update.Done,
+		Envelope: envelope,
+	}
+
+	return app.deliverSignal(peerId, event, MESSAGE_TYPE+"-"+EVENT_CANDIDATES)
+}
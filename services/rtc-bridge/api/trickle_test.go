@@ -0,0 +1,118 @@
+package rtcbridgeapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	Envelope "peergrine/utils/envelope"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 測試同時附加至連結碼的候選不會互相覆蓋
+func TestAddLinkCodeCandidates(t *testing.T) {
+	app := newTestAPI(t, nil)
+	owner := app.Login("owner", "")
+	answerer := app.Login("answerer", "")
+
+	stream := app.createLinkCode(t, owner, "")
+
+	const updates = 10
+	statuses := make([]int, updates)
+
+	var wg sync.WaitGroup
+	for i := 0; i < updates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			update := CandidateUpdate{Candidates: []Candidate{candidate(50000 + i)}}
+			statuses[i] = app.Status(http.MethodPost, "/"+stream.LinkCode.LinkCode+"/candidates", owner, update)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, status := range statuses {
+		assert.Equal(t, http.StatusOK, status)
+	}
+
+	res := app.Request(context.Background(), http.MethodGet, "/"+stream.LinkCode.LinkCode, answerer, nil, nil)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var envelope Envelope.Envelope
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&envelope))
+
+	var signal SignalData
+	require.NoError(t, envelope.Decode(&signal))
+	assert.Len(t, signal.Candidates, updates, "Every concurrent update should be kept")
+
+	update := CandidateUpdate{Candidates: []Candidate{candidate(60000)}}
+	assert.Equal(t, http.StatusForbidden, app.Status(http.MethodPost, "/"+stream.LinkCode.LinkCode+"/candidates", answerer, update))
+}
+
+// 測試客戶端的一個信號串流關閉時，其他串流仍可收到信號
+func TestSignalStreams(t *testing.T) {
+	app := newTestAPI(t, nil)
+	sender := app.Login("sender", "")
+	receiver := app.Login("receiver", "")
+
+	require.NoError(t, app.storage.SetPeer("sender", "receiver", time.Now().Add(time.Hour).Unix()))
+
+	listen := func() context.CancelFunc {
+		ctx, cancel := context.WithCancel(context.Background())
+		res := app.Request(ctx, http.MethodGet, "/signals", receiver, nil, nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		go io.Copy(io.Discard, res.Body)
+		return cancel
+	}
+
+	listeners := func() int {
+		channels, _ := app.storage.GetClientChannels("receiver")
+		return len(channels)
+	}
+
+	closeFirst := listen()
+	closeSecond := listen()
+	defer closeSecond()
+	require.Equal(t, 2, listeners())
+
+	update := CandidateUpdate{Candidates: []Candidate{candidate(50000)}}
+
+	closeFirst()
+	require.Eventually(t, func() bool { return listeners() == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusOK, app.Status(http.MethodPost, "/peers/receiver/candidates", sender, update), "The second stream should still receive signals")
+
+	closeSecond()
+	require.Eventually(t, func() bool { return listeners() == 0 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusNotFound, app.Status(http.MethodPost, "/peers/receiver/candidates", sender, update))
+}
+
+// 測試經另一個實例附加的候選，在共用 Redis 時可從建立連結碼的實例取得
+func TestAddLinkCodeCandidatesAcrossInstances(t *testing.T) {
+	apis := newTestAPIs(t, 2)
+	first, second := apis[0], apis[1]
+	owner := first.Login("owner", "")
+	second.Login("owner", "")
+	answerer := first.Login("answerer", "")
+
+	stream := first.createLinkCode(t, owner, "")
+
+	update := CandidateUpdate{Candidates: []Candidate{candidate(50000)}}
+	require.Equal(t, http.StatusOK, second.Status(http.MethodPost, "/"+stream.LinkCode.LinkCode+"/candidates", owner, update))
+
+	res := first.Request(context.Background(), http.MethodGet, "/"+stream.LinkCode.LinkCode, answerer, nil, nil)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var envelope Envelope.Envelope
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&envelope))
+
+	var signal SignalData
+	require.NoError(t, envelope.Decode(&signal))
+	assert.Len(t, signal.Candidates, 1, "The candidate added on the other instance should be returned")
+}
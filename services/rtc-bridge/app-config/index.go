@@ -10,23 +10,87 @@ import (
 )
 
 const (
-	_DEFAULT_ADDRESS              = ":80"
-	_DEFAULT_AUTHORIZE_ADDRESS    = "" // auth:50051
-	_DEFAULT_REDIS_ADDRESS        = "" // redis:6379
-	_DEFAULT_PULSAR_ADDRESSES     = "" // pulsar://pulsar-broker:6650
-	_DEFAULT_PULSAR_TOPIC         = "RtcBridge"
-	_DEFAULT_UNIFIED_MESSAGE_ADDR = ""
-	_DEFAULT_ZK_CONFIG_PATH       = "/rtc-bridge"
+	_DEFAULT_ADDRESS                = ":80"
+	_DEFAULT_AUTHORIZE_ADDRESS      = "" // auth:50051
+	_DEFAULT_SERVICE_TOKEN          = ""
+	_DEFAULT_REDIS_ADDRESS          = "" // redis:6379
+	_DEFAULT_PULSAR_ADDRESSES       = "" // pulsar://pulsar-broker:6650
+	_DEFAULT_PULSAR_TOPIC           = "RtcBridge"
+	_DEFAULT_UNIFIED_MESSAGE_ADDR   = ""
+	_DEFAULT_LINK_CODE_LENGTH       = "8"
+	_DEFAULT_LINK_CODE_DURATION     = "300"
+	_DEFAULT_LINK_CODE_MIN_DURATION = "30"
+	_DEFAULT_LINK_CODE_MAX_DURATION = "3600"
+	_DEFAULT_LINK_CODE_MAX_USES     = "0"
+	_DEFAULT_LINK_CODE_DEFAULT_USES = "1"
+	_DEFAULT_LOOKUP_MAX_FAILURES    = "10"
+	_DEFAULT_LOOKUP_FAILURE_WINDOW  = "60"
+	_DEFAULT_LOOKUP_LOCKOUT         = "300"
+	_DEFAULT_TRUSTED_PROXIES        = "" // 10.0.0.0/8,192.168.1.2
+	_DEFAULT_ALLOWED_ORIGINS        = "" // https://app.example.com,https://admin.example.com
+	_DEFAULT_PEER_DURATION          = "3600"
+	_DEFAULT_ROOM_MAX_MEMBERS       = "8"
+	_DEFAULT_STUN_URLS              = "" // stun:stun.example.com:3478
+	_DEFAULT_TURN_URLS              = "" // turn:turn.example.com:3478?transport=udp,turns:turn.example.com:5349
+	_DEFAULT_TURN_SECRET            = ""
+	_DEFAULT_TURN_CREDENTIAL_TTL    = "86400"
+	_DEFAULT_TURN_EMBEDDED          = "false"
+	_DEFAULT_TURN_PUBLIC_IP         = ""
+	_DEFAULT_TURN_UDP_PORT          = "3478"
+	_DEFAULT_TURN_TCP_PORT          = "3478"
+	_DEFAULT_TURN_RELAY_MIN_PORT    = "0"
+	_DEFAULT_TURN_RELAY_MAX_PORT    = "0"
+	_DEFAULT_TURN_REALM             = "peergrine"
+	_DEFAULT_TURN_MAX_ALLOCATIONS   = "10"
+	_DEFAULT_TURN_MAX_BANDWIDTH     = "1048576"
+	_DEFAULT_TURN_ALLOWED_PEERS     = "" // 10.0.0.0/8,192.168.1.20
+	_DEFAULT_SDP_MAX_SIZE           = "65536"
+	_DEFAULT_SDP_CODECS             = "" // opus,vp8,h264
+	_DEFAULT_CANDIDATE_FILTERS      = "" // no-private-host,no-ipv6
+	_DEFAULT_SCOPE_FILTERS          = "" // bot=relay-only+no-tcp;guest=relay-only
+	_DEFAULT_ZK_CONFIG_PATH         = "/rtc-bridge"
 )
 
 type AppConfig struct {
-	Id                 string `json:"-" config:"APP_ID"`
-	Addr               string `json:"address" config:"APP_ADDR"`
-	AuthAddr           string `json:"auth_address" config:"APP_AUTH_ADDR"`
-	RedisAddr          string `json:"redis_address" config:"APP_REDIS_ADDR"`
-	PulsarAddrs        string `json:"pulsar_addresses" config:"APP_PULSAR_ADDRS"`
-	PulsarTopic        string `json:"pulsar_topic" config:"APP_PULSAR_TOPIC"`
-	UnifiedMessageAddr string `json:"unified_message_address" config:"APP_UNIFIED_MESSAGE_ADDR"`
+	Id                  string `json:"-" config:"APP_ID"`
+	Addr                string `json:"address" config:"APP_ADDR"`
+	AuthAddr            string `json:"auth_address" config:"APP_AUTH_ADDR"`
+	ServiceToken        string `json:"service_token" config:"APP_SERVICE_TOKEN" mask:"true"`
+	RedisAddr           string `json:"redis_address" config:"APP_REDIS_ADDR"`
+	PulsarAddrs         string `json:"pulsar_addresses" config:"APP_PULSAR_ADDRS"`
+	PulsarTopic         string `json:"pulsar_topic" config:"APP_PULSAR_TOPIC"`
+	UnifiedMessageAddr  string `json:"unified_message_address" config:"APP_UNIFIED_MESSAGE_ADDR"`
+	LinkCodeLength      string `json:"link_code_length" config:"APP_LINK_CODE_LENGTH"`
+	LinkCodeDuration    string `json:"link_code_duration" config:"APP_LINK_CODE_DURATION"`
+	LinkCodeMinDuration string `json:"link_code_min_duration" config:"APP_LINK_CODE_MIN_DURATION"`
+	LinkCodeMaxDuration string `json:"link_code_max_duration" config:"APP_LINK_CODE_MAX_DURATION"`
+	LinkCodeMaxUses     string `json:"link_code_max_uses" config:"APP_LINK_CODE_MAX_USES"`
+	LinkCodeDefaultUses string `json:"link_code_default_uses" config:"APP_LINK_CODE_DEFAULT_USES"`
+	LookupMaxFailures   string `json:"lookup_max_failures" config:"APP_LOOKUP_MAX_FAILURES"`
+	LookupFailureWindow string `json:"lookup_failure_window" config:"APP_LOOKUP_FAILURE_WINDOW"`
+	LookupLockout       string `json:"lookup_lockout" config:"APP_LOOKUP_LOCKOUT"`
+	TrustedProxies      string `json:"trusted_proxies" config:"APP_TRUSTED_PROXIES"`
+	AllowedOrigins      string `json:"allowed_origins" config:"APP_ALLOWED_ORIGINS"`
+	PeerDuration        string `json:"peer_duration" config:"APP_PEER_DURATION"`
+	RoomMaxMembers      string `json:"room_max_members" config:"APP_ROOM_MAX_MEMBERS"`
+	StunUrls            string `json:"stun_urls" config:"APP_STUN_URLS"`
+	TurnUrls            string `json:"turn_urls" config:"APP_TURN_URLS"`
+	TurnSecret          string `json:"turn_secret" config:"APP_TURN_SECRET" mask:"true"`
+	TurnCredentialTTL   string `json:"turn_credential_ttl" config:"APP_TURN_CREDENTIAL_TTL"`
+	TurnEmbedded        string `json:"turn_embedded" config:"APP_TURN_EMBEDDED"`
+	TurnPublicIP        string `json:"turn_public_ip" config:"APP_TURN_PUBLIC_IP"`
+	TurnUDPPort         string `json:"turn_udp_port" config:"APP_TURN_UDP_PORT"`
+	TurnTCPPort         string `json:"turn_tcp_port" config:"APP_TURN_TCP_PORT"`
+	TurnRelayMinPort    string `json:"turn_relay_min_port" config:"APP_TURN_RELAY_MIN_PORT"`
+	TurnRelayMaxPort    string `json:"turn_relay_max_port" config:"APP_TURN_RELAY_MAX_PORT"`
+	TurnRealm           string `json:"turn_realm" config:"APP_TURN_REALM"`
+	TurnMaxAllocations  string `json:"turn_max_allocations" config:"APP_TURN_MAX_ALLOCATIONS"`
+	TurnMaxBandwidth    string `json:"turn_max_bandwidth" config:"APP_TURN_MAX_BANDWIDTH"`
+	TurnAllowedPeers    string `json:"turn_allowed_peers" config:"APP_TURN_ALLOWED_PEERS"`
+	SdpMaxSize          string `json:"sdp_max_size" config:"APP_SDP_MAX_SIZE"`
+	SdpCodecs           string `json:"sdp_codecs" config:"APP_SDP_CODECS"`
+	CandidateFilters    string `json:"candidate_filters" config:"APP_CANDIDATE_FILTERS"`
+	ScopeFilters        string `json:"scope_filters" config:"APP_SCOPE_CANDIDATE_FILTERS"`
 }
 
 func Init() (*AppConfig, error) {
@@ -48,12 +112,44 @@ func Init() (*AppConfig, error) {
 	)
 
 	appConfig := &AppConfig{
-		Addr:               _DEFAULT_ADDRESS,
-		AuthAddr:           _DEFAULT_AUTHORIZE_ADDRESS,
-		RedisAddr:          _DEFAULT_REDIS_ADDRESS,
-		PulsarAddrs:        _DEFAULT_PULSAR_ADDRESSES,
-		PulsarTopic:        _DEFAULT_PULSAR_TOPIC,
-		UnifiedMessageAddr: _DEFAULT_UNIFIED_MESSAGE_ADDR,
+		Addr:                _DEFAULT_ADDRESS,
+		AuthAddr:            _DEFAULT_AUTHORIZE_ADDRESS,
+		ServiceToken:        _DEFAULT_SERVICE_TOKEN,
+		RedisAddr:           _DEFAULT_REDIS_ADDRESS,
+		PulsarAddrs:         _DEFAULT_PULSAR_ADDRESSES,
+		PulsarTopic:         _DEFAULT_PULSAR_TOPIC,
+		UnifiedMessageAddr:  _DEFAULT_UNIFIED_MESSAGE_ADDR,
+		LinkCodeLength:      _DEFAULT_LINK_CODE_LENGTH,
+		LinkCodeDuration:    _DEFAULT_LINK_CODE_DURATION,
+		LinkCodeMinDuration: _DEFAULT_LINK_CODE_MIN_DURATION,
+		LinkCodeMaxDuration: _DEFAULT_LINK_CODE_MAX_DURATION,
+		LinkCodeMaxUses:     _DEFAULT_LINK_CODE_MAX_USES,
+		LinkCodeDefaultUses: _DEFAULT_LINK_CODE_DEFAULT_USES,
+		LookupMaxFailures:   _DEFAULT_LOOKUP_MAX_FAILURES,
+		LookupFailureWindow: _DEFAULT_LOOKUP_FAILURE_WINDOW,
+		LookupLockout:       _DEFAULT_LOOKUP_LOCKOUT,
+		TrustedProxies:      _DEFAULT_TRUSTED_PROXIES,
+		AllowedOrigins:      _DEFAULT_ALLOWED_ORIGINS,
+		PeerDuration:        _DEFAULT_PEER_DURATION,
+		RoomMaxMembers:      _DEFAULT_ROOM_MAX_MEMBERS,
+		StunUrls:            _DEFAULT_STUN_URLS,
+		TurnUrls:            _DEFAULT_TURN_URLS,
+		TurnSecret:          _DEFAULT_TURN_SECRET,
+		TurnCredentialTTL:   _DEFAULT_TURN_CREDENTIAL_TTL,
+		TurnEmbedded:        _DEFAULT_TURN_EMBEDDED,
+		TurnPublicIP:        _DEFAULT_TURN_PUBLIC_IP,
+		TurnUDPPort:         _DEFAULT_TURN_UDP_PORT,
+		TurnTCPPort:         _DEFAULT_TURN_TCP_PORT,
+		TurnRelayMinPort:    _DEFAULT_TURN_RELAY_MIN_PORT,
+		TurnRelayMaxPort:    _DEFAULT_TURN_RELAY_MAX_PORT,
+		TurnRealm:           _DEFAULT_TURN_REALM,
+		TurnMaxAllocations:  _DEFAULT_TURN_MAX_ALLOCATIONS,
+		TurnMaxBandwidth:    _DEFAULT_TURN_MAX_BANDWIDTH,
+		TurnAllowedPeers:    _DEFAULT_TURN_ALLOWED_PEERS,
+		SdpMaxSize:          _DEFAULT_SDP_MAX_SIZE,
+		SdpCodecs:           _DEFAULT_SDP_CODECS,
+		CandidateFilters:    _DEFAULT_CANDIDATE_FILTERS,
+		ScopeFilters:        _DEFAULT_SCOPE_FILTERS,
 	}
 
 	log.Println("Reading environment configuration values...")
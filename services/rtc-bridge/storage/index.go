@@ -1,21 +1,35 @@
 package storage
 
 import (
+	"encoding/json"
 	"errors"
 	GenericStorage "peergrine/utils/generic-storage"
+	LinkCodes "peergrine/utils/link-code"
+	"strconv"
+	"time"
 )
 
 const (
-	REDIS_PREFIX_LINKCODE = "signal-linkcode:"
+	REDIS_PREFIX_LINKCODE      = "signal-linkcode:"
+	REDIS_PREFIX_LINKCODE_USES = "signal-linkcode-uses:"
 )
 
+// _UPDATE_SIGNAL_ATTEMPTS bounds how often UpdateSignal retries after losing a race.
+const _UPDATE_SIGNAL_ATTEMPTS = 5
+
+// ErrSignalNotFound is returned when a link code has expired or was removed.
+var ErrSignalNotFound = errors.New("signal not found")
+
 // Signal represents a communication signal with metadata such as LinkCode, ClientId, etc.
 type Signal struct {
-	LinkCode    string
-	ClientId    string
-	SignalBytes []byte
-	ChannelId   string
-	ExpiresAt   int64
+	LinkCode        string
+	ClientId        string
+	SignalBytes     []byte
+	ChannelId       string
+	ExpiresAt       int64
+	RemainingUses   int
+	RequireApproval bool   // Answers wait for the owner to accept their join request
+	Scope           string // Token scope of the owner, whose candidate filter applies to the answers
 }
 
 // NewSignal creates a new Signal instance with the provided client ID, signal data, and expiration time.
@@ -49,6 +63,27 @@ func (s *Signal) SetChannelId(channelId string) {
 	s.ChannelId = channelId
 }
 
+// SetRemainingUses sets how many answers the Signal accepts before its link code is deleted.
+// Parameters:
+//   - remainingUses (int): The number of redemptions left, 0 for unlimited.
+func (s *Signal) SetRemainingUses(remainingUses int) {
+	s.RemainingUses = remainingUses
+}
+
+// SetRequireApproval sets whether answers need the approval of the owner before they are forwarded.
+// Parameters:
+//   - requireApproval (bool): true if the owner accepts or declines each join request.
+func (s *Signal) SetRequireApproval(requireApproval bool) {
+	s.RequireApproval = requireApproval
+}
+
+// SetScope sets the token scope of the owner, which decides the candidate filter of the signals it receives.
+// Parameters:
+//   - scope (string): The scope of the owner's token.
+func (s *Signal) SetScope(scope string) {
+	s.Scope = scope
+}
+
 // GetKey returns the LinkCode as the key for the signal.
 // Returns:
 //   - string: The link code of the signal.
@@ -66,6 +101,11 @@ func (s Signal) GetExpiresAt() int64 {
 // Storage manages Signal storage and retrieval, using either Redis or local storage.
 type Storage struct {
 	*GenericStorage.Storage[Signal]
+	routes       *GenericStorage.LocalStorageManager[Route]
+	sessions     *GenericStorage.LocalStorageManager[StreamSession]
+	channelStore *channelStore
+	roomStore    *roomStore
+	joinStore    *joinStore
 }
 
 // New creates a new instance of the Storage to manage signals.
@@ -80,29 +120,102 @@ func New(channelId string, redisAddr string) (*Storage, error) {
 	if err != nil {
 		return nil, err
 	}
-	storage := &Storage{s}
+	storage := &Storage{
+		Storage:      s,
+		routes:       GenericStorage.NewLocalStorageManager[Route](),
+		sessions:     GenericStorage.NewLocalStorageManager[StreamSession](),
+		channelStore: newChannelStore(),
+		roomStore:    newRoomStore(),
+		joinStore:    newJoinStore(),
+	}
 	return storage, nil
 }
 
-// SetSignal storages a Signal into either Redis or local storage.
+// Close releases the route, session and room stores along with the underlying generic storage.
+// Returns:
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) Close() error {
+	m.routes.Close()
+	m.sessions.Close()
+	m.roomStore.rooms.Close()
+	return m.Storage.Close()
+}
+
+// ReserveSignal stores a Signal only if its link code is not taken yet.
+// In Redis the check and the write are a single SET NX, so concurrent instances cannot
+// hand out the same link code. Signals in Redis are not cached locally, since other
+// instances update and remove them.
 // Parameters:
-//   - linkCode (string): The link code of the signal.
 //   - signal (Signal): The signal data to storage.
 //
 // Returns:
+//   - bool: true if the link code was reserved, false if it is already in use.
 //   - error: nil if successful, otherwise an error message.
-func (m *Storage) SetSignal(signal Signal) error {
-	m.Local.Set(signal)
+func (m *Storage) ReserveSignal(signal Signal) (bool, error) {
+
+	if m.Redis == nil {
+		return m.Local.SetIfAbsent(signal), nil
+	}
+
+	key := REDIS_PREFIX_LINKCODE + signal.GetKey()
+	reserved, err := m.SetToRedisNX(key, signal)
+	if err != nil || !reserved {
+		return false, err
+	}
+
+	if signal.RemainingUses > 0 {
+		key := REDIS_PREFIX_LINKCODE_USES + signal.GetKey()
+		duration := time.Until(time.Unix(signal.ExpiresAt, 0))
+		if err := m.Redis.Set(key, []byte(strconv.Itoa(signal.RemainingUses)), duration); err != nil {
+			m.Redis.Del(REDIS_PREFIX_LINKCODE + signal.GetKey())
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// RedeemSignal consumes one use of a limited link code and deletes the signal on its last use.
+// Parameters:
+//   - signal (Signal): The signal being answered.
+//
+// Returns:
+//   - error: LinkCodes.ErrExhausted if the last use was already taken, otherwise nil if successful.
+func (m *Storage) RedeemSignal(signal Signal) error {
+
+	if signal.RemainingUses <= 0 {
+		return nil
+	}
 
 	if m.Redis != nil {
-		key := REDIS_PREFIX_LINKCODE + signal.GetKey()
-		return m.SetToRedis(key, signal)
+		key := REDIS_PREFIX_LINKCODE_USES + signal.GetKey()
+
+		remaining, err := m.Redis.Decr(key)
+		if err != nil {
+			return err
+		}
+		if remaining < 0 {
+			m.Redis.Del(key)
+			return LinkCodes.ErrExhausted
+		}
+		if remaining == 0 {
+			return m.RemoveSignal(signal.GetKey())
+		}
+		return nil
+	}
+
+	exists := m.Local.Update(signal.GetKey(), func(signal *Signal) bool {
+		signal.RemainingUses--
+		return signal.RemainingUses > 0
+	})
+	if !exists {
+		return LinkCodes.ErrExhausted
 	}
 
 	return nil
 }
 
-// GetSignal retrieves a Signal from either Redis or local storage based on the provided link code.
+// GetSignal retrieves a Signal from Redis if it is configured, otherwise from local storage.
 // Parameters:
 //   - linkCode (string): The link code of the signal to retrieve.
 //
@@ -111,41 +224,80 @@ func (m *Storage) SetSignal(signal Signal) error {
 //   - error: nil if successful, otherwise an error message.
 func (m *Storage) GetSignal(linkCode string) (*Signal, error) {
 
+	if m.Redis != nil {
+		key := REDIS_PREFIX_LINKCODE + linkCode
+		return m.GetFromRedis(key)
+	}
+
 	localSignal := m.Local.Get(linkCode)
 
 	if localSignal != nil {
 		return localSignal, nil
 	}
 
-	if m.Redis != nil {
-		key := REDIS_PREFIX_LINKCODE + linkCode
-		return m.GetFromRedis(key)
-	}
-
 	return nil, errors.New("no storage manager configured")
 }
 
-// SignalExist checks if a signal with the given link code exists in either Redis or local storage.
+// UpdateSignal applies update to the stored data of a signal whose link code is still reserved,
+// keeping its expiration time. In Redis the change is written with a compare-and-swap and
+// update runs again on the latest data if another instance changed the signal in between,
+// so concurrent updates are not lost and an expired link code is never recreated.
+// Remaining uses are tracked separately and are not affected.
 // Parameters:
-//   - linkCode (string): The link code to check.
+//   - linkCode (string): The link code of the signal.
+//   - update (func(*Signal) error): Changes the signal, or returns an error to leave it as is.
 //
 // Returns:
-//   - bool: true if the signal exists, false otherwise.
-//   - error: nil if successful, otherwise an error message.
-func (m *Storage) SignalExists(linkCode string) (bool, error) {
-
-	localExists := m.Local.Exists(linkCode)
+//   - error: ErrSignalNotFound if the link code is gone, the error of update, or nil if successful.
+func (m *Storage) UpdateSignal(linkCode string, update func(signal *Signal) error) error {
 
-	if localExists {
-		return localExists, nil
+	if m.Redis == nil {
+		var updateErr error
+		exists := m.Local.Update(linkCode, func(signal *Signal) bool {
+			updateErr = update(signal)
+			return true
+		})
+		if !exists {
+			return ErrSignalNotFound
+		}
+		return updateErr
 	}
 
-	if m.Redis != nil {
-		key := REDIS_PREFIX_LINKCODE + linkCode
-		return m.Redis.Exists(key)
+	key := REDIS_PREFIX_LINKCODE + linkCode
+
+	for attempt := 0; attempt < _UPDATE_SIGNAL_ATTEMPTS; attempt++ {
+
+		current, err := m.Redis.Get(key)
+		if err != nil {
+			return ErrSignalNotFound
+		}
+
+		var signal Signal
+		if err := json.Unmarshal(current, &signal); err != nil {
+			return err
+		}
+
+		if err := update(&signal); err != nil {
+			return err
+		}
+
+		updated, err := json.Marshal(signal)
+		if err != nil {
+			return err
+		}
+
+		swapped, err := m.Redis.CompareAndSwap(key, current, updated)
+		if err != nil {
+			return err
+		}
+		if swapped {
+			return nil
+		}
+
+		// Either another update won, which the next attempt builds on, or the link code expired.
 	}
 
-	return false, nil
+	return errors.New("signal is being updated concurrently")
 }
 
 // RemoveSignal deletes a signal from either Redis or local storage.
@@ -156,12 +308,13 @@ func (m *Storage) SignalExists(linkCode string) (bool, error) {
 //   - error: nil if successful, otherwise an error message.
 func (m *Storage) RemoveSignal(linkCode string) error {
 
-	m.Local.Remove(linkCode)
-
 	if m.Redis != nil {
+		m.Redis.Del(REDIS_PREFIX_LINKCODE_USES + linkCode)
+
 		key := REDIS_PREFIX_LINKCODE + linkCode
 		return m.Redis.Del(key)
 	}
 
+	m.Local.Remove(linkCode)
 	return nil
 }
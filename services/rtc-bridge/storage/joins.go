@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const REDIS_PREFIX_JOIN_REQUESTS = "signal-join-requests:"
+
+// JoinRequest is an answer to a link code that waits for the approval of the link code owner.
+type JoinRequest struct {
+	ClientId  string
+	ChannelId string // The instance holding the request of the joiner
+}
+
+// member returns the sorted set member of the request. ChannelId is last because it may contain colons.
+func (r JoinRequest) member() string {
+	return r.ClientId + ":" + r.ChannelId
+}
+
+// parseJoinRequest reverses JoinRequest.member.
+func parseJoinRequest(member string) (JoinRequest, bool) {
+	clientId, channelId, found := strings.Cut(member, ":")
+	if !found {
+		return JoinRequest{}, false
+	}
+	return JoinRequest{ClientId: clientId, ChannelId: channelId}, true
+}
+
+// joinStore keeps the join requests of link codes when Redis is not configured.
+type joinStore struct {
+	mutex    sync.Mutex
+	requests map[string]map[JoinRequest]int64 // Link code to request expiry in Unix milliseconds
+}
+
+func newJoinStore() *joinStore {
+	return &joinStore{
+		requests: make(map[string]map[JoinRequest]int64),
+	}
+}
+
+// AddJoinRequest records a join request, which expires after ttl unless removed earlier.
+// Expired requests of the link code are pruned at the same time.
+// Parameters:
+//   - linkCode (string): The link code being answered.
+//   - request (JoinRequest): The join request.
+//   - ttl (time.Duration): How long the request is kept.
+//
+// Returns:
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) AddJoinRequest(linkCode string, request JoinRequest, ttl time.Duration) error {
+
+	now := time.Now()
+	expiresAt := now.Add(ttl).UnixMilli()
+
+	if m.Redis != nil {
+		key := REDIS_PREFIX_JOIN_REQUESTS + linkCode
+
+		if err := m.Redis.ZAddWithExpire(key, request.member(), expiresAt, ttl); err != nil {
+			return err
+		}
+
+		return m.Redis.ZRemRangeByScore(key, now.UnixMilli())
+	}
+
+	store := m.joinStore
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	requests, ok := store.requests[linkCode]
+	if !ok {
+		requests = make(map[JoinRequest]int64)
+		store.requests[linkCode] = requests
+	}
+
+	for entry, entryExpiresAt := range requests {
+		if entryExpiresAt < now.UnixMilli() {
+			delete(requests, entry)
+		}
+	}
+
+	requests[request] = expiresAt
+	return nil
+}
+
+// GetJoinRequests returns the pending join requests of a link code.
+// Parameters:
+//   - linkCode (string): The link code.
+//
+// Returns:
+//   - []JoinRequest: The join requests, one per instance a client waits on.
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) GetJoinRequests(linkCode string) ([]JoinRequest, error) {
+
+	now := time.Now().UnixMilli()
+
+	if m.Redis != nil {
+		entries, err := m.Redis.ZRangeByScore(REDIS_PREFIX_JOIN_REQUESTS+linkCode, now)
+		if err != nil {
+			return nil, err
+		}
+
+		requests := make([]JoinRequest, 0, len(entries))
+		for _, entry := range entries {
+			if request, ok := parseJoinRequest(entry); ok {
+				requests = append(requests, request)
+			}
+		}
+		return requests, nil
+	}
+
+	store := m.joinStore
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	requests := make([]JoinRequest, 0, len(store.requests[linkCode]))
+	for request, expiresAt := range store.requests[linkCode] {
+		if expiresAt >= now {
+			requests = append(requests, request)
+		}
+	}
+	return requests, nil
+}
+
+// RemoveJoinRequest removes a join request once it is decided, cancelled or withdrawn.
+// Parameters:
+//   - linkCode (string): The link code.
+//   - request (JoinRequest): The join request.
+//
+// Returns:
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) RemoveJoinRequest(linkCode string, request JoinRequest) error {
+
+	if m.Redis != nil {
+		return m.Redis.ZRem(REDIS_PREFIX_JOIN_REQUESTS+linkCode, request.member())
+	}
+
+	store := m.joinStore
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.requests[linkCode], request)
+	if len(store.requests[linkCode]) == 0 {
+		delete(store.requests, linkCode)
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	GenericStorage "peergrine/utils/generic-storage"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	REDIS_PREFIX_ROOM         = "signal-room:"
+	REDIS_PREFIX_ROOM_MEMBERS = "signal-room-members:"
+)
+
+// _ADD_ROOM_MEMBER_SCRIPT prunes and returns the expired entries of a room, then adds a member
+// entry unless its client is new and the room already has ARGV[4] distinct clients.
+// The first value of the reply is 0 when the room is full, 1 for a new client and 2 for a
+// client that already had an entry, followed by the pruned entries.
+const _ADD_ROOM_MEMBER_SCRIPT = `
+local cutoff = "(" .. ARGV[1]
+local expired = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", cutoff)
+if #expired > 0 then
+	redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", cutoff)
+end
+local clients = {}
+local count = 0
+local status = 1
+for _, entry in ipairs(redis.call("ZRANGE", KEYS[1], 0, -1)) do
+	local client = string.match(entry, "^([^:]*):")
+	if client == ARGV[5] then
+		status = 2
+	end
+	if client and not clients[client] then
+		clients[client] = true
+		count = count + 1
+	end
+end
+if status == 1 and tonumber(ARGV[4]) > 0 and count >= tonumber(ARGV[4]) then
+	status = 0
+else
+	redis.call("ZADD", KEYS[1], ARGV[2], ARGV[3])
+	if redis.call("PTTL", KEYS[1]) < tonumber(ARGV[6]) then
+		redis.call("PEXPIRE", KEYS[1], ARGV[6])
+	end
+end
+local reply = {status}
+for _, entry in ipairs(expired) do
+	table.insert(reply, entry)
+end
+return reply
+`
+
+// ErrRoomFull is returned when a new client would exceed the member limit of a room.
+var ErrRoomFull = errors.New("room is full")
+
+// Room is a signaling room that members join by its code.
+type Room struct {
+	Code       string
+	OwnerId    string
+	ExpiresAt  int64
+	MaxMembers int
+}
+
+// GetKey returns the room code as the key of the room.
+// Returns:
+//   - string: The code of the room.
+func (r Room) GetKey() string {
+	return r.Code
+}
+
+// GetExpiresAt returns the expiration timestamp of the room.
+// Returns:
+//   - int64: The expiration time of the room.
+func (r Room) GetExpiresAt() int64 {
+	return r.ExpiresAt
+}
+
+// RoomMember is one connection of a client to a room. A client connected from several tabs
+// or devices has one entry per connection.
+type RoomMember struct {
+	ClientId   string
+	ListenerId string
+	ChannelId  string // The instance ID, or the UnifiedMessage channel of the client
+	Scope      string // Token scope of the connection, whose candidate filter applies to the signals it receives
+}
+
+// member returns the sorted set member of the entry. The scope is escaped, and ChannelId is
+// last because it may contain colons.
+func (m RoomMember) member() string {
+	return m.ClientId + ":" + m.ListenerId + ":" + url.QueryEscape(m.Scope) + ":" + m.ChannelId
+}
+
+// parseRoomMember reverses RoomMember.member.
+func parseRoomMember(member string) (RoomMember, bool) {
+	parts := strings.SplitN(member, ":", 4)
+	if len(parts) != 4 {
+		return RoomMember{}, false
+	}
+	scope, err := url.QueryUnescape(parts[2])
+	if err != nil {
+		return RoomMember{}, false
+	}
+	return RoomMember{ClientId: parts[0], ListenerId: parts[1], Scope: scope, ChannelId: parts[3]}, true
+}
+
+// RoomJoin is the outcome of AddRoomMember.
+type RoomJoin struct {
+	Rejoined bool         // The client already had another connection to the room
+	Expired  []RoomMember // Entries of other connections that expired and were pruned
+}
+
+// roomStore keeps rooms and their members when Redis is not configured.
+type roomStore struct {
+	rooms   *GenericStorage.LocalStorageManager[Room]
+	mutex   sync.Mutex
+	members map[string]map[RoomMember]int64 // Room code to member expiry in Unix milliseconds
+}
+
+func newRoomStore() *roomStore {
+	return &roomStore{
+		rooms:   GenericStorage.NewLocalStorageManager[Room](),
+		members: make(map[string]map[RoomMember]int64),
+	}
+}
+
+// ReserveRoom stores a Room only if its code is not taken yet.
+// Parameters:
+//   - room (Room): The room to store.
+//
+// Returns:
+//   - bool: true if the code was reserved, false if it is already in use.
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) ReserveRoom(room Room) (bool, error) {
+
+	if m.Redis == nil {
+		return m.roomStore.rooms.SetIfAbsent(room), nil
+	}
+
+	roomBytes, err := json.Marshal(room)
+	if err != nil {
+		return false, err
+	}
+
+	return m.Redis.SetNX(REDIS_PREFIX_ROOM+room.Code, roomBytes, time.Until(time.Unix(room.ExpiresAt, 0)))
+}
+
+// GetRoom retrieves a Room by its code.
+// Parameters:
+//   - code (string): The code of the room.
+//
+// Returns:
+//   - *Room: The room.
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) GetRoom(code string) (*Room, error) {
+
+	if m.Redis == nil {
+		room := m.roomStore.rooms.Get(code)
+		if room == nil {
+			return nil, errors.New("room not found")
+		}
+		return room, nil
+	}
+
+	roomBytes, err := m.Redis.Get(REDIS_PREFIX_ROOM + code)
+	if err != nil {
+		return nil, err
+	}
+
+	var room Room
+	if err := json.Unmarshal(roomBytes, &room); err != nil {
+		return nil, err
+	}
+
+	return &room, nil
+}
+
+// AddRoomMember adds or refreshes a member entry, which expires after ttl unless added again.
+// Expired entries of other members are pruned at the same time and returned, so the caller
+// can announce the departure of clients whose instance stopped without removing them.
+// The capacity check, the prune and the add are a single script in Redis, so concurrent
+// joins cannot exceed maxClients and each expired entry is returned to one caller only.
+// Parameters:
+//   - code (string): The code of the room.
+//   - member (RoomMember): The member entry.
+//   - maxClients (int): The most distinct clients the room may have, 0 for no limit.
+//   - ttl (time.Duration): How long the entry is kept.
+//
+// Returns:
+//   - RoomJoin: Whether the client was already a member, and the pruned entries.
+//   - error: ErrRoomFull if a new client would exceed maxClients, otherwise nil if successful.
+func (m *Storage) AddRoomMember(code string, member RoomMember, maxClients int, ttl time.Duration) (RoomJoin, error) {
+
+	now := time.Now()
+	expiresAt := now.Add(ttl).UnixMilli()
+
+	if m.Redis != nil {
+		keys := []string{REDIS_PREFIX_ROOM_MEMBERS + code}
+
+		result, err := m.Redis.Eval(_ADD_ROOM_MEMBER_SCRIPT, keys, now.UnixMilli(), expiresAt, member.member(), maxClients, member.ClientId, ttl.Milliseconds())
+		if err != nil {
+			return RoomJoin{}, err
+		}
+
+		values, ok := result.([]interface{})
+		if !ok || len(values) == 0 {
+			return RoomJoin{}, errors.New("unexpected reply of the room member script")
+		}
+
+		var join RoomJoin
+		for _, value := range values[1:] {
+			if entry, ok := value.(string); ok {
+				if expired, ok := parseRoomMember(entry); ok {
+					join.Expired = append(join.Expired, expired)
+				}
+			}
+		}
+
+		status, _ := values[0].(int64)
+		switch status {
+		case 0:
+			return join, ErrRoomFull
+		case 2:
+			join.Rejoined = true
+		}
+		return join, nil
+	}
+
+	store := m.roomStore
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	members, ok := store.members[code]
+	if !ok {
+		members = make(map[RoomMember]int64)
+		store.members[code] = members
+	}
+
+	var join RoomJoin
+	clients := make(map[string]bool)
+
+	for entry, entryExpiresAt := range members {
+		if entryExpiresAt < now.UnixMilli() {
+			delete(members, entry)
+			join.Expired = append(join.Expired, entry)
+			continue
+		}
+		clients[entry.ClientId] = true
+	}
+
+	join.Rejoined = clients[member.ClientId]
+	if !join.Rejoined && maxClients > 0 && len(clients) >= maxClients {
+		return join, ErrRoomFull
+	}
+
+	members[member] = expiresAt
+	return join, nil
+}
+
+// GetRoomMembers returns the live member entries of a room.
+// Parameters:
+//   - code (string): The code of the room.
+//
+// Returns:
+//   - []RoomMember: The member entries, several per client if it is connected more than once.
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) GetRoomMembers(code string) ([]RoomMember, error) {
+
+	now := time.Now().UnixMilli()
+
+	if m.Redis != nil {
+		entries, err := m.Redis.ZRangeByScore(REDIS_PREFIX_ROOM_MEMBERS+code, now)
+		if err != nil {
+			return nil, err
+		}
+
+		members := make([]RoomMember, 0, len(entries))
+		for _, entry := range entries {
+			if member, ok := parseRoomMember(entry); ok {
+				members = append(members, member)
+			}
+		}
+		return members, nil
+	}
+
+	store := m.roomStore
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	members := make([]RoomMember, 0, len(store.members[code]))
+	for member, expiresAt := range store.members[code] {
+		if expiresAt >= now {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+// RemoveRoomMember removes a member entry.
+// Parameters:
+//   - code (string): The code of the room.
+//   - member (RoomMember): The member entry.
+//
+// Returns:
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) RemoveRoomMember(code string, member RoomMember) error {
+
+	if m.Redis != nil {
+		return m.Redis.ZRem(REDIS_PREFIX_ROOM_MEMBERS+code, member.member())
+	}
+
+	store := m.roomStore
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.members[code], member)
+	if len(store.members[code]) == 0 {
+		delete(store.members, code)
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	REDIS_PREFIX_CLIENT_CHANNELS = "signal-client-channels:"
+	REDIS_PREFIX_PEER            = "signal-peer:"
+)
+
+// Route is a peer entry kept in local storage when Redis is not configured.
+type Route struct {
+	Key       string
+	ExpiresAt int64
+}
+
+// GetKey returns the storage key of the route.
+// Returns:
+//   - string: The key of the route.
+func (r Route) GetKey() string {
+	return r.Key
+}
+
+// GetExpiresAt returns the expiration timestamp of the route.
+// Returns:
+//   - int64: The expiration time of the route.
+func (r Route) GetExpiresAt() int64 {
+	return r.ExpiresAt
+}
+
+// ClientChannel is one registry entry of a client: a stream of this client, or a
+// UnifiedMessage channel it receives signals on.
+type ClientChannel struct {
+	ListenerId string
+	ChannelId  string // The instance ID, or the UnifiedMessage channel of the client
+	Scope      string // Token scope of the client, whose candidate filter applies to the signals it receives
+}
+
+// member returns the sorted set member of the entry. The scope is escaped, and ChannelId is
+// last because it may contain colons.
+func (c ClientChannel) member() string {
+	return c.ListenerId + ":" + url.QueryEscape(c.Scope) + ":" + c.ChannelId
+}
+
+// parseClientChannel reverses ClientChannel.member.
+func parseClientChannel(member string) (ClientChannel, bool) {
+	parts := strings.SplitN(member, ":", 3)
+	if len(parts) != 3 {
+		return ClientChannel{}, false
+	}
+	scope, err := url.QueryUnescape(parts[1])
+	if err != nil {
+		return ClientChannel{}, false
+	}
+	return ClientChannel{ListenerId: parts[0], Scope: scope, ChannelId: parts[2]}, true
+}
+
+// channelStore keeps the client channel registry when Redis is not configured.
+type channelStore struct {
+	mutex    sync.Mutex
+	channels map[string]map[ClientChannel]int64 // Client ID to entry expiry in Unix milliseconds
+}
+
+func newChannelStore() *channelStore {
+	return &channelStore{
+		channels: make(map[string]map[ClientChannel]int64),
+	}
+}
+
+// AddClientChannel records, or refreshes, a channel on which a client receives signals
+// addressed to it rather than to one of its link codes. Every stream has its own entry, so
+// streams of the same client can come and go independently. The entry expires after ttl
+// unless added again, and expired entries of the client are pruned at the same time.
+// Parameters:
+//   - clientId (string): The client identifier.
+//   - channel (ClientChannel): The registry entry.
+//   - ttl (time.Duration): How long the entry is kept unless added again.
+//
+// Returns:
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) AddClientChannel(clientId string, channel ClientChannel, ttl time.Duration) error {
+
+	now := time.Now()
+	expiresAt := now.Add(ttl).UnixMilli()
+
+	if m.Redis != nil {
+		key := REDIS_PREFIX_CLIENT_CHANNELS + clientId
+
+		if err := m.Redis.ZAddWithExpire(key, channel.member(), expiresAt, ttl); err != nil {
+			return err
+		}
+
+		return m.Redis.ZRemRangeByScore(key, now.UnixMilli())
+	}
+
+	store := m.channelStore
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	channels, ok := store.channels[clientId]
+	if !ok {
+		channels = make(map[ClientChannel]int64)
+		store.channels[clientId] = channels
+	}
+
+	for entry, entryExpiresAt := range channels {
+		if entryExpiresAt < now.UnixMilli() {
+			delete(channels, entry)
+		}
+	}
+
+	channels[channel] = expiresAt
+	return nil
+}
+
+// GetClientChannels returns the live entries added by AddClientChannel.
+// Parameters:
+//   - clientId (string): The client identifier.
+//
+// Returns:
+//   - []ClientChannel: The entries of the client, which may share a channel.
+//   - error: An error if the client has no live entry, otherwise nil.
+func (m *Storage) GetClientChannels(clientId string) ([]ClientChannel, error) {
+
+	now := time.Now().UnixMilli()
+	channels := make([]ClientChannel, 0)
+
+	if m.Redis != nil {
+		members, err := m.Redis.ZRangeByScore(REDIS_PREFIX_CLIENT_CHANNELS+clientId, now)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range members {
+			if channel, ok := parseClientChannel(member); ok {
+				channels = append(channels, channel)
+			}
+		}
+	} else {
+		store := m.channelStore
+		store.mutex.Lock()
+		for channel, expiresAt := range store.channels[clientId] {
+			if expiresAt >= now {
+				channels = append(channels, channel)
+			}
+		}
+		store.mutex.Unlock()
+	}
+
+	if len(channels) == 0 {
+		return nil, errors.New("client channel not found")
+	}
+	return channels, nil
+}
+
+// RemoveClientChannel removes a single entry added by AddClientChannel, leaving the entries
+// of the other streams of the client untouched.
+// Parameters:
+//   - clientId (string): The client identifier.
+//   - channel (ClientChannel): The registry entry.
+//
+// Returns:
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) RemoveClientChannel(clientId string, channel ClientChannel) error {
+
+	if m.Redis != nil {
+		return m.Redis.ZRem(REDIS_PREFIX_CLIENT_CHANNELS+clientId, channel.member())
+	}
+
+	store := m.channelStore
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.channels[clientId], channel)
+	if len(store.channels[clientId]) == 0 {
+		delete(store.channels, clientId)
+	}
+	return nil
+}
+
+// peerKey returns the same key for both directions of a peer entry.
+func peerKey(clientId string, peerId string) string {
+	if clientId > peerId {
+		clientId, peerId = peerId, clientId
+	}
+	return REDIS_PREFIX_PEER + clientId + ":" + peerId
+}
+
+// SetPeer records that two clients exchanged an offer and an answer, which allows them to
+// send each other further signals until expiresAt.
+// Parameters:
+//   - clientId (string): One of the clients.
+//   - peerId (string): The other client.
+//   - expiresAt (int64): The timestamp when the entry expires.
+//
+// Returns:
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) SetPeer(clientId string, peerId string, expiresAt int64) error {
+
+	key := peerKey(clientId, peerId)
+
+	if m.Redis != nil {
+		return m.Redis.Set(key, []byte{1}, time.Until(time.Unix(expiresAt, 0)))
+	}
+
+	m.routes.Set(Route{Key: key, ExpiresAt: expiresAt})
+	return nil
+}
+
+// ExtendPeer moves the expiration of an existing peer entry to expiresAt. An entry that
+// expired or was removed, for example by a bye, is not recreated.
+// Parameters:
+//   - clientId (string): One of the clients.
+//   - peerId (string): The other client.
+//   - expiresAt (int64): The new expiration timestamp of the entry.
+//
+// Returns:
+//   - bool: true if the clients are peers.
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) ExtendPeer(clientId string, peerId string, expiresAt int64) (bool, error) {
+
+	key := peerKey(clientId, peerId)
+
+	if m.Redis != nil {
+		return m.Redis.Expire(key, time.Until(time.Unix(expiresAt, 0)))
+	}
+
+	return m.routes.Update(key, func(route *Route) bool {
+		route.ExpiresAt = expiresAt
+		return true
+	}), nil
+}
+
+// PeerExists reports whether two clients may send each other signals.
+// Parameters:
+//   - clientId (string): One of the clients.
+//   - peerId (string): The other client.
+//
+// Returns:
+//   - bool: true if the clients are peers.
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) PeerExists(clientId string, peerId string) (bool, error) {
+
+	key := peerKey(clientId, peerId)
+
+	if m.Redis != nil {
+		return m.Redis.Exists(key)
+	}
+
+	return m.routes.Exists(key), nil
+}
+
+// RemovePeer ends the peer entry of two clients in both directions.
+// Parameters:
+//   - clientId (string): One of the clients.
+//   - peerId (string): The other client.
+//
+// Returns:
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) RemovePeer(clientId string, peerId string) error {
+
+	key := peerKey(clientId, peerId)
+
+	if m.Redis != nil {
+		return m.Redis.Del(key)
+	}
+
+	m.routes.Remove(key)
+	return nil
+}
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	REDIS_PREFIX_STREAM_OFFER   = "signal-stream-offer:"
+	REDIS_PREFIX_STREAM_SESSION = "signal-stream-session:"
+)
+
+// StreamSession is a WHIP or WHEP session between a stream client and the owner of the link
+// code it sent its offer to. Its ID names the session resource the client deletes to stop.
+type StreamSession struct {
+	Id        string
+	ClientId  string
+	OwnerId   string
+	ExpiresAt int64
+}
+
+// GetKey returns the session ID as the key of the session.
+// Returns:
+//   - string: The ID of the session.
+func (s StreamSession) GetKey() string {
+	return s.Id
+}
+
+// GetExpiresAt returns the expiration timestamp of the session.
+// Returns:
+//   - int64: The expiration time of the session.
+func (s StreamSession) GetExpiresAt() int64 {
+	return s.ExpiresAt
+}
+
+// streamOfferKey returns the key of the offer a stream client waits with for a link code owner.
+func streamOfferKey(ownerId string, clientId string) string {
+	return REDIS_PREFIX_STREAM_OFFER + ownerId + ":" + clientId
+}
+
+// ReserveStreamOffer records that a stream client waits for the answer of a link code owner,
+// unless it already does. In Redis the check and the write are a single SET NX, so concurrent
+// offers of the same client on several instances cannot both wait.
+// Parameters:
+//   - ownerId (string): The owner of the link code.
+//   - clientId (string): The stream client.
+//   - ttl (time.Duration): How long the offer waits at most.
+//
+// Returns:
+//   - bool: true if the offer was reserved, false if another offer of the client is waiting.
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) ReserveStreamOffer(ownerId string, clientId string, ttl time.Duration) (bool, error) {
+
+	key := streamOfferKey(ownerId, clientId)
+
+	if m.Redis != nil {
+		return m.Redis.SetNX(key, []byte{1}, ttl)
+	}
+
+	return m.routes.SetIfAbsent(Route{Key: key, ExpiresAt: time.Now().Add(ttl).Unix()}), nil
+}
+
+// ReleaseStreamOffer removes the reservation made by ReserveStreamOffer.
+// Parameters:
+//   - ownerId (string): The owner of the link code.
+//   - clientId (string): The stream client.
+//
+// Returns:
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) ReleaseStreamOffer(ownerId string, clientId string) error {
+
+	key := streamOfferKey(ownerId, clientId)
+
+	if m.Redis != nil {
+		return m.Redis.Del(key)
+	}
+
+	m.routes.Remove(key)
+	return nil
+}
+
+// SetStreamSession stores a stream session until its expiration time.
+// Parameters:
+//   - session (StreamSession): The session to store.
+//
+// Returns:
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) SetStreamSession(session StreamSession) error {
+
+	if m.Redis == nil {
+		m.sessions.Set(session)
+		return nil
+	}
+
+	sessionBytes, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	return m.Redis.Set(REDIS_PREFIX_STREAM_SESSION+session.Id, sessionBytes, time.Until(time.Unix(session.ExpiresAt, 0)))
+}
+
+// GetStreamSession retrieves a stream session by its ID.
+// Parameters:
+//   - id (string): The ID of the session.
+//
+// Returns:
+//   - *StreamSession: The session.
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) GetStreamSession(id string) (*StreamSession, error) {
+
+	if m.Redis == nil {
+		session := m.sessions.Get(id)
+		if session == nil {
+			return nil, errors.New("stream session not found")
+		}
+		return session, nil
+	}
+
+	sessionBytes, err := m.Redis.Get(REDIS_PREFIX_STREAM_SESSION + id)
+	if err != nil {
+		return nil, err
+	}
+
+	var session StreamSession
+	if err := json.Unmarshal(sessionBytes, &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// RemoveStreamSession deletes a stream session.
+// Parameters:
+//   - id (string): The ID of the session.
+//
+// Returns:
+//   - error: nil if successful, otherwise an error message.
+func (m *Storage) RemoveStreamSession(id string) error {
+
+	if m.Redis != nil {
+		return m.Redis.Del(REDIS_PREFIX_STREAM_SESSION + id)
+	}
+
+	m.sessions.Remove(id)
+	return nil
+}
@@ -0,0 +1,220 @@
+package turnserver
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	IceServers "peergrine/utils/ice-servers"
+	IpPolicy "peergrine/utils/ip-policy"
+	RelayQuota "peergrine/utils/relay-quota"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/turn/v3"
+)
+
+// ALLOCATION_IDLE is how long a client address counts against the allocation quota without
+// any traffic. Allocations that are still alive send at least a refresh in this interval.
+const ALLOCATION_IDLE = 11 * time.Minute
+
+// Config configures the embedded STUN/TURN server.
+type Config struct {
+	Realm    string
+	PublicIP net.IP // Address advertised for relayed candidates
+	UDPPort  int    // 0 to disable the UDP listener
+	TCPPort  int    // 0 to disable the TCP listener
+	Secret   []byte // Shared secret of the ephemeral credentials
+	Limits   RelayQuota.Limits
+
+	// Peers the relays may reach; internal addresses are refused unless allowed here
+	PeerPolicy IpPolicy.Policy
+
+	// Ports of the relayed addresses, both 0 to let the system choose
+	RelayMinPort uint16
+	RelayMaxPort uint16
+}
+
+// Server is an embedded STUN/TURN server. Clients authenticate with the ephemeral
+// credentials of GET /ice-servers, which callers obtain with their access token.
+type Server struct {
+	config  Config
+	tracker *RelayQuota.Tracker
+	server  *turn.Server
+}
+
+// New starts the STUN/TURN server on the configured ports.
+// Parameters:
+//   - config (Config): The server settings.
+//
+// Returns:
+//   - *Server: The running server.
+//   - error: nil if successful, otherwise an error message.
+func New(config Config) (*Server, error) {
+	if config.PublicIP == nil {
+		return nil, errors.New("embedded TURN server requires a public IP")
+	}
+	if len(config.Secret) == 0 {
+		return nil, errors.New("embedded TURN server requires a secret")
+	}
+	if config.UDPPort == 0 && config.TCPPort == 0 {
+		return nil, errors.New("embedded TURN server requires a UDP or TCP port")
+	}
+	if config.RelayMinPort > config.RelayMaxPort {
+		return nil, errors.New("embedded TURN server relay port range is empty")
+	}
+
+	if config.Limits.Idle == 0 {
+		config.Limits.Idle = ALLOCATION_IDLE
+	}
+
+	s := &Server{
+		config:  config,
+		tracker: RelayQuota.New(config.Limits),
+	}
+
+	serverConfig := turn.ServerConfig{
+		Realm:       config.Realm,
+		AuthHandler: s.authenticate,
+	}
+
+	if config.UDPPort != 0 {
+		conn, err := net.ListenPacket("udp4", ":"+strconv.Itoa(config.UDPPort))
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen for TURN over UDP: %w", err)
+		}
+
+		serverConfig.PacketConnConfigs = append(serverConfig.PacketConnConfigs, turn.PacketConnConfig{
+			PacketConn:            &meteredPacketConn{PacketConn: conn, tracker: s.tracker},
+			RelayAddressGenerator: s.relayAddressGenerator(),
+			PermissionHandler:     s.permit,
+		})
+	}
+
+	if config.TCPPort != 0 {
+		listener, err := net.Listen("tcp4", ":"+strconv.Itoa(config.TCPPort))
+		if err != nil {
+			closeConfigs(serverConfig)
+			return nil, fmt.Errorf("failed to listen for TURN over TCP: %w", err)
+		}
+
+		serverConfig.ListenerConfigs = append(serverConfig.ListenerConfigs, turn.ListenerConfig{
+			Listener:              &meteredListener{Listener: listener, tracker: s.tracker},
+			RelayAddressGenerator: s.relayAddressGenerator(),
+			PermissionHandler:     s.permit,
+		})
+	}
+
+	server, err := turn.NewServer(serverConfig)
+	if err != nil {
+		closeConfigs(serverConfig)
+		return nil, err
+	}
+	s.server = server
+
+	return s, nil
+}
+
+// Close stops the server and its relays.
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+// URLs returns the STUN and TURN URLs of the server.
+// Returns:
+//   - []string: The STUN URLs.
+//   - []string: The TURN URLs.
+func (s *Server) URLs() ([]string, []string) {
+	stunURLs := make([]string, 0, 1)
+	turnURLs := make([]string, 0, 2)
+
+	if s.config.UDPPort != 0 {
+		host := net.JoinHostPort(s.config.PublicIP.String(), strconv.Itoa(s.config.UDPPort))
+		stunURLs = append(stunURLs, "stun:"+host)
+		turnURLs = append(turnURLs, "turn:"+host+"?transport=udp")
+	}
+	if s.config.TCPPort != 0 {
+		host := net.JoinHostPort(s.config.PublicIP.String(), strconv.Itoa(s.config.TCPPort))
+		turnURLs = append(turnURLs, "turn:"+host+"?transport=tcp")
+	}
+
+	return stunURLs, turnURLs
+}
+
+func (s *Server) relayAddressGenerator() turn.RelayAddressGenerator {
+	if s.config.RelayMaxPort != 0 {
+		return &turn.RelayAddressGeneratorPortRange{
+			RelayAddress: s.config.PublicIP,
+			MinPort:      s.config.RelayMinPort,
+			MaxPort:      s.config.RelayMaxPort,
+			Address:      "0.0.0.0",
+		}
+	}
+	return &turn.RelayAddressGeneratorStatic{
+		RelayAddress: s.config.PublicIP,
+		Address:      "0.0.0.0",
+	}
+}
+
+// authenticate returns the long-term credential key of an ephemeral username of the form
+// "<expiry>:<user ID>". Access tokens are never accepted, so a token cannot leak through
+// the TURN protocol. The client address is charged to the user ID once the server confirms
+// the allocation, which it only does for a valid password.
+func (s *Server) authenticate(username string, realm string, srcAddr net.Addr) ([]byte, bool) {
+	identity, password, err := s.credential(username)
+	if err != nil {
+		log.Printf("TURN authentication failed from %s: %v\n", srcAddr, err)
+		return nil, false
+	}
+
+	if !s.tracker.Authorize(identity, srcAddr.String(), time.Now()) {
+		log.Printf("TURN allocation quota reached for %s from %s\n", identity, srcAddr)
+		return nil, false
+	}
+
+	return turn.GenerateAuthKey(username, realm, password), true
+}
+
+// permit decides whether a client may create a permission or channel binding for a peer.
+// Relays to loopback, private, link-local and other internal addresses, including cloud
+// metadata endpoints, are refused unless the peer policy allows them, so the server cannot
+// be used to reach the network it runs in.
+func (s *Server) permit(clientAddr net.Addr, peerIP net.IP) bool {
+	if !s.config.PeerPolicy.Allowed(peerIP) {
+		log.Printf("TURN permission for %s refused to %s\n", peerIP, clientAddr)
+		return false
+	}
+	return true
+}
+
+// credential resolves an ephemeral username to the identity it belongs to and its password.
+func (s *Server) credential(username string) (string, string, error) {
+	expiry, userId, ephemeral := strings.Cut(username, ":")
+	if !ephemeral || userId == "" {
+		return "", "", errors.New("not an ephemeral username")
+	}
+
+	timestamp, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return "", "", errors.New("not an ephemeral username")
+	}
+
+	expiresAt := time.Unix(timestamp, 0)
+	if time.Now().After(expiresAt) {
+		return "", "", errors.New("credentials expired")
+	}
+
+	_, password := IceServers.Credential(s.config.Secret, userId, expiresAt)
+	return userId, password, nil
+}
+
+// closeConfigs closes the listeners opened for a server that failed to start.
+func closeConfigs(config turn.ServerConfig) {
+	for _, c := range config.PacketConnConfigs {
+		c.PacketConn.Close()
+	}
+	for _, c := range config.ListenerConfigs {
+		c.Listener.Close()
+	}
+}
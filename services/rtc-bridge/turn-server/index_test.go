@@ -0,0 +1,30 @@
+package turnserver
+
+import (
+	IceServers "peergrine/utils/ice-servers"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 測試只接受未過期的臨時憑證，不接受存取令牌
+func TestCredential(t *testing.T) {
+	s := &Server{config: Config{Secret: []byte("test-secret")}}
+
+	username, password := IceServers.Credential(s.config.Secret, "user", time.Now().Add(time.Minute))
+	userId, expected, err := s.credential(username)
+	require.NoError(t, err)
+	assert.Equal(t, "user", userId)
+	assert.Equal(t, password, expected)
+
+	expired, _ := IceServers.Credential(s.config.Secret, "user", time.Now().Add(-time.Minute))
+	_, _, err = s.credential(expired)
+	assert.Error(t, err, "Expired credentials should be refused")
+
+	for _, username := range []string{"eyJhbGciOiJIUzI1NiJ9.eyJ1c2VyX2lkIjoidXNlciJ9.c2ln", "token:user", "1700000000:"} {
+		_, _, err := s.credential(username)
+		assert.Error(t, err, "%q should not be accepted as a username", username)
+	}
+}
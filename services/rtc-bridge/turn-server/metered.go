@@ -0,0 +1,105 @@
+package turnserver
+
+import (
+	"encoding/binary"
+	"net"
+	RelayQuota "peergrine/utils/relay-quota"
+	"time"
+
+	"github.com/pion/stun/v2"
+)
+
+var (
+	allocateSuccess = stun.NewType(stun.MethodAllocate, stun.ClassSuccessResponse)
+	refreshSuccess  = stun.NewType(stun.MethodRefresh, stun.ClassSuccessResponse)
+)
+
+// observe follows the allocations of a client through the responses the server sends it:
+// a successful Allocate charges the client address to its identity, and a successful
+// Refresh with a zero lifetime releases it.
+func observe(tracker *RelayQuota.Tracker, p []byte, addr string) {
+	if !stun.IsMessage(p) {
+		return
+	}
+
+	message := &stun.Message{Raw: append([]byte(nil), p...)}
+	if err := message.Decode(); err != nil {
+		return
+	}
+
+	switch message.Type {
+	case allocateSuccess:
+		tracker.Admit(addr, time.Now())
+	case refreshSuccess:
+		lifetime, err := message.Get(stun.AttrLifetime)
+		if err == nil && len(lifetime) == 4 && binary.BigEndian.Uint32(lifetime) == 0 {
+			tracker.Release(addr)
+		}
+	}
+}
+
+// meteredPacketConn charges the datagrams exchanged with each client to its identity and
+// drops those over the bandwidth quota, as a congested network would.
+type meteredPacketConn struct {
+	net.PacketConn
+	tracker *RelayQuota.Tracker
+}
+
+func (c *meteredPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil || c.tracker.Allow(addr.String(), n, time.Now()) {
+			return n, addr, err
+		}
+	}
+}
+
+func (c *meteredPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	observe(c.tracker, p, addr.String())
+
+	if !c.tracker.Allow(addr.String(), len(p), time.Now()) {
+		return len(p), nil
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+// meteredListener accepts TCP connections whose traffic is throttled to the bandwidth
+// quota, since a stream cannot drop data.
+type meteredListener struct {
+	net.Listener
+	tracker *RelayQuota.Tracker
+}
+
+func (l *meteredListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &meteredConn{Conn: conn, tracker: l.tracker}, nil
+}
+
+type meteredConn struct {
+	net.Conn
+	tracker *RelayQuota.Tracker
+}
+
+func (c *meteredConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		time.Sleep(c.tracker.Wait(c.RemoteAddr().String(), n, time.Now()))
+	}
+	return n, err
+}
+
+// Write receives whole STUN messages or ChannelData frames from the server.
+func (c *meteredConn) Write(p []byte) (int, error) {
+	observe(c.tracker, p, c.RemoteAddr().String())
+
+	time.Sleep(c.tracker.Wait(c.RemoteAddr().String(), len(p), time.Now()))
+	return c.Conn.Write(p)
+}
+
+func (c *meteredConn) Close() error {
+	c.tracker.Release(c.RemoteAddr().String())
+	return c.Conn.Close()
+}
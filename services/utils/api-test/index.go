@@ -0,0 +1,109 @@
+package apitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	Auth "peergrine/utils/auth"
+	Envelope "peergrine/utils/envelope"
+	"strings"
+	"testing"
+	"time"
+)
+
+const ISSUER = "test-issuer"
+
+// TokenCache is the token cache of a service's storage; tokens found there are accepted
+// without asking the auth service.
+type TokenCache interface {
+	SetTokenCache(token string, tokenData Auth.TokenPayload)
+}
+
+// Client sends requests to a service's handler in a test, with tokens that are cached
+// instead of issued.
+type Client struct {
+	URL string
+	// RawType is the Content-Type of string and []byte bodies.
+	RawType string
+	tokens  TokenCache
+}
+
+// Start serves handler until the test ends and returns a client of it. Logins are cached in
+// tokens.
+func Start(t *testing.T, handler http.Handler, tokens TokenCache) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return &Client{URL: server.URL, RawType: "application/octet-stream", tokens: tokens}
+}
+
+// Keyring returns a keyring that signs envelopes of every issuer with a fixed secret, for
+// tests that run without an auth service.
+func Keyring() *Envelope.Keyring {
+	return Envelope.NewKeyring(func(iss string) ([]byte, error) {
+		return Envelope.SeedFromSecret([]byte("test-secret")), nil
+	}, time.Minute)
+}
+
+// Login caches a token of the client that is valid for an hour and returns it.
+func (c *Client) Login(userId string, scope string) string {
+	token := "token-" + userId
+	now := time.Now()
+	c.tokens.SetTokenCache(token, Auth.TokenPayload{
+		Iss:       ISSUER,
+		Iat:       now.Unix(),
+		Exp:       now.Add(time.Hour).Unix(),
+		UserId:    userId,
+		ChannelId: "channel-" + userId,
+		Scope:     scope,
+	})
+	return token
+}
+
+// Request sends a request with the token of a client. String and []byte bodies are sent as
+// they are, anything else is encoded as JSON. A request that fails, for example because ctx
+// was cancelled, returns an empty response with status 0.
+func (c *Client) Request(ctx context.Context, method string, path string, token string, header http.Header, body any) *http.Response {
+	var reader io.Reader
+	contentType := "application/json"
+
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(body)
+		contentType = c.RawType
+	case []byte:
+		reader = bytes.NewReader(body)
+		contentType = c.RawType
+	default:
+		bodyBytes, _ := json.Marshal(body)
+		reader = bytes.NewReader(bodyBytes)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.URL+path, reader)
+	if err != nil {
+		panic(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return &http.Response{Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}
+	}
+	return res
+}
+
+// Status sends a request and returns its status code.
+func (c *Client) Status(method string, path string, token string, body any) int {
+	res := c.Request(context.Background(), method, path, token, nil, body)
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	return res.StatusCode
+}
@@ -0,0 +1,205 @@
+package attemptlimiter
+
+import (
+	"errors"
+	"fmt"
+	Configurator "peergrine/utils/configurator"
+	Redis "peergrine/utils/redis"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	_PREFIX_FAILURES = "failures:"
+	_PREFIX_LOCKOUT  = "lockout:"
+)
+
+type counter struct {
+	failures    int
+	windowEnd   time.Time
+	lockedUntil time.Time
+}
+
+// Limiter counts failed attempts per key and locks a key out once it fails too often
+// within a window. Counters live in Redis when available so that every instance shares them.
+type Limiter struct {
+	redis       *Redis.Manager
+	prefix      string
+	maxFailures int
+	window      time.Duration
+	lockout     time.Duration
+	mux         *sync.Mutex
+	counters    map[string]*counter
+	closeTicker chan struct{}
+}
+
+// New creates a Limiter. Keys are stored in Redis under prefix; with a nil Redis manager
+// the counters are kept in memory.
+func New(redis *Redis.Manager, prefix string, maxFailures int, window time.Duration, lockout time.Duration) *Limiter {
+	limiter := &Limiter{
+		redis:       redis,
+		prefix:      prefix,
+		maxFailures: maxFailures,
+		window:      window,
+		lockout:     lockout,
+		mux:         new(sync.Mutex),
+		counters:    make(map[string]*counter),
+		closeTicker: make(chan struct{}),
+	}
+
+	if redis == nil {
+		go limiter.removeExpiredTicker()
+	}
+
+	return limiter
+}
+
+// FromConfig creates a Limiter from configuration values. The window and lockout are in seconds.
+func FromConfig(redis *Redis.Manager, prefix string, maxFailures, window, lockout string) (*Limiter, error) {
+	max, err := strconv.Atoi(maxFailures)
+	if err != nil || max <= 0 {
+		return nil, fmt.Errorf("invalid max failures: %s", maxFailures)
+	}
+
+	windowDuration, err := Configurator.ParseSeconds(window)
+	if err != nil || windowDuration <= 0 {
+		return nil, fmt.Errorf("invalid failure window: %s", window)
+	}
+
+	// A lockout of 0 would store lockout keys in Redis without an expiry.
+	lockoutDuration, err := Configurator.ParseSeconds(lockout)
+	if err != nil || lockoutDuration <= 0 {
+		return nil, fmt.Errorf("invalid lockout duration: %s", lockout)
+	}
+
+	return New(redis, prefix, max, windowDuration, lockoutDuration), nil
+}
+
+// Locked reports the longest remaining lockout among keys, or 0 if none of them is locked out.
+func (l *Limiter) Locked(keys ...string) (time.Duration, error) {
+	var longest time.Duration
+
+	for _, key := range keys {
+		remaining, err := l.locked(key)
+		if err != nil {
+			return 0, err
+		}
+		if remaining > longest {
+			longest = remaining
+		}
+	}
+
+	return longest, nil
+}
+
+// Fail records a failed attempt for each key and locks out every key that reaches the maximum.
+func (l *Limiter) Fail(keys ...string) error {
+	for _, key := range keys {
+		if err := l.fail(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Limiter) locked(key string) (time.Duration, error) {
+
+	if l.redis != nil {
+		value, err := l.redis.Get(l.prefix + _PREFIX_LOCKOUT + key)
+		if errors.Is(err, Redis.Nil) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		lockedUntil, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return remaining(time.Unix(lockedUntil, 0)), nil
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	c, exists := l.counters[key]
+	if !exists {
+		return 0, nil
+	}
+	return remaining(c.lockedUntil), nil
+}
+
+func (l *Limiter) fail(key string) error {
+	now := time.Now()
+
+	if l.redis != nil {
+		failures, err := l.redis.IncrWithExpire(l.prefix+_PREFIX_FAILURES+key, l.window)
+		if err != nil {
+			return err
+		}
+
+		if failures >= int64(l.maxFailures) {
+			lockedUntil := now.Add(l.lockout).Unix()
+			return l.redis.Set(l.prefix+_PREFIX_LOCKOUT+key, []byte(strconv.FormatInt(lockedUntil, 10)), l.lockout)
+		}
+		return nil
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	c, exists := l.counters[key]
+	if !exists {
+		c = &counter{}
+		l.counters[key] = c
+	}
+	if now.After(c.windowEnd) {
+		c.failures = 0
+		c.windowEnd = now.Add(l.window)
+	}
+
+	c.failures++
+	if c.failures >= l.maxFailures {
+		c.lockedUntil = now.Add(l.lockout)
+	}
+
+	return nil
+}
+
+// removeExpiredTicker drops in-memory counters whose window and lockout have both passed.
+func (l *Limiter) removeExpiredTicker() {
+	ticker := time.NewTicker(l.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.closeTicker:
+			return
+		case now := <-ticker.C:
+			l.mux.Lock()
+			for key, c := range l.counters {
+				if now.After(c.windowEnd) && now.After(c.lockedUntil) {
+					delete(l.counters, key)
+				}
+			}
+			l.mux.Unlock()
+		}
+	}
+}
+
+// Close stops the in-memory cleanup.
+func (l *Limiter) Close() {
+	if l.redis == nil {
+		close(l.closeTicker)
+	}
+}
+
+func remaining(until time.Time) time.Duration {
+	d := time.Until(until)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
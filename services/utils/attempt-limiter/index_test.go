@@ -0,0 +1,72 @@
+package attemptlimiter_test
+
+import (
+	"testing"
+	"time"
+
+	AttemptLimiter "peergrine/utils/attempt-limiter"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockoutAfterMaxFailures(t *testing.T) {
+	limiter := AttemptLimiter.New(nil, "test:", 3, time.Minute, time.Minute)
+	defer limiter.Close()
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, limiter.Fail("ip:1.2.3.4"))
+	}
+
+	locked, err := limiter.Locked("ip:1.2.3.4")
+	assert.NoError(t, err)
+	assert.Zero(t, locked, "key should not be locked before reaching the maximum")
+
+	assert.NoError(t, limiter.Fail("ip:1.2.3.4"))
+
+	locked, err = limiter.Locked("user:someone", "ip:1.2.3.4")
+	assert.NoError(t, err)
+	assert.Greater(t, locked, time.Duration(0), "any locked key should lock the request")
+}
+
+func TestKeysAreIndependent(t *testing.T) {
+	limiter := AttemptLimiter.New(nil, "test:", 1, time.Minute, time.Minute)
+	defer limiter.Close()
+
+	assert.NoError(t, limiter.Fail("user:a"))
+
+	locked, err := limiter.Locked("user:b")
+	assert.NoError(t, err)
+	assert.Zero(t, locked)
+}
+
+func TestLockoutExpires(t *testing.T) {
+	limiter := AttemptLimiter.New(nil, "test:", 1, time.Minute, 50*time.Millisecond)
+	defer limiter.Close()
+
+	assert.NoError(t, limiter.Fail("user:a"))
+
+	locked, _ := limiter.Locked("user:a")
+	assert.Greater(t, locked, time.Duration(0))
+
+	time.Sleep(100 * time.Millisecond)
+
+	locked, _ = limiter.Locked("user:a")
+	assert.Zero(t, locked)
+}
+
+func TestFromConfigRejectsInvalidValues(t *testing.T) {
+	for _, values := range [][3]string{
+		{"0", "60", "300"},
+		{"10", "0", "300"},
+		{"10", "60", "0"},
+		{"10", "60", "-1"},
+		{"10", "60", "soon"},
+	} {
+		_, err := AttemptLimiter.FromConfig(nil, "test:", values[0], values[1], values[2])
+		assert.Error(t, err, "values %v should be rejected", values)
+	}
+
+	limiter, err := AttemptLimiter.FromConfig(nil, "test:", "10", "60", "300")
+	assert.NoError(t, err)
+	limiter.Close()
+}
@@ -24,6 +24,24 @@ import (
 //	string: 生成的 Bearer Token。
 //	error: 如果生成令牌過程中發生錯誤，則返回錯誤信息。
 func GenerateBearerToken(iss string, userId string, channelId string, secret []byte, iat, exp int64) (string, error) {
+	return GenerateScopedBearerToken(iss, userId, channelId, "", secret, iat, exp)
+}
+
+// GenerateScopedBearerToken 生成帶有權限範圍的 Bearer Token，範圍為空時與 GenerateBearerToken 相同。
+// 參數:
+//
+//	iss (string): 令牌的發行者。
+//	userId (string): 使用者的唯一標識。
+//	scope (string): 令牌的權限範圍，例如 SCOPE_BOT。
+//	secret ([]byte): 用於簽署令牌的密鑰。
+//	iat (int64): 令牌的簽發時間（UNIX 時間戳）。
+//	exp (int64): 令牌的過期時間（UNIX 時間戳）.
+//
+// 返回值:
+//
+//	string: 生成的 Bearer Token。
+//	error: 如果生成令牌過程中發生錯誤，則返回錯誤信息。
+func GenerateScopedBearerToken(iss string, userId string, channelId string, scope string, secret []byte, iat, exp int64) (string, error) {
 	payload := jwt.MapClaims{
 		"iss":        iss,
 		"iat":        iat,
@@ -32,6 +50,10 @@ func GenerateBearerToken(iss string, userId string, channelId string, secret []b
 		"channel_id": channelId,
 	}
 
+	if scope != "" {
+		payload["scope"] = scope
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
 	tokenString, err := token.SignedString(secret)
 	if err != nil {
@@ -102,6 +124,7 @@ func Claims2TokenPayload(token string, claims *jwt.MapClaims) (tokenPayload Toke
 
 	iat, _ := (*claims)["iat"].(float64)
 	exp, _ := (*claims)["exp"].(float64)
+	scope, _ := (*claims)["scope"].(string)
 
 	return TokenPayload{
 		Token:     token,
@@ -110,6 +133,7 @@ func Claims2TokenPayload(token string, claims *jwt.MapClaims) (tokenPayload Toke
 		Exp:       int64(exp),
 		UserId:    (*claims)["user_id"].(string),
 		ChannelId: (*claims)["channel_id"].(string),
+		Scope:     scope,
 	}
 }
 
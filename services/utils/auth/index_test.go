@@ -125,3 +125,32 @@ func TestExtractIssuerFromToken(t *testing.T) {
 	_, err = auth.ExtractIssuerFromToken(modifiedToken)
 	assert.Error(t, err)
 }
+
+func TestGenerateScopedBearerToken(t *testing.T) {
+	iss := "test_issuer"
+	userId := "bot_123"
+	iat := time.Now().Unix()
+	exp := iat + 3600
+	channeId := "0"
+
+	token, err := auth.GenerateScopedBearerToken(iss, userId, channeId, auth.SCOPE_BOT, secret, iat, exp)
+	assert.NoError(t, err)
+
+	claims, err := auth.DecodeToken(token, secret)
+	assert.NoError(t, err)
+
+	payload := auth.Claims2TokenPayload(token, claims)
+	assert.Equal(t, userId, payload.UserId)
+	assert.Equal(t, auth.SCOPE_BOT, payload.Scope)
+
+	// 未指定範圍的令牌不帶 scope 欄位
+	token, err = auth.GenerateBearerToken(iss, userId, channeId, secret, iat, exp)
+	assert.NoError(t, err)
+
+	claims, err = auth.DecodeToken(token, secret)
+	assert.NoError(t, err)
+
+	_, exists := (*claims)["scope"]
+	assert.False(t, exists)
+	assert.Equal(t, "", auth.Claims2TokenPayload(token, claims).Scope)
+}
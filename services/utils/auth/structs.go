@@ -1,5 +1,11 @@
 package auth
 
+// SCOPE_BOT 為機器人身分令牌的權限範圍
+const SCOPE_BOT = "bot"
+
+// SERVICE_TOKEN_METADATA 為服務間 gRPC 呼叫以 "Bearer <token>" 攜帶服務令牌的 metadata 鍵
+const SERVICE_TOKEN_METADATA = "authorization"
+
 type TokenPayload struct {
 	Token     string
 	Iss       string `json:"iss"`
@@ -7,6 +13,7 @@ type TokenPayload struct {
 	Exp       int64  `json:"exp"`
 	UserId    string `json:"user_id"`
 	ChannelId string `json:"channel_id"`
+	Scope     string `json:"scope,omitempty"`
 }
 
 func (t *TokenPayload) SetToken(token string) {
@@ -0,0 +1,63 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("blob key is invalid")
+)
+
+// Backend stores opaque blobs under slash-separated keys.
+type Backend interface {
+	// Put stores size bytes read from r under key, replacing any existing blob.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get opens the blob stored under key. It returns ErrNotFound if the blob does not exist.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes every blob whose key starts with prefix.
+	Delete(ctx context.Context, prefix string) error
+	// RemoveExpired removes every blob last written before the given time.
+	RemoveExpired(ctx context.Context, before time.Time) error
+}
+
+// Config selects and configures a Backend.
+type Config struct {
+	Type      string // "local" or "s3"
+	Dir       string // Root directory of the local backend
+	Endpoint  string // Host and port of the S3-compatible API
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	UseSSL    bool
+}
+
+// New creates the Backend selected by config.Type.
+func New(config Config) (Backend, error) {
+	switch config.Type {
+	case "local":
+		return NewLocal(config.Dir)
+	case "s3":
+		return NewS3(config.Endpoint, config.AccessKey, config.SecretKey, config.Bucket, config.UseSSL)
+	default:
+		return nil, fmt.Errorf("unknown blob backend: %s", config.Type)
+	}
+}
+
+// validKey reports whether key is a relative slash-separated path without empty, "." or ".." segments.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.ContainsRune(segment, '\\') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package blobstore_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	BlobStore "peergrine/utils/blob-store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalPutGetDelete(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	backend, err := BlobStore.NewLocal(dir)
+	require.NoError(t, err)
+
+	data := []byte("encrypted chunk")
+	require.NoError(t, backend.Put(ctx, "drop/000", bytes.NewReader(data), int64(len(data))))
+
+	reader, err := backend.Get(ctx, "drop/000")
+	require.NoError(t, err)
+	read, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, data, read)
+
+	require.NoError(t, backend.Delete(ctx, "drop/"))
+	_, err = backend.Get(ctx, "drop/000")
+	assert.ErrorIs(t, err, BlobStore.ErrNotFound)
+}
+
+func TestLocalRejectsShortAndInvalidBlobs(t *testing.T) {
+	ctx := context.Background()
+
+	backend, err := BlobStore.NewLocal(t.TempDir())
+	require.NoError(t, err)
+
+	err = backend.Put(ctx, "drop/000", bytes.NewReader([]byte("abc")), 10)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = backend.Get(ctx, "drop/000")
+	assert.ErrorIs(t, err, BlobStore.ErrNotFound, "a short upload must not leave a blob behind")
+
+	for _, key := range []string{"", "/abs", "../escape", "a/../b", "a//b"} {
+		assert.ErrorIs(t, backend.Put(ctx, key, bytes.NewReader(nil), 0), BlobStore.ErrInvalidKey, key)
+	}
+}
+
+func TestLocalRemoveExpired(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	backend, err := BlobStore.NewLocal(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, backend.Put(ctx, "old/000", bytes.NewReader([]byte("a")), 1))
+	require.NoError(t, backend.Put(ctx, "new/000", bytes.NewReader([]byte("b")), 1))
+
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "old", "000"), past, past))
+
+	require.NoError(t, backend.RemoveExpired(ctx, time.Now().Add(-time.Minute)))
+
+	_, err = backend.Get(ctx, "old/000")
+	assert.ErrorIs(t, err, BlobStore.ErrNotFound)
+	_, err = os.Stat(filepath.Join(dir, "old"))
+	assert.True(t, os.IsNotExist(err), "empty directories are removed")
+
+	reader, err := backend.Get(ctx, "new/000")
+	require.NoError(t, err)
+	reader.Close()
+}
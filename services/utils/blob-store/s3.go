@@ -0,0 +1,114 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 stores blobs in a bucket of an S3-compatible API such as MinIO.
+type S3 struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3 connects to the S3-compatible API at endpoint and creates the bucket if it does not exist.
+func NewS3(endpoint, accessKey, secretKey, bucket string, useSSL bool) (*S3, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &S3{client: client, bucket: bucket}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return err
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// GetObject is lazy; Stat surfaces a missing object before the caller starts streaming.
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return object, nil
+}
+
+func (s *S3) Delete(ctx context.Context, prefix string) error {
+	return s.remove(ctx, prefix, func(minio.ObjectInfo) bool { return true })
+}
+
+// RemoveExpired removes objects last modified before the given time. A bucket lifecycle
+// rule can do the same without listing the bucket.
+func (s *S3) RemoveExpired(ctx context.Context, before time.Time) error {
+	return s.remove(ctx, "", func(object minio.ObjectInfo) bool {
+		return object.LastModified.Before(before)
+	})
+}
+
+// remove deletes the objects below prefix for which match returns true.
+func (s *S3) remove(ctx context.Context, prefix string, match func(minio.ObjectInfo) bool) error {
+	objects := make(chan minio.ObjectInfo)
+
+	var listErr error
+	go func() {
+		defer close(objects)
+		for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+			if object.Err != nil {
+				listErr = object.Err
+				return
+			}
+			if match(object) {
+				objects <- object
+			}
+		}
+	}()
+
+	var removeErr error
+	for result := range s.client.RemoveObjects(ctx, s.bucket, objects, minio.RemoveObjectsOptions{}) {
+		removeErr = errors.Join(removeErr, result.Err)
+	}
+
+	return errors.Join(listErr, removeErr)
+}
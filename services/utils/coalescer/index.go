@@ -0,0 +1,159 @@
+package coalescer
+
+import (
+	"sync"
+	"time"
+)
+
+// pending is the latest coalesced action of a key and when the key may run again.
+type pending struct {
+	action  func()
+	nextRun time.Time
+	timer   *time.Timer
+}
+
+// window counts the submissions of a sender in the current rate window.
+type window struct {
+	count int
+	end   time.Time
+}
+
+// Coalescer rate-limits submissions per sender and coalesces actions per key: an action runs
+// at most once per interval for its key, and actions submitted in between replace each other
+// so only the latest one runs when the interval ends. Nothing is persisted; pending actions
+// are dropped on Close.
+type Coalescer struct {
+	rate        int
+	interval    time.Duration
+	mux         sync.Mutex
+	keys        map[string]*pending
+	windows     map[string]*window
+	closed      bool
+	closeTicker chan struct{}
+}
+
+// New creates a Coalescer allowing rate submissions per sender per second, and running
+// actions of the same key at most once per interval.
+func New(rate int, interval time.Duration) *Coalescer {
+	coalescer := &Coalescer{
+		rate:        rate,
+		interval:    interval,
+		keys:        make(map[string]*pending),
+		windows:     make(map[string]*window),
+		closeTicker: make(chan struct{}),
+	}
+
+	go coalescer.removeIdleTicker()
+
+	return coalescer
+}
+
+// allow counts a submission of sender and reports whether it is within the rate.
+// The caller must hold the lock.
+func (c *Coalescer) allow(sender string, now time.Time) bool {
+	w, exists := c.windows[sender]
+	if !exists || !now.Before(w.end) {
+		w = &window{end: now.Add(time.Second)}
+		c.windows[sender] = w
+	}
+
+	if w.count >= c.rate {
+		return false
+	}
+
+	w.count++
+	return true
+}
+
+// Submit runs action for key now if the key has not run within the interval, or schedules
+// it to run when the interval ends, replacing any action already waiting for that key.
+// It reports false, without running or scheduling anything, when sender exceeded its rate.
+func (c *Coalescer) Submit(sender string, key string, action func()) bool {
+	now := time.Now()
+
+	c.mux.Lock()
+
+	if c.closed || !c.allow(sender, now) {
+		c.mux.Unlock()
+		return false
+	}
+
+	p, exists := c.keys[key]
+	if exists && now.Before(p.nextRun) {
+		p.action = action
+		if p.timer == nil {
+			p.timer = time.AfterFunc(p.nextRun.Sub(now), func() { c.flush(key) })
+		}
+		c.mux.Unlock()
+		return true
+	}
+
+	c.keys[key] = &pending{nextRun: now.Add(c.interval)}
+	c.mux.Unlock()
+
+	action()
+	return true
+}
+
+// flush runs the action waiting for key, if any.
+func (c *Coalescer) flush(key string) {
+	c.mux.Lock()
+
+	p, exists := c.keys[key]
+	if c.closed || !exists || p.action == nil {
+		c.mux.Unlock()
+		return
+	}
+
+	action := p.action
+	c.keys[key] = &pending{nextRun: time.Now().Add(c.interval)}
+	c.mux.Unlock()
+
+	action()
+}
+
+// removeIdleTicker periodically forgets idle keys and senders, so the maps do not grow with
+// every sender ever seen.
+func (c *Coalescer) removeIdleTicker() {
+	ticker := time.NewTicker(c.interval + time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closeTicker:
+			return
+		case now := <-ticker.C:
+			c.mux.Lock()
+			for key, p := range c.keys {
+				if p.timer == nil && now.After(p.nextRun) {
+					delete(c.keys, key)
+				}
+			}
+			for sender, w := range c.windows {
+				if now.After(w.end) {
+					delete(c.windows, sender)
+				}
+			}
+			c.mux.Unlock()
+		}
+	}
+}
+
+// Close stops every scheduled action and rejects further submissions.
+func (c *Coalescer) Close() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	close(c.closeTicker)
+	c.closed = true
+	for _, p := range c.keys {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+	}
+	c.keys = make(map[string]*pending)
+}
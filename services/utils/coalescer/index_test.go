@@ -0,0 +1,89 @@
+package coalescer_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	Coalescer "peergrine/utils/coalescer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder collects the values passed to the actions it creates.
+type recorder struct {
+	mux    sync.Mutex
+	values []string
+}
+
+func (r *recorder) action(value string) func() {
+	return func() {
+		r.mux.Lock()
+		r.values = append(r.values, value)
+		r.mux.Unlock()
+	}
+}
+
+func (r *recorder) get() []string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]string(nil), r.values...)
+}
+
+func TestSubmitCoalescesWithinInterval(t *testing.T) {
+	c := Coalescer.New(100, 50*time.Millisecond)
+	defer c.Close()
+
+	r := &recorder{}
+
+	assert.True(t, c.Submit("alice", "alice:bob:typing", r.action("first")))
+	assert.True(t, c.Submit("alice", "alice:bob:typing", r.action("second")))
+	assert.True(t, c.Submit("alice", "alice:bob:typing", r.action("third")))
+
+	assert.Equal(t, []string{"first"}, r.get(), "only the first action runs immediately")
+
+	assert.Eventually(t, func() bool {
+		return len(r.get()) == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"first", "third"}, r.get(), "the latest pending action replaces earlier ones")
+}
+
+func TestSubmitSeparateKeys(t *testing.T) {
+	c := Coalescer.New(100, time.Minute)
+	defer c.Close()
+
+	r := &recorder{}
+
+	c.Submit("alice", "alice:bob:typing", r.action("typing"))
+	c.Submit("alice", "alice:bob:viewing", r.action("viewing"))
+
+	assert.Equal(t, []string{"typing", "viewing"}, r.get())
+}
+
+func TestSubmitRateLimitsSender(t *testing.T) {
+	c := Coalescer.New(2, time.Millisecond)
+	defer c.Close()
+
+	r := &recorder{}
+
+	assert.True(t, c.Submit("alice", "a", r.action("1")))
+	assert.True(t, c.Submit("alice", "b", r.action("2")))
+	assert.False(t, c.Submit("alice", "c", r.action("3")), "third submission within a second exceeds the rate")
+	assert.True(t, c.Submit("bob", "d", r.action("4")), "rates are counted per sender")
+
+	assert.Equal(t, []string{"1", "2", "4"}, r.get())
+}
+
+func TestCloseDropsPending(t *testing.T) {
+	c := Coalescer.New(100, 30*time.Millisecond)
+
+	r := &recorder{}
+
+	c.Submit("alice", "key", r.action("first"))
+	c.Submit("alice", "key", r.action("second"))
+	c.Close()
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, []string{"first"}, r.get())
+	assert.False(t, c.Submit("alice", "key", r.action("third")))
+}
@@ -5,6 +5,9 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // ReadConfigValues reads values from environment variables and command-line flags
@@ -146,6 +149,43 @@ func Print[T any](config *T) {
 			continue
 		}
 
+		// Fields tagged mask:"true" hold credentials and are not written to the log
+		if field.Tag.Get("mask") == "true" && !fieldValue.IsZero() {
+			log.Printf("%s: ******\n", tag)
+			continue
+		}
+
 		log.Printf("%s: %v\n", tag, fieldValue.Interface())
 	}
 }
+
+// ParseSeconds converts a configuration value expressed in whole seconds into a time.Duration.
+func ParseSeconds(str string) (time.Duration, error) {
+	i, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(i) * time.Second, nil
+}
+
+// ParseMilliseconds converts a configuration value expressed in whole milliseconds into a time.Duration.
+func ParseMilliseconds(str string) (time.Duration, error) {
+	i, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(i) * time.Millisecond, nil
+}
+
+// SplitList splits a comma-separated configuration value into its items, skipping blank ones.
+func SplitList(list string) []string {
+	values := make([]string, 0)
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
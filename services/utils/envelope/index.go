@@ -0,0 +1,207 @@
+package envelope
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Envelopes are sealed with VERSION. Verify also accepts versions down to MIN_VERSION, so
+// clients keep verifying envelopes of relays that have not been upgraded yet; raising
+// MIN_VERSION drops an old format once every relay seals a newer one.
+const (
+	VERSION              = 1
+	MIN_VERSION          = 1
+	SEED_CONTEXT         = "peergrine-envelope-signing-key"
+	SIGNING_LABEL_PREFIX = "peergrine-envelope-v"
+)
+
+var (
+	ErrInvalidSignature = errors.New("envelope signature is invalid")
+	ErrUnknownVersion   = errors.New("envelope version is not supported")
+)
+
+// Envelope wraps a relayed payload with the sender identity the server authenticated.
+// Payload holds the JSON text of the relayed data, so clients verify the exact bytes
+// that were signed before parsing them.
+type Envelope struct {
+	Version   int    `json:"version"`
+	Iss       string `json:"iss"`
+	MessageId string `json:"message_id"`
+	SenderId  string `json:"sender_id"`
+	Timestamp int64  `json:"timestamp"` // Server time in Unix milliseconds
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"` // Base64 Ed25519 signature over SigningInput
+}
+
+// SigningInput returns the bytes covered by the signature: the label of the envelope version
+// and every field except the signature, separated by newlines. The label binds the signature
+// to the version, so an envelope cannot be reinterpreted under another format.
+func (e *Envelope) SigningInput() []byte {
+	return []byte(strings.Join([]string{
+		SIGNING_LABEL_PREFIX + strconv.Itoa(e.Version),
+		e.Iss,
+		e.MessageId,
+		e.SenderId,
+		strconv.FormatInt(e.Timestamp, 10),
+		e.Payload,
+	}, "\n"))
+}
+
+// Decode unmarshals the payload into v.
+func (e *Envelope) Decode(v any) error {
+	return json.Unmarshal([]byte(e.Payload), v)
+}
+
+// SeedFromSecret derives the Ed25519 seed of an issuer from its token secret.
+// The secret cannot be recovered from the seed, so the seed can be handed to relays
+// that must sign on behalf of the issuer without being able to mint tokens.
+func SeedFromSecret(secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(SEED_CONTEXT))
+	return mac.Sum(nil)
+}
+
+// PublicKeyFromSecret returns the Ed25519 public key clients use to verify envelopes of an issuer.
+func PublicKeyFromSecret(secret []byte) ed25519.PublicKey {
+	return ed25519.NewKeyFromSeed(SeedFromSecret(secret)).Public().(ed25519.PublicKey)
+}
+
+// Signer seals payloads on behalf of a single issuer.
+type Signer struct {
+	iss string
+	key ed25519.PrivateKey
+}
+
+// NewSigner creates a signer for iss from the seed returned by SeedFromSecret.
+func NewSigner(iss string, seed []byte) (*Signer, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid signing seed length: %d", len(seed))
+	}
+	return &Signer{iss: iss, key: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// PublicKey returns the public key matching the signer.
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// Seal marshals payload and wraps it in an envelope signed for senderId with a new
+// message ID and the current server time.
+func (s *Signer) Seal(senderId string, payload any) (*Envelope, error) {
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	messageId := make([]byte, 16)
+	if _, err := rand.Read(messageId); err != nil {
+		return nil, err
+	}
+
+	envelope := &Envelope{
+		Version:   VERSION,
+		Iss:       s.iss,
+		MessageId: hex.EncodeToString(messageId),
+		SenderId:  senderId,
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   string(payloadBytes),
+	}
+
+	envelope.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, envelope.SigningInput()))
+
+	return envelope, nil
+}
+
+// Verify checks the version and signature of an envelope against the issuer's public key.
+// Replay protection is left to the recipient, which should reject message IDs it has
+// already seen within the accepted timestamp window.
+func Verify(publicKey ed25519.PublicKey, envelope *Envelope) error {
+
+	if envelope.Version < MIN_VERSION || envelope.Version > VERSION {
+		return ErrUnknownVersion
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(envelope.Signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if !ed25519.Verify(publicKey, envelope.SigningInput(), signature) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+type cachedSigner struct {
+	signer    *Signer
+	expiresAt time.Time
+}
+
+// Keyring caches one signer per issuer, fetching issuer seeds on first use. Cached signers
+// are fetched again after ttl, so a rotated issuer secret reaches the relays.
+type Keyring struct {
+	mux     sync.RWMutex
+	signers map[string]cachedSigner
+	fetch   func(iss string) ([]byte, error)
+	ttl     time.Duration
+}
+
+// NewKeyring creates a keyring that obtains the seed of an unknown issuer through fetch and
+// keeps it for ttl.
+func NewKeyring(fetch func(iss string) ([]byte, error), ttl time.Duration) *Keyring {
+	return &Keyring{
+		signers: make(map[string]cachedSigner),
+		fetch:   fetch,
+		ttl:     ttl,
+	}
+}
+
+// Signer returns the signer of iss, fetching its seed if it is not cached yet or the
+// cached one is older than the ttl of the keyring.
+func (k *Keyring) Signer(iss string) (*Signer, error) {
+
+	k.mux.RLock()
+	cached, exists := k.signers[iss]
+	k.mux.RUnlock()
+	if exists && time.Now().Before(cached.expiresAt) {
+		return cached.signer, nil
+	}
+
+	seed, err := k.fetch(iss)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing key for issuer %s: %w", iss, err)
+	}
+
+	signer, err := NewSigner(iss, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mux.Lock()
+	k.signers[iss] = cachedSigner{signer: signer, expiresAt: time.Now().Add(k.ttl)}
+	k.mux.Unlock()
+
+	return signer, nil
+}
+
+// Seal signs payload for senderId with the key of the issuer iss.
+func (k *Keyring) Seal(iss string, senderId string, payload any) (*Envelope, error) {
+	signer, err := k.Signer(iss)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Seal(senderId, payload)
+}
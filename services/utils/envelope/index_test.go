@@ -0,0 +1,115 @@
+package envelope_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	Envelope "peergrine/utils/envelope"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type payload struct {
+	Message string `json:"message"`
+}
+
+func newSigner(t *testing.T, secret string) *Envelope.Signer {
+	signer, err := Envelope.NewSigner("issuer", Envelope.SeedFromSecret([]byte(secret)))
+	require.NoError(t, err)
+	return signer
+}
+
+func TestSealAndVerify(t *testing.T) {
+	signer := newSigner(t, "secret")
+
+	envelope, err := signer.Seal("alice", payload{Message: "hello"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "issuer", envelope.Iss)
+	assert.Equal(t, "alice", envelope.SenderId)
+	assert.Len(t, envelope.MessageId, 32)
+	assert.NotZero(t, envelope.Timestamp)
+
+	publicKey := Envelope.PublicKeyFromSecret([]byte("secret"))
+	assert.Equal(t, signer.PublicKey(), publicKey)
+	assert.NoError(t, Envelope.Verify(publicKey, envelope))
+
+	var decoded payload
+	require.NoError(t, envelope.Decode(&decoded))
+	assert.Equal(t, "hello", decoded.Message)
+
+	other, err := signer.Seal("alice", payload{Message: "hello"})
+	require.NoError(t, err)
+	assert.NotEqual(t, envelope.MessageId, other.MessageId)
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	signer := newSigner(t, "secret")
+	publicKey := signer.PublicKey()
+
+	envelope, err := signer.Seal("alice", payload{Message: "hello"})
+	require.NoError(t, err)
+
+	forged := *envelope
+	forged.SenderId = "mallory"
+	assert.ErrorIs(t, Envelope.Verify(publicKey, &forged), Envelope.ErrInvalidSignature)
+
+	forged = *envelope
+	forged.Payload = `{"message":"bye"}`
+	assert.ErrorIs(t, Envelope.Verify(publicKey, &forged), Envelope.ErrInvalidSignature)
+
+	forged = *envelope
+	forged.Version = Envelope.VERSION + 1
+	assert.ErrorIs(t, Envelope.Verify(publicKey, &forged), Envelope.ErrUnknownVersion)
+
+	forged = *envelope
+	forged.Version = Envelope.MIN_VERSION - 1
+	assert.ErrorIs(t, Envelope.Verify(publicKey, &forged), Envelope.ErrUnknownVersion)
+
+	assert.Error(t, Envelope.Verify(Envelope.PublicKeyFromSecret([]byte("other")), envelope))
+}
+
+func TestKeyringCachesSigners(t *testing.T) {
+	fetches := 0
+	keyring := Envelope.NewKeyring(func(iss string) ([]byte, error) {
+		fetches++
+		if iss == "unknown" {
+			return nil, errors.New("not found")
+		}
+		return Envelope.SeedFromSecret([]byte(iss)), nil
+	}, time.Minute)
+
+	first, err := keyring.Signer("issuer")
+	require.NoError(t, err)
+	second, err := keyring.Signer("issuer")
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+	assert.Equal(t, 1, fetches)
+
+	_, err = keyring.Seal("unknown", "alice", payload{})
+	assert.Error(t, err)
+
+	envelope, err := keyring.Seal("issuer", "alice", payload{Message: "hi"})
+	require.NoError(t, err)
+	assert.NoError(t, Envelope.Verify(Envelope.PublicKeyFromSecret([]byte("issuer")), envelope))
+}
+
+func TestKeyringRefetchesAfterTTL(t *testing.T) {
+	secret := "old"
+	keyring := Envelope.NewKeyring(func(iss string) ([]byte, error) {
+		return Envelope.SeedFromSecret([]byte(secret)), nil
+	}, 10*time.Millisecond)
+
+	first, err := keyring.Signer("issuer")
+	require.NoError(t, err)
+	assert.Equal(t, Envelope.PublicKeyFromSecret([]byte("old")), first.PublicKey())
+
+	secret = "new"
+	time.Sleep(20 * time.Millisecond)
+
+	second, err := keyring.Signer("issuer")
+	require.NoError(t, err)
+	assert.Equal(t, Envelope.PublicKeyFromSecret([]byte("new")), second.PublicKey(), "a rotated secret should be picked up after the ttl")
+}
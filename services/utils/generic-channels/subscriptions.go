@@ -0,0 +1,303 @@
+package genericchannels
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Policy decides what happens when an item is published to a full subscription.
+type Policy int
+
+const (
+	DropOldest Policy = iota // Discard the oldest queued item to make room
+	DropNewest               // Discard the item being published
+	Disconnect               // Close the subscription so the consumer can reconnect and resync
+)
+
+// ParsePolicy converts a configuration value into a Policy.
+func ParsePolicy(str string) (Policy, error) {
+	switch str {
+	case "drop_oldest":
+		return DropOldest, nil
+	case "drop_newest":
+		return DropNewest, nil
+	case "disconnect":
+		return Disconnect, nil
+	default:
+		return 0, fmt.Errorf("unknown overflow policy: %s", str)
+	}
+}
+
+// String returns the configuration value of the policy.
+func (p Policy) String() string {
+	switch p {
+	case DropOldest:
+		return "drop_oldest"
+	case DropNewest:
+		return "drop_newest"
+	case Disconnect:
+		return "disconnect"
+	default:
+		return fmt.Sprintf("Policy(%d)", int(p))
+	}
+}
+
+// Expirer is implemented by items that are no longer worth delivering after a deadline.
+// Expired items are discarded when published and purged from a full queue before the
+// overflow policy applies.
+type Expirer interface {
+	Expired() bool
+}
+
+// expired reports whether item implements Expirer and has expired.
+func expired[T any](item T) bool {
+	expirer, ok := any(item).(Expirer)
+	return ok && expirer.Expired()
+}
+
+// Stats counts what happened to published items.
+type Stats struct {
+	Published    int64 `json:"published"`    // Items queued for a subscriber
+	Dropped      int64 `json:"dropped"`      // Items discarded because a subscription was full
+	Expired      int64 `json:"expired"`      // Items discarded because they expired before being read
+	Disconnected int64 `json:"disconnected"` // Subscriptions closed because they were full
+}
+
+type counters struct {
+	published    atomic.Int64
+	dropped      atomic.Int64
+	expired      atomic.Int64
+	disconnected atomic.Int64
+}
+
+// Subscription is a bounded queue of items for one consumer. Publishing never blocks and
+// is safe after the subscription is closed.
+type Subscription[T any] struct {
+	mux      sync.Mutex
+	ch       chan T
+	policy   Policy
+	closed   bool
+	overflow bool
+	counters *counters
+}
+
+// C returns the channel the consumer reads from. It is closed when the subscription closes.
+func (s *Subscription[T]) C() <-chan T {
+	return s.ch
+}
+
+// Overflowed reports whether the subscription was closed by the Disconnect policy.
+func (s *Subscription[T]) Overflowed() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.overflow
+}
+
+// publish queues item according to the overflow policy and reports whether it was queued.
+func (s *Subscription[T]) publish(item T) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	if expired(item) {
+		s.counters.expired.Add(1)
+		return false
+	}
+
+	select {
+	case s.ch <- item:
+		s.counters.published.Add(1)
+		return true
+	default:
+	}
+
+	// A full queue may be holding items nobody wants any more.
+	if s.purge() > 0 {
+		select {
+		case s.ch <- item:
+			s.counters.published.Add(1)
+			return true
+		default:
+		}
+	}
+
+	switch s.policy {
+	case DropOldest:
+		select {
+		case <-s.ch:
+			s.counters.dropped.Add(1)
+		default:
+		}
+		select {
+		case s.ch <- item:
+			s.counters.published.Add(1)
+			return true
+		default:
+		}
+	case Disconnect:
+		s.overflow = true
+		s.close()
+		s.counters.disconnected.Add(1)
+	}
+
+	s.counters.dropped.Add(1)
+	return false
+}
+
+// purge removes expired items from the queue, keeping the order of the others, and returns
+// how many were removed. The caller must hold the lock.
+func (s *Subscription[T]) purge() int {
+	queued := len(s.ch)
+	kept := make([]T, 0, queued)
+
+	for i := 0; i < queued; i++ {
+		select {
+		case item := <-s.ch:
+			if !expired(item) {
+				kept = append(kept, item)
+			}
+		default:
+		}
+	}
+
+	// Only publishers add to the queue and they hold the lock, so the kept items fit back in.
+	for _, item := range kept {
+		s.ch <- item
+	}
+
+	purged := queued - len(kept)
+	s.counters.expired.Add(int64(purged))
+	return purged
+}
+
+// close closes the channel once. The caller must hold the lock.
+func (s *Subscription[T]) close() {
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+// Close closes the subscription; further items published to it are discarded.
+func (s *Subscription[T]) Close() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.close()
+}
+
+// Subscriptions holds a set of bounded subscriptions per key. Items published to a key are
+// fanned out to every subscription of that key.
+type Subscriptions[T any] struct {
+	mux           *sync.RWMutex
+	subscriptions map[string]map[*Subscription[T]]struct{}
+	capacity      int
+	policy        Policy
+	counters      *counters
+}
+
+// NewSubscriptions creates a registry whose subscriptions queue up to capacity items and
+// apply policy when full.
+func NewSubscriptions[T any](capacity int, policy Policy) Subscriptions[T] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return Subscriptions[T]{
+		mux:           new(sync.RWMutex),
+		subscriptions: make(map[string]map[*Subscription[T]]struct{}),
+		capacity:      capacity,
+		policy:        policy,
+		counters:      new(counters),
+	}
+}
+
+// Subscribe adds a subscription to key alongside any existing ones.
+func (s *Subscriptions[T]) Subscribe(key string) *Subscription[T] {
+	subscription := &Subscription[T]{
+		ch:       make(chan T, s.capacity),
+		policy:   s.policy,
+		counters: s.counters,
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	set, exists := s.subscriptions[key]
+	if !exists {
+		set = make(map[*Subscription[T]]struct{})
+		s.subscriptions[key] = set
+	}
+	set[subscription] = struct{}{}
+
+	return subscription
+}
+
+// Unsubscribe closes subscription and removes it from key, leaving the other subscriptions
+// of key untouched.
+func (s *Subscriptions[T]) Unsubscribe(key string, subscription *Subscription[T]) {
+	s.mux.Lock()
+	if set, exists := s.subscriptions[key]; exists {
+		delete(set, subscription)
+		if len(set) == 0 {
+			delete(s.subscriptions, key)
+		}
+	}
+	s.mux.Unlock()
+
+	subscription.Close()
+}
+
+// Remove closes and removes every subscription of key.
+func (s *Subscriptions[T]) Remove(key string) {
+	s.mux.Lock()
+	set := s.subscriptions[key]
+	delete(s.subscriptions, key)
+	s.mux.Unlock()
+
+	for subscription := range set {
+		subscription.Close()
+	}
+}
+
+// Publish queues item for every subscriber of key without blocking.
+// It reports whether key has a subscriber, even if the item was dropped by the overflow policy.
+func (s *Subscriptions[T]) Publish(key string, item T) bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	set, exists := s.subscriptions[key]
+	if !exists {
+		return false
+	}
+
+	for subscription := range set {
+		subscription.publish(item)
+	}
+	return true
+}
+
+// Stats returns the counters of every subscription created by this registry.
+func (s *Subscriptions[T]) Stats() Stats {
+	return Stats{
+		Published:    s.counters.published.Load(),
+		Dropped:      s.counters.dropped.Load(),
+		Expired:      s.counters.expired.Load(),
+		Disconnected: s.counters.disconnected.Load(),
+	}
+}
+
+// Close closes and removes every subscription.
+func (s *Subscriptions[T]) Close() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for key, set := range s.subscriptions {
+		for subscription := range set {
+			subscription.Close()
+		}
+		delete(s.subscriptions, key)
+	}
+}
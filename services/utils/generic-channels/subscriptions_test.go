@@ -0,0 +1,206 @@
+package genericchannels_test
+
+import (
+	"sync"
+	"testing"
+
+	GenericChannels "peergrine/utils/generic-channels"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 測試解析溢出策略
+func TestParsePolicy(t *testing.T) {
+	policy, err := GenericChannels.ParsePolicy("drop_oldest")
+	assert.NoError(t, err)
+	assert.Equal(t, GenericChannels.DropOldest, policy)
+
+	policy, err = GenericChannels.ParsePolicy("drop_newest")
+	assert.NoError(t, err)
+	assert.Equal(t, GenericChannels.DropNewest, policy)
+
+	policy, err = GenericChannels.ParsePolicy("disconnect")
+	assert.NoError(t, err)
+	assert.Equal(t, GenericChannels.Disconnect, policy)
+
+	// 策略的字串形式即為設定值
+	for _, value := range []string{"drop_oldest", "drop_newest", "disconnect"} {
+		policy, err := GenericChannels.ParsePolicy(value)
+		assert.NoError(t, err)
+		assert.Equal(t, value, policy.String())
+	}
+
+	_, err = GenericChannels.ParsePolicy("block")
+	assert.Error(t, err, "Unknown policies should be rejected")
+}
+
+// 測試發布到不存在的訂閱
+func TestPublishWithoutSubscriber(t *testing.T) {
+	subs := GenericChannels.NewSubscriptions[int](2, GenericChannels.DropNewest)
+
+	assert.False(t, subs.Publish("missing", 1), "Publish should report a missing subscriber")
+	assert.Equal(t, GenericChannels.Stats{}, subs.Stats())
+}
+
+// 測試捨棄最舊項目的策略
+func TestDropOldest(t *testing.T) {
+	subs := GenericChannels.NewSubscriptions[int](2, GenericChannels.DropOldest)
+	sub := subs.Subscribe("key")
+
+	for i := 1; i <= 3; i++ {
+		assert.True(t, subs.Publish("key", i))
+	}
+
+	assert.Equal(t, 2, <-sub.C())
+	assert.Equal(t, 3, <-sub.C())
+	assert.Equal(t, GenericChannels.Stats{Published: 3, Dropped: 1}, subs.Stats())
+}
+
+// 測試捨棄最新項目的策略
+func TestDropNewest(t *testing.T) {
+	subs := GenericChannels.NewSubscriptions[int](2, GenericChannels.DropNewest)
+	sub := subs.Subscribe("key")
+
+	for i := 1; i <= 3; i++ {
+		assert.True(t, subs.Publish("key", i))
+	}
+
+	assert.Equal(t, 1, <-sub.C())
+	assert.Equal(t, 2, <-sub.C())
+	assert.Equal(t, GenericChannels.Stats{Published: 2, Dropped: 1}, subs.Stats())
+}
+
+// 測試滿載時中斷訂閱的策略
+func TestDisconnect(t *testing.T) {
+	subs := GenericChannels.NewSubscriptions[int](1, GenericChannels.Disconnect)
+	sub := subs.Subscribe("key")
+
+	subs.Publish("key", 1)
+	subs.Publish("key", 2)
+	subs.Publish("key", 3)
+
+	// 已排入的項目仍可讀取，之後通道關閉
+	assert.Equal(t, 1, <-sub.C())
+	_, ok := <-sub.C()
+	assert.False(t, ok, "Channel should be closed after overflowing")
+	assert.True(t, sub.Overflowed())
+	assert.Equal(t, GenericChannels.Stats{Published: 1, Dropped: 1, Disconnected: 1}, subs.Stats())
+}
+
+// 測試同一個鍵的多個訂閱皆會收到發布的項目
+func TestFanOut(t *testing.T) {
+	subs := GenericChannels.NewSubscriptions[int](1, GenericChannels.DropNewest)
+	first := subs.Subscribe("key")
+	second := subs.Subscribe("key")
+
+	assert.True(t, subs.Publish("key", 1))
+	assert.Equal(t, 1, <-first.C())
+	assert.Equal(t, 1, <-second.C())
+	assert.Equal(t, GenericChannels.Stats{Published: 2}, subs.Stats())
+}
+
+// 測試取消其中一個訂閱不影響同一個鍵的其他訂閱
+func TestUnsubscribeKeepsOthers(t *testing.T) {
+	subs := GenericChannels.NewSubscriptions[int](1, GenericChannels.DropNewest)
+	first := subs.Subscribe("key")
+	second := subs.Subscribe("key")
+
+	subs.Unsubscribe("key", first)
+
+	_, ok := <-first.C()
+	assert.False(t, ok, "Unsubscribed subscription should be closed")
+
+	assert.True(t, subs.Publish("key", 1), "Other subscriptions of the key should remain")
+	assert.Equal(t, 1, <-second.C())
+
+	subs.Unsubscribe("key", second)
+	assert.False(t, subs.Publish("key", 2), "Key should be gone after its last subscription")
+}
+
+// 測試一個訂閱滿載中斷時，其他訂閱仍持續接收
+func TestDisconnectOnlySlowSubscriber(t *testing.T) {
+	subs := GenericChannels.NewSubscriptions[int](1, GenericChannels.Disconnect)
+	slow := subs.Subscribe("key")
+	fast := subs.Subscribe("key")
+
+	subs.Publish("key", 1)
+	assert.Equal(t, 1, <-fast.C())
+	subs.Publish("key", 2)
+
+	assert.True(t, slow.Overflowed())
+	assert.False(t, fast.Overflowed())
+	assert.Equal(t, 2, <-fast.C())
+}
+
+// 測試移除訂閱
+func TestRemoveSubscription(t *testing.T) {
+	subs := GenericChannels.NewSubscriptions[int](1, GenericChannels.DropNewest)
+	first := subs.Subscribe("key")
+	second := subs.Subscribe("key")
+
+	subs.Remove("key")
+
+	_, ok := <-first.C()
+	assert.False(t, ok, "Removed subscriptions should be closed")
+	_, ok = <-second.C()
+	assert.False(t, ok, "Removed subscriptions should be closed")
+	assert.False(t, subs.Publish("key", 1))
+}
+
+// 測試發布與取消訂閱同時進行時不會 panic
+func TestPublishRacesUnsubscribe(t *testing.T) {
+	subs := GenericChannels.NewSubscriptions[int](1, GenericChannels.DropOldest)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 100; i++ {
+		sub := subs.Subscribe("key")
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				subs.Publish("key", j)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			subs.Unsubscribe("key", sub)
+		}()
+	}
+
+	wg.Wait()
+	subs.Close()
+}
+
+// expiring 是可標記為過期的測試項目
+type expiring struct {
+	value   int
+	expired *bool
+}
+
+func (e expiring) Expired() bool {
+	return *e.expired
+}
+
+// 測試過期項目在發布及佇列滿載時被清除
+func TestExpiredItems(t *testing.T) {
+	subs := GenericChannels.NewSubscriptions[expiring](2, GenericChannels.DropNewest)
+	sub := subs.Subscribe("key")
+
+	stale, fresh := false, false
+	dead := true
+
+	// 已過期的項目不會進入佇列
+	assert.True(t, subs.Publish("key", expiring{0, &dead}))
+
+	assert.True(t, subs.Publish("key", expiring{1, &stale}))
+	assert.True(t, subs.Publish("key", expiring{2, &fresh}))
+
+	// 佇列已滿，但過期的項目先被清除，新項目仍可加入
+	stale = true
+	assert.True(t, subs.Publish("key", expiring{3, &fresh}))
+
+	assert.Equal(t, 2, (<-sub.C()).value)
+	assert.Equal(t, 3, (<-sub.C()).value)
+	assert.Equal(t, GenericChannels.Stats{Published: 3, Expired: 2}, subs.Stats())
+}
@@ -1,6 +1,7 @@
 package genericstorage
 
 import (
+	"errors"
 	Auth "peergrine/utils/auth"
 	Redis "peergrine/utils/redis"
 	"sync"
@@ -96,6 +97,21 @@ func (m *Storage[any]) GetSecret(unitName string) ([]byte, error) {
 	}
 }
 
+// BotExists reports whether the bot identity registered with JwtIssuer is still valid.
+// JwtIssuer deletes the key of a bot when it is revoked.
+// Parameters:
+//   - botId (string): The user ID of the bot.
+//
+// Returns:
+//   - bool: Whether the bot is registered and not revoked.
+//   - error: An error if Redis is not configured or the lookup fails, otherwise nil.
+func (m *Storage[any]) BotExists(botId string) (bool, error) {
+	if m.Redis == nil {
+		return false, errors.New("no Redis configured to check bot revocation")
+	}
+	return m.Redis.Exists("bot:" + botId)
+}
+
 // Close closes the Redis client connection and releases local storage resources.
 // Returns:
 //   - error: If successful, returns nil, otherwise an error message.
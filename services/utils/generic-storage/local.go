@@ -74,7 +74,13 @@ func (store *LocalStorageManager[base]) removeExpiredSignals() {
 				break
 			}
 			heap.Pop(store.dataHeap)
-			delete(store.data, data.GetKey())
+
+			// A key that was set again carries a newer heap entry, so only the
+			// entry that is still current may evict it.
+			current, exists := store.data[data.GetKey()]
+			if exists && current.GetExpiresAt() <= now {
+				delete(store.data, data.GetKey())
+			}
 		}
 		store.mutex.Unlock()
 	}
@@ -107,6 +113,21 @@ func (store *LocalStorageManager[T]) Set(data T) {
 	store.data[data.GetKey()] = data
 }
 
+// SetIfAbsent adds a new data entry only if its key is not already present.
+// It reports whether the entry was added.
+func (store *LocalStorageManager[T]) SetIfAbsent(data T) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, exist := store.data[data.GetKey()]; exist {
+		return false
+	}
+
+	heap.Push(store.dataHeap, data)
+	store.data[data.GetKey()] = data
+	return true
+}
+
 // Get retrieves data by its key. If the key exists, it returns the data; otherwise, it returns nil.
 func (store *LocalStorageManager[any]) Get(key string) *any {
 	store.mutex.RLock()
@@ -119,6 +140,32 @@ func (store *LocalStorageManager[any]) Get(key string) *any {
 	return nil
 }
 
+// Update modifies the entry stored under key while holding the write lock.
+// If fn returns false the entry is deleted instead of being kept. An entry whose expiration
+// time changes is tracked again under the new time.
+// It reports whether the key existed.
+func (store *LocalStorageManager[T]) Update(key string, fn func(data *T) bool) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	data, exist := store.data[key]
+	if !exist {
+		return false
+	}
+
+	expiresAt := data.GetExpiresAt()
+
+	if fn(&data) {
+		if data.GetExpiresAt() != expiresAt {
+			heap.Push(store.dataHeap, data)
+		}
+		store.data[key] = data
+	} else {
+		delete(store.data, key)
+	}
+	return true
+}
+
 // Exist checks if a given key exists in the data store.
 func (store *LocalStorageManager[any]) Exists(key string) bool {
 	store.mutex.RLock()
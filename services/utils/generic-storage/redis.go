@@ -23,6 +23,25 @@ func (m *Storage[T]) SetToRedis(key string, data T) error {
 	return m.Redis.Set(key, dataBytes, duration)
 }
 
+// SetToRedisNX stores data of type T into Redis only if the key does not exist yet.
+// Parameters:
+//   - key (string): The key under which the data will be stored in Redis.
+//   - data (T): The data object that implements the base interface.
+//
+// Returns:
+//   - bool: true if the data was stored, false if the key was already taken.
+//   - error: If the operation is successful, returns nil, otherwise returns an error.
+func (m *Storage[T]) SetToRedisNX(key string, data T) (bool, error) {
+
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return false, err
+	}
+
+	duration := time.Duration(data.GetExpiresAt()-time.Now().Unix()) * time.Second
+	return m.Redis.SetNX(key, dataBytes, duration)
+}
+
 // GetFromRedis retrieves data of type T from Redis based on the provided key.
 // Parameters:
 //   - key (string): The key under which the data is stored in Redis.
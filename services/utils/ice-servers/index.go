@@ -0,0 +1,83 @@
+package iceservers
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	Configurator "peergrine/utils/configurator"
+	"strconv"
+	"time"
+)
+
+// Server is an ICE server entry in the shape of the WebRTC RTCIceServer dictionary.
+type Server struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// Config holds the STUN and TURN servers handed to clients. TURN credentials follow the
+// coturn REST API scheme (use-auth-secret), so TURN servers only need the shared secret.
+type Config struct {
+	StunURLs []string
+	TurnURLs []string
+	Secret   []byte
+	TTL      time.Duration
+}
+
+// NewConfig parses ICE server settings from configuration values. URL lists are
+// comma-separated and the TTL is in seconds.
+func NewConfig(stunURLs, turnURLs, secret, ttl string) (Config, error) {
+	config := Config{
+		StunURLs: Configurator.SplitList(stunURLs),
+		TurnURLs: Configurator.SplitList(turnURLs),
+		Secret:   []byte(secret),
+	}
+
+	var err error
+	if config.TTL, err = Configurator.ParseSeconds(ttl); err != nil {
+		return config, fmt.Errorf("invalid TURN credential TTL: %w", err)
+	}
+	if config.TTL <= 0 {
+		return config, errors.New("TURN credential TTL must be positive")
+	}
+	if len(config.TurnURLs) > 0 && len(config.Secret) == 0 {
+		return config, errors.New("TURN servers require a shared secret")
+	}
+
+	return config, nil
+}
+
+// Credential returns a TURN username and password valid until expiresAt. The username is
+// "<expiry>:<user ID>" and the password the Base64 HMAC-SHA1 of the username under secret.
+func Credential(secret []byte, userId string, expiresAt time.Time) (string, string) {
+	username := strconv.FormatInt(expiresAt.Unix(), 10) + ":" + userId
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write([]byte(username))
+
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Servers returns the ICE servers for a user, with TURN credentials expiring TTL after now.
+func (c Config) Servers(userId string, now time.Time) ([]Server, time.Time) {
+	expiresAt := now.Add(c.TTL)
+	servers := make([]Server, 0, 2)
+
+	if len(c.StunURLs) > 0 {
+		servers = append(servers, Server{URLs: c.StunURLs})
+	}
+
+	if len(c.TurnURLs) > 0 {
+		username, credential := Credential(c.Secret, userId, expiresAt)
+		servers = append(servers, Server{
+			URLs:       c.TurnURLs,
+			Username:   username,
+			Credential: credential,
+		})
+	}
+
+	return servers, expiresAt
+}
@@ -0,0 +1,54 @@
+package iceservers_test
+
+import (
+	"testing"
+	"time"
+
+	IceServers "peergrine/utils/ice-servers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 測試 coturn REST API 憑證格式
+func TestCredential(t *testing.T) {
+	username, credential := IceServers.Credential([]byte("north"), "alice", time.Unix(1700000000, 0))
+	assert.Equal(t, "1700000000:alice", username)
+	assert.Equal(t, "Cd/49soE35ICqcJF/bCTn8Z4OyE=", credential)
+}
+
+// 測試設定解析
+func TestNewConfig(t *testing.T) {
+	config, err := IceServers.NewConfig("stun:a:3478, ,stun:b:3478", "turn:a:3478?transport=udp,turns:a:5349", "north", "600")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stun:a:3478", "stun:b:3478"}, config.StunURLs)
+	assert.Len(t, config.TurnURLs, 2)
+	assert.Equal(t, 10*time.Minute, config.TTL)
+
+	_, err = IceServers.NewConfig("", "turn:a:3478", "", "600")
+	assert.Error(t, err, "TURN servers without a shared secret should be rejected")
+
+	_, err = IceServers.NewConfig("", "", "", "0")
+	assert.Error(t, err)
+}
+
+// 測試產生的伺服器清單
+func TestServers(t *testing.T) {
+	config, err := IceServers.NewConfig("stun:a:3478", "turn:a:3478", "north", "600")
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	servers, expiresAt := config.Servers("alice", now)
+	assert.Equal(t, now.Add(10*time.Minute), expiresAt)
+	require.Len(t, servers, 2)
+	assert.Empty(t, servers[0].Username, "STUN servers need no credentials")
+
+	username, credential := IceServers.Credential([]byte("north"), "alice", expiresAt)
+	assert.Equal(t, username, servers[1].Username)
+	assert.Equal(t, credential, servers[1].Credential)
+
+	stunOnly, err := IceServers.NewConfig("stun:a:3478", "", "", "600")
+	require.NoError(t, err)
+	servers, _ = stunOnly.Servers("alice", now)
+	assert.Len(t, servers, 1)
+}
@@ -0,0 +1,119 @@
+package ippolicy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+)
+
+var ErrForbidden = errors.New("address is not allowed")
+
+// internalNetworks are the ranges the standard library does not classify but that still
+// reach infrastructure rather than the public internet.
+var internalNetworks = mustParseNetworks(
+	"0.0.0.0/8",     // "This" network
+	"100.64.0.0/10", // Carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // Benchmarking
+	"240.0.0.0/4",   // Reserved, including the broadcast address
+	"64:ff9b::/96",  // NAT64, which can embed any of the ranges above
+)
+
+// Policy decides which addresses outbound connections may reach. Public addresses are always
+// allowed; loopback, private, link-local (including the 169.254.169.254 cloud metadata
+// service) and other internal addresses only when they fall into one of the allowed networks.
+type Policy struct {
+	allowed []*net.IPNet
+}
+
+// New creates a Policy that additionally allows the given addresses or CIDR ranges.
+func New(allowed []string) (Policy, error) {
+	var policy Policy
+
+	for _, value := range allowed {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return policy, fmt.Errorf("invalid allowed address: %s", value)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			policy.allowed = append(policy.allowed, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return policy, fmt.Errorf("invalid allowed network: %s", value)
+		}
+		policy.allowed = append(policy.allowed, network)
+	}
+
+	return policy, nil
+}
+
+// Allowed reports whether ip may be reached.
+func (p Policy) Allowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+	}
+
+	for _, network := range p.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return Public(ip)
+}
+
+// Control can be set as the Control function of a net.Dialer. It checks the address actually
+// dialed, after name resolution, so a host name that resolves to an internal address is
+// refused even if it resolved to a public one when it was checked before.
+func (p Policy) Control(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if !p.Allowed(net.ParseIP(host)) {
+		return fmt.Errorf("%w: %s", ErrForbidden, host)
+	}
+	return nil
+}
+
+// Public reports whether ip is a globally routable unicast address.
+func Public(ip net.IP) bool {
+	if ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+
+	for _, network := range internalNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func mustParseNetworks(values ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
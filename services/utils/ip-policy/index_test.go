@@ -0,0 +1,60 @@
+package ippolicy_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	IpPolicy "peergrine/utils/ip-policy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 測試預設只允許公開位址
+func TestDefaultPolicy(t *testing.T) {
+	policy, err := IpPolicy.New(nil)
+	require.NoError(t, err)
+
+	for _, address := range []string{"8.8.8.8", "1.1.1.1", "2606:4700:4700::1111"} {
+		assert.True(t, policy.Allowed(net.ParseIP(address)), address)
+	}
+
+	for _, address := range []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"100.64.0.1", "0.0.0.0", "255.255.255.255", "224.0.0.1",
+		"::1", "fe80::1", "fd00:ec2::254", "::ffff:127.0.0.1", "64:ff9b::a00:1",
+	} {
+		assert.False(t, policy.Allowed(net.ParseIP(address)), address)
+	}
+
+	assert.False(t, policy.Allowed(nil), "unparsable addresses should be refused")
+}
+
+// 測試允許清單中的內部位址
+func TestAllowlist(t *testing.T) {
+	policy, err := IpPolicy.New([]string{"10.0.0.0/8", "127.0.0.1"})
+	require.NoError(t, err)
+
+	assert.True(t, policy.Allowed(net.ParseIP("10.20.30.40")))
+	assert.True(t, policy.Allowed(net.ParseIP("127.0.0.1")))
+	assert.False(t, policy.Allowed(net.ParseIP("127.0.0.2")))
+	assert.False(t, policy.Allowed(net.ParseIP("192.168.1.1")))
+
+	_, err = IpPolicy.New([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+
+	_, err = IpPolicy.New([]string{"localhost"})
+	assert.Error(t, err)
+}
+
+// 測試撥號時檢查實際連線的位址
+func TestControl(t *testing.T) {
+	policy, err := IpPolicy.New(nil)
+	require.NoError(t, err)
+
+	err = policy.Control("tcp4", "127.0.0.1:80", nil)
+	assert.True(t, errors.Is(err, IpPolicy.ErrForbidden))
+
+	assert.NoError(t, policy.Control("tcp4", "8.8.8.8:443", nil))
+}
@@ -0,0 +1,135 @@
+package linkcode
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	Configurator "peergrine/utils/configurator"
+	"strconv"
+	"time"
+)
+
+const LETTER_BYTES = "abcdefghijkmnopqrstuvwxyzABCDEFHJKLMNPQRSTUVWXYZ0123456789"
+
+// MIN_LENGTH is the shortest accepted link code. Lookup lockouts are per identity and address,
+// so shorter codes, especially unlimited or multi-use ones, could still be enumerated.
+const MIN_LENGTH = 6
+
+var (
+	ErrInvalidTTL     = errors.New("requested link code TTL is outside the allowed range")
+	ErrInvalidMaxUses = errors.New("requested link code max uses is outside the allowed range")
+	ErrExhausted      = errors.New("link code has no remaining uses")
+)
+
+// Options are the link code settings a client may request when creating a code.
+type Options struct {
+	TTL       int64 `form:"ttl"`        // Lifetime in seconds, 0 for the server default
+	MaxUses   int   `form:"max_uses"`   // Number of redemptions, 0 for the server default
+	SingleUse bool  `form:"single_use"` // Shorthand for max_uses=1
+}
+
+// Limits are the server-side bounds applied to client-requested Options.
+type Limits struct {
+	Length         int
+	Duration       time.Duration
+	MinDuration    time.Duration
+	MaxDuration    time.Duration
+	MaxUses        int // Upper bound on redemptions, 0 for no bound
+	DefaultMaxUses int // Redemptions when none are requested, 0 for unlimited or MaxUses when bounded
+}
+
+// NewLimits parses link code limits from configuration values. Durations are in seconds.
+func NewLimits(length, duration, minDuration, maxDuration, maxUses, defaultMaxUses string) (Limits, error) {
+	var limits Limits
+	var err error
+
+	if limits.Length, err = strconv.Atoi(length); err != nil {
+		return limits, fmt.Errorf("invalid link code length: %w", err)
+	}
+	if limits.Duration, err = Configurator.ParseSeconds(duration); err != nil {
+		return limits, fmt.Errorf("invalid link code duration: %w", err)
+	}
+	if limits.MinDuration, err = Configurator.ParseSeconds(minDuration); err != nil {
+		return limits, fmt.Errorf("invalid link code min duration: %w", err)
+	}
+	if limits.MaxDuration, err = Configurator.ParseSeconds(maxDuration); err != nil {
+		return limits, fmt.Errorf("invalid link code max duration: %w", err)
+	}
+	if limits.MaxUses, err = strconv.Atoi(maxUses); err != nil {
+		return limits, fmt.Errorf("invalid link code max uses: %w", err)
+	}
+	if limits.DefaultMaxUses, err = strconv.Atoi(defaultMaxUses); err != nil {
+		return limits, fmt.Errorf("invalid link code default max uses: %w", err)
+	}
+
+	if limits.Length < MIN_LENGTH {
+		return limits, fmt.Errorf("link code length must be at least %d", MIN_LENGTH)
+	}
+	if limits.MinDuration > limits.Duration || limits.Duration > limits.MaxDuration {
+		return limits, errors.New("link code duration must lie between its min and max duration")
+	}
+	if limits.MaxUses < 0 || limits.DefaultMaxUses < 0 {
+		return limits, errors.New("link code max uses must not be negative")
+	}
+	if limits.MaxUses > 0 && limits.DefaultMaxUses > limits.MaxUses {
+		return limits, errors.New("link code default max uses must not exceed its max uses")
+	}
+
+	return limits, nil
+}
+
+// Resolve validates the requested options against the limits.
+// Returns:
+//   - time.Duration: How long the link code stays valid.
+//   - int: How many times it may be redeemed, 0 for unlimited.
+//   - error: ErrInvalidTTL or ErrInvalidMaxUses if a request falls outside the limits.
+func (l Limits) Resolve(options Options) (time.Duration, int, error) {
+
+	duration := l.Duration
+	if options.TTL != 0 {
+		duration = time.Duration(options.TTL) * time.Second
+		if duration < l.MinDuration || duration > l.MaxDuration {
+			return 0, 0, ErrInvalidTTL
+		}
+	}
+
+	maxUses := l.DefaultMaxUses
+	if options.SingleUse {
+		if options.MaxUses > 1 {
+			return 0, 0, ErrInvalidMaxUses
+		}
+		maxUses = 1
+	} else if options.MaxUses < 0 {
+		return 0, 0, ErrInvalidMaxUses
+	} else if options.MaxUses > 0 {
+		maxUses = options.MaxUses
+	}
+
+	if l.MaxUses > 0 {
+		if maxUses > l.MaxUses {
+			return 0, 0, ErrInvalidMaxUses
+		}
+		if maxUses == 0 {
+			maxUses = l.MaxUses
+		}
+	}
+
+	return duration, maxUses, nil
+}
+
+// Generate returns a random link code of the configured length.
+func (l Limits) Generate() (string, error) {
+	letterLen := big.NewInt(int64(len(LETTER_BYTES)))
+
+	b := make([]byte, l.Length)
+	for i := range b {
+		randNum, err := rand.Int(rand.Reader, letterLen)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate random number for link code: %v", err)
+		}
+		b[i] = LETTER_BYTES[randNum.Int64()]
+	}
+
+	return string(b), nil
+}
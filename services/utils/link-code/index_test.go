@@ -0,0 +1,104 @@
+package linkcode_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	LinkCodes "peergrine/utils/link-code"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLimits(t *testing.T, maxUses string) LinkCodes.Limits {
+	limits, err := LinkCodes.NewLimits("8", "300", "30", "3600", maxUses, "0")
+	require.NoError(t, err)
+	return limits
+}
+
+func TestNewLimits(t *testing.T) {
+	limits := newLimits(t, "0")
+	assert.Equal(t, 8, limits.Length)
+	assert.Equal(t, 5*time.Minute, limits.Duration)
+
+	_, err := LinkCodes.NewLimits("8", "10", "30", "3600", "0", "0")
+	assert.Error(t, err, "default duration below the minimum should be rejected")
+
+	_, err = LinkCodes.NewLimits("x", "300", "30", "3600", "0", "0")
+	assert.Error(t, err)
+
+	_, err = LinkCodes.NewLimits("5", "300", "30", "3600", "1", "1")
+	assert.Error(t, err, "codes shorter than MIN_LENGTH should be rejected")
+
+	limits, err = LinkCodes.NewLimits("8", "300", "30", "3600", "5", "1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, limits.DefaultMaxUses)
+
+	_, err = LinkCodes.NewLimits("8", "300", "30", "3600", "5", "6")
+	assert.Error(t, err, "default max uses above the bound should be rejected")
+
+	_, err = LinkCodes.NewLimits("8", "300", "30", "3600", "0", "-1")
+	assert.Error(t, err)
+}
+
+func TestResolveDefaults(t *testing.T) {
+	limits := newLimits(t, "0")
+	limits.DefaultMaxUses = 1
+
+	duration, maxUses, err := limits.Resolve(LinkCodes.Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, duration)
+	assert.Equal(t, 1, maxUses)
+}
+
+func TestResolveTTL(t *testing.T) {
+	limits := newLimits(t, "0")
+
+	duration, _, err := limits.Resolve(LinkCodes.Options{TTL: 60})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, duration)
+
+	_, _, err = limits.Resolve(LinkCodes.Options{TTL: 10})
+	assert.ErrorIs(t, err, LinkCodes.ErrInvalidTTL)
+
+	_, _, err = limits.Resolve(LinkCodes.Options{TTL: 7200})
+	assert.ErrorIs(t, err, LinkCodes.ErrInvalidTTL)
+}
+
+func TestResolveMaxUses(t *testing.T) {
+	limits := newLimits(t, "5")
+
+	_, maxUses, err := limits.Resolve(LinkCodes.Options{SingleUse: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, maxUses)
+
+	_, maxUses, err = limits.Resolve(LinkCodes.Options{MaxUses: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, maxUses)
+
+	_, maxUses, err = limits.Resolve(LinkCodes.Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, maxUses, "unlimited default should be capped by the server bound")
+
+	_, _, err = limits.Resolve(LinkCodes.Options{MaxUses: 6})
+	assert.ErrorIs(t, err, LinkCodes.ErrInvalidMaxUses)
+
+	_, _, err = limits.Resolve(LinkCodes.Options{MaxUses: -1})
+	assert.ErrorIs(t, err, LinkCodes.ErrInvalidMaxUses)
+
+	_, _, err = limits.Resolve(LinkCodes.Options{SingleUse: true, MaxUses: 2})
+	assert.ErrorIs(t, err, LinkCodes.ErrInvalidMaxUses)
+}
+
+func TestGenerate(t *testing.T) {
+	limits := newLimits(t, "0")
+	limits.Length = 12
+
+	code, err := limits.Generate()
+	assert.NoError(t, err)
+	assert.Len(t, code, 12)
+	for _, r := range code {
+		assert.True(t, strings.ContainsRune(LinkCodes.LETTER_BYTES, r))
+	}
+}
@@ -0,0 +1,124 @@
+package publickey
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MIN_RSA_BITS is the smallest accepted RSA modulus.
+const MIN_RSA_BITS = 2048
+
+// SAFETY_NUMBER_GROUPS is the number of five-digit groups in a safety number.
+const SAFETY_NUMBER_GROUPS = 6
+
+var (
+	ErrInvalidKey     = errors.New("public key is not a valid SPKI key")
+	ErrUnsupportedKey = errors.New("public key algorithm is not supported")
+	ErrWeakKey        = errors.New("public key is too weak")
+)
+
+// PublicKey is a validated SubjectPublicKeyInfo key.
+type PublicKey struct {
+	Algorithm string // rsa, ecdsa-p256, ecdsa-p384, ecdsa-p521, ed25519 or x25519
+	Der       []byte // Canonical DER encoding of the SubjectPublicKeyInfo
+}
+
+// Parse reads an SPKI public key, PEM encoded ("PUBLIC KEY") or as Base64 DER, and rejects
+// unsupported algorithms and RSA keys shorter than MIN_RSA_BITS.
+func Parse(raw string) (*PublicKey, error) {
+	raw = strings.TrimSpace(raw)
+
+	var der []byte
+	if block, _ := pem.Decode([]byte(raw)); block != nil {
+		if block.Type != "PUBLIC KEY" {
+			return nil, fmt.Errorf("%w: unexpected PEM block %q", ErrInvalidKey, block.Type)
+		}
+		der = block.Bytes
+	} else {
+		var err error
+		if der, err = base64.StdEncoding.DecodeString(raw); err != nil {
+			if der, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(raw, "=")); err != nil {
+				return nil, ErrInvalidKey
+			}
+		}
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	algorithm, err := algorithmOf(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Re-encoding drops any trailing data so equal keys have equal fingerprints.
+	canonical, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	return &PublicKey{Algorithm: algorithm, Der: canonical}, nil
+}
+
+func algorithmOf(key any) (string, error) {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < MIN_RSA_BITS {
+			return "", fmt.Errorf("%w: RSA keys must have at least %d bits", ErrWeakKey, MIN_RSA_BITS)
+		}
+		return "rsa", nil
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return "ecdsa-p256", nil
+		case elliptic.P384():
+			return "ecdsa-p384", nil
+		case elliptic.P521():
+			return "ecdsa-p521", nil
+		}
+		return "", fmt.Errorf("%w: curve %s", ErrUnsupportedKey, key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "ed25519", nil
+	case *ecdh.PublicKey:
+		if key.Curve() == ecdh.X25519() {
+			return "x25519", nil
+		}
+	}
+	return "", fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+}
+
+// Fingerprint returns the hex SHA-256 digest of the canonical DER encoding.
+func (key *PublicKey) Fingerprint() string {
+	digest := sha256.Sum256(key.Der)
+	return hex.EncodeToString(digest[:])
+}
+
+// SafetyNumber returns the key digest as SAFETY_NUMBER_GROUPS groups of five digits,
+// short enough to be read aloud or compared on two screens.
+func (key *PublicKey) SafetyNumber() string {
+	digest := sha256.Sum256(key.Der)
+
+	groups := make([]string, SAFETY_NUMBER_GROUPS)
+	for i := range groups {
+		// Five bytes per group, as 40 bits reduce to five digits with negligible bias.
+		chunk := make([]byte, 8)
+		copy(chunk[3:], digest[i*5:i*5+5])
+		groups[i] = fmt.Sprintf("%05d", binary.BigEndian.Uint64(chunk)%100000)
+	}
+
+	return strings.Join(groups, " ")
+}
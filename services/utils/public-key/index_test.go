@@ -0,0 +1,83 @@
+package publickey_test
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"regexp"
+	"testing"
+
+	PublicKey "peergrine/utils/public-key"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func marshal(t *testing.T, key any) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	assert.NoError(t, err)
+	return der
+}
+
+// 測試支援的演算法
+func TestParseSupported(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecdsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	xKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+
+	cases := map[string]any{
+		"rsa":        &rsaKey.PublicKey,
+		"ecdsa-p256": &ecdsaKey.PublicKey,
+		"ed25519":    edKey,
+		"x25519":     xKey.PublicKey(),
+	}
+
+	for algorithm, key := range cases {
+		parsed, err := PublicKey.Parse(base64.StdEncoding.EncodeToString(marshal(t, key)))
+		assert.NoError(t, err, algorithm)
+		assert.Equal(t, algorithm, parsed.Algorithm)
+	}
+}
+
+// 測試 PEM 與 Base64 格式得到相同的指紋
+func TestFingerprintCanonical(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	der := marshal(t, &key.PublicKey)
+
+	fromPem, err := PublicKey.Parse(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	assert.NoError(t, err)
+	fromBase64, err := PublicKey.Parse(base64.RawURLEncoding.EncodeToString(der))
+	assert.NoError(t, err)
+
+	assert.Equal(t, fromPem.Fingerprint(), fromBase64.Fingerprint())
+	assert.Len(t, fromPem.Fingerprint(), 64)
+	assert.Equal(t, fromPem.SafetyNumber(), fromBase64.SafetyNumber())
+	assert.Regexp(t, regexp.MustCompile(`^\d{5}( \d{5}){5}$`), fromPem.SafetyNumber())
+
+	other, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	otherKey, err := PublicKey.Parse(base64.StdEncoding.EncodeToString(marshal(t, &other.PublicKey)))
+	assert.NoError(t, err)
+	assert.NotEqual(t, fromPem.SafetyNumber(), otherKey.SafetyNumber())
+}
+
+// 測試拒絕弱金鑰與無效金鑰
+func TestParseRejected(t *testing.T) {
+	weak, _ := rsa.GenerateKey(rand.Reader, 1024)
+	_, err := PublicKey.Parse(base64.StdEncoding.EncodeToString(marshal(t, &weak.PublicKey)))
+	assert.ErrorIs(t, err, PublicKey.ErrWeakKey)
+
+	_, err = PublicKey.Parse("not a key")
+	assert.ErrorIs(t, err, PublicKey.ErrInvalidKey)
+
+	_, err = PublicKey.Parse(base64.StdEncoding.EncodeToString([]byte("garbage")))
+	assert.ErrorIs(t, err, PublicKey.ErrInvalidKey)
+
+	_, err = PublicKey.Parse(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("x")})))
+	assert.ErrorIs(t, err, PublicKey.ErrInvalidKey)
+}
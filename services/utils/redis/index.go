@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,6 +14,51 @@ import (
 const _MAX_RETRY_ATTEMPTS = 10
 const _RETRY_INTERVAL_TIME = time.Second * 5
 
+// Nil is returned by Get when the key does not exist.
+const Nil = redis.Nil
+
+// _INCR_WITH_EXPIRE_SCRIPT increments a counter and starts its expiry on the first increment,
+// so the window is fixed from the first hit instead of sliding on every call.
+const _INCR_WITH_EXPIRE_SCRIPT = `
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`
+
+// _INCRBY_WITH_EXPIRE_SCRIPT adds to a counter and extends its expiry on every call.
+const _INCRBY_WITH_EXPIRE_SCRIPT = `
+local count = redis.call("INCRBY", KEYS[1], ARGV[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[2])
+return count
+`
+
+// _ZADD_WITH_EXPIRE_SCRIPT adds a member to a sorted set and extends the expiry of the set,
+// never shortening it.
+const _ZADD_WITH_EXPIRE_SCRIPT = `
+redis.call("ZADD", KEYS[1], ARGV[1], ARGV[2])
+if redis.call("PTTL", KEYS[1]) < tonumber(ARGV[3]) then
+	redis.call("PEXPIRE", KEYS[1], ARGV[3])
+end
+return 1
+`
+
+// _COMPARE_AND_SWAP_SCRIPT replaces the value at key only if it still equals the expected value,
+// keeping the remaining expiry to the millisecond. A missing key never matches.
+const _COMPARE_AND_SWAP_SCRIPT = `
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl > 0 then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ttl)
+else
+	redis.call("SET", KEYS[1], ARGV[2])
+end
+return 1
+`
+
 type Manager struct {
 	client        *redis.Client
 	clusterClient *redis.ClusterClient
@@ -166,6 +212,69 @@ func (r *Manager) Set(key string, data []byte, expiration time.Duration) error {
 	return r.client.Set(ctx, key, data, expiration).Err()
 }
 
+// SetNX stores data under key only if the key does not exist yet.
+// It reports whether the value was stored.
+func (r *Manager) SetNX(key string, data []byte, expiration time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+
+	if r.clusterClient != nil {
+		return r.clusterClient.SetNX(ctx, key, data, expiration).Result()
+	}
+
+	return r.client.SetNX(ctx, key, data, expiration).Result()
+}
+
+// CompareAndSwap sets key to data if its current value equals expected, keeping its expiry.
+// It reports whether the value was replaced; a missing key is never recreated.
+func (r *Manager) CompareAndSwap(key string, expected []byte, data []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+
+	keys := []string{key}
+	args := []interface{}{expected, data}
+
+	if r.clusterClient != nil {
+		swapped, err := r.clusterClient.Eval(ctx, _COMPARE_AND_SWAP_SCRIPT, keys, args...).Int64()
+		return swapped == 1, err
+	}
+
+	swapped, err := r.client.Eval(ctx, _COMPARE_AND_SWAP_SCRIPT, keys, args...).Int64()
+	return swapped == 1, err
+}
+
+// IncrWithExpire atomically increments the counter at key and returns its new value.
+// The expiration is applied when the counter is created and is not extended afterwards.
+func (r *Manager) IncrWithExpire(key string, expiration time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+
+	keys := []string{key}
+	args := []interface{}{expiration.Milliseconds()}
+
+	if r.clusterClient != nil {
+		return r.clusterClient.Eval(ctx, _INCR_WITH_EXPIRE_SCRIPT, keys, args...).Int64()
+	}
+
+	return r.client.Eval(ctx, _INCR_WITH_EXPIRE_SCRIPT, keys, args...).Int64()
+}
+
+// IncrByWithExpire atomically adds value, which may be negative, to the counter at key and
+// returns its new value. Unlike IncrWithExpire, the expiration is extended on every call.
+func (r *Manager) IncrByWithExpire(key string, value int64, expiration time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+
+	keys := []string{key}
+	args := []interface{}{value, expiration.Milliseconds()}
+
+	if r.clusterClient != nil {
+		return r.clusterClient.Eval(ctx, _INCRBY_WITH_EXPIRE_SCRIPT, keys, args...).Int64()
+	}
+
+	return r.client.Eval(ctx, _INCRBY_WITH_EXPIRE_SCRIPT, keys, args...).Int64()
+}
+
 func (r *Manager) Exists(key string) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
 	defer cancel()
@@ -196,6 +305,135 @@ func (r *Manager) Del(key string) error {
 	return r.client.Del(ctx, key).Err()
 }
 
+// Take deletes key and reports whether it existed. The check and the delete are one command,
+// so only one of several concurrent callers sees true.
+func (r *Manager) Take(key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+
+	if r.clusterClient != nil {
+		removed, err := r.clusterClient.Del(ctx, key).Result()
+		if err != nil {
+			return false, err
+		}
+		return removed > 0, nil
+	}
+
+	removed, err := r.client.Del(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	return removed > 0, nil
+}
+
+// Expire sets the expiration of key and reports whether the key exists. A missing key is not
+// created, so an entry removed in the meantime stays removed.
+func (r *Manager) Expire(key string, expiration time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+
+	if r.clusterClient != nil {
+		return r.clusterClient.PExpire(ctx, key, expiration).Result()
+	}
+
+	return r.client.PExpire(ctx, key, expiration).Result()
+}
+
+// Decr atomically decrements the integer stored at key and returns the new value.
+// A missing key is treated as 0, so the first decrement of an expired counter returns -1.
+func (r *Manager) Decr(key string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+
+	if r.clusterClient != nil {
+		return r.clusterClient.Decr(ctx, key).Result()
+	}
+
+	return r.client.Decr(ctx, key).Result()
+}
+
+// DecrBy atomically subtracts value from the integer stored at key and returns the new value.
+// The expiration of the key is left unchanged.
+func (r *Manager) DecrBy(key string, value int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+
+	if r.clusterClient != nil {
+		return r.clusterClient.DecrBy(ctx, key, value).Result()
+	}
+
+	return r.client.DecrBy(ctx, key, value).Result()
+}
+
+// ZAddWithExpire sets the score of member in the sorted set at key. The expiry of the key is
+// extended to at least expiration, so the set outlives every member added with the same expiration.
+func (r *Manager) ZAddWithExpire(key string, member string, score int64, expiration time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+
+	keys := []string{key}
+	args := []interface{}{score, member, expiration.Milliseconds()}
+
+	if r.clusterClient != nil {
+		return r.clusterClient.Eval(ctx, _ZADD_WITH_EXPIRE_SCRIPT, keys, args...).Err()
+	}
+
+	return r.client.Eval(ctx, _ZADD_WITH_EXPIRE_SCRIPT, keys, args...).Err()
+}
+
+// ZRem removes member from the sorted set at key. Redis deletes the key with its last member.
+func (r *Manager) ZRem(key string, member string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+
+	if r.clusterClient != nil {
+		return r.clusterClient.ZRem(ctx, key, member).Err()
+	}
+
+	return r.client.ZRem(ctx, key, member).Err()
+}
+
+// ZRangeByScore returns the members of the sorted set at key whose score is at least min.
+func (r *Manager) ZRangeByScore(key string, min int64) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+
+	opt := &redis.ZRangeBy{Min: strconv.FormatInt(min, 10), Max: "+inf"}
+
+	if r.clusterClient != nil {
+		return r.clusterClient.ZRangeByScore(ctx, key, opt).Result()
+	}
+
+	return r.client.ZRangeByScore(ctx, key, opt).Result()
+}
+
+// ZRemRangeByScore removes the members of the sorted set at key whose score is below max.
+func (r *Manager) ZRemRangeByScore(key string, max int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+
+	maxScore := "(" + strconv.FormatInt(max, 10)
+
+	if r.clusterClient != nil {
+		return r.clusterClient.ZRemRangeByScore(ctx, key, "-inf", maxScore).Err()
+	}
+
+	return r.client.ZRemRangeByScore(ctx, key, "-inf", maxScore).Err()
+}
+
+// Eval runs a Lua script atomically, for operations specific to one service that the other
+// methods do not cover. Every key the script touches must be passed in keys.
+func (r *Manager) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+
+	if r.clusterClient != nil {
+		return r.clusterClient.Eval(ctx, script, keys, args...).Result()
+	}
+
+	return r.client.Eval(ctx, script, keys, args...).Result()
+}
+
 func (r *Manager) Close() error {
 	if r.clusterClient != nil {
 		return r.clusterClient.Close()
@@ -2,9 +2,11 @@ package redis_test
 
 import (
 	"testing"
+	"time"
 
 	"peergrine/utils/redis"
 
+	goredis "github.com/go-redis/redis/v8"
 	"github.com/go-redis/redismock/v8"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -61,6 +63,28 @@ func TestManager_Del(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestManager_Take(t *testing.T) {
+
+	client, mock := redismock.NewClientMock()
+
+	mock.ExpectPing().SetVal("PONG")
+
+	mock.ExpectClusterInfo().RedisNil()
+
+	manager, err := redis.Test(client)
+	require.NoError(t, err)
+
+	mock.ExpectDel("test_key").SetVal(1)
+	taken, err := manager.Take("test_key")
+	assert.NoError(t, err)
+	assert.True(t, taken)
+
+	mock.ExpectDel("test_key").SetVal(0)
+	taken, err = manager.Take("test_key")
+	assert.NoError(t, err)
+	assert.False(t, taken)
+}
+
 func TestManager_Exists(t *testing.T) {
 
 	client, mock := redismock.NewClientMock()
@@ -77,3 +101,177 @@ func TestManager_Exists(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, exists)
 }
+
+func TestManager_Expire(t *testing.T) {
+
+	client, mock := redismock.NewClientMock()
+
+	mock.ExpectPing().SetVal("PONG")
+
+	mock.ExpectClusterInfo().RedisNil()
+
+	manager, err := redis.Test(client)
+	require.NoError(t, err)
+
+	mock.ExpectPExpire("test_key", time.Minute).SetVal(true)
+	exists, err := manager.Expire("test_key", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	mock.ExpectPExpire("test_key", time.Minute).SetVal(false)
+	exists, err = manager.Expire("test_key", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_Decr(t *testing.T) {
+
+	client, mock := redismock.NewClientMock()
+
+	mock.ExpectPing().SetVal("PONG")
+
+	mock.ExpectClusterInfo().RedisNil()
+
+	manager, err := redis.Test(client)
+	require.NoError(t, err)
+
+	mock.ExpectDecr("test_key").SetVal(2)
+	remaining, err := manager.Decr("test_key")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), remaining)
+
+	mock.ExpectDecrBy("test_key", 512).SetVal(-510)
+	remaining, err = manager.DecrBy("test_key", 512)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-510), remaining)
+}
+
+func TestManager_SetNX(t *testing.T) {
+
+	client, mock := redismock.NewClientMock()
+
+	mock.ExpectPing().SetVal("PONG")
+
+	mock.ExpectClusterInfo().RedisNil()
+
+	manager, err := redis.Test(client)
+	require.NoError(t, err)
+
+	mock.ExpectSetNX("test_key", []byte("test_value"), time.Minute).SetVal(true)
+	stored, err := manager.SetNX("test_key", []byte("test_value"), time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, stored)
+
+	mock.ExpectSetNX("test_key", []byte("other_value"), time.Minute).SetVal(false)
+	stored, err = manager.SetNX("test_key", []byte("other_value"), time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, stored)
+}
+
+func TestManager_CompareAndSwap(t *testing.T) {
+
+	client, mock := redismock.NewClientMock()
+
+	mock.ExpectPing().SetVal("PONG")
+
+	mock.ExpectClusterInfo().RedisNil()
+
+	manager, err := redis.Test(client)
+	require.NoError(t, err)
+
+	mock.Regexp().ExpectEval(`PTTL`, []string{"test_key"}, []byte("old"), []byte("new")).SetVal(int64(1))
+	swapped, err := manager.CompareAndSwap("test_key", []byte("old"), []byte("new"))
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+
+	mock.Regexp().ExpectEval(`PTTL`, []string{"test_key"}, []byte("old"), []byte("new")).SetVal(int64(0))
+	swapped, err = manager.CompareAndSwap("test_key", []byte("old"), []byte("new"))
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_IncrWithExpire(t *testing.T) {
+
+	client, mock := redismock.NewClientMock()
+
+	mock.ExpectPing().SetVal("PONG")
+
+	mock.ExpectClusterInfo().RedisNil()
+
+	manager, err := redis.Test(client)
+	require.NoError(t, err)
+
+	mock.Regexp().ExpectEval(`INCR`, []string{"test_key"}, int64(60000)).SetVal(int64(3))
+	count, err := manager.IncrWithExpire("test_key", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestManager_IncrByWithExpire(t *testing.T) {
+
+	client, mock := redismock.NewClientMock()
+
+	mock.ExpectPing().SetVal("PONG")
+
+	mock.ExpectClusterInfo().RedisNil()
+
+	manager, err := redis.Test(client)
+	require.NoError(t, err)
+
+	mock.Regexp().ExpectEval(`INCRBY`, []string{"test_key"}, int64(-512), int64(60000)).SetVal(int64(1024))
+	count, err := manager.IncrByWithExpire("test_key", -512, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1024), count)
+}
+
+func TestManager_SortedSet(t *testing.T) {
+
+	client, mock := redismock.NewClientMock()
+
+	mock.ExpectPing().SetVal("PONG")
+
+	mock.ExpectClusterInfo().RedisNil()
+
+	manager, err := redis.Test(client)
+	require.NoError(t, err)
+
+	mock.Regexp().ExpectEval(`ZADD`, []string{"test_zset"}, int64(1000), "a", int64(60000)).SetVal(int64(1))
+	assert.NoError(t, manager.ZAddWithExpire("test_zset", "a", 1000, time.Minute))
+
+	mock.ExpectZRangeByScore("test_zset", &goredis.ZRangeBy{Min: "500", Max: "+inf"}).SetVal([]string{"a"})
+	members, err := manager.ZRangeByScore("test_zset", 500)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, members)
+
+	mock.ExpectZRemRangeByScore("test_zset", "-inf", "(500").SetVal(0)
+	assert.NoError(t, manager.ZRemRangeByScore("test_zset", 500))
+
+	mock.ExpectZRem("test_zset", "a").SetVal(1)
+	assert.NoError(t, manager.ZRem("test_zset", "a"))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_Eval(t *testing.T) {
+
+	client, mock := redismock.NewClientMock()
+
+	mock.ExpectPing().SetVal("PONG")
+
+	mock.ExpectClusterInfo().RedisNil()
+
+	manager, err := redis.Test(client)
+	require.NoError(t, err)
+
+	script := `return {1, ARGV[1]}`
+	mock.ExpectEval(script, []string{"test_key"}, "value").SetVal([]interface{}{int64(1), "value"})
+	result, err := manager.Eval(script, []string{"test_key"}, "value")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(1), "value"}, result)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,238 @@
+package relayquota
+
+import (
+	"sync"
+	"time"
+)
+
+// PENDING_TTL is how long an authorized address may take to complete its allocation. The
+// server answers an authorized Allocate at once, so this only needs to cover a round trip.
+const PENDING_TTL = 10 * time.Second
+
+// Limits are the relay quotas applied to each identity.
+type Limits struct {
+	MaxAllocations int           // Client transport addresses relaying at once, 0 for no limit
+	MaxBandwidth   int64         // Bytes per second in both directions together, 0 for no limit
+	Idle           time.Duration // Silence after which a client address no longer counts
+}
+
+// client is a client transport address and the identity it allocated for.
+type client struct {
+	identity string
+	lastSeen time.Time
+}
+
+// identity holds the usage of one identity across its client addresses.
+type identity struct {
+	clients   int
+	tokens    float64 // Remaining bytes of the bandwidth bucket
+	updatedAt time.Time
+}
+
+// pending is an address whose request was authorized but whose allocation is not confirmed yet.
+type pending struct {
+	identity string
+	since    time.Time
+}
+
+// Tracker enforces Limits on relayed traffic, keyed by client transport address. Addresses
+// are authorized for an identity when a request names it, and admitted once the allocation
+// succeeds; traffic of other addresses is not limited.
+type Tracker struct {
+	limits     Limits
+	mutex      sync.Mutex
+	clients    map[string]*client
+	pending    map[string]pending
+	identities map[string]*identity
+}
+
+// New creates a Tracker.
+func New(limits Limits) *Tracker {
+	return &Tracker{
+		limits:     limits,
+		clients:    make(map[string]*client),
+		pending:    make(map[string]pending),
+		identities: make(map[string]*identity),
+	}
+}
+
+// Authorize reports whether a client address may allocate for an identity, and reserves a
+// place for it until Admit confirms the allocation. It returns false when the address is
+// new and the admitted and pending addresses of the identity already reach MaxAllocations,
+// so concurrent Allocate requests cannot exceed the quota. Reservations of requests that
+// fail authentication later lapse after PENDING_TTL.
+func (t *Tracker) Authorize(identityId string, addr string, now time.Time) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.prune(now)
+
+	if c, ok := t.clients[addr]; ok && c.identity == identityId {
+		c.lastSeen = now
+		return true
+	}
+
+	if t.limits.MaxAllocations > 0 && t.reserved(identityId, addr) >= t.limits.MaxAllocations {
+		return false
+	}
+
+	t.pending[addr] = pending{identity: identityId, since: now}
+	return true
+}
+
+// reserved counts the admitted and pending addresses of an identity other than addr.
+func (t *Tracker) reserved(identityId string, addr string) int {
+	count := 0
+	if usage, ok := t.identities[identityId]; ok {
+		count = usage.clients
+	}
+
+	for pendingAddr, p := range t.pending {
+		if pendingAddr != addr && p.identity == identityId {
+			count++
+		}
+	}
+	return count
+}
+
+// Admit charges a client address to the identity it was authorized for. It returns false
+// when the address was not authorized.
+func (t *Tracker) Admit(addr string, now time.Time) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	p, ok := t.pending[addr]
+	if !ok {
+		_, ok = t.clients[addr]
+		return ok
+	}
+	delete(t.pending, addr)
+
+	if c, ok := t.clients[addr]; ok {
+		if c.identity == p.identity {
+			c.lastSeen = now
+			return true
+		}
+		// The address switches identity, so it counts against the new one from here on.
+		t.release(addr)
+	}
+
+	usage, ok := t.identities[p.identity]
+	if !ok {
+		usage = &identity{tokens: float64(t.limits.MaxBandwidth), updatedAt: now}
+		t.identities[p.identity] = usage
+	}
+
+	usage.clients++
+	t.clients[addr] = &client{identity: p.identity, lastSeen: now}
+	return true
+}
+
+// Allow takes n bytes from the bandwidth of the identity behind addr. It returns false,
+// taking nothing, when the identity has used up its bandwidth; the caller drops the packet.
+func (t *Tracker) Allow(addr string, n int, now time.Time) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	usage := t.refill(addr, now)
+	if usage == nil {
+		return true
+	}
+
+	if usage.tokens < float64(n) {
+		return false
+	}
+
+	usage.tokens -= float64(n)
+	return true
+}
+
+// Wait takes n bytes from the bandwidth of the identity behind addr and returns how long
+// the caller should wait before passing them on, for streams that cannot drop data.
+func (t *Tracker) Wait(addr string, n int, now time.Time) time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	usage := t.refill(addr, now)
+	if usage == nil {
+		return 0
+	}
+
+	usage.tokens -= float64(n)
+	if usage.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-usage.tokens / float64(t.limits.MaxBandwidth) * float64(time.Second))
+}
+
+// Release unbinds a client address, for example when its allocation is deleted or its
+// connection closes.
+func (t *Tracker) Release(addr string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.pending, addr)
+	t.release(addr)
+}
+
+// refill marks the address as active and refills the bucket of its identity. It returns nil
+// when the traffic of the address is not limited.
+func (t *Tracker) refill(addr string, now time.Time) *identity {
+	c, ok := t.clients[addr]
+	if !ok {
+		return nil
+	}
+	c.lastSeen = now
+
+	if t.limits.MaxBandwidth <= 0 {
+		return nil
+	}
+
+	usage := t.identities[c.identity]
+
+	// The bucket holds at most one second of bandwidth.
+	elapsed := now.Sub(usage.updatedAt).Seconds()
+	if elapsed > 0 {
+		usage.tokens += elapsed * float64(t.limits.MaxBandwidth)
+		if max := float64(t.limits.MaxBandwidth); usage.tokens > max {
+			usage.tokens = max
+		}
+		usage.updatedAt = now
+	}
+
+	return usage
+}
+
+func (t *Tracker) release(addr string) {
+	c, ok := t.clients[addr]
+	if !ok {
+		return
+	}
+	delete(t.clients, addr)
+
+	usage := t.identities[c.identity]
+	usage.clients--
+	if usage.clients <= 0 {
+		delete(t.identities, c.identity)
+	}
+}
+
+// prune forgets stale authorizations and releases the addresses that have been silent for
+// longer than Idle.
+func (t *Tracker) prune(now time.Time) {
+	for addr, p := range t.pending {
+		if now.Sub(p.since) > PENDING_TTL {
+			delete(t.pending, addr)
+		}
+	}
+
+	if t.limits.Idle <= 0 {
+		return
+	}
+	for addr, c := range t.clients {
+		if now.Sub(c.lastSeen) > t.limits.Idle {
+			t.release(addr)
+		}
+	}
+}
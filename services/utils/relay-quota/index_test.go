@@ -0,0 +1,84 @@
+package relayquota_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	RelayQuota "peergrine/utils/relay-quota"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var start = time.Unix(1700000000, 0)
+
+// admit 授權並確認一個位址的分配
+func admit(tracker *RelayQuota.Tracker, identity string, addr string, now time.Time) bool {
+	return tracker.Authorize(identity, addr, now) && tracker.Admit(addr, now)
+}
+
+// 測試每個身分的分配數量上限
+func TestAdmit(t *testing.T) {
+	tracker := RelayQuota.New(RelayQuota.Limits{MaxAllocations: 2, Idle: 5 * time.Minute})
+
+	assert.True(t, admit(tracker, "alice", "10.0.0.1:1000", start))
+	assert.True(t, admit(tracker, "alice", "10.0.0.1:1001", start))
+	assert.True(t, tracker.Authorize("alice", "10.0.0.1:1000", start), "Known addresses should stay authorized")
+	assert.False(t, tracker.Authorize("alice", "10.0.0.1:1002", start))
+	assert.True(t, admit(tracker, "bob", "10.0.0.2:1000", start), "Quotas should be per identity")
+
+	tracker.Release("10.0.0.1:1001")
+	assert.True(t, admit(tracker, "alice", "10.0.0.1:1002", start))
+
+	// 閒置的位址不再計入
+	later := start.Add(10 * time.Minute)
+	assert.True(t, admit(tracker, "alice", "10.0.0.1:1003", later))
+	assert.True(t, admit(tracker, "alice", "10.0.0.1:1004", later))
+}
+
+// 測試未確認的授權在過期前佔用配額
+func TestAuthorizeUnconfirmed(t *testing.T) {
+	tracker := RelayQuota.New(RelayQuota.Limits{MaxAllocations: 2})
+
+	// 同時發出的請求不能超過上限
+	assert.True(t, tracker.Authorize("alice", "10.0.0.9:0", start))
+	assert.True(t, tracker.Authorize("alice", "10.0.0.9:0", start), "Repeated requests of an address should keep its reservation")
+	assert.True(t, tracker.Authorize("alice", "10.0.0.9:1", start))
+	for port := 2; port < 5; port++ {
+		assert.False(t, tracker.Authorize("alice", "10.0.0.9:"+strconv.Itoa(port), start))
+	}
+	assert.True(t, tracker.Authorize("bob", "10.0.0.9:2", start), "Reservations should be per identity")
+	assert.False(t, tracker.Admit("10.0.0.1:1000", start), "Addresses that were never authorized should not be admitted")
+
+	// 未確認的授權過期後釋出配額
+	later := start.Add(RelayQuota.PENDING_TTL + time.Second)
+	assert.True(t, admit(tracker, "alice", "10.0.0.1:1000", later))
+	assert.True(t, admit(tracker, "alice", "10.0.0.1:1001", later))
+	assert.False(t, tracker.Authorize("alice", "10.0.0.1:1002", later))
+}
+
+// 測試丟棄超出頻寬的封包
+func TestAllow(t *testing.T) {
+	tracker := RelayQuota.New(RelayQuota.Limits{MaxBandwidth: 1000})
+
+	assert.True(t, tracker.Allow("10.0.0.9:1000", 5000, start), "Unknown addresses should not be limited")
+
+	admit(tracker, "alice", "10.0.0.1:1000", start)
+	admit(tracker, "alice", "10.0.0.1:1001", start)
+
+	assert.True(t, tracker.Allow("10.0.0.1:1000", 600, start))
+	assert.False(t, tracker.Allow("10.0.0.1:1001", 600, start), "Addresses of an identity should share its bandwidth")
+	assert.True(t, tracker.Allow("10.0.0.1:1001", 400, start))
+
+	assert.True(t, tracker.Allow("10.0.0.1:1000", 500, start.Add(500*time.Millisecond)))
+	assert.False(t, tracker.Allow("10.0.0.1:1000", 1001, start.Add(time.Hour)), "The bucket should hold one second of bandwidth")
+}
+
+// 測試串流連線的等待時間
+func TestWait(t *testing.T) {
+	tracker := RelayQuota.New(RelayQuota.Limits{MaxBandwidth: 1000})
+	admit(tracker, "alice", "10.0.0.1:1000", start)
+
+	assert.Zero(t, tracker.Wait("10.0.0.1:1000", 1000, start))
+	assert.Equal(t, 500*time.Millisecond, tracker.Wait("10.0.0.1:1000", 500, start))
+}
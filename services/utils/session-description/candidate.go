@@ -0,0 +1,135 @@
+package sessiondescription
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const MAX_CANDIDATE_LENGTH = 1024
+
+var ErrInvalidCandidate = errors.New("invalid ICE candidate")
+
+var (
+	foundation = regexp.MustCompile(`^[A-Za-z0-9+/]{1,32}$`)
+	hostname   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*$`)
+	extension  = regexp.MustCompile(`^[\x21-\x7e]+$`)
+)
+
+var candidateTypes = map[string]bool{"host": true, "srflx": true, "prflx": true, "relay": true}
+
+// Candidate is a parsed ICE candidate attribute (RFC 8839).
+type Candidate struct {
+	Foundation     string
+	Component      int
+	Transport      string
+	Priority       uint32
+	Address        string // An IP address, or a host name such as an mDNS .local name
+	Port           int
+	Type           string
+	RelatedAddress string
+	RelatedPort    int
+	Extensions     map[string]string
+}
+
+func invalidCandidate(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidCandidate, fmt.Sprintf(format, args...))
+}
+
+// ParseCandidate parses the candidate string of an RTCIceCandidate, with or without the
+// "a=" prefix. The errors wrap ErrInvalidCandidate.
+func ParseCandidate(raw string) (*Candidate, error) {
+	if len(raw) > MAX_CANDIDATE_LENGTH {
+		return nil, invalidCandidate("candidate exceeds %d bytes", MAX_CANDIDATE_LENGTH)
+	}
+
+	value, found := strings.CutPrefix(strings.TrimPrefix(raw, "a="), "candidate:")
+	if !found {
+		return nil, invalidCandidate("candidate must start with \"candidate:\"")
+	}
+
+	fields := strings.Split(value, " ")
+	if len(fields) < 8 {
+		return nil, invalidCandidate("candidate needs at least 8 fields, got %d", len(fields))
+	}
+
+	candidate := Candidate{
+		Foundation: fields[0],
+		Transport:  strings.ToLower(fields[2]),
+		Address:    fields[4],
+		Type:       fields[7],
+		Extensions: make(map[string]string),
+	}
+
+	if !foundation.MatchString(candidate.Foundation) {
+		return nil, invalidCandidate("foundation %q is not 1 to 32 ice-chars", truncate(candidate.Foundation))
+	}
+
+	var err error
+	if candidate.Component, err = strconv.Atoi(fields[1]); err != nil || candidate.Component < 1 || candidate.Component > 256 {
+		return nil, invalidCandidate("component ID %q is not between 1 and 256", truncate(fields[1]))
+	}
+
+	if candidate.Transport != "udp" && candidate.Transport != "tcp" {
+		return nil, invalidCandidate("transport %q is not UDP or TCP", truncate(fields[2]))
+	}
+
+	priority, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return nil, invalidCandidate("priority %q is not a 32-bit number", truncate(fields[3]))
+	}
+	candidate.Priority = uint32(priority)
+
+	if net.ParseIP(candidate.Address) == nil && !validHostname(candidate.Address) {
+		return nil, invalidCandidate("address %q is not an IP address or host name", truncate(candidate.Address))
+	}
+
+	if candidate.Port, err = parsePort(fields[5]); err != nil {
+		return nil, invalidCandidate("port %q is not a port number", truncate(fields[5]))
+	}
+
+	if fields[6] != "typ" || !candidateTypes[candidate.Type] {
+		return nil, invalidCandidate("expected typ host, srflx, prflx or relay")
+	}
+
+	rest := fields[8:]
+	if len(rest)%2 != 0 {
+		return nil, invalidCandidate("extension %q has no value", truncate(rest[len(rest)-1]))
+	}
+
+	for i := 0; i < len(rest); i += 2 {
+		name, value := rest[i], rest[i+1]
+		if !extension.MatchString(name) || !extension.MatchString(value) {
+			return nil, invalidCandidate("extension %q is malformed", truncate(name))
+		}
+
+		switch name {
+		case "raddr":
+			if net.ParseIP(value) == nil && !validHostname(value) {
+				return nil, invalidCandidate("related address %q is not an IP address or host name", truncate(value))
+			}
+			candidate.RelatedAddress = value
+		case "rport":
+			if candidate.RelatedPort, err = parsePort(value); err != nil {
+				return nil, invalidCandidate("related port %q is not a port number", truncate(value))
+			}
+		default:
+			candidate.Extensions[name] = value
+		}
+	}
+
+	return &candidate, nil
+}
+
+func parsePort(value string) (int, error) {
+	port, err := strconv.ParseUint(value, 10, 16)
+	return int(port), err
+}
+
+// validHostname reports whether value is a DNS host name.
+func validHostname(value string) bool {
+	return len(value) <= 253 && hostname.MatchString(value)
+}
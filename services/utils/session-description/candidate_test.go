@@ -0,0 +1,57 @@
+package sessiondescription_test
+
+import (
+	"strings"
+	"testing"
+
+	SessionDescription "peergrine/utils/session-description"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 測試解析合法的候選
+func TestParseCandidate(t *testing.T) {
+	candidate, err := SessionDescription.ParseCandidate("candidate:842163049 1 udp 1677729535 203.0.113.7 46154 typ srflx raddr 10.0.0.2 rport 50000 generation 0 ufrag EsAw")
+	require.NoError(t, err)
+	assert.Equal(t, "srflx", candidate.Type)
+	assert.Equal(t, uint32(1677729535), candidate.Priority)
+	assert.Equal(t, "10.0.0.2", candidate.RelatedAddress)
+	assert.Equal(t, 50000, candidate.RelatedPort)
+	assert.Equal(t, "EsAw", candidate.Extensions["ufrag"])
+
+	valid := []string{
+		"a=candidate:1 1 UDP 2122260223 2001:db8::1 54400 typ host",
+		"candidate:3 1 udp 2113937151 7c0f8f4b-2a3b-4d4e-9f0a-1b2c3d4e5f60.local 54401 typ host generation 0",
+		"candidate:4 1 tcp 1518280447 192.0.2.1 9 typ host tcptype active",
+		"candidate:5 2 udp 41885439 198.51.100.3 3478 typ relay raddr 203.0.113.7 rport 46154",
+	}
+	for _, raw := range valid {
+		_, err := SessionDescription.ParseCandidate(raw)
+		assert.NoError(t, err, raw)
+	}
+}
+
+// 測試不合法的候選
+func TestParseCandidateRejected(t *testing.T) {
+	cases := map[string]string{
+		"842163049 1 udp 1 203.0.113.7 1 typ host":                                  "must start with",
+		"candidate:1 1 udp 1 203.0.113.7 1":                                         "at least 8 fields",
+		"candidate:bad! 1 udp 1 203.0.113.7 1 typ host":                             "foundation",
+		"candidate:1 0 udp 1 203.0.113.7 1 typ host":                                "component ID",
+		"candidate:1 1 sctp 1 203.0.113.7 1 typ host":                               "transport",
+		"candidate:1 1 udp 4294967296 203.0.113.7 1 typ host":                       "priority",
+		"candidate:1 1 udp 1 not_an_address 1 typ host":                             "address",
+		"candidate:1 1 udp 1 203.0.113.7 70000 typ host":                            "port",
+		"candidate:1 1 udp 1 203.0.113.7 1 type host":                               "expected typ",
+		"candidate:1 1 udp 1 203.0.113.7 1 typ host generation":                     "has no value",
+		"candidate:1 1 udp 1 203.0.113.7 1 typ srflx raddr x_y rport 0":             "related address",
+		"candidate:1 1 udp 1 203.0.113.7 1 typ host " + strings.Repeat("k v ", 300): "exceeds",
+	}
+
+	for raw, expected := range cases {
+		_, err := SessionDescription.ParseCandidate(raw)
+		assert.ErrorIs(t, err, SessionDescription.ErrInvalidCandidate, raw)
+		assert.ErrorContains(t, err, expected, raw)
+	}
+}
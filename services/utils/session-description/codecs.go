@@ -0,0 +1,109 @@
+package sessiondescription
+
+import (
+	"strconv"
+	"strings"
+)
+
+// payloadAttributes are the attributes whose value starts with the payload type they describe.
+var payloadAttributes = []string{"a=rtpmap:", "a=fmtp:", "a=rtcp-fb:"}
+
+// Strip removes the codecs the policy does not offer from a session description: their
+// payload types are dropped from the m= lines along with their a=rtpmap, a=fmtp and
+// a=rtcp-fb lines, and so are retransmission formats whose apt names a dropped payload type.
+// The line endings are kept. It returns an error if the description does not pass Parse or
+// an RTP media section would be left without a format.
+func (p Policy) Strip(sdp string) (string, error) {
+	description, err := p.Parse(sdp)
+	if err != nil || p.Offered == nil {
+		return sdp, err
+	}
+
+	lines := strings.SplitAfter(sdp, "\n")
+	kept := lines[:0]
+
+	section := -1
+	var dropped map[string]bool
+
+	for number, line := range lines {
+		content := strings.TrimRight(line, "\r\n")
+
+		if strings.HasPrefix(content, "m=") {
+			section++
+			media := description.Media[section]
+			if dropped = p.droppedFormats(media); len(dropped) == 0 {
+				kept = append(kept, line)
+				continue
+			}
+
+			formats := make([]string, 0, len(media.Formats))
+			for _, format := range media.Formats {
+				if !dropped[format] {
+					formats = append(formats, format)
+				}
+			}
+			if len(formats) == 0 {
+				return sdp, invalid(number+1, "media section %d has no offered codec", section+1)
+			}
+
+			fields := strings.SplitN(content, " ", 4)
+			kept = append(kept, strings.Join(append(fields[:3], formats...), " ")+line[len(content):])
+			continue
+		}
+
+		if len(dropped) > 0 && dropped[payloadOf(content)] {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	return strings.Join(kept, ""), nil
+}
+
+// droppedFormats returns the payload types of an RTP media section that Strip removes:
+// those of codecs that are not offered or unknown, and retransmissions of removed ones.
+func (p Policy) droppedFormats(media Media) map[string]bool {
+	dropped := make(map[string]bool)
+	if !protocols[media.Protocol] {
+		return dropped
+	}
+
+	for _, format := range media.Formats {
+		payloadType, _ := strconv.Atoi(format)
+		if !p.Offered[media.Codecs[payloadType]] {
+			dropped[format] = true
+		}
+	}
+
+	for _, format := range media.Formats {
+		payloadType, _ := strconv.Atoi(format)
+		if apt, ok := associatedPayload(media.Parameters[payloadType]); ok && dropped[apt] {
+			dropped[format] = true
+		}
+	}
+
+	return dropped
+}
+
+// associatedPayload returns the apt parameter of format parameters, which names the payload
+// type a retransmission format repairs.
+func associatedPayload(parameters string) (string, bool) {
+	for _, parameter := range strings.Split(parameters, ";") {
+		if value, found := strings.CutPrefix(strings.TrimSpace(parameter), "apt="); found {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// payloadOf returns the payload type an a=rtpmap, a=fmtp or a=rtcp-fb line describes, or an
+// empty string for other lines.
+func payloadOf(line string) string {
+	for _, prefix := range payloadAttributes {
+		if value, found := strings.CutPrefix(line, prefix); found {
+			payload, _, _ := strings.Cut(value, " ")
+			return payload
+		}
+	}
+	return ""
+}
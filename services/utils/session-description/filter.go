@@ -0,0 +1,231 @@
+package sessiondescription
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Candidate filter names, as used in configuration.
+const (
+	FILTER_NO_PRIVATE_HOST = "no-private-host" // Drop host candidates with private addresses and hide private related addresses
+	FILTER_RELAY_ONLY      = "relay-only"      // Keep only relay candidates, forcing TURN, and hide their related addresses
+	FILTER_NO_IPV6         = "no-ipv6"         // Drop IPv6 candidates
+	FILTER_NO_TCP          = "no-tcp"          // Drop TCP candidates
+)
+
+// CandidateFilter decides which ICE candidates may reach the other peer.
+type CandidateFilter struct {
+	NoPrivateHost bool
+	RelayOnly     bool
+	NoIPv6        bool
+	NoTCP         bool
+}
+
+// carrierNAT is the shared address space of RFC 6598, which is not routable either.
+var carrierNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// ParseCandidateFilter builds a filter from filter names.
+func ParseCandidateFilter(names []string) (CandidateFilter, error) {
+	var filter CandidateFilter
+
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case FILTER_NO_PRIVATE_HOST:
+			filter.NoPrivateHost = true
+		case FILTER_RELAY_ONLY:
+			filter.RelayOnly = true
+		case FILTER_NO_IPV6:
+			filter.NoIPv6 = true
+		case FILTER_NO_TCP:
+			filter.NoTCP = true
+		case "":
+		default:
+			return filter, fmt.Errorf("unknown candidate filter: %q", name)
+		}
+	}
+
+	return filter, nil
+}
+
+// Merge returns a filter applying the rules of both filters.
+func (f CandidateFilter) Merge(other CandidateFilter) CandidateFilter {
+	return CandidateFilter{
+		NoPrivateHost: f.NoPrivateHost || other.NoPrivateHost,
+		RelayOnly:     f.RelayOnly || other.RelayOnly,
+		NoIPv6:        f.NoIPv6 || other.NoIPv6,
+		NoTCP:         f.NoTCP || other.NoTCP,
+	}
+}
+
+// IsZero reports whether the filter lets every candidate through unchanged.
+func (f CandidateFilter) IsZero() bool {
+	return f == CandidateFilter{}
+}
+
+// Allows reports whether a candidate may be forwarded.
+func (f CandidateFilter) Allows(candidate *Candidate) bool {
+	if f.RelayOnly && candidate.Type != "relay" {
+		return false
+	}
+	if f.NoTCP && candidate.Transport == "tcp" {
+		return false
+	}
+
+	ip := net.ParseIP(candidate.Address)
+
+	if f.NoIPv6 && ip != nil && ip.To4() == nil {
+		return false
+	}
+	if f.NoPrivateHost && candidate.Type == "host" && privateIP(ip) {
+		return false
+	}
+
+	return true
+}
+
+// hidesRelated reports whether the related address of a forwarded candidate is hidden. The
+// related address of a relay candidate is the public address of the sender, which relay-only
+// is meant to keep from the other peer.
+func (f CandidateFilter) hidesRelated(candidate *Candidate) bool {
+	if candidate.RelatedAddress == "" {
+		return false
+	}
+	return f.RelayOnly || f.NoPrivateHost && privateIP(net.ParseIP(candidate.RelatedAddress))
+}
+
+// Apply filters a candidate string. It returns the string to forward, with hidden related
+// addresses replaced by the unspecified address the way browsers hide them, and false when
+// the candidate is dropped. Strings that do not parse are dropped.
+func (f CandidateFilter) Apply(raw string) (string, bool) {
+	if f.IsZero() {
+		return raw, true
+	}
+
+	candidate, err := ParseCandidate(raw)
+	if err != nil || !f.Allows(candidate) {
+		return "", false
+	}
+
+	if !f.hidesRelated(candidate) {
+		return raw, true
+	}
+
+	fields := strings.Split(raw, " ")
+	for i := 8; i+1 < len(fields); i += 2 {
+		switch fields[i] {
+		case "raddr":
+			if net.ParseIP(fields[i+1]).To4() != nil {
+				fields[i+1] = "0.0.0.0"
+			} else {
+				fields[i+1] = "::"
+			}
+		case "rport":
+			fields[i+1] = "0"
+		}
+	}
+
+	return strings.Join(fields, " "), true
+}
+
+// FilterSDP applies the filter to the a=candidate lines of a session description that
+// already passed Parse, keeping its line endings. The default candidate that browsers copy
+// into the c= lines, the ports of the m= lines and a=rtcp is replaced by the placeholders
+// of trickle ICE, 0.0.0.0 and port 9, since it may be a candidate the filter drops. Ports
+// of 0, which disable a media section, are kept.
+func (f CandidateFilter) FilterSDP(sdp string) string {
+	if f.IsZero() {
+		return sdp
+	}
+
+	lines := strings.SplitAfter(sdp, "\n")
+	kept := lines[:0]
+
+	for _, line := range lines {
+		content := strings.TrimRight(line, "\r\n")
+		ending := line[len(content):]
+
+		switch {
+		case strings.HasPrefix(content, "a=candidate:"):
+			if filtered, ok := f.Apply(content); ok {
+				kept = append(kept, filtered+ending)
+			}
+		case strings.HasPrefix(content, "c="):
+			kept = append(kept, "c=IN IP4 0.0.0.0"+ending)
+		case strings.HasPrefix(content, "m="):
+			// m=<media> <port>[/<count>] <proto> <fmt> ...
+			fields := strings.SplitN(content, " ", 3)
+			if len(fields) == 3 {
+				if port, count, found := strings.Cut(fields[1], "/"); port != "0" {
+					fields[1] = "9"
+					if found {
+						fields[1] += "/" + count
+					}
+				}
+			}
+			kept = append(kept, strings.Join(fields, " ")+ending)
+		case strings.HasPrefix(content, "a=rtcp:"):
+			kept = append(kept, "a=rtcp:9 IN IP4 0.0.0.0"+ending)
+		default:
+			kept = append(kept, line)
+		}
+	}
+
+	return strings.Join(kept, "")
+}
+
+// privateIP reports whether ip is an address that is not reachable from the internet.
+func privateIP(ip net.IP) bool {
+	if ip == nil || ip.IsUnspecified() {
+		return false
+	}
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || carrierNAT.Contains(ip)
+}
+
+// InsertCandidates adds candidate attributes to the media section at mLineIndex of a session
+// description that already passed Parse, after the section's other lines and with its line
+// endings. An empty candidate string adds a=end-of-candidates. Candidates for a section the
+// description does not have are dropped.
+func InsertCandidates(sdp string, mLineIndex int, candidates []string) string {
+	if len(candidates) == 0 || mLineIndex < 0 {
+		return sdp
+	}
+
+	eol := "\n"
+	if strings.Contains(sdp, "\r\n") {
+		eol = "\r\n"
+	}
+	if !strings.HasSuffix(sdp, "\n") {
+		sdp += eol
+	}
+
+	lines := strings.SplitAfter(sdp, "\n")
+	lines = lines[:len(lines)-1] // SplitAfter leaves an empty string after the last newline
+
+	section, end := -1, len(lines)
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "m=") {
+			continue
+		}
+		section++
+		if section == mLineIndex+1 {
+			end = i
+			break
+		}
+	}
+	if section < mLineIndex {
+		return sdp
+	}
+
+	added := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate == "" {
+			added = append(added, "a=end-of-candidates"+eol)
+		} else {
+			added = append(added, "a="+strings.TrimPrefix(candidate, "a=")+eol)
+		}
+	}
+
+	result := append(append(append(make([]string, 0, len(lines)+len(added)), lines[:end]...), added...), lines[end:]...)
+	return strings.Join(result, "")
+}
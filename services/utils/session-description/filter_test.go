@@ -0,0 +1,104 @@
+package sessiondescription_test
+
+import (
+	"strings"
+	"testing"
+
+	SessionDescription "peergrine/utils/session-description"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	privateHost = "candidate:1 1 udp 2122260223 192.168.1.20 54400 typ host generation 0"
+	mdnsHost    = "candidate:2 1 udp 2122260223 7c0f8f4b-2a3b.local 54401 typ host"
+	ipv6Host    = "candidate:3 1 udp 2122262783 2001:db8::1 54402 typ host"
+	tcpHost     = "candidate:4 1 tcp 1518280447 203.0.113.7 9 typ host tcptype active"
+	srflx       = "candidate:5 1 udp 1686052607 203.0.113.7 46154 typ srflx raddr 192.168.1.20 rport 54400 generation 0"
+	relay       = "candidate:6 1 udp 41885439 198.51.100.3 3478 typ relay raddr 203.0.113.7 rport 46154"
+
+	hiddenRelay = "candidate:6 1 udp 41885439 198.51.100.3 3478 typ relay raddr 0.0.0.0 rport 0"
+)
+
+// 測試過濾器名稱解析
+func TestParseCandidateFilter(t *testing.T) {
+	filter, err := SessionDescription.ParseCandidateFilter([]string{"relay-only", " NO-IPV6 ", ""})
+	require.NoError(t, err)
+	assert.Equal(t, SessionDescription.CandidateFilter{RelayOnly: true, NoIPv6: true}, filter)
+
+	_, err = SessionDescription.ParseCandidateFilter([]string{"no-udp"})
+	assert.Error(t, err)
+
+	merged := filter.Merge(SessionDescription.CandidateFilter{NoTCP: true})
+	assert.True(t, merged.RelayOnly && merged.NoIPv6 && merged.NoTCP)
+	assert.True(t, SessionDescription.CandidateFilter{}.IsZero())
+}
+
+// 測試各種過濾規則
+func TestApply(t *testing.T) {
+	kept := func(filter SessionDescription.CandidateFilter) []string {
+		result := make([]string, 0)
+		for _, raw := range []string{privateHost, mdnsHost, ipv6Host, tcpHost, srflx, relay} {
+			if filtered, ok := filter.Apply(raw); ok {
+				result = append(result, filtered)
+			}
+		}
+		return result
+	}
+
+	assert.Len(t, kept(SessionDescription.CandidateFilter{}), 6)
+	assert.Equal(t, []string{hiddenRelay}, kept(SessionDescription.CandidateFilter{RelayOnly: true}), "Relay-only should hide the public address of the sender")
+	assert.NotContains(t, kept(SessionDescription.CandidateFilter{NoIPv6: true}), ipv6Host)
+	assert.NotContains(t, kept(SessionDescription.CandidateFilter{NoTCP: true}), tcpHost)
+
+	noPrivate := kept(SessionDescription.CandidateFilter{NoPrivateHost: true})
+	assert.NotContains(t, noPrivate, privateHost)
+	assert.Contains(t, noPrivate, mdnsHost, "mDNS host names do not expose addresses")
+	assert.Contains(t, noPrivate, relay, "Public related addresses should stay")
+	assert.Contains(t, noPrivate, "candidate:5 1 udp 1686052607 203.0.113.7 46154 typ srflx raddr 0.0.0.0 rport 0 generation 0")
+}
+
+// 測試過濾 SDP 中的候選
+func TestFilterSDP(t *testing.T) {
+	filtered := SessionDescription.CandidateFilter{RelayOnly: true}.FilterSDP(offer)
+
+	_, err := policy.Parse(filtered)
+	assert.NoError(t, err)
+	assert.NotContains(t, filtered, "typ srflx")
+	assert.Equal(t, strings.Count(offer, "\r\n")-1, strings.Count(filtered, "\r\n"))
+
+	assert.Equal(t, offer, SessionDescription.CandidateFilter{}.FilterSDP(offer))
+
+	// 預設候選會從 c=、m= 與 a=rtcp 行移除
+	gathered := strings.NewReplacer(
+		"m=audio 9 ", "m=audio 46154 ",
+		"m=application 9 ", "m=application 0 ",
+		"c=IN IP4 0.0.0.0\r\na=rtcp:9 IN IP4 0.0.0.0", "c=IN IP4 203.0.113.7\r\na=rtcp:46155 IN IP4 203.0.113.7",
+	).Replace(offer)
+	require.Contains(t, gathered, "c=IN IP4 203.0.113.7\r\na=rtcp:46155 IN IP4 203.0.113.7")
+
+	filtered = SessionDescription.CandidateFilter{NoTCP: true}.FilterSDP(gathered)
+
+	_, err = policy.Parse(filtered)
+	assert.NoError(t, err)
+	assert.NotContains(t, filtered, "c=IN IP4 203.0.113.7")
+	assert.Contains(t, filtered, "m=audio 9 UDP/TLS/RTP/SAVPF 111 0\r\nc=IN IP4 0.0.0.0\r\na=rtcp:9 IN IP4 0.0.0.0\r\n")
+	assert.Contains(t, filtered, "m=application 0 ", "Disabled media sections should stay disabled")
+}
+
+// 測試將候選插入對應的媒體區段
+func TestInsertCandidates(t *testing.T) {
+	inserted := SessionDescription.InsertCandidates(offer, 0, []string{relay, ""})
+
+	description, err := policy.Parse(inserted)
+	require.NoError(t, err)
+	assert.Equal(t, 2, description.Candidates)
+	assert.Contains(t, inserted, "a="+relay+"\r\na=end-of-candidates\r\nm=application")
+
+	last := SessionDescription.InsertCandidates(offer, 1, []string{"a=" + srflx})
+	assert.True(t, strings.HasSuffix(last, "a=sctp-port:5000\r\na="+srflx+"\r\n"))
+
+	assert.Equal(t, offer, SessionDescription.InsertCandidates(offer, 2, []string{relay}))
+	assert.Equal(t, offer, SessionDescription.InsertCandidates(offer, 0, nil))
+}
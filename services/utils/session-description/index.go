@@ -0,0 +1,495 @@
+package sessiondescription
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	MAX_SIZE        = 64 * 1024 // Default largest session description in bytes
+	MAX_LINE_LENGTH = 4096
+	MAX_MEDIA       = 64
+)
+
+var ErrInvalid = errors.New("invalid session description")
+
+var (
+	attributeName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	token         = regexp.MustCompile(`^[!#$%&'*+\-.0-9A-Z^_` + "`" + `a-z{|}~]+$`)
+)
+
+// Protocols of m= lines used by WebRTC. RTP protocols carry numeric payload types.
+var protocols = map[string]bool{
+	"UDP/TLS/RTP/SAVPF": true,
+	"UDP/TLS/RTP/SAVP":  true,
+	"RTP/SAVPF":         true,
+	"RTP/SAVP":          true,
+	"RTP/AVPF":          true,
+	"RTP/AVP":           true,
+	"UDP/DTLS/SCTP":     false,
+	"TCP/DTLS/SCTP":     false,
+	"DTLS/SCTP":         false,
+}
+
+// staticPayloadTypes are the encodings of the payload types RFC 3551 assigns statically,
+// which a description may use without an a=rtpmap line.
+var staticPayloadTypes = map[int]string{
+	0: "pcmu", 3: "gsm", 4: "g723", 5: "dvi4", 6: "dvi4", 7: "lpc", 8: "pcma", 9: "g722",
+	10: "l16", 11: "l16", 12: "qcelp", 13: "cn", 14: "mpa", 15: "g728", 16: "dvi4", 17: "dvi4",
+	18: "g729", 25: "celb", 26: "jpeg", 28: "nv", 31: "h261", 32: "mpv", 33: "mp2t", 34: "h263",
+}
+
+// Policy is what a session description may contain.
+type Policy struct {
+	MaxSize       int
+	MaxCandidates int             // Candidates per request, in a description or a candidate list
+	Media         map[string]bool // Allowed media types of m= lines
+	Codecs        map[string]bool // Allowed encoding names of a=rtpmap lines and static payload types, lowercase
+	Offered       map[string]bool // Codecs Strip keeps, nil to keep every allowed codec
+}
+
+// DefaultPolicy allows the media and codecs of current browsers.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxSize:       MAX_SIZE,
+		MaxCandidates: 64,
+		Media:         setOf("audio", "video", "application"),
+		Codecs: setOf(
+			"opus", "pcmu", "pcma", "g722", "isac", "ilbc", "cn", "telephone-event",
+			"vp8", "vp9", "h264", "h265", "av1",
+			"rtx", "red", "ulpfec", "flexfec-03",
+		),
+	}
+}
+
+// WithCodecs returns a copy of the policy that only offers the given codecs: descriptions may
+// still list the other allowed codecs, but Strip removes them. The given codecs are allowed
+// even if the policy does not know them. An empty list offers every allowed codec.
+func (p Policy) WithCodecs(codecs []string) Policy {
+	if len(codecs) == 0 {
+		return p
+	}
+
+	p.Offered = setOf(codecs...)
+
+	allowed := make(map[string]bool, len(p.Codecs)+len(p.Offered))
+	for codec := range p.Codecs {
+		allowed[codec] = true
+	}
+	for codec := range p.Offered {
+		allowed[codec] = true
+	}
+	p.Codecs = allowed
+
+	return p
+}
+
+func setOf(values ...string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[strings.ToLower(value)] = true
+	}
+	return set
+}
+
+// ValidationError locates a problem in a session description.
+type ValidationError struct {
+	Line   int // 1-based line number, 0 for the description as a whole
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Line == 0 {
+		return e.Reason
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalid
+}
+
+func invalid(line int, format string, args ...any) error {
+	return &ValidationError{Line: line, Reason: fmt.Sprintf(format, args...)}
+}
+
+// SessionDescription is the parsed structure of an SDP offer or answer.
+type SessionDescription struct {
+	Origin     string
+	Media      []Media
+	Candidates int
+}
+
+// Media is an m= section.
+type Media struct {
+	Type       string
+	Port       int
+	Protocol   string
+	Formats    []string
+	Mid        string
+	Codecs     map[int]string // Payload type to encoding name, from a=rtpmap or the static assignments
+	Parameters map[int]string // Payload type to format parameters, from a=fmtp
+}
+
+// parser holds the state of Parse.
+type parser struct {
+	policy      Policy
+	description SessionDescription
+	media       *Media
+	mediaNumber int  // Line number of the m= line of the current section
+	connection  bool // Whether the current section has a c= line
+	session     bool // Whether the session level has a c= line
+	timing      bool
+}
+
+// Parse checks a session description against RFC 8866 and the policy.
+// Lines may end with CRLF or LF. The errors wrap ErrInvalid.
+func (p Policy) Parse(raw string) (*SessionDescription, error) {
+	if len(raw) == 0 {
+		return nil, invalid(0, "session description is empty")
+	}
+	if len(raw) > p.MaxSize {
+		return nil, invalid(0, "session description exceeds %d bytes", p.MaxSize)
+	}
+
+	lines := strings.Split(strings.TrimRight(raw, "\r\n"), "\n")
+	state := parser{policy: p}
+
+	for i, line := range lines {
+		number := i + 1
+		line = strings.TrimSuffix(line, "\r")
+
+		if len(line) > MAX_LINE_LENGTH {
+			return nil, invalid(number, "line exceeds %d bytes", MAX_LINE_LENGTH)
+		}
+		if len(line) < 2 || line[1] != '=' || line[0] < 'a' || line[0] > 'z' {
+			return nil, invalid(number, "expected <type>=<value>, got %q", truncate(line))
+		}
+		if strings.ContainsAny(line, "\x00\r") {
+			return nil, invalid(number, "line contains a control character")
+		}
+
+		if err := state.line(number, line[0], line[2:]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := state.endMedia(len(lines)); err != nil {
+		return nil, err
+	}
+	if len(state.description.Media) == 0 {
+		return nil, invalid(0, "session description has no m= line")
+	}
+	if !state.timing {
+		return nil, invalid(0, "session description has no t= line")
+	}
+
+	return &state.description, nil
+}
+
+// line handles one line. The first three lines must be v=, o= and s=.
+func (s *parser) line(number int, kind byte, value string) error {
+	switch number {
+	case 1:
+		if kind != 'v' || value != "0" {
+			return invalid(number, "session description must start with v=0")
+		}
+		return nil
+	case 2:
+		if kind != 'o' {
+			return invalid(number, "expected o= line")
+		}
+		return s.origin(number, value)
+	case 3:
+		if kind != 's' {
+			return invalid(number, "expected s= line")
+		}
+		if value == "" {
+			return invalid(number, "s= line is empty")
+		}
+		return nil
+	}
+
+	switch kind {
+	case 'm':
+		return s.mediaLine(number, value)
+	case 'c':
+		return s.connectionLine(number, value)
+	case 'a':
+		return s.attribute(number, value)
+	case 't':
+		if s.media != nil {
+			return invalid(number, "t= line inside a media section")
+		}
+		return s.timingLine(number, value)
+	case 'b':
+		return bandwidth(number, value)
+	case 'i', 'k':
+		return nil
+	case 'u', 'e', 'p', 'r', 'z':
+		if s.media != nil {
+			return invalid(number, "%c= line inside a media section", kind)
+		}
+		return nil
+	default:
+		return invalid(number, "unknown line type %c=", kind)
+	}
+}
+
+// origin checks o=<username> <sess-id> <sess-version> <nettype> <addrtype> <unicast-address>.
+func (s *parser) origin(number int, value string) error {
+	fields := strings.Split(value, " ")
+	if len(fields) != 6 {
+		return invalid(number, "o= line needs 6 fields, got %d", len(fields))
+	}
+	if _, err := strconv.ParseUint(fields[1], 10, 64); err != nil {
+		return invalid(number, "o= session ID %q is not a number", fields[1])
+	}
+	if _, err := strconv.ParseUint(fields[2], 10, 64); err != nil {
+		return invalid(number, "o= session version %q is not a number", fields[2])
+	}
+	if err := address(number, "o=", fields[3], fields[4], fields[5]); err != nil {
+		return err
+	}
+	s.description.Origin = value
+	return nil
+}
+
+// timingLine checks t=<start-time> <stop-time>.
+func (s *parser) timingLine(number int, value string) error {
+	fields := strings.Split(value, " ")
+	if len(fields) != 2 {
+		return invalid(number, "t= line needs 2 fields")
+	}
+	for _, field := range fields {
+		if _, err := strconv.ParseUint(field, 10, 64); err != nil {
+			return invalid(number, "t= time %q is not a number", field)
+		}
+	}
+	s.timing = true
+	return nil
+}
+
+// connectionLine checks c=<nettype> <addrtype> <connection-address>.
+func (s *parser) connectionLine(number int, value string) error {
+	fields := strings.Split(value, " ")
+	if len(fields) != 3 {
+		return invalid(number, "c= line needs 3 fields, got %d", len(fields))
+	}
+
+	// Multicast addresses may carry a TTL and count, which WebRTC never uses.
+	if err := address(number, "c=", fields[0], fields[1], fields[2]); err != nil {
+		return err
+	}
+
+	if s.media == nil {
+		s.session = true
+	}
+	s.connection = true
+	return nil
+}
+
+// address checks a network type, address type and address triple.
+func address(number int, line string, netType string, addrType string, addr string) error {
+	if netType != "IN" {
+		return invalid(number, "%s network type %q is not IN", line, netType)
+	}
+	if addrType != "IP4" && addrType != "IP6" {
+		return invalid(number, "%s address type %q is not IP4 or IP6", line, addrType)
+	}
+	if net.ParseIP(addr) == nil && !validHostname(addr) {
+		return invalid(number, "%s address %q is not an IP address or host name", line, truncate(addr))
+	}
+	return nil
+}
+
+// bandwidth checks b=<bwtype>:<bandwidth>.
+func bandwidth(number int, value string) error {
+	kind, amount, found := strings.Cut(value, ":")
+	if !found || !token.MatchString(kind) {
+		return invalid(number, "b= line must be <type>:<bandwidth>")
+	}
+	if _, err := strconv.ParseUint(amount, 10, 32); err != nil {
+		return invalid(number, "b= bandwidth %q is not a number", amount)
+	}
+	return nil
+}
+
+// mediaLine checks m=<media> <port>[/<count>] <proto> <fmt> ... and starts a media section.
+func (s *parser) mediaLine(number int, value string) error {
+	if err := s.endMedia(number - 1); err != nil {
+		return err
+	}
+	if len(s.description.Media) >= MAX_MEDIA {
+		return invalid(number, "more than %d media sections", MAX_MEDIA)
+	}
+
+	fields := strings.Split(value, " ")
+	if len(fields) < 4 {
+		return invalid(number, "m= line needs a media type, port, protocol and format")
+	}
+
+	media := Media{
+		Type:       fields[0],
+		Protocol:   fields[2],
+		Formats:    fields[3:],
+		Codecs:     make(map[int]string),
+		Parameters: make(map[int]string),
+	}
+
+	if !s.policy.Media[strings.ToLower(media.Type)] {
+		return invalid(number, "media type %q is not allowed", truncate(media.Type))
+	}
+
+	port, _, _ := strings.Cut(fields[1], "/")
+	var err error
+	if media.Port, err = strconv.Atoi(port); err != nil || media.Port < 0 || media.Port > 65535 {
+		return invalid(number, "m= port %q is not a port number", truncate(fields[1]))
+	}
+
+	rtp, ok := protocols[media.Protocol]
+	if !ok {
+		return invalid(number, "m= protocol %q is not supported", truncate(media.Protocol))
+	}
+
+	for _, format := range media.Formats {
+		if rtp {
+			if payloadType, err := strconv.Atoi(format); err != nil || payloadType < 0 || payloadType > 127 {
+				return invalid(number, "m= payload type %q is not between 0 and 127", truncate(format))
+			}
+		} else if !token.MatchString(format) {
+			return invalid(number, "m= format %q is not a token", truncate(format))
+		}
+	}
+
+	s.description.Media = append(s.description.Media, media)
+	s.media = &s.description.Media[len(s.description.Media)-1]
+	s.mediaNumber = number
+	s.connection = false
+	return nil
+}
+
+// endMedia checks the media section ending before the given line. Payload types without an
+// a=rtpmap line take their static encoding, which must be allowed like any other codec.
+func (s *parser) endMedia(number int) error {
+	if s.media == nil {
+		return nil
+	}
+	if !s.connection && !s.session {
+		return invalid(number, "media section %d has no c= line", len(s.description.Media))
+	}
+
+	if !protocols[s.media.Protocol] {
+		return nil
+	}
+	for _, format := range s.media.Formats {
+		payloadType, _ := strconv.Atoi(format)
+		if _, mapped := s.media.Codecs[payloadType]; mapped {
+			continue
+		}
+		codec, static := staticPayloadTypes[payloadType]
+		if !static {
+			continue
+		}
+		if !s.policy.Codecs[codec] {
+			return invalid(s.mediaNumber, "codec %q of static payload type %d is not allowed", codec, payloadType)
+		}
+		s.media.Codecs[payloadType] = codec
+	}
+	return nil
+}
+
+// attribute checks a=<attribute>[:<value>], including the rtpmap, mid and candidate values.
+func (s *parser) attribute(number int, value string) error {
+	name, content, hasValue := strings.Cut(value, ":")
+	if !attributeName.MatchString(name) {
+		return invalid(number, "attribute name %q is not a token", truncate(name))
+	}
+
+	switch name {
+	case "rtpmap":
+		if s.media == nil {
+			return invalid(number, "a=rtpmap outside a media section")
+		}
+		return s.rtpmap(number, content)
+	case "fmtp":
+		if s.media == nil {
+			return invalid(number, "a=fmtp outside a media section")
+		}
+		// Non-RTP sections use formats that are not payload types, which are not recorded.
+		payload, parameters, _ := strings.Cut(content, " ")
+		if payloadType, err := strconv.Atoi(payload); err == nil {
+			s.media.Parameters[payloadType] = parameters
+		}
+	case "mid":
+		if s.media == nil {
+			return invalid(number, "a=mid outside a media section")
+		}
+		if !hasValue || len(content) > 64 || !token.MatchString(content) {
+			return invalid(number, "a=mid %q is not a token of up to 64 bytes", truncate(content))
+		}
+		s.media.Mid = content
+	case "candidate":
+		if s.description.Candidates++; s.description.Candidates > s.policy.MaxCandidates {
+			return invalid(number, "more than %d candidates", s.policy.MaxCandidates)
+		}
+		if _, err := ParseCandidate(value); err != nil {
+			return invalid(number, "%v", err)
+		}
+	}
+
+	return nil
+}
+
+// rtpmap checks <payload type> <encoding name>/<clock rate>[/<parameters>].
+func (s *parser) rtpmap(number int, value string) error {
+	payload, encoding, found := strings.Cut(value, " ")
+	if !found {
+		return invalid(number, "a=rtpmap needs a payload type and an encoding")
+	}
+
+	payloadType, err := strconv.Atoi(payload)
+	if err != nil || payloadType < 0 || payloadType > 127 {
+		return invalid(number, "a=rtpmap payload type %q is not between 0 and 127", truncate(payload))
+	}
+
+	listed := false
+	for _, format := range s.media.Formats {
+		if format == payload {
+			listed = true
+			break
+		}
+	}
+	if !listed {
+		return invalid(number, "a=rtpmap payload type %d is not listed on the m= line", payloadType)
+	}
+
+	parts := strings.Split(encoding, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return invalid(number, "a=rtpmap encoding %q is not <name>/<clock rate>[/<parameters>]", truncate(encoding))
+	}
+	if _, err := strconv.ParseUint(parts[1], 10, 32); err != nil {
+		return invalid(number, "a=rtpmap clock rate %q is not a number", truncate(parts[1]))
+	}
+
+	codec := strings.ToLower(parts[0])
+	if !s.policy.Codecs[codec] {
+		return invalid(number, "codec %q is not allowed", truncate(parts[0]))
+	}
+
+	s.media.Codecs[payloadType] = codec
+	return nil
+}
+
+// truncate shortens a value quoted in an error message.
+func truncate(value string) string {
+	const max = 64
+	if len(value) > max {
+		return value[:max] + "..."
+	}
+	return value
+}
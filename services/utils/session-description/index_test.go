@@ -0,0 +1,140 @@
+package sessiondescription_test
+
+import (
+	"strings"
+	"testing"
+
+	SessionDescription "peergrine/utils/session-description"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 瀏覽器產生的典型 offer
+var offer = strings.Join([]string{
+	"v=0",
+	"o=- 4611731400430051336 2 IN IP4 127.0.0.1",
+	"s=-",
+	"t=0 0",
+	"a=group:BUNDLE 0 1",
+	"a=msid-semantic: WMS",
+	"m=audio 9 UDP/TLS/RTP/SAVPF 111 0",
+	"c=IN IP4 0.0.0.0",
+	"a=rtcp:9 IN IP4 0.0.0.0",
+	"a=ice-ufrag:EsAw",
+	"a=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1",
+	"a=fingerprint:sha-256 D2:FA:0E:C3:22:59:5E:14:95:69:92:3D:13:B4:84:24:2C:C2:A2:C0:3E:FD:34:8E:5E:EA:6F:AF:52:CE:E6:0F",
+	"a=setup:actpass",
+	"a=mid:0",
+	"a=sendrecv",
+	"a=rtpmap:111 opus/48000/2",
+	"a=fmtp:111 minptime=10;useinbandfec=1",
+	"a=rtpmap:0 PCMU/8000",
+	"a=candidate:842163049 1 udp 1677729535 203.0.113.7 46154 typ srflx raddr 0.0.0.0 rport 0 generation 0 network-cost 999",
+	"m=application 9 UDP/DTLS/SCTP webrtc-datachannel",
+	"c=IN IP4 0.0.0.0",
+	"a=mid:1",
+	"a=sctp-port:5000",
+}, "\r\n") + "\r\n"
+
+var policy = SessionDescription.DefaultPolicy()
+
+// 測試解析合法的 SDP
+func TestParse(t *testing.T) {
+	description, err := policy.Parse(offer)
+	require.NoError(t, err)
+	require.Len(t, description.Media, 2)
+	assert.Equal(t, "audio", description.Media[0].Type)
+	assert.Equal(t, "0", description.Media[0].Mid)
+	assert.Equal(t, map[int]string{111: "opus", 0: "pcmu"}, description.Media[0].Codecs)
+	assert.Equal(t, 1, description.Candidates)
+
+	_, err = policy.Parse(strings.ReplaceAll(offer, "\r\n", "\n"))
+	assert.NoError(t, err, "LF line endings should be accepted")
+}
+
+// 測試不合法的 SDP 回傳精確的錯誤
+func TestParseRejected(t *testing.T) {
+	cases := map[string]string{
+		"":                        "empty",
+		"v=0&o=1&s=2&m=3&c=4&a=5": "must start with v=0",
+		strings.Replace(offer, "o=- 4611731400430051336 2 IN IP4 127.0.0.1", "o=- x 2 IN IP4 127.0.0.1", 1):                     "line 2: o= session ID",
+		strings.Replace(offer, "t=0 0\r\n", "", 1):                                                                              "no t= line",
+		strings.Replace(offer, "m=audio 9", "m=hologram 9", 1):                                                                  "line 7: media type \"hologram\" is not allowed",
+		strings.Replace(offer, "opus/48000/2", "speex/48000", 1):                                                                "line 16: codec \"speex\" is not allowed",
+		strings.Replace(offer, "a=rtpmap:0 PCMU/8000", "a=rtpmap:8 PCMA/8000", 1):                                               "line 18: a=rtpmap payload type 8 is not listed",
+		strings.Replace(offer, "typ srflx", "typ bogus", 1):                                                                     "line 19: invalid ICE candidate",
+		strings.Replace(offer, "m=audio 9 UDP/TLS/RTP/SAVPF 111 0\r\nc=IN IP4 0.0.0.0", "m=audio 9 UDP/TLS/RTP/SAVPF 111 0", 1): "media section 1 has no c= line",
+		strings.Replace(offer, "a=sendrecv", "garbage", 1):                                                                      "line 15: expected <type>=<value>",
+		offer + strings.Repeat("a=x:"+strings.Repeat("y", 1000)+"\r\n", 70):                                                     "exceeds 65536 bytes",
+	}
+
+	for raw, expected := range cases {
+		_, err := policy.Parse(raw)
+		require.Error(t, err, expected)
+		assert.ErrorIs(t, err, SessionDescription.ErrInvalid)
+		assert.Contains(t, err.Error(), expected)
+	}
+}
+
+// 測試靜態負載類型也受編解碼器限制
+func TestStaticPayloadTypes(t *testing.T) {
+	staticOffer := strings.Replace(offer, "a=rtpmap:0 PCMU/8000\r\n", "", 1)
+
+	description, err := policy.Parse(staticOffer)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]string{111: "opus", 0: "pcmu"}, description.Media[0].Codecs)
+
+	_, err = policy.Parse(strings.Replace(staticOffer, "SAVPF 111 0", "SAVPF 111 3", 1))
+	assert.ErrorContains(t, err, "line 7: codec \"gsm\" of static payload type 3 is not allowed")
+}
+
+// 測試移除未提供的編解碼器
+func TestWithCodecs(t *testing.T) {
+	video := strings.Join([]string{
+		"m=video 9 UDP/TLS/RTP/SAVPF 96 97 98 99 102",
+		"c=IN IP4 0.0.0.0",
+		"a=mid:2",
+		"a=rtpmap:96 VP8/90000",
+		"a=rtcp-fb:96 nack",
+		"a=rtpmap:97 rtx/90000",
+		"a=fmtp:97 apt=96",
+		"a=rtpmap:98 H264/90000",
+		"a=rtcp-fb:98 nack pli",
+		"a=fmtp:98 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+		"a=rtpmap:99 rtx/90000",
+		"a=fmtp:99 apt=98",
+		"a=rtcp-fb:* transport-cc",
+	}, "\r\n") + "\r\n"
+
+	restricted := policy.WithCodecs([]string{"OPUS", "vp8", "rtx"})
+
+	stripped, err := restricted.Strip(offer + video)
+	require.NoError(t, err)
+
+	assert.Contains(t, stripped, "m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n")
+	assert.NotContains(t, stripped, "PCMU")
+	assert.Contains(t, stripped, "m=video 9 UDP/TLS/RTP/SAVPF 96 97\r\n")
+	assert.Contains(t, stripped, "a=fmtp:97 apt=96\r\n")
+	assert.Contains(t, stripped, "a=rtcp-fb:* transport-cc\r\n")
+	for _, removed := range []string{":98 ", ":99 ", " 102"} {
+		assert.NotContains(t, stripped, removed)
+	}
+	assert.Contains(t, stripped, "m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n", "Non-RTP sections should be kept")
+
+	_, err = restricted.Parse(stripped)
+	assert.NoError(t, err, "The stripped description should still be valid")
+
+	// 沒有任何可用編解碼器的媒體區段會被拒絕
+	_, err = policy.WithCodecs([]string{"vp8"}).Strip(offer)
+	assert.ErrorContains(t, err, "line 7: media section 1 has no offered codec")
+
+	// 政策未知的編解碼器在指定後也允許
+	_, err = policy.WithCodecs([]string{"speex"}).Parse(strings.Replace(offer, "opus/48000/2", "speex/48000", 1))
+	assert.NoError(t, err)
+
+	unchanged, err := policy.Strip(offer)
+	assert.NoError(t, err)
+	assert.Equal(t, offer, unchanged)
+	assert.Equal(t, policy, policy.WithCodecs(nil))
+}
@@ -0,0 +1,132 @@
+package typedmessage
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// VERSION is the current protocol version of Message. Older versions stay accepted.
+const VERSION = 1
+
+const (
+	TYPE_CHAT    = "chat"    // Conversation text
+	TYPE_FILE    = "file"    // File metadata, for example a drop ID, name and digest
+	TYPE_CONTROL = "control" // Client protocol messages such as receipts or key rotation
+
+	CONTENT_TEXT     = "text/plain"
+	CONTENT_MARKDOWN = "text/markdown"
+	CONTENT_JSON     = "application/json"
+	CONTENT_BINARY   = "application/octet-stream" // Base64 payload, typically ciphertext
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported message version")
+	ErrUnknownType        = errors.New("unknown message type")
+	ErrContentType        = errors.New("content type not allowed for message type")
+	ErrInvalidPayload     = errors.New("invalid message payload")
+	ErrTooLarge           = errors.New("message payload too large")
+)
+
+// Message is the versioned envelope of a relayed message. The server validates its shape
+// but never interprets Payload, which clients normally encrypt.
+type Message struct {
+	Version     int    `json:"version"`
+	Type        string `json:"type"`
+	ContentType string `json:"content_type"`
+	Payload     string `json:"payload"`
+}
+
+// Type describes an allowed message type.
+type Type struct {
+	ContentTypes []string
+	MaxSize      int // Largest payload in bytes, measured after Base64 decoding for CONTENT_BINARY
+}
+
+// Registry maps message type names to their limits.
+type Registry map[string]Type
+
+// DefaultRegistry returns the message types every relay accepts.
+func DefaultRegistry() Registry {
+	return Registry{
+		TYPE_CHAT: {
+			ContentTypes: []string{CONTENT_TEXT, CONTENT_MARKDOWN, CONTENT_BINARY},
+			MaxSize:      64 * 1024,
+		},
+		TYPE_FILE: {
+			ContentTypes: []string{CONTENT_JSON, CONTENT_BINARY},
+			MaxSize:      16 * 1024,
+		},
+		TYPE_CONTROL: {
+			ContentTypes: []string{CONTENT_JSON, CONTENT_BINARY},
+			MaxSize:      4 * 1024,
+		},
+	}
+}
+
+// MaxSize returns the largest payload any registered type accepts.
+func (r Registry) MaxSize() int {
+	max := 0
+	for _, t := range r {
+		if t.MaxSize > max {
+			max = t.MaxSize
+		}
+	}
+	return max
+}
+
+// Validate checks a message against the registry. A missing version is read as VERSION.
+func (r Registry) Validate(message *Message) error {
+	if message.Version == 0 {
+		message.Version = VERSION
+	}
+	if message.Version < 0 || message.Version > VERSION {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, message.Version)
+	}
+
+	t, ok := r[message.Type]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownType, message.Type)
+	}
+
+	// Parameters such as charset do not change what the type accepts.
+	mediaType, _, _ := strings.Cut(message.ContentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	allowed := false
+	for _, contentType := range t.ContentTypes {
+		if contentType == mediaType {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %q for %q", ErrContentType, message.ContentType, message.Type)
+	}
+
+	size := len(message.Payload)
+	if mediaType == CONTENT_BINARY {
+		payload, err := base64.StdEncoding.DecodeString(message.Payload)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+		}
+		size = len(payload)
+	}
+
+	if size > t.MaxSize {
+		return fmt.Errorf("%w: %d bytes, %q allows %d", ErrTooLarge, size, message.Type, t.MaxSize)
+	}
+
+	return nil
+}
+
+// Text wraps a plain text payload as a chat message, as sent by clients predating Message.
+func Text(payload string) Message {
+	return Message{
+		Version:     VERSION,
+		Type:        TYPE_CHAT,
+		ContentType: CONTENT_TEXT,
+		Payload:     payload,
+	}
+}
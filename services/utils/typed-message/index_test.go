@@ -0,0 +1,55 @@
+package typedmessage_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	TypedMessage "peergrine/utils/typed-message"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var registry = TypedMessage.DefaultRegistry()
+
+// 測試合法的訊息
+func TestValidate(t *testing.T) {
+	message := TypedMessage.Message{
+		Type:        TypedMessage.TYPE_CHAT,
+		ContentType: "text/plain; charset=utf-8",
+		Payload:     "hello",
+	}
+	assert.NoError(t, registry.Validate(&message))
+	assert.Equal(t, TypedMessage.VERSION, message.Version, "Missing version should default to the current one")
+
+	binary := TypedMessage.Message{
+		Version:     1,
+		Type:        TypedMessage.TYPE_CONTROL,
+		ContentType: TypedMessage.CONTENT_BINARY,
+		Payload:     base64.StdEncoding.EncodeToString(make([]byte, 4096)),
+	}
+	assert.NoError(t, registry.Validate(&binary), "Binary size should be measured after decoding")
+
+	text := TypedMessage.Text("hi")
+	assert.NoError(t, registry.Validate(&text))
+}
+
+// 測試不合法的訊息
+func TestValidateRejected(t *testing.T) {
+	cases := map[error]TypedMessage.Message{
+		TypedMessage.ErrUnsupportedVersion: {Version: TypedMessage.VERSION + 1, Type: TypedMessage.TYPE_CHAT, ContentType: TypedMessage.CONTENT_TEXT},
+		TypedMessage.ErrUnknownType:        {Type: "video", ContentType: TypedMessage.CONTENT_TEXT},
+		TypedMessage.ErrContentType:        {Type: TypedMessage.TYPE_FILE, ContentType: TypedMessage.CONTENT_TEXT},
+		TypedMessage.ErrInvalidPayload:     {Type: TypedMessage.TYPE_CHAT, ContentType: TypedMessage.CONTENT_BINARY, Payload: "not base64!"},
+		TypedMessage.ErrTooLarge:           {Type: TypedMessage.TYPE_CONTROL, ContentType: TypedMessage.CONTENT_JSON, Payload: strings.Repeat("a", 4097)},
+	}
+
+	for expected, message := range cases {
+		assert.ErrorIs(t, registry.Validate(&message), expected)
+	}
+}
+
+// 測試最大長度
+func TestMaxSize(t *testing.T) {
+	assert.Equal(t, 64*1024, registry.MaxSize())
+}
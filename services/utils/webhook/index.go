@@ -0,0 +1,289 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	IpPolicy "peergrine/utils/ip-policy"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SIGNATURE_HEADER = "X-Peergrine-Signature" // t=<unix seconds>,v1=<hex HMAC-SHA256>
+	DELIVERY_HEADER  = "X-Peergrine-Delivery"  // Stays the same across retries so receivers can drop duplicates
+	MAX_BACKOFF      = 5 * time.Minute
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidUrl       = errors.New("webhook URL must be an http or https URL with a host")
+)
+
+// CheckUrl reports an error if rawUrl is not an http or https URL, or if its host resolves to
+// an address policy refuses. Deliveries check the dialed address again, as the host may
+// resolve differently by then.
+func CheckUrl(ctx context.Context, rawUrl string, policy IpPolicy.Policy) error {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return ErrInvalidUrl
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, parsed.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve webhook host: %w", err)
+	}
+
+	for _, address := range addresses {
+		if !policy.Allowed(address.IP) {
+			return fmt.Errorf("%w: %s", IpPolicy.ErrForbidden, address.IP)
+		}
+	}
+	return nil
+}
+
+// Sign returns the signature header value of body sent at timestamp: an HMAC-SHA256 over
+// "<timestamp>.<body>", so a captured request cannot be replayed with another timestamp.
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Verify checks a signature header produced by Sign and rejects signatures whose timestamp is
+// more than tolerance away from now, in either direction.
+func Verify(secret []byte, header string, body []byte, tolerance time.Duration) error {
+	var timestamp int64
+	var signature string
+
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signature = value
+		}
+	}
+
+	if timestamp == 0 || signature == "" {
+		return ErrInvalidSignature
+	}
+
+	if age := time.Since(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(fmt.Sprintf("t=%d,v1=%s", timestamp, signature))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// delivery is a webhook request waiting for its next attempt.
+type delivery struct {
+	id      string
+	url     string
+	secret  []byte
+	body    []byte
+	attempt int
+	expires time.Time // Zero when the delivery may be retried indefinitely
+	once    bool      // Set when the delivery is never retried
+}
+
+// expired reports whether the delivery must no longer be attempted.
+func (item *delivery) expired() bool {
+	return !item.expires.IsZero() && !time.Now().Before(item.expires)
+}
+
+// Dispatcher posts signed JSON bodies to webhook URLs from a bounded queue. Failed attempts
+// are retried with exponential backoff and jitter; nothing is persisted, so pending
+// deliveries are dropped on Close.
+type Dispatcher struct {
+	client      *http.Client
+	queue       chan *delivery
+	maxAttempts int
+	backoff     time.Duration
+	closed      chan struct{}
+	closeOnce   sync.Once
+	wg          sync.WaitGroup
+}
+
+// New starts a Dispatcher with the given number of workers. Each request times out after
+// timeout, and a delivery is attempted at most maxAttempts times with backoff doubling
+// from the given initial delay. Requests, including redirects, only connect to addresses
+// policy allows.
+func New(workers int, queueSize int, maxAttempts int, backoff time.Duration, timeout time.Duration, policy IpPolicy.Policy) *Dispatcher {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: policy.Control,
+	}
+
+	dispatcher := &Dispatcher{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+		},
+		queue:       make(chan *delivery, queueSize),
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		closed:      make(chan struct{}),
+	}
+
+	for i := 0; i < workers; i++ {
+		dispatcher.wg.Add(1)
+		go dispatcher.work()
+	}
+
+	return dispatcher
+}
+
+// Send queues body for delivery to url, signed with secret.
+// It reports false when the queue is full or the dispatcher is closed.
+func (d *Dispatcher) Send(url string, secret []byte, body []byte) bool {
+	return d.SendUntil(url, secret, body, time.Time{})
+}
+
+// SendUntil is like Send, but the delivery is discarded instead of attempted or retried
+// once expires has passed. A zero expires never expires.
+func (d *Dispatcher) SendUntil(url string, secret []byte, body []byte, expires time.Time) bool {
+	return d.enqueue(&delivery{
+		id:      uuid.New().String(),
+		url:     url,
+		secret:  secret,
+		body:    body,
+		expires: expires,
+	})
+}
+
+// SendOnce is like Send, but the delivery is attempted once and never retried, for events
+// that are worthless when late.
+func (d *Dispatcher) SendOnce(url string, secret []byte, body []byte) bool {
+	return d.enqueue(&delivery{
+		id:     uuid.New().String(),
+		url:    url,
+		secret: secret,
+		body:   body,
+		once:   true,
+	})
+}
+
+// enqueue adds a delivery to the queue without blocking.
+func (d *Dispatcher) enqueue(item *delivery) bool {
+	select {
+	case <-d.closed:
+		return false
+	default:
+	}
+
+	select {
+	case d.queue <- item:
+		return true
+	default:
+		return false
+	}
+}
+
+// work runs attempts until the dispatcher is closed.
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-d.closed:
+			return
+		case item := <-d.queue:
+			d.attempt(item)
+		}
+	}
+}
+
+// attempt posts a delivery once and schedules a retry if the failure may be temporary.
+func (d *Dispatcher) attempt(item *delivery) {
+	if item.expired() {
+		return
+	}
+
+	item.attempt++
+
+	retry, err := d.post(item)
+	if err == nil {
+		return
+	}
+
+	if !retry || item.once || item.attempt >= d.maxAttempts {
+		log.Printf("Webhook delivery %s to %s failed after %d attempts: %v\n", item.id, item.url, item.attempt, err)
+		return
+	}
+
+	delay := d.delay(item.attempt)
+	if !item.expires.IsZero() && time.Now().Add(delay).After(item.expires) {
+		log.Printf("Webhook delivery %s to %s expired after %d attempts: %v\n", item.id, item.url, item.attempt, err)
+		return
+	}
+
+	time.AfterFunc(delay, func() {
+		if !d.enqueue(item) {
+			log.Printf("Webhook delivery %s to %s dropped: queue full or closed\n", item.id, item.url)
+		}
+	})
+}
+
+// post sends a delivery and reports whether a failure is worth retrying: network errors,
+// 429 and 5xx responses are, other responses are not.
+func (d *Dispatcher) post(item *delivery) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, item.url, bytes.NewReader(item.body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DELIVERY_HEADER, item.id)
+	req.Header.Set(SIGNATURE_HEADER, Sign(item.secret, time.Now().Unix(), item.body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("unexpected status %d", res.StatusCode)
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500, err
+}
+
+// delay returns the backoff before the attempt following attempt, with up to 50% jitter.
+func (d *Dispatcher) delay(attempt int) time.Duration {
+	delay := d.backoff << (attempt - 1)
+	if delay <= 0 || delay > MAX_BACKOFF {
+		delay = MAX_BACKOFF
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// Close stops the workers and drops pending deliveries.
+func (d *Dispatcher) Close() {
+	d.closeOnce.Do(func() {
+		close(d.closed)
+	})
+	d.wg.Wait()
+}
@@ -0,0 +1,185 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	IpPolicy "peergrine/utils/ip-policy"
+	Webhook "peergrine/utils/webhook"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var secret = []byte("webhook-secret")
+
+// loopback lets the dispatchers under test reach the httptest servers.
+var loopback, _ = IpPolicy.New([]string{"127.0.0.1", "::1"})
+
+// 測試簽名與驗證
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"event":"message"}`)
+	header := Webhook.Sign(secret, time.Now().Unix(), body)
+
+	assert.NoError(t, Webhook.Verify(secret, header, body, time.Minute))
+	assert.ErrorIs(t, Webhook.Verify(secret, header, []byte(`{}`), time.Minute), Webhook.ErrInvalidSignature, "Modified body should be rejected")
+	assert.ErrorIs(t, Webhook.Verify([]byte("other"), header, body, time.Minute), Webhook.ErrInvalidSignature, "Other secret should be rejected")
+	assert.ErrorIs(t, Webhook.Verify(secret, "v1=00", body, time.Minute), Webhook.ErrInvalidSignature, "Missing timestamp should be rejected")
+
+	old := Webhook.Sign(secret, time.Now().Add(-time.Hour).Unix(), body)
+	assert.ErrorIs(t, Webhook.Verify(secret, old, body, time.Minute), Webhook.ErrInvalidSignature, "Old signatures should be rejected")
+
+	future := Webhook.Sign(secret, time.Now().Add(time.Hour).Unix(), body)
+	assert.ErrorIs(t, Webhook.Verify(secret, future, body, time.Minute), Webhook.ErrInvalidSignature, "Future signatures should be rejected")
+}
+
+// 測試失敗後重試直到成功，且每次重試使用相同的投遞 ID
+func TestRetryUntilSuccess(t *testing.T) {
+	var attempts atomic.Int32
+	var mux sync.Mutex
+	deliveryIds := map[string]bool{}
+	done := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(t, Webhook.Verify(secret, r.Header.Get(Webhook.SIGNATURE_HEADER), body, time.Minute))
+
+		mux.Lock()
+		deliveryIds[r.Header.Get(Webhook.DELIVERY_HEADER)] = true
+		mux.Unlock()
+
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		close(done)
+	}))
+	defer server.Close()
+
+	dispatcher := Webhook.New(1, 4, 5, time.Millisecond*10, time.Second, loopback)
+	defer dispatcher.Close()
+
+	assert.True(t, dispatcher.Send(server.URL, secret, []byte(`{"event":"message"}`)))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 2):
+		t.Fatal("Delivery did not succeed")
+	}
+
+	assert.Equal(t, int32(3), attempts.Load())
+	assert.Len(t, deliveryIds, 1, "Retries should reuse the delivery ID")
+}
+
+// 測試用戶端錯誤不重試，且超過次數後放棄
+func TestGiveUp(t *testing.T) {
+	var rejected, failing atomic.Int32
+
+	rejectServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rejected.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer rejectServer.Close()
+
+	failServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failing.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failServer.Close()
+
+	dispatcher := Webhook.New(2, 4, 3, time.Millisecond*5, time.Second, loopback)
+	defer dispatcher.Close()
+
+	dispatcher.Send(rejectServer.URL, secret, []byte(`{}`))
+	dispatcher.Send(failServer.URL, secret, []byte(`{}`))
+
+	time.Sleep(time.Millisecond * 300)
+
+	assert.Equal(t, int32(1), rejected.Load(), "4xx responses should not be retried")
+	assert.Equal(t, int32(3), failing.Load(), "Deliveries should stop after the maximum attempts")
+}
+
+// 測試過期的投遞不再嘗試或重試
+func TestSendUntil(t *testing.T) {
+	var attempts atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	dispatcher := Webhook.New(1, 4, 10, time.Millisecond*40, time.Second, loopback)
+	defer dispatcher.Close()
+
+	assert.True(t, dispatcher.SendUntil(server.URL, secret, []byte(`{}`), time.Now().Add(-time.Second)))
+	assert.True(t, dispatcher.SendUntil(server.URL, secret, []byte(`{}`), time.Now().Add(time.Millisecond*100)))
+
+	time.Sleep(time.Millisecond * 400)
+
+	// 已過期的投遞被丟棄，另一個在到期前只嘗試兩次（40ms 後重試，下一次重試超過期限）
+	count := attempts.Load()
+	assert.GreaterOrEqual(t, count, int32(1))
+	assert.LessOrEqual(t, count, int32(2), "Deliveries should not be retried past their deadline")
+}
+
+// 測試只投遞一次的事件失敗後不重試
+func TestSendOnce(t *testing.T) {
+	var attempts atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	dispatcher := Webhook.New(1, 4, 5, time.Millisecond*5, time.Second, loopback)
+	defer dispatcher.Close()
+
+	assert.True(t, dispatcher.SendOnce(server.URL, secret, []byte(`{}`)))
+
+	time.Sleep(time.Millisecond * 100)
+
+	assert.Equal(t, int32(1), attempts.Load(), "Deliveries sent once should not be retried")
+}
+
+// 測試關閉後不再接受投遞
+func TestSendAfterClose(t *testing.T) {
+	dispatcher := Webhook.New(1, 1, 1, time.Millisecond, time.Second, loopback)
+	dispatcher.Close()
+
+	assert.False(t, dispatcher.Send("http://localhost", secret, []byte(`{}`)))
+}
+
+// 測試不允許的位址不會收到投遞，且只接受 http 與 https 網址
+func TestInternalAddresses(t *testing.T) {
+	var attempts atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	policy, err := IpPolicy.New(nil)
+	assert.NoError(t, err)
+
+	dispatcher := Webhook.New(1, 4, 1, time.Millisecond, time.Second, policy)
+	defer dispatcher.Close()
+
+	assert.True(t, dispatcher.Send(server.URL, secret, []byte(`{}`)))
+	time.Sleep(time.Millisecond * 100)
+	assert.Zero(t, attempts.Load(), "Loopback webhooks should not be reached")
+
+	ctx := context.Background()
+	assert.ErrorIs(t, Webhook.CheckUrl(ctx, server.URL, policy), IpPolicy.ErrForbidden)
+	assert.ErrorIs(t, Webhook.CheckUrl(ctx, "http://169.254.169.254/latest/meta-data", policy), IpPolicy.ErrForbidden)
+	assert.ErrorIs(t, Webhook.CheckUrl(ctx, "ftp://8.8.8.8/", policy), Webhook.ErrInvalidUrl)
+	assert.NoError(t, Webhook.CheckUrl(ctx, server.URL, loopback))
+}
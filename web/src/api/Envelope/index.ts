@@ -0,0 +1,134 @@
+/**
+ * A relayed payload wrapped by msg-bridge or rtc-bridge with the sender identity the server
+ * authenticated, signed with the Ed25519 key of the sender's token issuer.
+ */
+export interface Envelope {
+    version: number;
+    iss: string;
+    message_id: string;
+    sender_id: string;
+    timestamp: number; // Server time in Unix milliseconds
+    payload: string;   // JSON text of the relayed data
+    signature: string; // Base64 Ed25519 signature
+}
+
+export interface OpenedEnvelope<T> {
+    envelope: Envelope;
+    payload: T;
+}
+
+type IssuerKey = {
+    iss: string;
+    public_key: string;
+};
+
+export default class EnvelopeVerifier {
+    // Envelope versions this client verifies, matching utils/envelope on the server
+    public static readonly VERSION = 1;
+    public static readonly MIN_VERSION = 1;
+
+    private static readonly SIGNING_LABEL_PREFIX = "peergrine-envelope-v";
+    private static readonly KEYS_URL = "./api/token/keys";
+
+    // Public keys of issuers, fetched once per issuer
+    private static readonly publicKeys = new Map<string, Promise<CryptoKey>>();
+
+    public static readonly IsEnvelope = (raw: any): (Envelope | undefined) => {
+        if (typeof raw !== "object" || raw === null) {
+            return;
+        }
+
+        const { version, iss, message_id, sender_id, timestamp, payload, signature } = raw;
+
+        if (typeof version !== "number" || typeof timestamp !== "number") {
+            return;
+        }
+
+        for (const field of [iss, message_id, sender_id, payload, signature]) {
+            if (typeof field !== "string") {
+                return;
+            }
+        }
+
+        return { version, iss, message_id, sender_id, timestamp, payload, signature };
+    }
+
+    /**
+     * Verifies an envelope against the public key of its issuer and parses its payload.
+     *
+     * @param raw - The envelope or its JSON text.
+     * @returns The envelope and its parsed payload.
+     * @throws {Error} When the envelope is malformed, of an unknown version or wrongly signed.
+     */
+    public static async Open<T>(raw: string | object): Promise<OpenedEnvelope<T>> {
+        const envelope = EnvelopeVerifier.IsEnvelope((typeof raw === "string") ? JSON.parse(raw) : raw);
+        if (!envelope) {
+            throw new Error("Payload is not a signed envelope");
+        }
+
+        if (envelope.version < EnvelopeVerifier.MIN_VERSION || envelope.version > EnvelopeVerifier.VERSION) {
+            throw new Error(`Envelope version ${envelope.version} is not supported`);
+        }
+
+        // A failure with a cached key is retried once with a fresh key, in case the issuer rotated its secret.
+        if (!await EnvelopeVerifier.Verify(envelope, false) && !await EnvelopeVerifier.Verify(envelope, true)) {
+            throw new Error("Envelope signature is invalid");
+        }
+
+        return {
+            envelope,
+            payload: JSON.parse(envelope.payload) as T,
+        };
+    }
+
+    private static async Verify(envelope: Envelope, refresh: boolean): Promise<boolean> {
+        const publicKey = await EnvelopeVerifier.GetPublicKey(envelope.iss, refresh);
+        const signature = Uint8Array.from(atob(envelope.signature), c => c.charCodeAt(0));
+
+        return crypto.subtle.verify({ name: "Ed25519" }, publicKey, signature, EnvelopeVerifier.SigningInput(envelope));
+    }
+
+    // The bytes covered by the signature: the version label and every field except the signature, one per line.
+    private static SigningInput(envelope: Envelope): Uint8Array {
+        return new TextEncoder().encode([
+            `${EnvelopeVerifier.SIGNING_LABEL_PREFIX}${envelope.version}`,
+            envelope.iss,
+            envelope.message_id,
+            envelope.sender_id,
+            String(envelope.timestamp),
+            envelope.payload,
+        ].join("\n"));
+    }
+
+    private static GetPublicKey(iss: string, refresh: boolean): Promise<CryptoKey> {
+        const { publicKeys } = EnvelopeVerifier;
+
+        const cached = publicKeys.get(iss);
+        if (cached && !refresh) {
+            return cached;
+        }
+
+        // A failed fetch is not cached, so the next envelope of the issuer fetches the key again.
+        const publicKey = EnvelopeVerifier.FetchPublicKey(iss);
+        publicKey.catch(() => {
+            if (publicKeys.get(iss) === publicKey) {
+                publicKeys.delete(iss);
+            }
+        });
+        publicKeys.set(iss, publicKey);
+
+        return publicKey;
+    }
+
+    private static async FetchPublicKey(iss: string): Promise<CryptoKey> {
+        const response = await fetch(`${EnvelopeVerifier.KEYS_URL}/${encodeURIComponent(iss)}`);
+        if (!response.ok) {
+            throw new Error(`Failed to fetch the key of issuer ${iss}, status: ${response.status}`);
+        }
+
+        const { public_key }: IssuerKey = await response.json();
+        const publicKeyBytes = Uint8Array.from(atob(public_key), c => c.charCodeAt(0));
+
+        return crypto.subtle.importKey("raw", publicKeyBytes, { name: "Ed25519" }, false, ["verify"]);
+    }
+}
@@ -1,6 +1,7 @@
-import SseParser, { RawMessageData, RawSessionData, MessageData, SessionData } from "./sseParser";
+import SseParser, { RawMessageData, RawSessionData, MessageData, SessionData, TypedMessage } from "./sseParser";
 import BaseEventSystem from "@Src/structs/eventSystem";
 import Authorization, { AuthorizationEvent, Message } from "@API/Authorization";
+import EnvelopeVerifier, { Envelope } from "@API/Envelope";
 
 export interface LinkCode {
     link_code: string;
@@ -61,11 +62,15 @@ export default class MessageBridgeApi extends BaseEventSystem<EventDefinitions>
         public static ERROR: State = "ERROR";
     };
 
+    // Message IDs already received are kept up to this count, so a replayed envelope is shown once
+    private static SEEN_MESSAGE_IDS = 1000;
+
     private state: State = MessageBridgeApi.STATUS.INITIAL;
     private controller?: AbortController;
     private parser: SseParser;
     private auth: Authorization;
     private key: CryptoKeyPair;
+    private seenMessageIds = new Set<string>();
 
     constructor(auth: Authorization, key: CryptoKeyPair) {
         super();
@@ -79,29 +84,13 @@ export default class MessageBridgeApi extends BaseEventSystem<EventDefinitions>
         auth.on("MessageReceived", async (e: AuthorizationEvent<"MessageReceived">) => {
             if (e.detail.type !== "message-relay") return;
 
-            const message: Message<RawSessionData | MessageData> = e.detail;
-
-            const rawSessionData = RawSessionData.IsRawSessionData(message.content);
-            if (rawSessionData !== undefined) {
-                const sessionData = await parser.DecodeSessionData(rawSessionData);
-                this.emit("UserAppended", {
-                    detail: {
-                        clientId: sessionData.client_id,
-                        publicKey: sessionData.public_key,
-                    },
-                });
-                return;
-            }
+            const message: Message<Envelope> = e.detail;
 
-            const rawMessageData = RawMessageData.IsMessageData(message.content);
-            if (rawMessageData != undefined) {
-                const messageData = await parser.DecodeMessageData(rawMessageData);
-                this.emit("MessageReceived", {
-                    detail: messageData,
-                });
-                return;
+            try {
+                await this.ReceiveEnvelope(message.content);
+            } catch (error) {
+                this.HandleError("Invalid relayed event", error);
             }
-
         });
 
         this.auth = auth;
@@ -110,7 +99,7 @@ export default class MessageBridgeApi extends BaseEventSystem<EventDefinitions>
     }
 
     public async Connect(): Promise<void> {
-        const { parser, state, auth } = this;
+        const { state, auth } = this;
 
         try {
             if (state === MessageBridgeApi.STATUS.READY) {
@@ -139,6 +128,8 @@ export default class MessageBridgeApi extends BaseEventSystem<EventDefinitions>
             this.SetConnected(controller);
 
             const reader = response.body.getReader();
+            const decoder = new TextDecoder();
+            let buffered = "";
 
             while (!controller.signal.aborted) {
                 const { done, value } = await reader.read();
@@ -147,31 +138,21 @@ export default class MessageBridgeApi extends BaseEventSystem<EventDefinitions>
                     return;
                 }
 
-                try {
-                    const { event, data } = SseParser.ParseResponse(value);
-
-                    switch (event) {
-                        case "connected":
-                            break;
-                        case "append_user":
-                            const sessionData = await parser.DecodeSessionData(data);
-                            this.emit("UserAppended", {
-                                detail: {
-                                    clientId: sessionData.client_id,
-                                    publicKey: sessionData.public_key,
-                                },
-                            });
-                            break;
-                        case "message":
-                            const messageData = await parser.DecodeMessageData(data);
-                            this.emit("MessageReceived", {
-                                detail: messageData,
-                            });
-                            break;
+                buffered += decoder.decode(value, { stream: true });
+                const { events, rest } = SseParser.ParseEvents(buffered);
+                buffered = rest;
+
+                for (const { event, data } of events) {
+                    try {
+                        switch (event) {
+                            case "append_user":
+                            case "message":
+                                await this.ReceiveEnvelope(data);
+                                break;
+                        }
+                    } catch (error) {
+                        this.HandleError("Invalid relayed event", error);
                     }
-
-                } catch (decryptError) {
-                    this.HandleError("Decryption or decompression error", decryptError);
                 }
             }
 
@@ -181,6 +162,56 @@ export default class MessageBridgeApi extends BaseEventSystem<EventDefinitions>
         }
     }
 
+    // Verifies a relayed envelope and emits the session or message it carries. The sender of
+    // the payload must be the sender the server signed for.
+    private async ReceiveEnvelope(raw: string | Envelope): Promise<void> {
+        const { parser, seenMessageIds } = this;
+
+        const { envelope, payload } = await EnvelopeVerifier.Open<unknown>(raw);
+
+        const rawSessionData = RawSessionData.IsRawSessionData(payload);
+        if (rawSessionData !== undefined) {
+            if (rawSessionData.client_id !== envelope.sender_id) {
+                throw new Error("Session data does not belong to the signed sender");
+            }
+
+            const sessionData = await parser.DecodeSessionData(rawSessionData);
+            this.emit("UserAppended", {
+                detail: {
+                    clientId: sessionData.client_id,
+                    publicKey: sessionData.public_key,
+                },
+            });
+            return;
+        }
+
+        const rawMessageData = RawMessageData.IsMessageData(payload);
+        if (rawMessageData !== undefined) {
+            if (rawMessageData.sender_id !== envelope.sender_id) {
+                throw new Error("Message does not belong to the signed sender");
+            }
+
+            // Only chat messages are shown; file and control messages are for other clients
+            const { message } = rawMessageData;
+            if (typeof message !== "string" && message.type !== TypedMessage.TYPE_CHAT) {
+                return;
+            }
+
+            if (seenMessageIds.has(envelope.message_id)) {
+                return;
+            }
+            seenMessageIds.add(envelope.message_id);
+            if (seenMessageIds.size > MessageBridgeApi.SEEN_MESSAGE_IDS) {
+                seenMessageIds.delete(seenMessageIds.values().next().value as string);
+            }
+
+            const messageData = await parser.DecodeMessageData(rawMessageData);
+            this.emit("MessageReceived", {
+                detail: messageData,
+            });
+        }
+    }
+
     private HandleError(message: string, rawError: unknown): void {
         let error: Error;
 
@@ -275,7 +306,18 @@ export default class MessageBridgeApi extends BaseEventSystem<EventDefinitions>
             body: await parser.EncodeSessionData(key.publicKey),
         });
 
-        const rawSessionData = await response.text();
+        if (!response.ok) {
+            throw new Error(`Failed to get user session, status: ${response.status}`);
+        }
+
+        // The session data was signed for the owner of the link code when it was uploaded.
+        const { envelope, payload } = await EnvelopeVerifier.Open<unknown>(await response.text());
+
+        const rawSessionData = RawSessionData.IsRawSessionData(payload);
+        if (rawSessionData === undefined || rawSessionData.client_id !== envelope.sender_id) {
+            throw new Error("Invalid session data");
+        }
+
         return parser.DecodeSessionData(rawSessionData);
     }
 
@@ -285,8 +327,11 @@ export default class MessageBridgeApi extends BaseEventSystem<EventDefinitions>
 
             await fetch(`${MessageBridgeApi.MESSAGES_URL}/${targetId}`, {
                 method: "POST",
-                headers: { "Authorization": `Bearer ${this.auth.AccessToken}` },
-                body: data,
+                headers: {
+                    "Authorization": `Bearer ${this.auth.AccessToken}`,
+                    "Content-Type": "application/json",
+                },
+                body: JSON.stringify(data),
             });
         } catch (error) {
             this.HandleError("Sending message failed", error);
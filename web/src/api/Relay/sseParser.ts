@@ -32,24 +32,66 @@ export interface MessageData {
     message: string;
 }
 
+// A message as validated by the relay, matching utils/typed-message on the server
+export interface TypedMessage {
+    version: number;
+    type: string;
+    content_type: string;
+    payload: string;
+}
+
+export class TypedMessage {
+    public static readonly VERSION = 1;
+    public static readonly TYPE_CHAT = "chat";
+    public static readonly CONTENT_BINARY = "application/octet-stream";
+
+    public static readonly IsTypedMessage = (raw: any): (TypedMessage | undefined) => {
+        if (typeof raw !== "object" || raw === null) {
+            return;
+        }
+
+        const { version, type, content_type, payload } = raw;
+
+        if (typeof version !== "number") {
+            return;
+        }
+
+        for (const field of [type, content_type, payload]) {
+            if (typeof field !== "string") {
+                return;
+            }
+        }
+
+        return { version, type, content_type, payload };
+    }
+}
+
 export interface RawMessageData {
     sender_id: string;
-    message: string;
+    message: string | TypedMessage; // A plain string is sent by relays predating typed messages
 }
 
 export class RawMessageData {
-    public static readonly IsMessageData = ({ sender_id, message }: any): (MessageData | undefined) => {
+    public static readonly IsMessageData = ({ sender_id, message }: any): (RawMessageData | undefined) => {
         if (typeof sender_id !== "string") {
             return;
         }
 
-        if (typeof message !== "string") {
+        if (typeof message === "string") {
+            return {
+                sender_id,
+                message
+            }
+        }
+
+        const typedMessage = TypedMessage.IsTypedMessage(message);
+        if (!typedMessage) {
             return;
         }
 
         return {
             sender_id,
-            message
+            message: typedMessage
         }
     }
 }
@@ -67,25 +109,31 @@ interface SSEParserData {
 }
 
 export default class SSEParser {
-    public static ParseResponse(raw: Uint8Array): Message {
-        const message: Message = {
-            event: "",
-            data: "",
-        };
-
-        const decoder = new TextDecoder();
-        const data = decoder.decode(raw);
-
-        // Split the raw SSE data by the two new lines separating each part
-        for (const line of data.split(/\n\n/)) {
-            if (line.startsWith('data: ')) {
-                message.data = line.slice(6).replace(/\n*$/, '');  // Removing trailing newlines from the data
-            } else if (line.startsWith('event: ')) {
-                message.event = line.slice(7);  // Extract the event
+    // Splits buffered SSE text into its complete events and returns the incomplete tail as rest
+    public static ParseEvents(buffered: string): { events: Message[], rest: string } {
+        const blocks = buffered.split("\n\n");
+        const rest = blocks.pop() ?? "";
+
+        const events = blocks.map((block) => {
+            const message: Message = {
+                event: "",
+                data: "",
+            };
+            const data: string[] = [];
+
+            for (const line of block.split("\n")) {
+                if (line.startsWith("event: ")) {
+                    message.event = line.slice(7);
+                } else if (line.startsWith("data: ")) {
+                    data.push(line.slice(6));
+                }
             }
-        }
 
-        return message;
+            message.data = data.join("\n");
+            return message;
+        });
+
+        return { events, rest };
     }
 
     private readonly keyName: string;
@@ -100,8 +148,8 @@ export default class SSEParser {
         this.privateKey = data.private_key;
     }
 
-    // Encode the message data by encrypting it and then compressing it
-    public async EncodeMessageData(key: CryptoKey, content: string): Promise<string> {
+    // Encode the message data as a chat message whose payload is the compressed and encrypted content
+    public async EncodeMessageData(key: CryptoKey, content: string): Promise<TypedMessage> {
         const { keyName } = this;
 
         // Encrypt and compress the content
@@ -114,7 +162,12 @@ export default class SSEParser {
         // Convert encrypted bytes to base64 for transmission
         const messageBase64 = btoa(String.fromCharCode(...new Uint8Array(messageBytes)));
 
-        return messageBase64;
+        return {
+            version: TypedMessage.VERSION,
+            type: TypedMessage.TYPE_CHAT,
+            content_type: TypedMessage.CONTENT_BINARY,
+            payload: messageBase64,
+        };
     }
 
     // Decode the message data by decompressing and decrypting it
@@ -123,8 +176,11 @@ export default class SSEParser {
 
         const { sender_id, message }: RawMessageData = (typeof raw === "string") ? JSON.parse(raw) : raw;
 
+        // Typed messages carry the ciphertext as their payload, legacy messages are the ciphertext itself
+        const ciphertext = (typeof message === "string") ? message : message.payload;
+
         // Convert the base64 message to bytes
-        const messageBytes = Uint8Array.from(atob(message), c => c.charCodeAt(0));
+        const messageBytes = Uint8Array.from(atob(ciphertext), c => c.charCodeAt(0));
 
         // Decrypt the message bytes
         const decrypted = await crypto.subtle.decrypt({ name: keyName }, privateKey, messageBytes);
@@ -138,18 +194,18 @@ export default class SSEParser {
         };
     }
 
-    // Encode session data by compressing the public key and converting it to base64
+    // Encode session data as the base64 SPKI public key, which the relay validates
     public async EncodeSessionData(key: CryptoKey): Promise<string> {
         const { keyFormat } = this;
 
         // Export the public key
         const publicKeyBytes = await crypto.subtle.exportKey(keyFormat, key);
 
-        // Compress and convert the public key bytes to base64
-        return btoa(String.fromCharCode(...pako.gzip(publicKeyBytes)));
+        // Convert the public key bytes to base64
+        return btoa(String.fromCharCode(...new Uint8Array(publicKeyBytes)));
     }
 
-    // Decode the session data by decompressing the public key and importing it
+    // Decode the session data by importing the base64 SPKI public key
     public async DecodeSessionData(raw: string | RawSessionData): Promise<SessionData> {
         const rawSessionData: RawSessionData = (typeof raw === "string") ? JSON.parse(raw) : raw;
         const { keyFormat, keyName, hashName } = this;
@@ -158,10 +214,10 @@ export default class SSEParser {
         // Convert the base64 public key to bytes
         const publicKeyBytes = Uint8Array.from(atob(rawSessionData.public_key), c => c.charCodeAt(0));
 
-        // Import the public key after decompressing it
+        // Import the public key
         const public_key = await crypto.subtle.importKey(
             keyFormat,
-            pako.ungzip(publicKeyBytes),
+            publicKeyBytes,
             {
                 name: keyName,
                 hash: {
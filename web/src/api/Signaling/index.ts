@@ -1,4 +1,5 @@
 import Authorization, { Message, AuthorizationEvent } from "@API/Authorization";
+import EnvelopeVerifier, { Envelope } from "@API/Envelope";
 import BaseEventSystem from "@Src/structs/eventSystem";
 
 export type Candidate = {
@@ -38,15 +39,85 @@ export default class Signaling extends BaseEventSystem<EventDefinitions> {
         super();
         this.auth = authorization;
 
-        authorization.on("MessageReceived", (e: AuthorizationEvent<"MessageReceived">) => {
+        authorization.on("MessageReceived", async (e: AuthorizationEvent<"MessageReceived">) => {
             if (e.detail.type !== "signaling") return;
 
-            const message: Message<Signal> = e.detail;
+            const message: Message<Envelope> = e.detail;
 
-            this.emit("SignalReceived", { detail: message.content });
+            try {
+                const signal = await Signaling.OpenSignal(message.content);
+                if (signal) {
+                    this.emit("SignalReceived", { detail: signal });
+                }
+            } catch (error) {
+                this.emit("ErrorOccurred", { detail: { message: "Invalid signal", error: error as Error } });
+            }
         });
     }
 
+    /**
+     * Verifies a signed signal envelope.
+     *
+     * @param raw - The envelope or its JSON text.
+     * @returns The signal with the client ID the server signed for, or undefined when the
+     * envelope carries another event, such as a join request.
+     */
+    private static async OpenSignal(raw: string | object): Promise<Signal | undefined> {
+        const { envelope, payload } = await EnvelopeVerifier.Open<Signal>(raw);
+
+        if (typeof payload?.sdp !== "string") {
+            return;
+        }
+
+        return { ...payload, client_id: envelope.sender_id };
+    }
+
+    /**
+     * Splits buffered text into the JSON objects written back to back on a response stream.
+     *
+     * @param buffered - The text received so far.
+     * @returns The complete objects and the incomplete tail.
+     */
+    private static SplitObjects(buffered: string): { objects: string[], rest: string } {
+        const objects: string[] = [];
+        let depth = 0;
+        let inString = false;
+        let escaped = false;
+        let start = 0;
+
+        for (let i = 0; i < buffered.length; i++) {
+            const c = buffered[i];
+
+            if (inString) {
+                if (escaped) {
+                    escaped = false;
+                } else if (c === "\\") {
+                    escaped = true;
+                } else if (c === "\"") {
+                    inString = false;
+                }
+                continue;
+            }
+
+            if (c === "\"") {
+                inString = true;
+            } else if (c === "{") {
+                if (depth === 0) {
+                    start = i;
+                }
+                depth++;
+            } else if (c === "}") {
+                depth--;
+                if (depth === 0) {
+                    objects.push(buffered.slice(start, i + 1));
+                    start = i + 1;
+                }
+            }
+        }
+
+        return { objects, rest: depth === 0 ? "" : buffered.slice(start) };
+    }
+
     /**
      * Sends a signaling request and handles the response.
      * 
@@ -87,19 +158,32 @@ export default class Signaling extends BaseEventSystem<EventDefinitions> {
             const reader = res.body.getReader();
 
             const decoder = new TextDecoder();
+            let buffered = "";
             while (true) {
                 const { done, value } = await reader.read();
                 if (done) break;
 
-                const resultStr = decoder.decode(value);
-                const result = JSON.parse(resultStr);
+                buffered += decoder.decode(value, { stream: true });
+                const { objects, rest } = Signaling.SplitObjects(buffered);
+                buffered = rest;
 
-                if (result.link_code) {
-                    resolve(result);
-                }
+                // The stream starts with the link code, followed by signed answers and other events.
+                for (const object of objects) {
+                    const result = JSON.parse(object);
 
-                if (result.sdp) {
-                    Target(result);
+                    if (result.link_code) {
+                        resolve(result);
+                        continue;
+                    }
+
+                    try {
+                        const answer = await Signaling.OpenSignal(result);
+                        if (answer) {
+                            Target(answer);
+                        }
+                    } catch (error) {
+                        this.emit("ErrorOccurred", { detail: { message: "Invalid signal", error: error as Error } });
+                    }
                 }
             }
 
@@ -130,7 +214,11 @@ export default class Signaling extends BaseEventSystem<EventDefinitions> {
                     return;
                 }
 
-                const signal: Signal = await res.json();
+                const signal = await Signaling.OpenSignal(await res.text());
+                if (!signal) {
+                    reject(new Error("Link code holds no signal"));
+                    return;
+                }
                 resolve(signal);
             } catch (error) {
                 console.error("Error while getting signal:", error);